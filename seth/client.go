@@ -79,6 +79,7 @@ type Client struct {
 	ContractAddressToNameMap ContractMap
 	ABIFinder                *ABIFinder
 	HeaderCache              *LFUHeaderCache
+	GasProfiler              *GasProfiler
 }
 
 // NewClientWithConfig creates a new seth client with all deps setup from config
@@ -192,22 +193,32 @@ func NewClientRaw(
 		}
 
 		if len(cfg.Network.URLs) > 1 {
-			L.Warn().Msg("Multiple RPC URLs provided, only the first one will be used")
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), cfg.Network.DialTimeout.Duration())
-		defer cancel()
-		rpcClient, err := rpc.DialOptions(ctx,
-			cfg.MustFirstNetworkURL(),
-			rpc.WithHeaders(cfg.RPCHeaders),
-			rpc.WithHTTPClient(&http.Client{
-				Transport: NewLoggingTransport(),
-			}),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect RPC client to '%s' due to: %w", cfg.MustFirstNetworkURL(), err)
+			multiClient, err := NewMultiClient(
+				cfg.Network.URLs,
+				cfg.Network.RPCPolicy,
+				cfg.RPCHeaders,
+				cfg.Network.DialTimeout.Duration(),
+				cfg.Network.RPCHealthCheckInterval.Duration(),
+			)
+			if err != nil {
+				return nil, err
+			}
+			client = multiClient
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Network.DialTimeout.Duration())
+			defer cancel()
+			rpcClient, err := rpc.DialOptions(ctx,
+				cfg.MustFirstNetworkURL(),
+				rpc.WithHeaders(cfg.RPCHeaders),
+				rpc.WithHTTPClient(&http.Client{
+					Transport: NewLoggingTransport(),
+				}),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect RPC client to '%s' due to: %w", cfg.MustFirstNetworkURL(), err)
+			}
+			client = ethclient.NewClient(rpcClient)
 		}
-		client = ethclient.NewClient(rpcClient)
 		firstUrl = cfg.MustFirstNetworkURL()
 	} else {
 		L.Info().
@@ -232,6 +243,15 @@ func NewClientRaw(
 		o(c)
 	}
 
+	if cfg.GasProfilerEnabled() && c.GasProfiler == nil {
+		c.GasProfiler = NewGasProfiler()
+	}
+
+	if multiClient, ok := c.Client.(*MultiClient); ok {
+		// health checks stop together with the client
+		context.AfterFunc(c.Context, multiClient.Close)
+	}
+
 	if cfg.Network.ChainID == 0 {
 		chainId, err := c.Client.ChainID(context.Background())
 		if err != nil {
@@ -285,7 +305,7 @@ func NewClientRaw(
 		if c.NonceManager == nil {
 			L.Debug().Msg("Nonce manager is not set, RPC health check will be skipped. Client will most probably fail on first transaction")
 		} else {
-			if err := c.checkRPCHealth(); err != nil {
+			if err := c.checkRPCHealthOfAllEndpoints(); err != nil {
 				return nil, err
 			}
 		}
@@ -300,7 +320,7 @@ func NewClientRaw(
 	L.Info().
 		Str("NetworkName", cfg.Network.Name).
 		Interface("Addresses", addrs).
-		Str("RPC", firstUrl).
+		Strs("RPC", cfg.Network.URLs).
 		Uint64("ChainID", cfg.Network.ChainID).
 		Int64("Ephemeral keys", *cfg.EphemeralAddrs).
 		Msg("Created new client")
@@ -359,6 +379,11 @@ func NewClientRaw(
 		c.Tracer = tr
 	}
 
+	if multiClient, ok := c.Client.(*MultiClient); ok && c.Tracer != nil {
+		// tracing calls use the same endpoints and failover policy as all other calls
+		c.Tracer.rpcClient = multiClient
+	}
+
 	now := time.Now().Format("2006-01-02-15-04-05")
 	c.Cfg.revertedTransactionsFile = filepath.Join(c.Cfg.ArtifactsDir, fmt.Sprintf(RevertedTransactionsFilePattern, c.Cfg.Network.Name, now))
 
@@ -395,6 +420,32 @@ func NewClientRaw(
 	return c, nil
 }
 
+// checkRPCHealthOfAllEndpoints probes every endpoint of MultiClient with eth_blockNumber, endpoints that fail it
+// are marked unhealthy and an error is returned if all of them fail. Then the transaction health check is run once,
+// through MultiClient for multiple endpoints, so it's sent to the endpoint the policy picks.
+func (m *Client) checkRPCHealthOfAllEndpoints() error {
+	multiClient, ok := m.Client.(*MultiClient)
+	if !ok {
+		return m.checkRPCHealth()
+	}
+
+	// every probe is limited by the health check interval
+	multiClient.CheckHealth(context.Background())
+
+	var lastErr error
+	for _, e := range multiClient.Endpoints {
+		if err := e.LastError(); err != nil {
+			L.Warn().Str("RPC node", e.URL).Err(err).Msg("RPC health check failed, endpoint won't be used until it recovers")
+			lastErr = err
+		}
+	}
+	if len(multiClient.HealthyEndpoints()) == 0 {
+		return errors.Wrap(lastErr, ErrAllRPCsFailed)
+	}
+
+	return m.checkRPCHealth()
+}
+
 func (m *Client) checkRPCHealth() error {
 	L.Info().Str("RPC node", m.URL).Msg("---------------- !!!!! ----------------> Checking RPC health")
 	ctx, cancel := context.WithTimeout(context.Background(), m.Cfg.Network.TxnTimeout.Duration())
@@ -480,8 +531,15 @@ func (m *Client) TransferETHFromKey(ctx context.Context, fromKeyNum int, to stri
 	return err
 }
 
-// WaitMined the same as bind.WaitMined, awaits transaction receipt until timeout
+// WaitMined the same as bind.WaitMined, awaits transaction receipt until timeout. If the network requires
+// confirmations, it also waits until transaction is confirmed, use WaitConfirmed to get details of reorgs that happened meanwhile.
 func (m *Client) WaitMined(ctx context.Context, l zerolog.Logger, b bind.DeployBackend, tx *types.Transaction) (*types.Receipt, error) {
+	receipt, _, err := m.WaitConfirmed(ctx, l, b, tx)
+	return receipt, err
+}
+
+// waitForReceipt awaits transaction receipt until timeout
+func (m *Client) waitForReceipt(ctx context.Context, l zerolog.Logger, b bind.DeployBackend, tx *types.Transaction) (*types.Receipt, error) {
 	l.Info().
 		Msg("Waiting for transaction to be mined")
 	queryTicker := time.NewTicker(time.Second)
@@ -545,6 +603,13 @@ func WithNonceManager(nm *NonceManager) ClientOpt {
 	}
 }
 
+// WithGasProfiler GasProfiler functional option
+func WithGasProfiler(p *GasProfiler) ClientOpt {
+	return func(c *Client) {
+		c.GasProfiler = p
+	}
+}
+
 // WithTracer Tracer functional option
 func WithTracer(t *Tracer) ClientOpt {
 	return func(c *Client) {
@@ -1095,6 +1160,17 @@ func (m *Client) DeployContract(auth *bind.TransactOpts, name string, abi abi.AB
 		Str("TXHash", tx.Hash().Hex()).
 		Msgf("Deployed %s contract", name)
 
+	if m.GasProfiler != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), m.Cfg.Network.TxnTimeout.Duration())
+		receipt, err := m.Client.TransactionReceipt(ctx, tx.Hash())
+		cancel()
+		if err != nil {
+			L.Debug().Err(err).Msg("Failed to get deployment receipt, gas used by it won't be profiled")
+		} else {
+			m.GasProfiler.AddTransaction(name, GasProfilerMethod_Deployment, receipt)
+		}
+	}
+
 	if !m.Cfg.ShouldSaveDeployedContractMap() {
 		return DeploymentData{Address: address, Transaction: tx, BoundContract: contract}, nil
 	}
@@ -1414,5 +1490,8 @@ func shouldIntialiseTracer(client simulated.Client, cfg *Config) bool {
 }
 
 func supportsTracing(client simulated.Client) bool {
+	if _, ok := client.(*MultiClient); ok {
+		return true
+	}
 	return strings.Contains(reflect.TypeOf(client).String(), "ethclient.Client")
 }
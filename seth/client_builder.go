@@ -84,6 +84,44 @@ func (c *ClientBuilder) WithRpcUrl(url string) *ClientBuilder {
 	return c
 }
 
+// WithRpcUrls sets multiple RPC URLs for the config. Client will dial all of them and route calls between them
+// using the policy set with `WithRpcPolicy`, skipping endpoints that are unhealthy.
+// Default value is an empty slice (which is an incorrect value).
+func (c *ClientBuilder) WithRpcUrls(urls []string) *ClientBuilder {
+	if !c.checkIfNetworkIsSet() {
+		return c
+	}
+
+	c.config.Network.URLs = urls
+	// defensive programming
+	if len(c.config.Networks) == 0 {
+		c.config.Networks = append(c.config.Networks, c.config.Network)
+	} else if net := c.config.findNetworkByName(c.config.Network.Name); net != nil {
+		net.URLs = urls
+	}
+	return c
+}
+
+// WithRpcPolicy sets the policy used to route calls when multiple RPC URLs are set and how often endpoints are health checked.
+// Policy must be one of: round_robin, lowest_latency or primary_fallback.
+// Default values are primary_fallback and 5 seconds.
+func (c *ClientBuilder) WithRpcPolicy(policy string, healthCheckInterval time.Duration) *ClientBuilder {
+	if !c.checkIfNetworkIsSet() {
+		return c
+	}
+
+	c.config.Network.RPCPolicy = policy
+	c.config.Network.RPCHealthCheckInterval = MustMakeDuration(healthCheckInterval)
+	// defensive programming
+	if len(c.config.Networks) == 0 {
+		c.config.Networks = append(c.config.Networks, c.config.Network)
+	} else if net := c.config.findNetworkByName(c.config.Network.Name); net != nil {
+		net.RPCPolicy = policy
+		net.RPCHealthCheckInterval = MustMakeDuration(healthCheckInterval)
+	}
+	return c
+}
+
 // UseNetworkWithName sets the network to use by name. If the network with the provided name is not found in the `Networks` slice, config will fail on build.
 // There is no default value.
 func (c *ClientBuilder) UseNetworkWithName(name string) *ClientBuilder {
@@ -312,6 +350,44 @@ func (c *ClientBuilder) WithRpcDialTimeout(timeout time.Duration) *ClientBuilder
 	return c
 }
 
+// WithConfirmations sets how transactions are confirmed after they are mined. Transaction is confirmed when at least `depth` blocks
+// were mined on top of its block and, if `blockTag` is set, its block is not newer than the "safe" or "finalized" block.
+// Reorgs that happen while waiting are reported in DecodedTransaction and, if `rebroadcastOnReorg` is true, transactions dropped by them are sent again.
+// Default values are 0, empty block tag (no confirmations), false and 15 minutes.
+func (c *ClientBuilder) WithConfirmations(depth uint64, blockTag string, rebroadcastOnReorg bool, timeout time.Duration) *ClientBuilder {
+	if !c.checkIfNetworkIsSet() {
+		return c
+	}
+	c.config.Network.ConfirmationDepth = depth
+	c.config.Network.ConfirmationBlockTag = blockTag
+	c.config.Network.RebroadcastOnReorg = rebroadcastOnReorg
+	c.config.Network.ConfirmationTimeout = MustMakeDuration(timeout)
+	// defensive programming
+	if len(c.config.Networks) == 0 {
+		c.config.Networks = append(c.config.Networks, c.config.Network)
+	} else if net := c.config.findNetworkByName(c.config.Network.Name); net != nil {
+		net.ConfirmationDepth = depth
+		net.ConfirmationBlockTag = blockTag
+		net.RebroadcastOnReorg = rebroadcastOnReorg
+		net.ConfirmationTimeout = MustMakeDuration(timeout)
+	}
+	return c
+}
+
+// WithGasProfiler enables gas profiler, which accumulates gas used by all decoded transactions and, if they are traced,
+// their internal calls. Call `SaveGasReport` at the end of the test to save the report in given outputs ("markdown", "json", "console").
+// If `baselineFile` is set, the report is compared with it and average gas increase above `regressionThreshold` percents is an error.
+// Default value is disabled gas profiler.
+func (c *ClientBuilder) WithGasProfiler(outputs []string, baselineFile string, regressionThreshold float64) *ClientBuilder {
+	c.config.GasProfiler = &GasProfilerConfig{
+		Enabled:             true,
+		Outputs:             outputs,
+		BaselineFile:        baselineFile,
+		RegressionThreshold: regressionThreshold,
+	}
+	return c
+}
+
 // WithEphemeralAddresses sets the number of ephemeral addresses to generate and the amount of funds to keep in the root private key.
 // Default values are 0 for ephemeral addresses and 0 for root key funds buffer.
 func (c *ClientBuilder) WithEphemeralAddresses(ephemeralAddressCount, rootKeyBufferAmount int64) *ClientBuilder {
@@ -50,28 +50,29 @@ type Config struct {
 
 	// external fields
 	// ArtifactDir is the directory where all artifacts generated by seth are stored (e.g. transaction traces)
-	ArtifactsDir                  string            `toml:"artifacts_dir"`
-	EphemeralAddrs                *int64            `toml:"ephemeral_addresses_number"`
-	RootKeyFundsBuffer            *int64            `toml:"root_key_funds_buffer"`
-	ABIDir                        string            `toml:"abi_dir"`
-	BINDir                        string            `toml:"bin_dir"`
-	GethWrappersDirs              []string          `toml:"geth_wrappers_dirs"`
-	ContractMapFile               string            `toml:"contract_map_file"`
-	SaveDeployedContractsMap      bool              `toml:"save_deployed_contracts_map"`
-	Network                       *Network          `toml:"network"`
-	Networks                      []*Network        `toml:"networks"`
-	NonceManager                  *NonceManagerCfg  `toml:"nonce_manager"`
-	TracingLevel                  string            `toml:"tracing_level"`
-	TraceOutputs                  []string          `toml:"trace_outputs"`
-	PendingNonceProtectionEnabled bool              `toml:"pending_nonce_protection_enabled"`
-	PendingNonceProtectionTimeout *Duration         `toml:"pending_nonce_protection_timeout"`
-	ConfigDir                     string            `toml:"abs_path"`
-	ExperimentsEnabled            []string          `toml:"experiments_enabled"`
-	CheckRpcHealthOnStart         bool              `toml:"check_rpc_health_on_start"`
-	BlockStatsConfig              *BlockStatsConfig `toml:"block_stats"`
-	GasBump                       *GasBumpConfig    `toml:"gas_bump"`
-	ReadOnly                      bool              `toml:"read_only"`
-	ForceHTTP                     bool              `toml:"force_http"`
+	ArtifactsDir                  string             `toml:"artifacts_dir"`
+	EphemeralAddrs                *int64             `toml:"ephemeral_addresses_number"`
+	RootKeyFundsBuffer            *int64             `toml:"root_key_funds_buffer"`
+	ABIDir                        string             `toml:"abi_dir"`
+	BINDir                        string             `toml:"bin_dir"`
+	GethWrappersDirs              []string           `toml:"geth_wrappers_dirs"`
+	ContractMapFile               string             `toml:"contract_map_file"`
+	SaveDeployedContractsMap      bool               `toml:"save_deployed_contracts_map"`
+	Network                       *Network           `toml:"network"`
+	Networks                      []*Network         `toml:"networks"`
+	NonceManager                  *NonceManagerCfg   `toml:"nonce_manager"`
+	TracingLevel                  string             `toml:"tracing_level"`
+	TraceOutputs                  []string           `toml:"trace_outputs"`
+	PendingNonceProtectionEnabled bool               `toml:"pending_nonce_protection_enabled"`
+	PendingNonceProtectionTimeout *Duration          `toml:"pending_nonce_protection_timeout"`
+	ConfigDir                     string             `toml:"abs_path"`
+	ExperimentsEnabled            []string           `toml:"experiments_enabled"`
+	CheckRpcHealthOnStart         bool               `toml:"check_rpc_health_on_start"`
+	BlockStatsConfig              *BlockStatsConfig  `toml:"block_stats"`
+	GasBump                       *GasBumpConfig     `toml:"gas_bump"`
+	GasProfiler                   *GasProfilerConfig `toml:"gas_profiler"`
+	ReadOnly                      bool               `toml:"read_only"`
+	ForceHTTP                     bool               `toml:"force_http"`
 }
 
 type GasBumpConfig struct {
@@ -118,6 +119,12 @@ type Network struct {
 	GasPriceEstimationBlocks       uint64    `toml:"gas_price_estimation_blocks"`
 	GasPriceEstimationTxPriority   string    `toml:"gas_price_estimation_tx_priority"`
 	GasPriceEstimationAttemptCount uint      `toml:"gas_price_estimation_attempt_count"`
+	RPCPolicy                      string    `toml:"rpc_policy"`
+	RPCHealthCheckInterval         *Duration `toml:"rpc_health_check_interval"`
+	ConfirmationDepth              uint64    `toml:"confirmation_depth"`
+	ConfirmationBlockTag           string    `toml:"confirmation_block_tag"`
+	ConfirmationTimeout            *Duration `toml:"confirmation_timeout"`
+	RebroadcastOnReorg             bool      `toml:"rebroadcast_on_reorg"`
 }
 
 // DefaultClient returns a Client with reasonable default config with the specified RPC URL and private keys. You should pass at least 1 private key.
@@ -200,7 +207,7 @@ func ReadConfig() (*Config, error) {
 // Validate checks and validates the provided Config struct.
 // It ensures essential fields have valid values or default to appropriate values
 // when necessary. This function performs validation on gas price estimation,
-// gas limit, tracing level, trace outputs, network dial timeout, and pending nonce protection timeout.
+// gas limit, tracing level, trace outputs, network dial timeout, RPC policy, confirmations and pending nonce protection timeout.
 // If any configuration is invalid, it returns an error.
 func (c *Config) Validate() error {
 	if c.Network.GasPriceEstimationEnabled {
@@ -257,6 +264,21 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.GasProfilerEnabled() {
+		for _, output := range c.GasProfiler.Outputs {
+			switch strings.ToLower(output) {
+			case GasProfilerOutput_Markdown:
+			case GasProfilerOutput_JSON:
+			case GasProfilerOutput_Console:
+			default:
+				return errors.New("gas profiler output must be one of: markdown, json, console")
+			}
+		}
+		if c.GasProfiler.RegressionThreshold < 0 {
+			return errors.New("gas profiler regression threshold cannot be negative")
+		}
+	}
+
 	if c.Network.DialTimeout == nil {
 		c.Network.DialTimeout = &Duration{D: DefaultDialTimeout}
 	}
@@ -265,6 +287,27 @@ func (c *Config) Validate() error {
 		c.PendingNonceProtectionTimeout = &Duration{D: DefaultPendingNonceProtectionTimeout}
 	}
 
+	c.Network.RPCPolicy = strings.ToLower(c.Network.RPCPolicy)
+	if c.Network.RPCPolicy == "" {
+		c.Network.RPCPolicy = DefaultRPCPolicy
+	}
+	if err := validateRPCPolicy(c.Network.RPCPolicy); err != nil {
+		return err
+	}
+
+	if c.Network.RPCHealthCheckInterval == nil {
+		c.Network.RPCHealthCheckInterval = &Duration{D: DefaultRPCHealthCheckInterval}
+	}
+
+	c.Network.ConfirmationBlockTag = strings.ToLower(c.Network.ConfirmationBlockTag)
+	if err := validateConfirmationBlockTag(c.Network.ConfirmationBlockTag); err != nil {
+		return err
+	}
+
+	if c.Network.ConfirmationTimeout == nil {
+		c.Network.ConfirmationTimeout = &Duration{D: DefaultConfirmationTimeout}
+	}
+
 	if c.ethclient == nil && len(c.Network.URLs) == 0 {
 		return errors.New("at least one url should be present in config in 'secret_urls = []'")
 	}
@@ -0,0 +1,359 @@
+package seth
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// BlockTag_Safe waits until the block with transaction is not newer than the "safe" block
+	BlockTag_Safe = "safe"
+	// BlockTag_Finalized waits until the block with transaction is not newer than the "finalized" block
+	BlockTag_Finalized = "finalized"
+
+	DefaultConfirmationTimeout = 15 * time.Minute
+
+	ErrTxNotConfirmed       = "transaction was mined, but wasn't confirmed in time"
+	ErrTxReplacedAfterReorg = "transaction was dropped by a reorg and its nonce was used by another transaction"
+	ErrTxConfirmationCheck  = "transaction was mined, but its confirmation can't be checked, because the node doesn't support it"
+)
+
+// errNodeNotSynced is returned when RPC node is behind the block with transaction, it's retried, not treated as a reorg
+var errNodeNotSynced = errors.New("RPC node is behind the block with transaction")
+
+// unsupportedConfirmationErrors are parts of error messages returned by nodes that don't support a method or a block tag
+var unsupportedConfirmationErrors = []string{"method not found", "does not exist", "not supported", "unsupported", "unknown block", "invalid block"}
+
+// TxReorg describes a single reorg that removed transaction from the block it was mined in
+type TxReorg struct {
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	// Dropped is true if transaction wasn't part of the chain for some time after the reorg
+	Dropped bool `json:"dropped,omitempty"`
+	// NewBlockNumber and NewBlockHash are empty if transaction wasn't included again
+	NewBlockNumber uint64 `json:"new_block_number,omitempty"`
+	NewBlockHash   string `json:"new_block_hash,omitempty"`
+}
+
+// TxConfirmation describes how transaction was confirmed and which reorgs happened while waiting for it
+type TxConfirmation struct {
+	Depth         uint64    `json:"depth,omitempty"`
+	BlockTag      string    `json:"block_tag,omitempty"`
+	BlockNumber   uint64    `json:"block_number"`
+	BlockHash     string    `json:"block_hash"`
+	Confirmations uint64    `json:"confirmations"`
+	Confirmed     bool      `json:"confirmed"`
+	Reorgs        []TxReorg `json:"reorgs,omitempty"`
+	Rebroadcasts  int       `json:"rebroadcasts,omitempty"`
+}
+
+func (c *Config) confirmationsEnabled() bool {
+	return c.Network.ConfirmationDepth > 0 || c.Network.ConfirmationBlockTag != ""
+}
+
+func validateConfirmationBlockTag(tag string) error {
+	switch tag {
+	case "", BlockTag_Safe, BlockTag_Finalized:
+		return nil
+	default:
+		return errors.Errorf("confirmation block tag must be one of: %s, %s", BlockTag_Safe, BlockTag_Finalized)
+	}
+}
+
+// WaitConfirmed waits for transaction to be mined and then, if either 'confirmation_depth' or 'confirmation_block_tag'
+// is set for the network, until it's confirmed. While waiting for confirmation it tracks the block transaction was mined in
+// and records every reorg that moves it to another block or drops it from the chain. Dropped transactions are
+// sent again if 'rebroadcast_on_reorg' is enabled. Confirmation is returned even if waiting for it fails.
+// Waiting for receipt is limited by 'transaction_timeout', waiting for confirmation by 'confirmation_timeout' and both by ctx.
+func (m *Client) WaitConfirmed(ctx context.Context, l zerolog.Logger, b bind.DeployBackend, tx *types.Transaction) (*types.Receipt, *TxConfirmation, error) {
+	receipt, err := m.waitForReceipt(ctx, l, b, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !m.Cfg.confirmationsEnabled() {
+		return receipt, nil, nil
+	}
+
+	return m.waitForConfirmation(ctx, l, b, tx, receipt)
+}
+
+func (m *Client) waitForConfirmation(parent context.Context, l zerolog.Logger, b bind.DeployBackend, tx *types.Transaction, receipt *types.Receipt) (*types.Receipt, *TxConfirmation, error) {
+	confirmation := &TxConfirmation{
+		Depth:       m.Cfg.Network.ConfirmationDepth,
+		BlockTag:    m.Cfg.Network.ConfirmationBlockTag,
+		BlockNumber: receipt.BlockNumber.Uint64(),
+		BlockHash:   receipt.BlockHash.Hex(),
+	}
+
+	l.Info().
+		Uint64("Depth", confirmation.Depth).
+		Str("Block tag", confirmation.BlockTag).
+		Uint64("BlockNumber", confirmation.BlockNumber).
+		Msg("Waiting for transaction to be confirmed")
+
+	ctx, cancel := context.WithTimeout(parent, m.Cfg.Network.ConfirmationTimeout.Duration())
+	defer cancel()
+	queryTicker := time.NewTicker(time.Second)
+	defer queryTicker.Stop()
+
+	// tracked is nil when transaction is not part of the canonical chain
+	tracked := receipt
+	for {
+		check, err := m.checkConfirmation(ctx, b, tx, tracked)
+		switch {
+		case err == nil:
+			current := check.receipt
+			if tracked == nil {
+				reorg := &confirmation.Reorgs[len(confirmation.Reorgs)-1]
+				reorg.NewBlockNumber = current.BlockNumber.Uint64()
+				reorg.NewBlockHash = current.BlockHash.Hex()
+				l.Warn().
+					Uint64("BlockNumber", reorg.NewBlockNumber).
+					Str("BlockHash", reorg.NewBlockHash).
+					Msg("Transaction was included again after reorg")
+			} else if current.BlockHash != tracked.BlockHash {
+				confirmation.Reorgs = append(confirmation.Reorgs, TxReorg{
+					BlockNumber:    tracked.BlockNumber.Uint64(),
+					BlockHash:      tracked.BlockHash.Hex(),
+					NewBlockNumber: current.BlockNumber.Uint64(),
+					NewBlockHash:   current.BlockHash.Hex(),
+				})
+				l.Warn().
+					Uint64("Previous BlockNumber", tracked.BlockNumber.Uint64()).
+					Uint64("BlockNumber", current.BlockNumber.Uint64()).
+					Msg("Transaction was moved to another block by reorg")
+			}
+			tracked = current
+			confirmation.BlockNumber = current.BlockNumber.Uint64()
+			confirmation.BlockHash = current.BlockHash.Hex()
+
+			confirmed, confirmations, confirmErr := check.confirmed, check.confirmations, check.err
+			if confirmErr != nil {
+				if isUnsupportedConfirmationError(confirmErr) {
+					return current, confirmation, errors.Wrap(confirmErr, ErrTxConfirmationCheck)
+				}
+				l.Warn().Err(confirmErr).Msg("Failed to check transaction confirmation, will retry")
+			}
+			confirmation.Confirmations = confirmations
+			if confirmed {
+				confirmation.Confirmed = true
+				l.Info().
+					Uint64("Confirmations", confirmations).
+					Int("Reorgs", len(confirmation.Reorgs)).
+					Msg("Transaction confirmed")
+				return current, confirmation, nil
+			}
+		case errors.Is(err, errNodeNotSynced):
+			l.Debug().Err(err).Msg("RPC node is behind, will retry")
+		case errors.Is(err, ethereum.NotFound):
+			if tracked != nil {
+				confirmation.Reorgs = append(confirmation.Reorgs, TxReorg{
+					BlockNumber: tracked.BlockNumber.Uint64(),
+					BlockHash:   tracked.BlockHash.Hex(),
+					Dropped:     true,
+				})
+				l.Warn().
+					Uint64("BlockNumber", tracked.BlockNumber.Uint64()).
+					Str("BlockHash", tracked.BlockHash.Hex()).
+					Msg("Transaction was dropped from the chain by reorg")
+				tracked = nil
+				confirmation.Confirmations = 0
+
+				if m.Cfg.Network.RebroadcastOnReorg {
+					if err := m.rebroadcast(ctx, l, tx); err != nil {
+						return receipt, confirmation, err
+					}
+					confirmation.Rebroadcasts++
+				}
+			}
+		default:
+			if isUnsupportedConfirmationError(err) {
+				if tracked != nil {
+					receipt = tracked
+				}
+				return receipt, confirmation, errors.Wrap(err, ErrTxConfirmationCheck)
+			}
+			l.Warn().Err(err).Msg("Failed to get transaction receipt, will retry")
+		}
+
+		select {
+		case <-ctx.Done():
+			if tracked != nil {
+				receipt = tracked
+			}
+			if parent.Err() != nil {
+				l.Warn().
+					Uint64("Confirmations", confirmation.Confirmations).
+					Msg("Context was cancelled, while waiting for transaction to be confirmed")
+				return receipt, confirmation, errors.Wrap(parent.Err(), ErrTxNotConfirmed)
+			}
+			l.Error().
+				Str("Timeout", m.Cfg.Network.ConfirmationTimeout.String()).
+				Uint64("Confirmations", confirmation.Confirmations).
+				Msg("Timed out, while waiting for transaction to be confirmed")
+			// not wrapping context error on purpose, because timeouts are retried with gas bumping and transaction is already mined
+			return receipt, confirmation, errors.Errorf("%s: %s", ErrTxNotConfirmed, ctx.Err())
+		case <-queryTicker.C:
+		}
+	}
+}
+
+// confirmationReader is the part of the client used to check confirmation
+type confirmationReader interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// backendReader reads receipts from the backend and blocks from the client
+type backendReader struct {
+	bind.DeployBackend
+	client simulated.Client
+}
+
+func (r *backendReader) BlockNumber(ctx context.Context) (uint64, error) {
+	return r.client.BlockNumber(ctx)
+}
+
+func (r *backendReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return r.client.HeaderByNumber(ctx, number)
+}
+
+// confirmationCheck is the state of transaction read from a single RPC node
+type confirmationCheck struct {
+	receipt       *types.Receipt
+	confirmed     bool
+	confirmations uint64
+	// err is the error of checking confirmation of the receipt
+	err error
+}
+
+// checkConfirmation reads the canonical receipt and checks its confirmation. With MultiClient all calls are made to a single endpoint,
+// otherwise receipt, head and blocks could come from nodes that don't see the same chain, which would look like a reorg.
+func (m *Client) checkConfirmation(ctx context.Context, b bind.DeployBackend, tx *types.Transaction, tracked *types.Receipt) (*confirmationCheck, error) {
+	check := func(callCtx context.Context, r confirmationReader) (*confirmationCheck, error) {
+		receipt, err := canonicalReceipt(callCtx, r, tx, tracked)
+		if err != nil {
+			return nil, err
+		}
+		c := &confirmationCheck{receipt: receipt}
+		c.confirmed, c.confirmations, c.err = m.isConfirmed(callCtx, r, receipt)
+		// the next endpoint is tried if this one failed
+		if isEndpointError(ctx, c.err) {
+			return nil, c.err
+		}
+		return c, nil
+	}
+	if multiClient, ok := b.(*MultiClient); ok {
+		return multiCall(ctx, multiClient, "confirmation", func(callCtx context.Context, c *ethclient.Client) (*confirmationCheck, error) {
+			return check(callCtx, c)
+		})
+	}
+	return check(ctx, &backendReader{DeployBackend: b, client: m.Client})
+}
+
+// canonicalReceipt returns receipt only if the block it points to is still part of the canonical chain.
+// errNodeNotSynced is returned if the node is behind the block with the receipt or with the tracked receipt.
+func canonicalReceipt(ctx context.Context, r confirmationReader, tx *types.Transaction, tracked *types.Receipt) (*types.Receipt, error) {
+	// head is read first, so the node can only be further when receipt is read
+	head, err := r.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := r.TransactionReceipt(ctx, tx.Hash())
+	if errors.Is(err, ethereum.NotFound) && tracked != nil && head < tracked.BlockNumber.Uint64() {
+		return nil, errors.Wrapf(errNodeNotSynced, "head is %d, transaction was mined in block %d", head, tracked.BlockNumber.Uint64())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if receipt.BlockNumber.Uint64() > head {
+		return nil, errors.Wrapf(errNodeNotSynced, "head is %d, transaction was mined in block %d", head, receipt.BlockNumber.Uint64())
+	}
+	header, err := r.HeaderByNumber(ctx, receipt.BlockNumber)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, errors.Wrapf(errNodeNotSynced, "block %d wasn't found", receipt.BlockNumber.Uint64())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != receipt.BlockHash {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+// isConfirmed checks if block with the receipt is deep enough or not newer than the configured block tag
+func (m *Client) isConfirmed(ctx context.Context, r confirmationReader, receipt *types.Receipt) (bool, uint64, error) {
+	head, err := r.BlockNumber(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	var confirmations uint64
+	if head >= receipt.BlockNumber.Uint64() {
+		confirmations = head - receipt.BlockNumber.Uint64()
+	}
+	if confirmations < m.Cfg.Network.ConfirmationDepth {
+		return false, confirmations, nil
+	}
+
+	if m.Cfg.Network.ConfirmationBlockTag == "" {
+		return true, confirmations, nil
+	}
+
+	tagNumber := rpc.SafeBlockNumber
+	if m.Cfg.Network.ConfirmationBlockTag == BlockTag_Finalized {
+		tagNumber = rpc.FinalizedBlockNumber
+	}
+	tagHeader, err := r.HeaderByNumber(ctx, big.NewInt(tagNumber.Int64()))
+	if err != nil {
+		return false, confirmations, errors.Wrapf(err, "failed to get %s block", m.Cfg.Network.ConfirmationBlockTag)
+	}
+
+	return tagHeader.Number.Cmp(receipt.BlockNumber) >= 0, confirmations, nil
+}
+
+// isUnsupportedConfirmationError returns true for errors that won't go away by waiting, because the node doesn't support
+// a method or the block tag used to check confirmation, other errors, e.g. timeouts or rate limits, are retried
+func isUnsupportedConfirmationError(err error) bool {
+	var rpcErr rpc.Error
+	// method not found or invalid params
+	if errors.As(err, &rpcErr) && (rpcErr.ErrorCode() == -32601 || rpcErr.ErrorCode() == -32602) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, unsupported := range unsupportedConfirmationErrors {
+		if strings.Contains(msg, unsupported) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebroadcast sends transaction dropped by reorg again. It's fine if the node already knows it, but if its nonce
+// was already used, then it was replaced by another transaction and it won't be ever mined
+func (m *Client) rebroadcast(ctx context.Context, l zerolog.Logger, tx *types.Transaction) error {
+	l.Info().Msg("Sending transaction dropped by reorg again")
+	err := m.Client.SendTransaction(ctx, tx)
+	if err == nil || isAlreadyKnownError(err) {
+		return nil
+	}
+	if isNonceTooLowError(err) {
+		return errors.Wrap(err, ErrTxReplacedAfterReorg)
+	}
+	l.Warn().Err(err).Msg("Failed to send transaction dropped by reorg again, will wait for it to be included anyway")
+	return nil
+}
@@ -0,0 +1,417 @@
+package seth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/seth"
+)
+
+// fakeChain is a chain served by fakeRPC that includes a single transaction and can be reorganised
+type fakeChain struct {
+	mu        sync.Mutex
+	fork      byte
+	head      uint64
+	safe      uint64
+	finalized uint64
+	// txBlock is 0 when transaction is not part of the chain
+	txBlock  uint64
+	tx       *types.Transaction
+	sent     int
+	receipts int
+	// onReceipt is called before every receipt is returned, so tests can change the chain
+	onReceipt func(c *fakeChain, call int)
+	// onSend is called when transaction is sent, by default transaction is included in the next block
+	onSend func(c *fakeChain) error
+	// tagErr is returned for "safe" and "finalized" blocks if set, tagErrs limits how many times, 0 means always
+	tagErr   string
+	tagErrs  int
+	tagCalls int
+}
+
+// header returns block header, all blocks change their hash after reorg
+func (c *fakeChain) header(number uint64) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		Difficulty: big.NewInt(1),
+		Extra:      []byte{c.fork},
+	}
+}
+
+// reorg changes hashes of all blocks and moves transaction to the block, 0 drops it from the chain
+func (c *fakeChain) reorg(txBlock uint64) {
+	c.fork++
+	c.txBlock = txBlock
+}
+
+func newFakeChain(t *testing.T, tx *types.Transaction, txBlock uint64) (*fakeChain, *fakeRPC) {
+	chain := &fakeChain{tx: tx, head: txBlock, txBlock: txBlock}
+	node := newFakeRPC(t)
+	node.handlers.Store("eth_blockNumber", fakeRPCHandler(func(_ []json.RawMessage) (interface{}, error) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		return hexutil.Uint64(chain.head), nil
+	}))
+	node.handlers.Store("eth_getBlockByNumber", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		var tag string
+		if err := json.Unmarshal(params[0], &tag); err != nil {
+			return nil, err
+		}
+		if (tag == "safe" || tag == "finalized") && chain.tagErr != "" {
+			chain.tagCalls++
+			if chain.tagErrs == 0 || chain.tagCalls <= chain.tagErrs {
+				return nil, errors.New(chain.tagErr)
+			}
+		}
+		switch tag {
+		case "latest":
+			return chain.header(chain.head), nil
+		case "safe":
+			return chain.header(chain.safe), nil
+		case "finalized":
+			return chain.header(chain.finalized), nil
+		}
+		number, err := strconv.ParseUint(tag, 0, 64)
+		if err != nil {
+			return nil, err
+		}
+		if number > chain.head {
+			return nil, nil
+		}
+		return chain.header(number), nil
+	}))
+	node.handlers.Store("eth_getTransactionReceipt", fakeRPCHandler(func(_ []json.RawMessage) (interface{}, error) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		chain.receipts++
+		if chain.onReceipt != nil {
+			chain.onReceipt(chain, chain.receipts)
+		}
+		if chain.txBlock == 0 {
+			return nil, nil
+		}
+		return &types.Receipt{
+			Status:      types.ReceiptStatusSuccessful,
+			TxHash:      chain.tx.Hash(),
+			BlockNumber: new(big.Int).SetUint64(chain.txBlock),
+			BlockHash:   chain.header(chain.txBlock).Hash(),
+			Logs:        []*types.Log{},
+			GasUsed:     21_000,
+			// 2 gwei
+			EffectiveGasPrice: big.NewInt(2_000_000_000),
+		}, nil
+	}))
+	node.handlers.Store("eth_sendRawTransaction", fakeRPCHandler(func(_ []json.RawMessage) (interface{}, error) {
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		chain.sent++
+		if chain.onSend != nil {
+			if err := chain.onSend(chain); err != nil {
+				return nil, err
+			}
+		} else {
+			chain.head++
+			chain.txBlock = chain.head
+		}
+		return chain.tx.Hash(), nil
+	}))
+	return chain, node
+}
+
+func newConfirmationsTestTx(t *testing.T) *types.Transaction {
+	pk, err := crypto.GenerateKey()
+	require.NoError(t, err, "failed to generate key")
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	tx, err := types.SignNewTx(pk, types.LatestSignerForChainID(big.NewInt(1337)), &types.LegacyTx{
+		Nonce:    1,
+		To:       &to,
+		Value:    big.NewInt(1),
+		Gas:      21_000,
+		GasPrice: big.NewInt(1_000_000_000),
+	})
+	require.NoError(t, err, "failed to sign transaction")
+	return tx
+}
+
+func newConfirmationsTestClient(t *testing.T, url string, depth uint64, blockTag string, rebroadcast bool) *seth.Client {
+	client, err := seth.NewClientBuilder().
+		WithRpcUrl(url).
+		WithReadOnlyMode().
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithTransactionTimeout(10*time.Second).
+		WithConfirmations(depth, blockTag, rebroadcast, 10*time.Second).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	t.Cleanup(client.CancelFunc)
+	return client
+}
+
+func TestConfirmationsDepth(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	chain, node := newFakeChain(t, tx, 10)
+	chain.onReceipt = func(c *fakeChain, _ int) {
+		c.head++
+	}
+	client := newConfirmationsTestClient(t, node.URL, 3, "", false)
+
+	receipt, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+	require.NoError(t, err, "transaction should be confirmed")
+	require.Equal(t, uint64(10), receipt.BlockNumber.Uint64(), "expected different block number")
+	require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+	require.Equal(t, uint64(3), confirmation.Depth, "expected different depth")
+	require.GreaterOrEqual(t, confirmation.Confirmations, uint64(3), "expected at least 3 confirmations")
+	require.Empty(t, confirmation.Reorgs, "expected no reorgs")
+}
+
+func TestConfirmationsNotRequired(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	_, node := newFakeChain(t, tx, 10)
+	client := newConfirmationsTestClient(t, node.URL, 0, "", false)
+
+	receipt, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+	require.NoError(t, err, "transaction should be mined")
+	require.Equal(t, uint64(10), receipt.BlockNumber.Uint64(), "expected different block number")
+	require.Nil(t, confirmation, "confirmation should be nil when it's not required")
+}
+
+func TestConfirmationsBlockTag(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	chain, node := newFakeChain(t, tx, 10)
+	chain.finalized = 5
+	chain.onReceipt = func(c *fakeChain, _ int) {
+		c.head++
+		c.finalized += 2
+	}
+	client := newConfirmationsTestClient(t, node.URL, 0, seth.BlockTag_Finalized, false)
+
+	_, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+	require.NoError(t, err, "transaction should be confirmed")
+	require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+	require.Equal(t, seth.BlockTag_Finalized, confirmation.BlockTag, "expected different block tag")
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	require.GreaterOrEqual(t, chain.finalized, uint64(10), "transaction shouldn't be confirmed before its block is finalized")
+}
+
+func TestConfirmationsLaggingEndpoint(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	chain, node := newFakeChain(t, tx, 10)
+	chain.onReceipt = func(c *fakeChain, _ int) {
+		c.head++
+	}
+	// the lagging node hasn't seen the block with transaction yet
+	lagging, laggingNode := newFakeChain(t, tx, 0)
+	lagging.head = 9
+	client, err := seth.NewClientBuilder().
+		WithRpcUrls([]string{node.URL, laggingNode.URL}).
+		WithRpcPolicy(seth.RPCPolicy_RoundRobin, time.Minute).
+		WithReadOnlyMode().
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithTransactionTimeout(10*time.Second).
+		WithConfirmations(3, "", true, 10*time.Second).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	t.Cleanup(client.CancelFunc)
+
+	_, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+	require.NoError(t, err, "transaction should be confirmed")
+	require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+	require.Empty(t, confirmation.Reorgs, "lagging node shouldn't look like a reorg")
+	require.Equal(t, 0, confirmation.Rebroadcasts, "transaction shouldn't be rebroadcast")
+	require.Positive(t, laggingNode.callCount("eth_getTransactionReceipt"), "lagging node should be queried")
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	lagging.mu.Lock()
+	defer lagging.mu.Unlock()
+	require.Zero(t, chain.sent+lagging.sent, "transaction shouldn't be sent")
+}
+
+func TestConfirmationsContextCancelled(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	chain, node := newFakeChain(t, tx, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chain.onReceipt = func(_ *fakeChain, call int) {
+		// the first receipt is returned while waiting to be mined, the next ones while waiting for confirmation
+		if call == 3 {
+			cancel()
+		}
+	}
+	client := newConfirmationsTestClient(t, node.URL, 100, "", false)
+
+	start := time.Now()
+	receipt, confirmation, err := client.WaitConfirmed(ctx, seth.L, client.Client, tx)
+	require.Error(t, err, "expected error when context is cancelled")
+	require.ErrorIs(t, err, context.Canceled, "expected context error")
+	require.Contains(t, err.Error(), seth.ErrTxNotConfirmed, "expected different error message")
+	require.Less(t, time.Since(start), 5*time.Second, "shouldn't wait for confirmation timeout")
+	require.Equal(t, uint64(10), receipt.BlockNumber.Uint64(), "receipt should be returned with the error")
+	require.False(t, confirmation.Confirmed, "transaction shouldn't be confirmed")
+}
+
+func TestConfirmationsBlockTagErrors(t *testing.T) {
+	t.Run("unsupported block tag fails right away", func(t *testing.T) {
+		tx := newConfirmationsTestTx(t)
+		chain, node := newFakeChain(t, tx, 10)
+		chain.tagErr = "unsupported block tag finalized"
+		client := newConfirmationsTestClient(t, node.URL, 0, seth.BlockTag_Finalized, false)
+
+		start := time.Now()
+		receipt, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+		require.Error(t, err, "expected error for unsupported block tag")
+		require.Contains(t, err.Error(), seth.ErrTxConfirmationCheck, "expected different error message")
+		require.Less(t, time.Since(start), 5*time.Second, "shouldn't wait for confirmation timeout")
+		require.Equal(t, uint64(10), receipt.BlockNumber.Uint64(), "receipt should be returned with the error")
+		require.False(t, confirmation.Confirmed, "transaction shouldn't be confirmed")
+	})
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		tx := newConfirmationsTestTx(t)
+		chain, node := newFakeChain(t, tx, 10)
+		chain.finalized = 10
+		chain.tagErr = "request rate limited"
+		chain.tagErrs = 2
+		client := newConfirmationsTestClient(t, node.URL, 0, seth.BlockTag_Finalized, false)
+
+		_, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+		require.NoError(t, err, "transaction should be confirmed after transient errors")
+		require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		require.Equal(t, 3, chain.tagCalls, "block tag should be retried")
+	})
+}
+
+func TestConfirmationsReorgMovesTransaction(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	chain, node := newFakeChain(t, tx, 10)
+	var minedHash common.Hash
+	chain.onReceipt = func(c *fakeChain, call int) {
+		switch call {
+		case 1:
+			minedHash = c.header(10).Hash()
+		case 2:
+			c.reorg(11)
+			c.head = 11
+		default:
+			c.head++
+		}
+	}
+	client := newConfirmationsTestClient(t, node.URL, 2, "", false)
+
+	decoded, err := client.Decode(tx, nil)
+	require.NoError(t, err, "transaction should be confirmed")
+	require.NotNil(t, decoded.Confirmation, "decoded transaction should have confirmation")
+	confirmation := decoded.Confirmation
+	require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+	require.Len(t, confirmation.Reorgs, 1, "expected one reorg")
+	require.Equal(t, seth.TxReorg{
+		BlockNumber:    10,
+		BlockHash:      minedHash.Hex(),
+		NewBlockNumber: 11,
+		NewBlockHash:   confirmation.BlockHash,
+	}, confirmation.Reorgs[0], "expected different reorg")
+	require.Equal(t, uint64(11), confirmation.BlockNumber, "expected different block number")
+	require.Equal(t, uint64(11), decoded.Receipt.BlockNumber.Uint64(), "receipt should be from the new block")
+	require.Equal(t, 0, confirmation.Rebroadcasts, "transaction shouldn't be rebroadcast")
+}
+
+func TestConfirmationsReorgDropsTransaction(t *testing.T) {
+	t.Run("rebroadcast", func(t *testing.T) {
+		tx := newConfirmationsTestTx(t)
+		chain, node := newFakeChain(t, tx, 10)
+		chain.onReceipt = func(c *fakeChain, call int) {
+			switch call {
+			case 2:
+				c.reorg(0)
+			default:
+				c.head++
+			}
+		}
+		client := newConfirmationsTestClient(t, node.URL, 2, "", true)
+
+		_, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+		require.NoError(t, err, "transaction should be confirmed after rebroadcast")
+		require.True(t, confirmation.Confirmed, "transaction should be confirmed")
+		require.Equal(t, 1, confirmation.Rebroadcasts, "transaction should be rebroadcast once")
+		require.Len(t, confirmation.Reorgs, 1, "expected one reorg")
+		require.True(t, confirmation.Reorgs[0].Dropped, "transaction should be dropped")
+		require.Equal(t, uint64(10), confirmation.Reorgs[0].BlockNumber, "expected different block number")
+		require.Equal(t, confirmation.BlockNumber, confirmation.Reorgs[0].NewBlockNumber, "transaction should be included again")
+		require.Greater(t, confirmation.BlockNumber, uint64(10), "transaction should be included in a newer block")
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		tx := newConfirmationsTestTx(t)
+		chain, node := newFakeChain(t, tx, 10)
+		chain.onReceipt = func(c *fakeChain, call int) {
+			if call == 2 {
+				c.reorg(0)
+			}
+		}
+		chain.onSend = func(_ *fakeChain) error {
+			return errors.New("nonce too low")
+		}
+		client := newConfirmationsTestClient(t, node.URL, 2, "", true)
+
+		decoded, err := client.Decode(tx, nil)
+		require.Error(t, err, "expected error when transaction was replaced")
+		require.Contains(t, err.Error(), seth.ErrTxReplacedAfterReorg, "expected different error message")
+		require.NotNil(t, decoded, "decoded transaction should be returned together with error")
+		require.False(t, decoded.Confirmation.Confirmed, "transaction shouldn't be confirmed")
+		require.True(t, decoded.Confirmation.Reorgs[0].Dropped, "transaction should be dropped")
+	})
+
+	t.Run("without rebroadcast", func(t *testing.T) {
+		tx := newConfirmationsTestTx(t)
+		chain, node := newFakeChain(t, tx, 10)
+		chain.onReceipt = func(c *fakeChain, call int) {
+			switch call {
+			case 2:
+				c.reorg(0)
+			case 4:
+				// transaction is included again by another node
+				c.reorg(12)
+				c.head = 12
+			default:
+				c.head++
+			}
+		}
+		client := newConfirmationsTestClient(t, node.URL, 1, "", false)
+
+		_, confirmation, err := client.WaitConfirmed(context.Background(), seth.L, client.Client, tx)
+		require.NoError(t, err, "transaction should be confirmed")
+		require.Equal(t, 0, confirmation.Rebroadcasts, "transaction shouldn't be rebroadcast")
+		chain.mu.Lock()
+		defer chain.mu.Unlock()
+		require.Equal(t, 0, chain.sent, "transaction shouldn't be sent")
+		require.Len(t, confirmation.Reorgs, 1, "expected one reorg")
+		require.Equal(t, uint64(12), confirmation.Reorgs[0].NewBlockNumber, "transaction should be included again")
+	})
+}
+
+func TestConfirmationsConfig(t *testing.T) {
+	_, err := seth.NewClientBuilder().
+		WithRpcUrl(newFakeRPC(t).URL).
+		WithReadOnlyMode().
+		WithConfirmations(0, "latest", false, time.Minute).
+		Build()
+	require.Error(t, err, "expected error for unknown block tag")
+	require.Contains(t, err.Error(), "confirmation block tag must be one of", "expected different error message")
+}
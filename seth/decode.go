@@ -43,6 +43,8 @@ type DecodedTransaction struct {
 	Transaction *types.Transaction      `json:"transaction,omitempty"`
 	Receipt     *types.Receipt          `json:"receipt,omitempty"`
 	Events      []DecodedTransactionLog `json:"events,omitempty"`
+	// Confirmation is set only if the network requires confirmations
+	Confirmation *TxConfirmation `json:"confirmation,omitempty"`
 }
 
 type CommonData struct {
@@ -149,10 +151,20 @@ func (m *Client) DecodeTx(tx *types.Transaction) (*DecodedTransaction, error) {
 	l := L.With().Str("Transaction", tx.Hash().Hex()).Logger()
 
 	var receipt *types.Receipt
+	var confirmation *TxConfirmation
 	var err error
-	tx, receipt, err = m.waitUntilMined(l, tx)
+	tx, receipt, confirmation, err = m.waitUntilMined(l, tx)
 	if err != nil {
-		return nil, err
+		if confirmation == nil {
+			return nil, err
+		}
+		// transaction was mined, but not confirmed, so we return what we know about it together with the error
+		decoded, decodeErr := m.decodeTransaction(l, tx, receipt)
+		if decodeErr != nil {
+			l.Debug().Err(decodeErr).Msg("Failed to decode unconfirmed transaction")
+		}
+		decoded.Confirmation = confirmation
+		return decoded, err
 	}
 
 	var revertErr error
@@ -161,13 +173,16 @@ func (m *Client) DecodeTx(tx *types.Transaction) (*DecodedTransaction, error) {
 	}
 
 	decoded, decodeErr := m.decodeTransaction(l, tx, receipt)
+	decoded.Confirmation = confirmation
 
 	if decodeErr != nil && errors.Is(decodeErr, errors.New(ErrNoABIMethod)) {
+		m.profileGas(decoded, nil)
 		m.handleTxDecodingError(l, *decoded, decodeErr)
 		return decoded, revertErr
 	}
 
 	if m.Cfg.TracingLevel == TracingLevel_None {
+		m.profileGas(decoded, nil)
 		m.handleDisabledTracing(l, *decoded)
 		return decoded, revertErr
 	}
@@ -175,12 +190,15 @@ func (m *Client) DecodeTx(tx *types.Transaction) (*DecodedTransaction, error) {
 	if m.Cfg.TracingLevel == TracingLevel_All || (m.Cfg.TracingLevel == TracingLevel_Reverted && revertErr != nil) {
 		decodedCalls, traceErr := m.Tracer.TraceGethTX(decoded.Hash)
 		if traceErr != nil {
+			m.profileGas(decoded, nil)
 			m.handleTracingError(l, *decoded, traceErr, revertErr)
 			return decoded, revertErr
 		}
 
+		m.profileGas(decoded, decodedCalls)
 		m.handleSuccessfulTracing(l, *decoded, decodedCalls, revertErr)
 	} else {
+		m.profileGas(decoded, nil)
 		l.Trace().
 			Str("Tracing level", m.Cfg.TracingLevel).
 			Bool("Was reverted?", revertErr != nil).
@@ -190,16 +208,16 @@ func (m *Client) DecodeTx(tx *types.Transaction) (*DecodedTransaction, error) {
 	return decoded, revertErr
 }
 
-func (m *Client) waitUntilMined(l zerolog.Logger, tx *types.Transaction) (*types.Transaction, *types.Receipt, error) {
+func (m *Client) waitUntilMined(l zerolog.Logger, tx *types.Transaction) (*types.Transaction, *types.Receipt, *TxConfirmation, error) {
 	// if transaction was not mined, we will retry it with gas bumping, but only if gas bumping is enabled
 	// and if the transaction was not mined in time, other errors will be returned as is
 	var receipt *types.Receipt
+	var confirmation *TxConfirmation
 	err := retry.Do(
 		func() error {
 			var err error
-			ctx, cancel := context.WithTimeout(context.Background(), m.Cfg.Network.TxnTimeout.Duration())
-			receipt, err = m.WaitMined(ctx, l, m.Client, tx)
-			cancel()
+			// waiting for receipt is limited by 'transaction_timeout' and waiting for confirmation by 'confirmation_timeout'
+			receipt, confirmation, err = m.WaitConfirmed(context.Background(), l, m.Client, tx)
 
 			return err
 		}, retry.OnRetry(func(i uint, retryErr error) {
@@ -225,13 +243,16 @@ func (m *Client) waitUntilMined(l zerolog.Logger, tx *types.Transaction) (*types
 	)
 
 	if err != nil {
+		if confirmation != nil {
+			return tx, receipt, confirmation, err
+		}
 		l.Trace().
 			Err(err).
 			Msg("Skipping decoding, because transaction was not mined. Nothing to decode")
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return tx, receipt, nil
+	return tx, receipt, confirmation, nil
 }
 
 func (m *Client) handleTxDecodingError(l zerolog.Logger, decoded DecodedTransaction, decodeErr error) {
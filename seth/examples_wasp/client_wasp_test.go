@@ -1,11 +1,14 @@
 package examples_wasp
 
 import (
+	"context"
 	"errors"
 	"math/big"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/stretchr/testify/require"
 
 	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
@@ -63,3 +66,75 @@ func TestWithWasp(t *testing.T) {
 	require.NoError(t, err)
 	gen.Run(true)
 }
+
+// PipelinedGun sends transactions without waiting for previous ones from the same key to be mined
+type PipelinedGun struct {
+	client *seth.Client
+	sender *seth.PipelinedSender
+}
+
+func NewPipelinedGun(client *seth.Client, sender *seth.PipelinedSender) *PipelinedGun {
+	return &PipelinedGun{
+		client: client,
+		sender: sender,
+	}
+}
+
+func (m *PipelinedGun) Call(_ *wasp.Generator) *wasp.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), m.client.Cfg.Network.TxnTimeout.Duration())
+	defer cancel()
+	ptx, err := m.sender.SendWithAnyKey(ctx, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return TestEnv.DebugContract.AddCounter(opts, big.NewInt(0), big.NewInt(1))
+	})
+	if err != nil {
+		return &wasp.Response{Error: err.Error()}
+	}
+	receipt, err := ptx.Wait(ctx)
+	if err != nil {
+		return &wasp.Response{Error: err.Error()}
+	}
+	if receipt.Status == types.ReceiptStatusFailed {
+		return &wasp.Response{Error: "transaction reverted"}
+	}
+	return &wasp.Response{}
+}
+
+func TestWithWaspPipelined(t *testing.T) {
+	t.Setenv(seth.ROOT_PRIVATE_KEY_ENV_VAR, "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80")
+	t.Setenv(seth.CONFIG_FILE_ENV_VAR, "seth.toml")
+	cfg, err := seth.ReadConfig()
+	require.NoError(t, err, "failed to read config")
+	c, err := seth.NewClientWithConfig(cfg)
+	require.NoError(t, err, "failed to initialise seth")
+	// a single root key is enough, because it doesn't wait for transactions to be mined before sending the next one
+	sender, err := seth.NewPipelinedSender(c, seth.PipelineConfig{
+		KeyNums:           []int{0},
+		MaxInFlightPerKey: 200,
+	})
+	require.NoError(t, err, "failed to create pipelined sender")
+	defer sender.Close()
+	labels := map[string]string{
+		"go_test_name": "TestWithWaspPipelined",
+		"gen_name":     "TestWithWaspPipelined",
+		"branch":       "TestWithWaspPipelined",
+		"commit":       "TestWithWaspPipelined",
+	}
+	gen, err := wasp.NewGenerator(&wasp.Config{
+		LoadType: wasp.RPS,
+		Schedule: wasp.CombineAndRepeat(
+			2,
+			wasp.Plain(10, 30*time.Second),
+			wasp.Plain(100, 30*time.Second),
+			wasp.Plain(10, 30*time.Second),
+		),
+		Gun:        NewPipelinedGun(c, sender),
+		Labels:     labels,
+		LokiConfig: wasp.NewEnvLokiConfig(),
+	})
+	require.NoError(t, err)
+	gen.Run(true)
+	for _, stats := range sender.Stats() {
+		t.Logf("Key %d: sent %d, mined %d, reverted %d, max in-flight %d, rebroadcasts %d, gaps filled %d",
+			stats.KeyNum, stats.Sent, stats.Mined, stats.Reverted, stats.MaxInFlight, stats.Rebroadcasts, stats.GapsFilled)
+	}
+}
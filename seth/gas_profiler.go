@@ -0,0 +1,439 @@
+package seth
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	GasProfilerOutput_Markdown = "markdown"
+	GasProfilerOutput_JSON     = "json"
+	GasProfilerOutput_Console  = "console"
+
+	// GasProfilerMethod_Deployment is the method name used for contract deployments
+	GasProfilerMethod_Deployment = "constructor"
+	// GasProfilerMethod_Transfer is the method name used for transactions without data
+	GasProfilerMethod_Transfer = "transfer"
+
+	GasReportsDir = "gas_reports"
+
+	ErrGasProfilerDisabled = "gas profiler is not enabled"
+	ErrGasRegression       = "gas usage regressions found"
+)
+
+type GasProfilerConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Outputs are formats of the report saved at the end of the test, "markdown", "json" or "console"
+	Outputs []string `toml:"outputs"`
+	// BaselineFile is a JSON gas report to compare the report with
+	BaselineFile string `toml:"baseline_file"`
+	// RegressionThreshold is the increase of average gas used, in percents, above which the method is reported as a regression
+	RegressionThreshold float64 `toml:"regression_threshold"`
+}
+
+// GasProfilerEnabled returns true if gas profiler is enabled
+func (c *Config) GasProfilerEnabled() bool {
+	return c.GasProfiler != nil && c.GasProfiler.Enabled
+}
+
+func (c *GasProfilerConfig) hasOutput(output string) bool {
+	for _, o := range c.Outputs {
+		if strings.EqualFold(o, output) {
+			return true
+		}
+	}
+	return false
+}
+
+// GasProfiler accumulates gas used by all transactions and internal calls, grouped by contract and method
+type GasProfiler struct {
+	mu    *sync.Mutex
+	usage map[string]*gasUsage
+}
+
+type gasUsage struct {
+	contract  string
+	method    string
+	internal  bool
+	gasUsed   []uint64
+	gasPrices []*big.Int
+	cost      *big.Int
+}
+
+// NewGasProfiler creates a new empty GasProfiler
+func NewGasProfiler() *GasProfiler {
+	return &GasProfiler{
+		mu:    &sync.Mutex{},
+		usage: make(map[string]*gasUsage),
+	}
+}
+
+func gasUsageKey(contract, method string, internal bool) string {
+	return fmt.Sprintf("%s|%s|%t", contract, method, internal)
+}
+
+func (p *GasProfiler) get(contract, method string, internal bool) *gasUsage {
+	key := gasUsageKey(contract, method, internal)
+	u, ok := p.usage[key]
+	if !ok {
+		u = &gasUsage{contract: contract, method: method, internal: internal, cost: big.NewInt(0)}
+		p.usage[key] = u
+	}
+	return u
+}
+
+// AddTransaction records gas used, effective gas price and cost of mined transaction
+func (p *GasProfiler) AddTransaction(contract, method string, receipt *types.Receipt) {
+	if receipt == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.get(contract, method, false)
+	u.gasUsed = append(u.gasUsed, receipt.GasUsed)
+	if receipt.EffectiveGasPrice != nil {
+		u.gasPrices = append(u.gasPrices, new(big.Int).Set(receipt.EffectiveGasPrice))
+		u.cost.Add(u.cost, new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice))
+	}
+}
+
+// AddInternalCall records gas used by a call made by another contract
+func (p *GasProfiler) AddInternalCall(contract, method string, gasUsed uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u := p.get(contract, method, true)
+	u.gasUsed = append(u.gasUsed, gasUsed)
+}
+
+// Report returns statistics of all recorded transactions and calls sorted by contract, method and call type
+func (p *GasProfiler) Report() *GasReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := &GasReport{Entries: make([]*GasReportEntry, 0, len(p.usage))}
+	for _, u := range p.usage {
+		report.Entries = append(report.Entries, u.entry())
+	}
+	sortGasReportEntries(report.Entries)
+	return report
+}
+
+func (u *gasUsage) entry() *GasReportEntry {
+	sorted := make([]uint64, len(u.gasUsed))
+	copy(sorted, u.gasUsed)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total uint64
+	for _, g := range sorted {
+		total += g
+	}
+
+	e := &GasReportEntry{
+		Contract:   u.contract,
+		Method:     u.method,
+		Internal:   u.internal,
+		Calls:      len(sorted),
+		MinGasUsed: sorted[0],
+		MaxGasUsed: sorted[len(sorted)-1],
+		AvgGasUsed: total / uint64(len(sorted)),
+		// nearest-rank percentile
+		P95GasUsed: sorted[int(math.Ceil(0.95*float64(len(sorted))))-1],
+	}
+
+	if len(u.gasPrices) > 0 {
+		totalPrice := big.NewInt(0)
+		for _, price := range u.gasPrices {
+			totalPrice.Add(totalPrice, price)
+		}
+		e.AvgGasPrice = totalPrice.Div(totalPrice, big.NewInt(int64(len(u.gasPrices))))
+		e.TotalCost = new(big.Int).Set(u.cost)
+	}
+
+	return e
+}
+
+// GasReport is a gas usage summary of a test run
+type GasReport struct {
+	Entries []*GasReportEntry `json:"entries"`
+}
+
+// GasReportEntry is a gas usage summary of a single method, prices and costs are in wei and are not set for internal calls
+type GasReportEntry struct {
+	Contract    string   `json:"contract"`
+	Method      string   `json:"method"`
+	Internal    bool     `json:"internal,omitempty"`
+	Calls       int      `json:"calls"`
+	MinGasUsed  uint64   `json:"min_gas_used"`
+	AvgGasUsed  uint64   `json:"avg_gas_used"`
+	MaxGasUsed  uint64   `json:"max_gas_used"`
+	P95GasUsed  uint64   `json:"p95_gas_used"`
+	AvgGasPrice *big.Int `json:"avg_gas_price,omitempty"`
+	TotalCost   *big.Int `json:"total_cost,omitempty"`
+}
+
+func (e *GasReportEntry) key() string {
+	return gasUsageKey(e.Contract, e.Method, e.Internal)
+}
+
+func sortGasReportEntries(entries []*GasReportEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Contract != entries[j].Contract {
+			return entries[i].Contract < entries[j].Contract
+		}
+		if entries[i].Method != entries[j].Method {
+			return entries[i].Method < entries[j].Method
+		}
+		return !entries[i].Internal && entries[j].Internal
+	})
+}
+
+func callType(internal bool) string {
+	if internal {
+		return "internal"
+	}
+	return "tx"
+}
+
+func formatWei(wei *big.Int, unit string) string {
+	if wei == nil {
+		return "-"
+	}
+	divisor := big.NewFloat(1e9)
+	if unit == "ETH" {
+		divisor = big.NewFloat(1e18)
+	}
+	value, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), divisor).Float64()
+	return fmt.Sprintf("%.6f", value)
+}
+
+// Markdown returns the report as a Markdown table, gas prices are in gwei and costs in ETH
+func (r *GasReport) Markdown() string {
+	sb := strings.Builder{}
+	sb.WriteString("| Contract | Method | Type | Calls | Min gas | Avg gas | Max gas | P95 gas | Avg gas price (gwei) | Total cost (ETH) |\n")
+	sb.WriteString("|---|---|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, e := range r.Entries {
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %d | %d | %d | %d | %s | %s |\n",
+			e.Contract, e.Method, callType(e.Internal), e.Calls, e.MinGasUsed, e.AvgGasUsed, e.MaxGasUsed, e.P95GasUsed,
+			formatWei(e.AvgGasPrice, "gwei"), formatWei(e.TotalCost, "ETH")))
+	}
+	return sb.String()
+}
+
+// Save saves the report as JSON, so that it can be used as a baseline
+func (r *GasReport) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// LoadGasReport loads a gas report saved as JSON
+func LoadGasReport(path string) (*GasReport, error) {
+	report := &GasReport{}
+	if err := OpenJsonFileAsStruct(path, report); err != nil {
+		return nil, errors.Wrapf(err, "failed to load gas report from %s", path)
+	}
+	return report, nil
+}
+
+// GasDiff is a change of average gas used by a method between baseline and current report
+type GasDiff struct {
+	Contract           string  `json:"contract"`
+	Method             string  `json:"method"`
+	Internal           bool    `json:"internal,omitempty"`
+	BaselineAvgGasUsed uint64  `json:"baseline_avg_gas_used"`
+	CurrentAvgGasUsed  uint64  `json:"current_avg_gas_used"`
+	ChangePercent      float64 `json:"change_percent"`
+	// Added is true if the method is not present in the baseline, Removed if it's not present in the current report
+	Added   bool `json:"added,omitempty"`
+	Removed bool `json:"removed,omitempty"`
+}
+
+// IsRegression returns true if average gas used increased by more than threshold percents
+func (d GasDiff) IsRegression(threshold float64) bool {
+	return !d.Added && !d.Removed && d.ChangePercent > threshold
+}
+
+// DiffGasReports compares average gas used by every method in current report with the baseline
+func DiffGasReports(current, baseline *GasReport) []GasDiff {
+	baselineEntries := make(map[string]*GasReportEntry, len(baseline.Entries))
+	for _, e := range baseline.Entries {
+		baselineEntries[e.key()] = e
+	}
+
+	diffs := make([]GasDiff, 0, len(current.Entries))
+	seen := make(map[string]struct{}, len(current.Entries))
+	for _, e := range current.Entries {
+		seen[e.key()] = struct{}{}
+		d := GasDiff{Contract: e.Contract, Method: e.Method, Internal: e.Internal, CurrentAvgGasUsed: e.AvgGasUsed}
+		b, ok := baselineEntries[e.key()]
+		if !ok {
+			d.Added = true
+			diffs = append(diffs, d)
+			continue
+		}
+		d.BaselineAvgGasUsed = b.AvgGasUsed
+		if b.AvgGasUsed > 0 {
+			d.ChangePercent = (float64(e.AvgGasUsed) - float64(b.AvgGasUsed)) / float64(b.AvgGasUsed) * 100
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, b := range baseline.Entries {
+		if _, ok := seen[b.key()]; ok {
+			continue
+		}
+		diffs = append(diffs, GasDiff{Contract: b.Contract, Method: b.Method, Internal: b.Internal, BaselineAvgGasUsed: b.AvgGasUsed, Removed: true})
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return math.Abs(diffs[i].ChangePercent) > math.Abs(diffs[j].ChangePercent)
+	})
+
+	return diffs
+}
+
+// GasDiffMarkdown returns the diff as a Markdown table, regressions above threshold percents are marked
+func GasDiffMarkdown(diffs []GasDiff, threshold float64) string {
+	sb := strings.Builder{}
+	sb.WriteString("| Contract | Method | Type | Baseline avg gas | Current avg gas | Change |\n")
+	sb.WriteString("|---|---|---|---:|---:|---:|\n")
+	for _, d := range diffs {
+		var change string
+		switch {
+		case d.Added:
+			change = "added"
+		case d.Removed:
+			change = "removed"
+		default:
+			change = fmt.Sprintf("%+.2f%%", d.ChangePercent)
+			if d.IsRegression(threshold) {
+				change += " ⚠️"
+			}
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %d | %s |\n",
+			d.Contract, d.Method, callType(d.Internal), d.BaselineAvgGasUsed, d.CurrentAvgGasUsed, change))
+	}
+	return sb.String()
+}
+
+// contractNameForGasProfile returns name of the contract at the address or the address itself, if it's unknown
+func (m *Client) contractNameForGasProfile(address string) string {
+	if m.ContractAddressToNameMap.IsKnownAddress(address) {
+		return m.ContractAddressToNameMap.GetContractName(address)
+	}
+	return address
+}
+
+// profileGas records gas used by decoded transaction and, if it was traced, by its internal calls
+func (m *Client) profileGas(decoded *DecodedTransaction, decodedCalls []*DecodedCall) {
+	if m.GasProfiler == nil || decoded == nil || decoded.Transaction == nil {
+		return
+	}
+
+	tx := decoded.Transaction
+	contract := UNKNOWN
+	if tx.To() != nil {
+		contract = m.contractNameForGasProfile(tx.To().Hex())
+	}
+	method := decoded.Method
+	switch {
+	case len(tx.Data()) == 0:
+		method = GasProfilerMethod_Transfer
+	case method == "" || method == UNKNOWN:
+		method = "0x" + common.Bytes2Hex(tx.Data()[:min(4, len(tx.Data()))])
+	}
+	m.GasProfiler.AddTransaction(contract, method, decoded.Receipt)
+
+	for _, call := range decodedCalls {
+		// main call is the transaction itself and calls missing from the trace have no gas data
+		if call.NestingLevel == 0 || call.GasUsed == 0 {
+			continue
+		}
+		m.GasProfiler.AddInternalCall(m.contractNameForGasProfile(call.ToAddress), call.Method, call.GasUsed)
+	}
+}
+
+// GasReport returns gas usage of all transactions decoded by the client so far
+func (m *Client) GasReport() (*GasReport, error) {
+	if m.GasProfiler == nil {
+		return nil, errors.New(ErrGasProfilerDisabled)
+	}
+	return m.GasProfiler.Report(), nil
+}
+
+// SaveGasReport saves gas report in all formats set in 'gas_profiler.outputs' to artifacts dir and returns it.
+// If baseline file is set, the report is compared with it and an error is returned if average gas used by any method
+// increased by more than the regression threshold. Call it at the end of the test.
+func (m *Client) SaveGasReport() (*GasReport, error) {
+	report, err := m.GasReport()
+	if err != nil {
+		return nil, err
+	}
+	cfg := m.Cfg.GasProfiler
+
+	markdown := report.Markdown()
+	var regressions []GasDiff
+	if cfg.BaselineFile != "" {
+		baseline, err := LoadGasReport(cfg.BaselineFile)
+		if err != nil {
+			return report, err
+		}
+		diffs := DiffGasReports(report, baseline)
+		for _, d := range diffs {
+			if d.IsRegression(cfg.RegressionThreshold) {
+				regressions = append(regressions, d)
+			}
+		}
+		markdown += fmt.Sprintf("\n### Comparison with %s\n\n%s", filepath.Base(cfg.BaselineFile), GasDiffMarkdown(diffs, cfg.RegressionThreshold))
+	}
+
+	name := fmt.Sprintf("gas_report_%s_%s", m.Cfg.Network.Name, time.Now().Format("2006-01-02-15-04-05"))
+	dir := filepath.Join(m.Cfg.ArtifactsDir, GasReportsDir)
+	if cfg.hasOutput(GasProfilerOutput_JSON) {
+		path := filepath.Join(dir, name+".json")
+		if err := report.Save(path); err != nil {
+			return report, errors.Wrap(err, "failed to save gas report as JSON")
+		}
+		L.Info().Str("Path", path).Msg("Saved gas report as JSON")
+	}
+	if cfg.hasOutput(GasProfilerOutput_Markdown) {
+		path := filepath.Join(dir, name+".md")
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return report, err
+		}
+		if err := os.WriteFile(path, []byte(markdown), 0600); err != nil {
+			return report, errors.Wrap(err, "failed to save gas report as Markdown")
+		}
+		L.Info().Str("Path", path).Msg("Saved gas report as Markdown")
+	}
+	if cfg.hasOutput(GasProfilerOutput_Console) {
+		fmt.Println(markdown)
+	}
+
+	if len(regressions) > 0 {
+		descriptions := make([]string, 0, len(regressions))
+		for _, r := range regressions {
+			descriptions = append(descriptions, fmt.Sprintf("%s.%s (%s): %d -> %d (%+.2f%%)", r.Contract, r.Method, callType(r.Internal), r.BaselineAvgGasUsed, r.CurrentAvgGasUsed, r.ChangePercent))
+		}
+		return report, errors.Errorf("%s: %s", ErrGasRegression, strings.Join(descriptions, ", "))
+	}
+
+	return report, nil
+}
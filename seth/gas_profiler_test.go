@@ -0,0 +1,166 @@
+package seth_test
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/seth"
+)
+
+func TestGasProfilerReport(t *testing.T) {
+	p := seth.NewGasProfiler()
+	for i := 1; i <= 20; i++ {
+		p.AddTransaction("NetworkDebugContract", "set(int256)", &types.Receipt{
+			GasUsed:           uint64(i * 1000),
+			EffectiveGasPrice: big.NewInt(int64(i) * 1_000_000_000),
+		})
+	}
+	p.AddInternalCall("NetworkDebugSubContract", "trace", 500)
+	p.AddInternalCall("NetworkDebugSubContract", "trace", 1500)
+	// receipts without effective gas price have no cost
+	p.AddTransaction("LinkToken", "transfer", &types.Receipt{GasUsed: 30_000})
+
+	report := p.Report()
+	require.Len(t, report.Entries, 3, "expected 3 entries")
+
+	link := report.Entries[0]
+	require.Equal(t, "LinkToken", link.Contract, "entries should be sorted by contract")
+	require.Nil(t, link.TotalCost, "cost should be empty without gas price")
+
+	set := report.Entries[1]
+	require.Equal(t, "set(int256)", set.Method, "expected different method")
+	require.False(t, set.Internal, "transaction shouldn't be internal")
+	require.Equal(t, 20, set.Calls, "expected different number of calls")
+	require.Equal(t, uint64(1000), set.MinGasUsed, "expected different min gas")
+	require.Equal(t, uint64(10500), set.AvgGasUsed, "expected different avg gas")
+	require.Equal(t, uint64(20000), set.MaxGasUsed, "expected different max gas")
+	require.Equal(t, uint64(19000), set.P95GasUsed, "expected different p95 gas")
+	require.Equal(t, big.NewInt(10_500_000_000), set.AvgGasPrice, "expected different avg gas price")
+	// sum of i*1000 * i gwei for i in 1..20
+	require.Equal(t, new(big.Int).Mul(big.NewInt(2_870_000), big.NewInt(1_000_000_000)), set.TotalCost, "expected different total cost")
+
+	trace := report.Entries[2]
+	require.True(t, trace.Internal, "call should be internal")
+	require.Equal(t, uint64(1000), trace.AvgGasUsed, "expected different avg gas")
+	require.Nil(t, trace.AvgGasPrice, "internal calls have no gas price")
+
+	markdown := report.Markdown()
+	require.Contains(t, markdown, "| NetworkDebugContract | set(int256) | tx | 20 | 1000 | 10500 | 20000 | 19000 | 10.500000 | 0.002870 |", "expected different markdown row")
+	require.Contains(t, markdown, "| NetworkDebugSubContract | trace | internal | 2 | 500 | 1000 | 1500 | 1500 | - | - |", "expected different markdown row")
+}
+
+func TestGasProfilerDiff(t *testing.T) {
+	baseline := &seth.GasReport{Entries: []*seth.GasReportEntry{
+		{Contract: "A", Method: "set", AvgGasUsed: 1000},
+		{Contract: "A", Method: "get", AvgGasUsed: 1000},
+		{Contract: "A", Method: "removed", AvgGasUsed: 1000},
+	}}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	require.NoError(t, baseline.Save(path), "failed to save baseline")
+	loaded, err := seth.LoadGasReport(path)
+	require.NoError(t, err, "failed to load baseline")
+	require.Equal(t, baseline, loaded, "loaded baseline should be the same")
+
+	current := &seth.GasReport{Entries: []*seth.GasReportEntry{
+		{Contract: "A", Method: "set", AvgGasUsed: 1200},
+		{Contract: "A", Method: "get", AvgGasUsed: 950},
+		{Contract: "A", Method: "added", AvgGasUsed: 500},
+	}}
+	diffs := seth.DiffGasReports(current, loaded)
+	require.Len(t, diffs, 4, "expected 4 diffs")
+	require.Equal(t, "set", diffs[0].Method, "biggest change should be first")
+	require.InDelta(t, 20, diffs[0].ChangePercent, 0.001, "expected different change")
+	require.True(t, diffs[0].IsRegression(10), "increase should be a regression")
+	require.False(t, diffs[0].IsRegression(25), "increase below threshold shouldn't be a regression")
+	require.InDelta(t, -5, diffs[1].ChangePercent, 0.001, "expected different change")
+	require.False(t, diffs[1].IsRegression(0), "decrease shouldn't be a regression")
+	require.True(t, diffs[2].Added, "method should be added")
+	require.True(t, diffs[3].Removed, "method should be removed")
+
+	markdown := seth.GasDiffMarkdown(diffs, 10)
+	require.Contains(t, markdown, "| A | set | tx | 1000 | 1200 | +20.00% ⚠️ |", "regression should be marked")
+	require.Contains(t, markdown, "| A | get | tx | 1000 | 950 | -5.00% |", "expected different markdown row")
+	require.Contains(t, markdown, "| A | added | tx | 0 | 500 | added |", "expected different markdown row")
+}
+
+func TestGasProfilerClient(t *testing.T) {
+	tx := newConfirmationsTestTx(t)
+	_, node := newFakeChain(t, tx, 10)
+	artifacts := t.TempDir()
+	baselinePath := filepath.Join(t.TempDir(), "baseline.json")
+	baseline := &seth.GasReport{Entries: []*seth.GasReportEntry{
+		{Contract: tx.To().Hex(), Method: seth.GasProfilerMethod_Transfer, AvgGasUsed: 20_000},
+	}}
+	require.NoError(t, baseline.Save(baselinePath), "failed to save baseline")
+
+	client, err := seth.NewClientBuilder().
+		WithRpcUrl(node.URL).
+		WithReadOnlyMode().
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithArtifactsFolder(artifacts).
+		WithGasProfiler([]string{seth.GasProfilerOutput_JSON, seth.GasProfilerOutput_Markdown}, baselinePath, 1).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	defer client.CancelFunc()
+
+	_, err = client.Decode(tx, nil)
+	require.NoError(t, err, "failed to decode transaction")
+	_, err = client.Decode(tx, nil)
+	require.NoError(t, err, "failed to decode transaction")
+
+	report, err := client.SaveGasReport()
+	require.Error(t, err, "expected gas regression")
+	require.Contains(t, err.Error(), seth.ErrGasRegression, "expected different error message")
+	require.Len(t, report.Entries, 1, "expected one entry")
+	require.Equal(t, 2, report.Entries[0].Calls, "expected two transactions")
+	require.Equal(t, uint64(21_000), report.Entries[0].AvgGasUsed, "expected different gas used")
+	require.Equal(t, big.NewInt(2*21_000*2_000_000_000), report.Entries[0].TotalCost, "expected different cost")
+
+	files, err := os.ReadDir(filepath.Join(artifacts, seth.GasReportsDir))
+	require.NoError(t, err, "failed to read gas reports dir")
+	require.Len(t, files, 2, "expected JSON and Markdown report")
+
+	_, err = seth.NewClientBuilder().
+		WithRpcUrl(node.URL).
+		WithReadOnlyMode().
+		WithGasProfiler([]string{"csv"}, "", 0).
+		Build()
+	require.Error(t, err, "expected error for unknown output")
+}
+
+func TestGasProfilerTracesInternalCalls(t *testing.T) {
+	c := newClientWithContractMapFromEnv(t)
+	SkipAnvil(t, c)
+
+	c.Cfg.TracingLevel = seth.TracingLevel_All
+	c.Cfg.TraceOutputs = []string{}
+	c.GasProfiler = seth.NewGasProfiler()
+
+	_, err := c.Decode(TestEnv.DebugContract.Trace(c.NewTXOpts(), big.NewInt(2), big.NewInt(4)))
+	require.NoError(t, err, FailedToDecode)
+
+	report, err := c.GasReport()
+	require.NoError(t, err, "failed to get gas report")
+
+	var tx, internal *seth.GasReportEntry
+	for _, e := range report.Entries {
+		switch {
+		case e.Contract == "NetworkDebugContract" && !e.Internal:
+			tx = e
+		case e.Contract == "NetworkDebugSubContract" && e.Internal:
+			internal = e
+		}
+	}
+	require.NotNil(t, tx, "expected transaction entry")
+	require.Equal(t, "trace(int256,int256)", tx.Method, "expected different method")
+	require.NotNil(t, tx.TotalCost, "transaction should have cost")
+	require.NotNil(t, internal, "expected internal call entry")
+	require.Greater(t, internal.AvgGasUsed, uint64(0), "internal call should use gas")
+	require.Less(t, internal.AvgGasUsed, tx.AvgGasUsed, "internal call should use less gas than transaction")
+}
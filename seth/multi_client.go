@@ -0,0 +1,601 @@
+package seth
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RPCPolicy_RoundRobin spreads calls evenly between healthy endpoints
+	RPCPolicy_RoundRobin = "round_robin"
+	// RPCPolicy_LowestLatency sends calls to the healthy endpoint that answered health checks the fastest
+	RPCPolicy_LowestLatency = "lowest_latency"
+	// RPCPolicy_PrimaryFallback sends calls to the first healthy endpoint in the order they are configured
+	RPCPolicy_PrimaryFallback = "primary_fallback"
+
+	DefaultRPCPolicy              = RPCPolicy_PrimaryFallback
+	DefaultRPCHealthCheckInterval = 5 * time.Second
+
+	ErrNoRPCEndpoints = "no RPC endpoints were provided"
+	ErrAllRPCsFailed  = "all RPC endpoints failed"
+)
+
+// latencyWeight is the weight of the newest sample in the moving average of endpoint latency
+const latencyWeight = 0.3
+
+// RPCEndpoint is a single RPC node used by MultiClient
+type RPCEndpoint struct {
+	URL    string
+	Client *ethclient.Client
+
+	mu      sync.Mutex
+	healthy bool
+	// ctx is cancelled when the endpoint becomes unhealthy, so calls stuck on a stalled node can fail over
+	ctx     context.Context
+	cancel  context.CancelFunc
+	latency time.Duration
+	lastErr error
+}
+
+// Healthy returns false if the last call or health check of the endpoint failed
+func (e *RPCEndpoint) Healthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+// Latency returns the moving average of the health check latency of the endpoint
+func (e *RPCEndpoint) Latency() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latency
+}
+
+// LastError returns the error the endpoint was marked unhealthy with, or nil if it's healthy
+func (e *RPCEndpoint) LastError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastErr
+}
+
+func (e *RPCEndpoint) markHealthy(latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.healthy {
+		L.Info().Str("RPC", e.URL).Msg("RPC endpoint is healthy")
+		e.ctx, e.cancel = context.WithCancel(context.Background())
+	}
+	e.healthy = true
+	e.lastErr = nil
+	if latency > 0 {
+		if e.latency == 0 {
+			e.latency = latency
+		} else {
+			e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+		}
+	}
+}
+
+func (e *RPCEndpoint) markUnhealthy(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.healthy {
+		L.Warn().Str("RPC", e.URL).Err(err).Msg("RPC endpoint is unhealthy")
+		e.cancel()
+	}
+	e.healthy = false
+	e.lastErr = err
+}
+
+// callContext returns a context that is cancelled with the parent or when the endpoint becomes unhealthy
+func (e *RPCEndpoint) callContext(parent context.Context) (context.Context, context.CancelFunc) {
+	e.mu.Lock()
+	endpointCtx := e.ctx
+	e.mu.Unlock()
+	ctx, cancel := context.WithCancel(parent)
+	stop := context.AfterFunc(endpointCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// MultiClient is a simulated.Client that dials every configured RPC URL and routes calls between them by a policy.
+// Endpoints that fail with transport errors or don't answer health checks are skipped until they recover
+// and calls are retried on the next endpoint. Errors returned by the node itself, like reverts, are returned as they are.
+type MultiClient struct {
+	Policy    string
+	Endpoints []*RPCEndpoint
+
+	next                atomic.Uint64
+	healthCheckInterval time.Duration
+	cancel              context.CancelFunc
+	wg                  sync.WaitGroup
+}
+
+// NewMultiClient dials all URLs and starts health checking them every healthCheckInterval, use Close to stop it.
+// Endpoints that can't be dialed are treated as unhealthy, an error is returned only if none of them can be dialed.
+func NewMultiClient(urls []string, policy string, headers http.Header, dialTimeout, healthCheckInterval time.Duration) (*MultiClient, error) {
+	if len(urls) == 0 {
+		return nil, errors.New(ErrNoRPCEndpoints)
+	}
+	if policy == "" {
+		policy = DefaultRPCPolicy
+	}
+	if err := validateRPCPolicy(policy); err != nil {
+		return nil, err
+	}
+	if healthCheckInterval == 0 {
+		healthCheckInterval = DefaultRPCHealthCheckInterval
+	}
+
+	m := &MultiClient{
+		Policy:              policy,
+		healthCheckInterval: healthCheckInterval,
+	}
+
+	var dialed int
+	for _, url := range urls {
+		e := &RPCEndpoint{URL: url}
+		e.ctx, e.cancel = context.WithCancel(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		rpcClient, err := rpc.DialOptions(ctx,
+			url,
+			rpc.WithHeaders(headers),
+			rpc.WithHTTPClient(&http.Client{
+				Transport: NewLoggingTransport(),
+			}),
+		)
+		cancel()
+		if err != nil {
+			L.Warn().Str("RPC", url).Err(err).Msg("Failed to connect RPC client, endpoint won't be used")
+			e.cancel()
+			e.lastErr = err
+		} else {
+			e.Client = ethclient.NewClient(rpcClient)
+			e.healthy = true
+			dialed++
+		}
+		m.Endpoints = append(m.Endpoints, e)
+	}
+	if dialed == 0 {
+		return nil, errors.Wrapf(m.Endpoints[0].lastErr, "failed to connect RPC client to any of '%s'", strings.Join(urls, ", "))
+	}
+
+	m.CheckHealth(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.wg.Add(1)
+	go m.healthCheckLoop(ctx)
+
+	L.Info().
+		Strs("RPCs", urls).
+		Str("Policy", policy).
+		Str("Health check interval", healthCheckInterval.String()).
+		Msg("Created RPC client for multiple endpoints")
+
+	return m, nil
+}
+
+func validateRPCPolicy(policy string) error {
+	switch policy {
+	case RPCPolicy_RoundRobin, RPCPolicy_LowestLatency, RPCPolicy_PrimaryFallback:
+		return nil
+	default:
+		return errors.Errorf("rpc policy must be one of: %s, %s, %s", RPCPolicy_RoundRobin, RPCPolicy_LowestLatency, RPCPolicy_PrimaryFallback)
+	}
+}
+
+// Close stops health checks and closes connections to all endpoints
+func (m *MultiClient) Close() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+	for _, e := range m.Endpoints {
+		if e.Client != nil {
+			e.Client.Close()
+		}
+	}
+}
+
+// HealthyEndpoints returns endpoints that passed the last health check or call
+func (m *MultiClient) HealthyEndpoints() []*RPCEndpoint {
+	var healthy []*RPCEndpoint
+	for _, e := range m.Endpoints {
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		}
+	}
+	return healthy
+}
+
+// CheckHealth probes all endpoints with eth_blockNumber and updates their health and latency.
+// A probe that doesn't finish within the health check interval marks the endpoint unhealthy.
+func (m *MultiClient) CheckHealth(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, e := range m.Endpoints {
+		if e.Client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(e *RPCEndpoint) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, m.healthCheckInterval)
+			defer cancel()
+			start := time.Now()
+			if _, err := e.Client.BlockNumber(probeCtx); err != nil {
+				if ctx.Err() == nil {
+					e.markUnhealthy(errors.Wrap(err, "health check failed"))
+				}
+				return
+			}
+			e.markHealthy(time.Since(start))
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (m *MultiClient) healthCheckLoop(ctx context.Context) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CheckHealth(ctx)
+		}
+	}
+}
+
+// candidates returns healthy endpoints in the order given by the policy, followed by unhealthy ones,
+// which are tried as the last resort, since their health might have changed since they were checked
+func (m *MultiClient) candidates() []*RPCEndpoint {
+	var healthy, unhealthy []*RPCEndpoint
+	for _, e := range m.Endpoints {
+		if e.Client == nil {
+			continue
+		}
+		if e.Healthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+
+	switch m.Policy {
+	case RPCPolicy_RoundRobin:
+		if len(healthy) > 0 {
+			start := int((m.next.Add(1) - 1) % uint64(len(healthy)))
+			rotated := make([]*RPCEndpoint, 0, len(healthy))
+			healthy = append(append(rotated, healthy[start:]...), healthy[:start]...)
+		}
+	case RPCPolicy_LowestLatency:
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].Latency() < healthy[j].Latency()
+		})
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// isEndpointError returns true if the call failed because of the endpoint, not because of the request,
+// i.e. the node didn't answer, answered with an HTTP error or stalled, but not when it returned a JSON-RPC error
+func isEndpointError(callerCtx context.Context, err error) bool {
+	if err == nil || callerCtx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// multiCall executes the call on endpoints in the policy order until one of them answers
+func multiCall[T any](ctx context.Context, m *MultiClient, method string, call func(ctx context.Context, c *ethclient.Client) (T, error)) (T, error) {
+	var lastErr error
+	for i, e := range m.candidates() {
+		callCtx, cancel := e.callContext(ctx)
+		res, err := call(callCtx, e.Client)
+		cancel()
+		if !isEndpointError(ctx, err) {
+			if err == nil && !e.Healthy() {
+				e.markHealthy(0)
+			}
+			return res, err
+		}
+		e.markUnhealthy(err)
+		lastErr = err
+		L.Warn().
+			Str("RPC", e.URL).
+			Str("Method", method).
+			Int("Attempt", i+1).
+			Err(err).
+			Msg("RPC call failed, trying next endpoint")
+	}
+	var zero T
+	if lastErr == nil {
+		return zero, errors.New(ErrNoRPCEndpoints)
+	}
+	return zero, errors.Wrap(lastErr, ErrAllRPCsFailed)
+}
+
+// CallContext makes a raw JSON-RPC call, e.g. debug_traceTransaction, on endpoints in the policy order until one of them answers
+func (m *MultiClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	_, err := multiCall(ctx, m, method, func(ctx context.Context, c *ethclient.Client) (struct{}, error) {
+		return struct{}{}, c.Client().CallContext(ctx, result, method, args...)
+	})
+	return err
+}
+
+// maxNonce returns the highest nonce reported by healthy endpoints, so nonces tracked by NonceManager
+// never go back when calls are routed to an endpoint that lags behind
+func (m *MultiClient) maxNonce(ctx context.Context, method string, nonceFn func(ctx context.Context, c *ethclient.Client) (uint64, error)) (uint64, error) {
+	healthy := m.HealthyEndpoints()
+	if len(healthy) <= 1 {
+		return multiCall(ctx, m, method, nonceFn)
+	}
+
+	type result struct {
+		nonce uint64
+		err   error
+	}
+	results := make([]result, len(healthy))
+	wg := sync.WaitGroup{}
+	for i, e := range healthy {
+		wg.Add(1)
+		go func(i int, e *RPCEndpoint) {
+			defer wg.Done()
+			callCtx, cancel := e.callContext(ctx)
+			defer cancel()
+			results[i].nonce, results[i].err = nonceFn(callCtx, e.Client)
+			if isEndpointError(ctx, results[i].err) {
+				e.markUnhealthy(results[i].err)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	var maxNonce uint64
+	var answered bool
+	var lastErr error
+	for _, r := range results {
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		answered = true
+		if r.nonce > maxNonce {
+			maxNonce = r.nonce
+		}
+	}
+	if !answered {
+		return multiCall(ctx, m, method, nonceFn)
+	}
+	if lastErr != nil {
+		L.Debug().Err(lastErr).Str("Method", method).Msg("Some RPC endpoints failed to return nonce")
+	}
+	return maxNonce, nil
+}
+
+// isAlreadyKnownError returns true if the node already has the transaction, which happens when
+// a transaction sent to an endpoint that failed was propagated before it failed
+func isAlreadyKnownError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction") || strings.Contains(msg, "already imported")
+}
+
+// SendTransaction sends the transaction to endpoints in the policy order until one of them accepts it
+func (m *MultiClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	var failedOver bool
+	_, err := multiCall(ctx, m, "eth_sendRawTransaction", func(ctx context.Context, c *ethclient.Client) (struct{}, error) {
+		err := c.SendTransaction(ctx, tx)
+		if failedOver && isAlreadyKnownError(err) {
+			L.Debug().Str("Transaction", tx.Hash().Hex()).Msg("Transaction was already propagated by the failed endpoint")
+			return struct{}{}, nil
+		}
+		if err != nil {
+			failedOver = true
+		}
+		return struct{}{}, err
+	})
+	return err
+}
+
+// NonceAt returns the highest account nonce reported by healthy endpoints
+func (m *MultiClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return m.maxNonce(ctx, "eth_getTransactionCount", func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.NonceAt(ctx, account, blockNumber)
+	})
+}
+
+// PendingNonceAt returns the highest pending account nonce reported by healthy endpoints
+func (m *MultiClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return m.maxNonce(ctx, "eth_getTransactionCount", func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.PendingNonceAt(ctx, account)
+	})
+}
+
+func (m *MultiClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return multiCall(ctx, m, "eth_blockNumber", func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.BlockNumber(ctx)
+	})
+}
+
+func (m *MultiClient) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return multiCall(ctx, m, "eth_getBlockByHash", func(ctx context.Context, c *ethclient.Client) (*types.Block, error) {
+		return c.BlockByHash(ctx, hash)
+	})
+}
+
+func (m *MultiClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return multiCall(ctx, m, "eth_getBlockByNumber", func(ctx context.Context, c *ethclient.Client) (*types.Block, error) {
+		return c.BlockByNumber(ctx, number)
+	})
+}
+
+func (m *MultiClient) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return multiCall(ctx, m, "eth_getBlockByHash", func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByHash(ctx, hash)
+	})
+}
+
+func (m *MultiClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return multiCall(ctx, m, "eth_getBlockByNumber", func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+}
+
+func (m *MultiClient) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	return multiCall(ctx, m, "eth_getBlockTransactionCountByHash", func(ctx context.Context, c *ethclient.Client) (uint, error) {
+		return c.TransactionCount(ctx, blockHash)
+	})
+}
+
+func (m *MultiClient) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error) {
+	return multiCall(ctx, m, "eth_getTransactionByBlockHashAndIndex", func(ctx context.Context, c *ethclient.Client) (*types.Transaction, error) {
+		return c.TransactionInBlock(ctx, blockHash, index)
+	})
+}
+
+// SubscribeNewHead subscribes on the first endpoint that accepts the subscription, it doesn't fail over once subscribed
+func (m *MultiClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return multiCall(ctx, m, "eth_subscribe", func(ctx context.Context, c *ethclient.Client) (ethereum.Subscription, error) {
+		return c.SubscribeNewHead(ctx, ch)
+	})
+}
+
+func (m *MultiClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return multiCall(ctx, m, "eth_getBalance", func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.BalanceAt(ctx, account, blockNumber)
+	})
+}
+
+func (m *MultiClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(ctx, m, "eth_getStorageAt", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.StorageAt(ctx, account, key, blockNumber)
+	})
+}
+
+func (m *MultiClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(ctx, m, "eth_getCode", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+func (m *MultiClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return multiCall(ctx, m, "eth_call", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (m *MultiClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return multiCall(ctx, m, "eth_estimateGas", func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.EstimateGas(ctx, call)
+	})
+}
+
+func (m *MultiClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return multiCall(ctx, m, "eth_gasPrice", func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.SuggestGasPrice(ctx)
+	})
+}
+
+func (m *MultiClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return multiCall(ctx, m, "eth_maxPriorityFeePerGas", func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.SuggestGasTipCap(ctx)
+	})
+}
+
+func (m *MultiClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return multiCall(ctx, m, "eth_feeHistory", func(ctx context.Context, c *ethclient.Client) (*ethereum.FeeHistory, error) {
+		return c.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+	})
+}
+
+func (m *MultiClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return multiCall(ctx, m, "eth_getLogs", func(ctx context.Context, c *ethclient.Client) ([]types.Log, error) {
+		return c.FilterLogs(ctx, q)
+	})
+}
+
+// SubscribeFilterLogs subscribes on the first endpoint that accepts the subscription, it doesn't fail over once subscribed
+func (m *MultiClient) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return multiCall(ctx, m, "eth_subscribe", func(ctx context.Context, c *ethclient.Client) (ethereum.Subscription, error) {
+		return c.SubscribeFilterLogs(ctx, q, ch)
+	})
+}
+
+func (m *MultiClient) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	return multiCall(ctx, m, "eth_getBalance", func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.PendingBalanceAt(ctx, account)
+	})
+}
+
+func (m *MultiClient) PendingStorageAt(ctx context.Context, account common.Address, key common.Hash) ([]byte, error) {
+	return multiCall(ctx, m, "eth_getStorageAt", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.PendingStorageAt(ctx, account, key)
+	})
+}
+
+func (m *MultiClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return multiCall(ctx, m, "eth_getCode", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.PendingCodeAt(ctx, account)
+	})
+}
+
+func (m *MultiClient) PendingTransactionCount(ctx context.Context) (uint, error) {
+	return multiCall(ctx, m, "eth_getBlockTransactionCountByNumber", func(ctx context.Context, c *ethclient.Client) (uint, error) {
+		return c.PendingTransactionCount(ctx)
+	})
+}
+
+func (m *MultiClient) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return multiCall(ctx, m, "eth_call", func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.PendingCallContract(ctx, call)
+	})
+}
+
+func (m *MultiClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type txWithStatus struct {
+		tx        *types.Transaction
+		isPending bool
+	}
+	res, err := multiCall(ctx, m, "eth_getTransactionByHash", func(ctx context.Context, c *ethclient.Client) (txWithStatus, error) {
+		tx, isPending, err := c.TransactionByHash(ctx, hash)
+		return txWithStatus{tx: tx, isPending: isPending}, err
+	})
+	return res.tx, res.isPending, err
+}
+
+func (m *MultiClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return multiCall(ctx, m, "eth_getTransactionReceipt", func(ctx context.Context, c *ethclient.Client) (*types.Receipt, error) {
+		return c.TransactionReceipt(ctx, txHash)
+	})
+}
+
+func (m *MultiClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return multiCall(ctx, m, "eth_chainId", func(ctx context.Context, c *ethclient.Client) (*big.Int, error) {
+		return c.ChainID(ctx)
+	})
+}
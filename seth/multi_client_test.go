@@ -0,0 +1,348 @@
+package seth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/seth"
+)
+
+// fakeRPC is a JSON-RPC node that answers the few methods MultiClient tests need
+type fakeRPC struct {
+	*httptest.Server
+	nonce    atomic.Uint64
+	delay    atomic.Int64
+	failing  atomic.Bool
+	stalling atomic.Bool
+	calls    sync.Map
+	// errors returned as JSON-RPC errors by method
+	rpcErrors sync.Map
+	// handlers of methods the fake node doesn't answer by itself
+	handlers sync.Map
+}
+
+// fakeRPCHandler returns result of the call, nil result is sent as null and error as JSON-RPC error
+type fakeRPCHandler func(params []json.RawMessage) (interface{}, error)
+
+// fakeRPCDataError is sent as JSON-RPC error with data, like revert errors
+type fakeRPCDataError struct {
+	message string
+	data    string
+}
+
+func (e fakeRPCDataError) Error() string {
+	return e.message
+}
+
+func newFakeRPC(t *testing.T) *fakeRPC {
+	f := &fakeRPC{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		counter, _ := f.calls.LoadOrStore(req.Method, &atomic.Int64{})
+		counter.(*atomic.Int64).Add(1)
+
+		if f.stalling.Load() && req.Method != "eth_chainId" {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(time.Duration(f.delay.Load()))
+		if f.failing.Load() {
+			http.Error(w, "node is down", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if msg, ok := f.rpcErrors.Load(req.Method); ok {
+			_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":%q}}`, req.ID, msg)
+			return
+		}
+		if handler, ok := f.handlers.Load(req.Method); ok {
+			res, err := handler.(fakeRPCHandler)(req.Params)
+			var dataErr fakeRPCDataError
+			if errors.As(err, &dataErr) {
+				_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":3,"message":%q,"data":%q}}`, req.ID, dataErr.message, dataErr.data)
+				return
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":%q}}`, req.ID, err.Error())
+				return
+			}
+			encoded, err := json.Marshal(res)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, encoded)
+			return
+		}
+		var result string
+		switch req.Method {
+		case "eth_chainId":
+			result = `"0x539"`
+		case "eth_blockNumber":
+			result = `"0x10"`
+		case "eth_getTransactionCount":
+			result = fmt.Sprintf(`"0x%x"`, f.nonce.Load())
+		case "eth_sendRawTransaction":
+			result = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+		case "eth_call":
+			result = `"0x"`
+		default:
+			_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not found"}}`, req.ID)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, req.ID, result)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRPC) callCount(method string) int64 {
+	counter, ok := f.calls.Load(method)
+	if !ok {
+		return 0
+	}
+	return counter.(*atomic.Int64).Load()
+}
+
+func newTestMultiClient(t *testing.T, policy string, healthCheckInterval time.Duration, nodes ...*fakeRPC) *seth.MultiClient {
+	urls := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		urls = append(urls, n.URL)
+	}
+	mc, err := seth.NewMultiClient(urls, policy, nil, time.Second, healthCheckInterval)
+	require.NoError(t, err, "failed to create multi client")
+	t.Cleanup(mc.Close)
+	return mc
+}
+
+func TestMultiClientPolicies(t *testing.T) {
+	t.Run("primary with fallback", func(t *testing.T) {
+		primary, secondary := newFakeRPC(t), newFakeRPC(t)
+		mc := newTestMultiClient(t, seth.RPCPolicy_PrimaryFallback, time.Minute, primary, secondary)
+
+		for i := 0; i < 5; i++ {
+			_, err := mc.BlockNumber(context.Background())
+			require.NoError(t, err, "failed to get block number")
+		}
+		// one call is the health check done when the client is created
+		require.Equal(t, int64(6), primary.callCount("eth_blockNumber"), "primary should receive all calls")
+		require.Equal(t, int64(1), secondary.callCount("eth_blockNumber"), "secondary should receive only health check")
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		nodes := []*fakeRPC{newFakeRPC(t), newFakeRPC(t), newFakeRPC(t)}
+		mc := newTestMultiClient(t, seth.RPCPolicy_RoundRobin, time.Minute, nodes...)
+
+		for i := 0; i < 9; i++ {
+			_, err := mc.BlockNumber(context.Background())
+			require.NoError(t, err, "failed to get block number")
+		}
+		for i, n := range nodes {
+			require.Equal(t, int64(4), n.callCount("eth_blockNumber"), "node %d should receive a third of calls", i)
+		}
+	})
+
+	t.Run("lowest latency", func(t *testing.T) {
+		slow, fast := newFakeRPC(t), newFakeRPC(t)
+		slow.delay.Store(int64(50 * time.Millisecond))
+		mc := newTestMultiClient(t, seth.RPCPolicy_LowestLatency, time.Minute, slow, fast)
+		require.Greater(t, mc.Endpoints[0].Latency(), mc.Endpoints[1].Latency(), "slow node should have higher latency")
+
+		for i := 0; i < 5; i++ {
+			_, err := mc.BlockNumber(context.Background())
+			require.NoError(t, err, "failed to get block number")
+		}
+		require.Equal(t, int64(1), slow.callCount("eth_blockNumber"), "slow node should receive only health check")
+		require.Equal(t, int64(6), fast.callCount("eth_blockNumber"), "fast node should receive all calls")
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		_, err := seth.NewMultiClient([]string{newFakeRPC(t).URL}, "random", nil, time.Second, time.Minute)
+		require.Error(t, err, "expected error for unknown policy")
+		require.Contains(t, err.Error(), "rpc policy must be one of", "expected different error message")
+	})
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	primary, secondary := newFakeRPC(t), newFakeRPC(t)
+	mc := newTestMultiClient(t, seth.RPCPolicy_PrimaryFallback, 100*time.Millisecond, primary, secondary)
+
+	primary.failing.Store(true)
+	_, err := mc.BlockNumber(context.Background())
+	require.NoError(t, err, "call should fail over to secondary node")
+	require.False(t, mc.Endpoints[0].Healthy(), "primary should be marked unhealthy")
+	require.Error(t, mc.Endpoints[0].LastError(), "primary should have last error")
+	require.Len(t, mc.HealthyEndpoints(), 1, "only secondary should be healthy")
+
+	primaryCalls := primary.callCount("eth_blockNumber")
+	_, err = mc.BlockNumber(context.Background())
+	require.NoError(t, err, "failed to get block number")
+	require.Equal(t, primaryCalls, primary.callCount("eth_blockNumber"), "unhealthy primary should be skipped")
+
+	primary.failing.Store(false)
+	require.Eventually(t, func() bool {
+		return mc.Endpoints[0].Healthy()
+	}, 5*time.Second, 50*time.Millisecond, "primary should recover after health check")
+
+	primary.failing.Store(true)
+	secondary.failing.Store(true)
+	_, err = mc.BlockNumber(context.Background())
+	require.Error(t, err, "expected error when all nodes fail")
+	require.Contains(t, err.Error(), seth.ErrAllRPCsFailed, "expected different error message")
+}
+
+func TestMultiClientDoesNotFailOverOnRPCErrors(t *testing.T) {
+	primary, secondary := newFakeRPC(t), newFakeRPC(t)
+	mc := newTestMultiClient(t, seth.RPCPolicy_PrimaryFallback, time.Minute, primary, secondary)
+
+	primary.rpcErrors.Store("eth_call", "execution reverted")
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	_, err := mc.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil)
+	require.Error(t, err, "expected revert error")
+	require.Contains(t, err.Error(), "execution reverted", "expected different error message")
+	require.Equal(t, int64(0), secondary.callCount("eth_call"), "reverted call should not be retried on secondary")
+	require.True(t, mc.Endpoints[0].Healthy(), "primary should stay healthy")
+}
+
+func TestMultiClientStalledEndpoint(t *testing.T) {
+	primary, secondary := newFakeRPC(t), newFakeRPC(t)
+	mc := newTestMultiClient(t, seth.RPCPolicy_PrimaryFallback, 200*time.Millisecond, primary, secondary)
+
+	primary.stalling.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := mc.BlockNumber(ctx)
+	require.NoError(t, err, "stalled call should fail over to secondary node")
+	require.Less(t, time.Since(start), 5*time.Second, "stalled call should be cancelled by health check")
+	require.False(t, mc.Endpoints[0].Healthy(), "stalled primary should be marked unhealthy")
+}
+
+func TestMultiClientNonceIsHighestOfAllEndpoints(t *testing.T) {
+	nodes := []*fakeRPC{newFakeRPC(t), newFakeRPC(t), newFakeRPC(t)}
+	nodes[0].nonce.Store(5)
+	nodes[1].nonce.Store(7)
+	nodes[2].nonce.Store(6)
+	mc := newTestMultiClient(t, seth.RPCPolicy_RoundRobin, time.Minute, nodes...)
+
+	addr := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	for i := 0; i < 3; i++ {
+		nonce, err := mc.NonceAt(context.Background(), addr, nil)
+		require.NoError(t, err, "failed to get nonce")
+		require.Equal(t, uint64(7), nonce, "nonce should be the highest one")
+		pendingNonce, err := mc.PendingNonceAt(context.Background(), addr)
+		require.NoError(t, err, "failed to get pending nonce")
+		require.Equal(t, uint64(7), pendingNonce, "pending nonce should be the highest one")
+	}
+
+	nodes[1].failing.Store(true)
+	nonce, err := mc.NonceAt(context.Background(), addr, nil)
+	require.NoError(t, err, "failed to get nonce")
+	require.Equal(t, uint64(6), nonce, "nonce should be the highest one of healthy nodes")
+}
+
+func TestMultiClientSendTransactionAlreadyKnownAfterFailover(t *testing.T) {
+	primary, secondary := newFakeRPC(t), newFakeRPC(t)
+	mc := newTestMultiClient(t, seth.RPCPolicy_PrimaryFallback, time.Minute, primary, secondary)
+
+	pk, err := crypto.GenerateKey()
+	require.NoError(t, err, "failed to generate key")
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	tx, err := types.SignNewTx(pk, types.LatestSignerForChainID(big.NewInt(1337)), &types.LegacyTx{
+		Nonce:    1,
+		To:       &to,
+		Value:    big.NewInt(1),
+		Gas:      21_000,
+		GasPrice: big.NewInt(1_000_000_000),
+	})
+	require.NoError(t, err, "failed to sign transaction")
+
+	primary.rpcErrors.Store("eth_sendRawTransaction", "already known")
+	err = mc.SendTransaction(context.Background(), tx)
+	require.Error(t, err, "already known transaction should be an error without failover")
+	require.Equal(t, int64(0), secondary.callCount("eth_sendRawTransaction"), "secondary should not receive transaction")
+
+	secondary.rpcErrors.Store("eth_sendRawTransaction", "already known")
+	primary.failing.Store(true)
+	err = mc.SendTransaction(context.Background(), tx)
+	require.NoError(t, err, "transaction propagated before failover should be treated as sent")
+	require.Equal(t, int64(1), secondary.callCount("eth_sendRawTransaction"), "secondary should receive transaction once")
+}
+
+func TestMultiClientWithClientBuilder(t *testing.T) {
+	primary, secondary := newFakeRPC(t), newFakeRPC(t)
+	client, err := seth.NewClientBuilder().
+		WithRpcUrls([]string{primary.URL, secondary.URL}).
+		WithRpcPolicy(seth.RPCPolicy_RoundRobin, time.Minute).
+		WithReadOnlyMode().
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithTracing(seth.TracingLevel_None, nil).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	defer client.CancelFunc()
+
+	mc, ok := client.Client.(*seth.MultiClient)
+	require.True(t, ok, "client should use multi client")
+	require.Equal(t, seth.RPCPolicy_RoundRobin, mc.Policy, "expected different policy")
+	require.Equal(t, uint64(1337), client.Cfg.Network.ChainID, "expected chain ID of fake node")
+
+	_, err = seth.NewClientBuilder().
+		WithRpcUrls([]string{primary.URL, secondary.URL}).
+		WithRpcPolicy("random", time.Minute).
+		WithReadOnlyMode().
+		Build()
+	require.Error(t, err, "expected error for unknown policy")
+}
+
+func TestMultiClientRPCHealthCheckOnStart(t *testing.T) {
+	mempool, healthy := newFakeMempool(t)
+	down := newFakeRPC(t)
+	down.failing.Store(true)
+	pk, err := crypto.GenerateKey()
+	require.NoError(t, err, "failed to generate key")
+
+	client, err := seth.NewClientBuilder().
+		WithRpcUrls([]string{down.URL, healthy.URL}).
+		WithRpcPolicy(seth.RPCPolicy_PrimaryFallback, time.Minute).
+		WithNetworkChainId(1337).
+		WithPrivateKeys([]string{common.Bytes2Hex(crypto.FromECDSA(pk))}).
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithLegacyGasPrice(1_000_000_000).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithTransactionTimeout(10*time.Second).
+		WithProtections(false, true, nil).
+		Build()
+	require.NoError(t, err, "health check should pass if any endpoint is healthy")
+	defer client.CancelFunc()
+
+	mc := client.Client.(*seth.MultiClient)
+	require.False(t, mc.Endpoints[0].Healthy(), "endpoint that is down should be marked unhealthy")
+	require.True(t, mc.Endpoints[1].Healthy(), "healthy endpoint should stay healthy")
+	require.Positive(t, down.callCount("eth_blockNumber"), "every endpoint should be probed")
+	require.Equal(t, uint64(1), mempool.confirmedNonce(client.Addresses[0]), "health check transaction should be sent once")
+	require.Zero(t, down.callCount("eth_sendRawTransaction"), "health check transaction shouldn't be sent to unhealthy endpoint")
+}
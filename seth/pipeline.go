@@ -0,0 +1,662 @@
+package seth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultPipelineMaxInFlightPerKey  = 16
+	DefaultPipelinePollInterval       = 500 * time.Millisecond
+	DefaultPipelineGasRefreshInterval = 10 * time.Second
+
+	ErrPipelineUnknownKey = "key is not used by the pipelined sender"
+	ErrPipelineClosed     = "pipelined sender is closed"
+	ErrPipelineTxReplaced = "nonce of the transaction was used by another transaction"
+	ErrPipelineNoTx       = "send function returned neither transaction nor error"
+
+	fillerTxGasLimit = 21_000
+)
+
+// PipelineConfig configures PipelinedSender
+type PipelineConfig struct {
+	// KeyNums are keys used to send transactions, by default all keys except the root key are used,
+	// or the root key if it's the only one
+	KeyNums []int
+	// MaxInFlightPerKey is the maximum number of sent, but not yet mined transactions per key
+	MaxInFlightPerKey int
+	// PollInterval is how often nonces and receipts of in-flight transactions are checked
+	PollInterval time.Duration
+	// DroppedTxTimeout is how long a transaction can wait for being mined, while all previous ones already were,
+	// before it's checked if the node still has it, and sent again if it doesn't. Defaults to network's transaction timeout
+	DroppedTxTimeout time.Duration
+	// GasRefreshInterval is how often gas prices are estimated, all transactions sent meanwhile use the same prices
+	GasRefreshInterval time.Duration
+}
+
+// PipelinedSender sends transactions without waiting for previous ones from the same key to be mined.
+// It reserves nonces locally, keeps up to MaxInFlightPerKey transactions in flight per key and reconciles
+// nonce gaps left by transactions that failed to be sent or were dropped by the node:
+//   - a nonce of transaction that failed to be sent is reused by the next transaction or, if there's none, filled with an empty self-transfer
+//   - a transaction that isn't mined and isn't known by the node anymore is sent again
+//
+// Keys used by PipelinedSender shouldn't be used to send transactions in any other way while it's running.
+type PipelinedSender struct {
+	client      *Client
+	cfg         PipelineConfig
+	keys        map[int]*keyPipeline
+	keyNums     []int
+	gasMu       *sync.RWMutex
+	estimations GasEstimations
+	gasUpdated  time.Time
+	closed      chan struct{}
+	closeOnce   *sync.Once
+	wg          *sync.WaitGroup
+}
+
+// PipelinedTx is a transaction sent by PipelinedSender
+type PipelinedTx struct {
+	Tx     *types.Transaction
+	KeyNum int
+	Nonce  uint64
+	SentAt time.Time
+
+	filler     bool
+	consumedAt time.Time
+	receipt    *types.Receipt
+	err        error
+	done       chan struct{}
+}
+
+// Done returns a channel that's closed when transaction is mined or replaced, or when the sender is closed
+func (t *PipelinedTx) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait waits until transaction is mined and returns its receipt. Reverted transactions are returned without error,
+// check receipt status or decode the transaction to get the revert reason. If the sender is closed before transaction is mined
+// ErrPipelineClosed is returned
+func (t *PipelinedTx) Wait(ctx context.Context) (*types.Receipt, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.done:
+		return t.receipt, t.err
+	}
+}
+
+// PipelineKeyStats are statistics of transactions sent with a single key
+type PipelineKeyStats struct {
+	KeyNum         int            `json:"key_num"`
+	Address        common.Address `json:"address"`
+	InFlight       int            `json:"in_flight"`
+	MaxInFlight    int            `json:"max_in_flight"`
+	NextNonce      uint64         `json:"next_nonce"`
+	ConfirmedNonce uint64         `json:"confirmed_nonce"`
+	Sent           uint64         `json:"sent"`
+	Mined          uint64         `json:"mined"`
+	Reverted       uint64         `json:"reverted"`
+	SendFailures   uint64         `json:"send_failures"`
+	Replaced       uint64         `json:"replaced"`
+	Rebroadcasts   uint64         `json:"rebroadcasts"`
+	GapsFilled     uint64         `json:"gaps_filled"`
+}
+
+type keyPipeline struct {
+	mu             *sync.Mutex
+	keyNum         int
+	address        common.Address
+	privateKey     *ecdsa.PrivateKey
+	slots          chan struct{}
+	nextNonce      uint64
+	confirmedNonce uint64
+	// gaps are reserved nonces without transaction, by the time they were left
+	gaps        map[uint64]time.Time
+	inFlight    map[uint64]*PipelinedTx
+	needsResync bool
+	stats       PipelineKeyStats
+}
+
+// NewPipelinedSender creates a new PipelinedSender, syncs nonces of its keys and starts reconciling them in the background.
+// Use Close to stop it.
+func NewPipelinedSender(client *Client, cfg PipelineConfig) (*PipelinedSender, error) {
+	if client.Cfg.ReadOnly {
+		return nil, errors.New("pipelined sender is not supported in read-only mode")
+	}
+	if len(client.PrivateKeys) == 0 {
+		return nil, errors.New("no private keys loaded, cannot send transactions")
+	}
+	if cfg.MaxInFlightPerKey == 0 {
+		cfg.MaxInFlightPerKey = DefaultPipelineMaxInFlightPerKey
+	}
+	if cfg.MaxInFlightPerKey < 0 {
+		return nil, errors.New("max in-flight transactions per key must be positive")
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultPipelinePollInterval
+	}
+	if cfg.DroppedTxTimeout == 0 {
+		cfg.DroppedTxTimeout = client.Cfg.Network.TxnTimeout.Duration()
+	}
+	if cfg.GasRefreshInterval == 0 {
+		cfg.GasRefreshInterval = DefaultPipelineGasRefreshInterval
+	}
+	if len(cfg.KeyNums) == 0 {
+		if len(client.PrivateKeys) == 1 {
+			cfg.KeyNums = []int{0}
+		} else {
+			for keyNum := 1; keyNum < len(client.PrivateKeys); keyNum++ {
+				cfg.KeyNums = append(cfg.KeyNums, keyNum)
+			}
+		}
+	}
+
+	p := &PipelinedSender{
+		client:    client,
+		cfg:       cfg,
+		keys:      make(map[int]*keyPipeline, len(cfg.KeyNums)),
+		keyNums:   cfg.KeyNums,
+		gasMu:     &sync.RWMutex{},
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+		wg:        &sync.WaitGroup{},
+	}
+
+	for _, keyNum := range cfg.KeyNums {
+		if err := client.validatePrivateKeysKeyNum(keyNum); err != nil {
+			return nil, err
+		}
+		if _, ok := p.keys[keyNum]; ok {
+			return nil, errors.Errorf("key %d is used more than once", keyNum)
+		}
+		k := &keyPipeline{
+			mu:         &sync.Mutex{},
+			keyNum:     keyNum,
+			address:    client.Addresses[keyNum],
+			privateKey: client.PrivateKeys[keyNum],
+			slots:      make(chan struct{}, cfg.MaxInFlightPerKey),
+			gaps:       make(map[uint64]time.Time),
+			inFlight:   make(map[uint64]*PipelinedTx),
+		}
+		k.stats.KeyNum = keyNum
+		k.stats.Address = k.address
+		if err := p.resync(k); err != nil {
+			return nil, err
+		}
+		p.keys[keyNum] = k
+	}
+
+	p.refreshGasEstimations()
+
+	p.wg.Add(1)
+	go p.reconcileLoop()
+
+	L.Info().
+		Ints("Keys", cfg.KeyNums).
+		Int("Max in-flight per key", cfg.MaxInFlightPerKey).
+		Msg("Created pipelined sender")
+
+	return p, nil
+}
+
+// Close stops reconciling nonces. Transactions still in flight won't be tracked anymore and their Wait returns ErrPipelineClosed,
+// use Flush to wait for them first.
+func (p *PipelinedSender) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	p.wg.Wait()
+	for _, k := range p.keys {
+		k.abandon(errors.New(ErrPipelineClosed))
+	}
+}
+
+// Send reserves the next nonce of the key, waiting for a free in-flight slot if needed, and calls send with transaction options
+// using that nonce. Send should only send the transaction, for example by calling a method of a Geth wrapper, and return it.
+// It returns as soon as transaction is sent, use PipelinedTx.Wait to wait until it's mined.
+func (p *PipelinedSender) Send(ctx context.Context, keyNum int, send func(opts *bind.TransactOpts) (*types.Transaction, error), o ...TransactOpt) (*PipelinedTx, error) {
+	k, ok := p.keys[keyNum]
+	if !ok {
+		return nil, errors.Errorf("%s: %d", ErrPipelineUnknownKey, keyNum)
+	}
+
+	// select picks a random ready case, so a closed sender has to be checked first, when there are free slots
+	select {
+	case <-p.closed:
+		return nil, errors.New(ErrPipelineClosed)
+	default:
+	}
+	select {
+	case <-p.closed:
+		return nil, errors.New(ErrPipelineClosed)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case k.slots <- struct{}{}:
+	}
+
+	nonce := k.reserve()
+	opts, err := bind.NewKeyedTransactorWithChainID(k.privateKey, big.NewInt(p.client.ChainID))
+	if err != nil {
+		k.release(nonce, err, true)
+		return nil, errors.Wrapf(err, "failed to create transactor for key %d", keyNum)
+	}
+	p.client.configureTransactionOpts(opts, nonce, p.gasEstimations(), o...)
+	opts.Context = ctx
+
+	tx, err := send(opts)
+	if err == nil && tx == nil {
+		err = errors.New(ErrPipelineNoTx)
+	}
+	if err != nil {
+		k.release(nonce, err, true)
+		return nil, err
+	}
+
+	pt := k.track(tx, nonce, false)
+	select {
+	case <-p.closed:
+		// sender was closed while transaction was being sent, nothing will complete it anymore
+		k.abandon(errors.New(ErrPipelineClosed))
+	default:
+	}
+	return pt, nil
+}
+
+// SendWithAnyKey sends transaction with the key that has the fewest transactions in flight
+func (p *PipelinedSender) SendWithAnyKey(ctx context.Context, send func(opts *bind.TransactOpts) (*types.Transaction, error), o ...TransactOpt) (*PipelinedTx, error) {
+	keyNum := p.keyNums[0]
+	fewest := -1
+	for _, kn := range p.keyNums {
+		inFlight := len(p.keys[kn].slots)
+		if fewest == -1 || inFlight < fewest {
+			keyNum, fewest = kn, inFlight
+		}
+	}
+	return p.Send(ctx, keyNum, send, o...)
+}
+
+// Flush waits until all transactions in flight are mined and all nonce gaps are filled
+func (p *PipelinedSender) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		pending := false
+		for _, k := range p.keys {
+			k.mu.Lock()
+			if len(k.inFlight) > 0 || len(k.gaps) > 0 {
+				pending = true
+			}
+			k.mu.Unlock()
+		}
+		if !pending {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.closed:
+			return errors.New(ErrPipelineClosed)
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats returns statistics of all keys
+func (p *PipelinedSender) Stats() []PipelineKeyStats {
+	stats := make([]PipelineKeyStats, 0, len(p.keyNums))
+	for _, keyNum := range p.keyNums {
+		stats = append(stats, p.keys[keyNum].snapshot())
+	}
+	return stats
+}
+
+// KeyStats returns statistics of a single key
+func (p *PipelinedSender) KeyStats(keyNum int) (PipelineKeyStats, error) {
+	k, ok := p.keys[keyNum]
+	if !ok {
+		return PipelineKeyStats{}, errors.Errorf("%s: %d", ErrPipelineUnknownKey, keyNum)
+	}
+	return k.snapshot(), nil
+}
+
+func (p *PipelinedSender) gasEstimations() GasEstimations {
+	p.gasMu.RLock()
+	defer p.gasMu.RUnlock()
+	return p.estimations
+}
+
+func (p *PipelinedSender) refreshGasEstimations() {
+	estimations := p.client.CalculateGasEstimations(p.client.NewDefaultGasEstimationRequest())
+	p.gasMu.Lock()
+	defer p.gasMu.Unlock()
+	p.estimations = estimations
+	p.gasUpdated = time.Now()
+}
+
+func (p *PipelinedSender) reconcileLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+		}
+
+		p.gasMu.RLock()
+		refreshGas := time.Since(p.gasUpdated) > p.cfg.GasRefreshInterval
+		p.gasMu.RUnlock()
+		if refreshGas {
+			p.refreshGasEstimations()
+		}
+
+		wg := sync.WaitGroup{}
+		for _, k := range p.keys {
+			wg.Add(1)
+			go func(k *keyPipeline) {
+				defer wg.Done()
+				if err := p.reconcile(k); err != nil {
+					L.Debug().Err(err).Int("KeyNum", k.keyNum).Msg("Failed to reconcile nonces")
+				}
+			}(k)
+		}
+		wg.Wait()
+	}
+}
+
+// resync moves the next nonce forward if key was used outside of the pipeline
+func (p *PipelinedSender) resync(k *keyPipeline) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.Cfg.Network.TxnTimeout.Duration())
+	defer cancel()
+	pendingNonce, err := p.client.Client.PendingNonceAt(ctx, k.address)
+	if err != nil {
+		return errors.Wrapf(err, "%s for key %d", ErrNonce, k.keyNum)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if pendingNonce > k.nextNonce {
+		for nonce := range k.gaps {
+			if nonce < pendingNonce {
+				delete(k.gaps, nonce)
+			}
+		}
+		k.nextNonce = pendingNonce
+	}
+	k.needsResync = false
+	return nil
+}
+
+// reconcile completes mined transactions, sends again dropped ones and fills nonce gaps
+func (p *PipelinedSender) reconcile(k *keyPipeline) error {
+	k.mu.Lock()
+	needsResync := k.needsResync
+	k.mu.Unlock()
+	if needsResync {
+		if err := p.resync(k); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.Cfg.Network.TxnTimeout.Duration())
+	defer cancel()
+	confirmed, err := p.client.Client.NonceAt(ctx, k.address, nil)
+	if err != nil {
+		return errors.Wrap(err, ErrNonce)
+	}
+
+	k.mu.Lock()
+	k.confirmedNonce = confirmed
+	var consumed []*PipelinedTx
+	var lowest *PipelinedTx
+	for nonce, tx := range k.inFlight {
+		if nonce < confirmed {
+			if tx.consumedAt.IsZero() {
+				tx.consumedAt = time.Now()
+			}
+			consumed = append(consumed, tx)
+		} else if nonce == confirmed {
+			lowest = tx
+		}
+	}
+	var gaps []uint64
+	for nonce, since := range k.gaps {
+		switch {
+		case nonce < confirmed:
+			// nonce was used outside of the pipeline
+			delete(k.gaps, nonce)
+		case time.Since(since) >= p.cfg.PollInterval:
+			gaps = append(gaps, nonce)
+		}
+	}
+	k.mu.Unlock()
+
+	for _, tx := range consumed {
+		receipt, err := p.client.Client.TransactionReceipt(ctx, tx.Tx.Hash())
+		switch {
+		case err == nil:
+			k.complete(tx, receipt, nil)
+		case errors.Is(err, ethereum.NotFound) && time.Since(tx.consumedAt) > p.cfg.DroppedTxTimeout:
+			k.complete(tx, nil, errors.New(ErrPipelineTxReplaced))
+		default:
+			// receipt might not be available yet on the node we asked
+		}
+	}
+
+	if lowest != nil && time.Since(lowest.SentAt) > p.cfg.DroppedTxTimeout {
+		p.rebroadcastIfDropped(ctx, k, lowest)
+	}
+
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	for _, nonce := range gaps {
+		if err := p.fillGap(ctx, k, nonce); err != nil {
+			L.Warn().Err(err).Int("KeyNum", k.keyNum).Uint64("Nonce", nonce).Msg("Failed to fill nonce gap")
+		}
+	}
+
+	return nil
+}
+
+func (p *PipelinedSender) rebroadcastIfDropped(ctx context.Context, k *keyPipeline, tx *PipelinedTx) {
+	if _, _, err := p.client.Client.TransactionByHash(ctx, tx.Tx.Hash()); !errors.Is(err, ethereum.NotFound) {
+		return
+	}
+	L.Warn().
+		Int("KeyNum", k.keyNum).
+		Uint64("Nonce", tx.Nonce).
+		Str("Transaction", tx.Tx.Hash().Hex()).
+		Msg("Transaction was dropped by the node, sending it again")
+	err := p.client.Client.SendTransaction(ctx, tx.Tx)
+	if err != nil && !isAlreadyKnownError(err) && !isNonceTooLowError(err) {
+		L.Warn().Err(err).Int("KeyNum", k.keyNum).Uint64("Nonce", tx.Nonce).Msg("Failed to send dropped transaction again")
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	tx.SentAt = time.Now()
+	k.stats.Rebroadcasts++
+}
+
+// fillGap sends an empty self-transfer with the nonce, so that transactions with higher nonces can be mined
+func (p *PipelinedSender) fillGap(ctx context.Context, k *keyPipeline, nonce uint64) error {
+	k.mu.Lock()
+	if _, ok := k.gaps[nonce]; !ok {
+		// nonce was reused meanwhile
+		k.mu.Unlock()
+		return nil
+	}
+	delete(k.gaps, nonce)
+	k.mu.Unlock()
+
+	estimations := p.gasEstimations()
+	var txData types.TxData
+	if p.client.Cfg.Network.EIP1559DynamicFees {
+		txData = &types.DynamicFeeTx{
+			Nonce:     nonce,
+			To:        &k.address,
+			Value:     big.NewInt(0),
+			Gas:       fillerTxGasLimit,
+			GasTipCap: estimations.GasTipCap,
+			GasFeeCap: estimations.GasFeeCap,
+		}
+	} else {
+		txData = &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &k.address,
+			Value:    big.NewInt(0),
+			Gas:      fillerTxGasLimit,
+			GasPrice: estimations.GasPrice,
+		}
+	}
+	tx, err := types.SignNewTx(k.privateKey, types.LatestSignerForChainID(big.NewInt(p.client.ChainID)), txData)
+	if err != nil {
+		k.release(nonce, err, false)
+		return err
+	}
+
+	L.Debug().Int("KeyNum", k.keyNum).Uint64("Nonce", nonce).Msg("Filling nonce gap with empty transaction")
+	if err := p.client.Client.SendTransaction(ctx, tx); err != nil {
+		k.release(nonce, err, false)
+		return err
+	}
+
+	k.track(tx, nonce, true)
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.stats.GapsFilled++
+	return nil
+}
+
+func isNonceTooLowError(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// reserve returns the lowest nonce left by a transaction that failed to be sent or the next one
+func (k *keyPipeline) reserve() uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.gaps) > 0 {
+		lowest := uint64(0)
+		first := true
+		for nonce := range k.gaps {
+			if first || nonce < lowest {
+				lowest, first = nonce, false
+			}
+		}
+		delete(k.gaps, lowest)
+		return lowest
+	}
+	nonce := k.nextNonce
+	k.nextNonce++
+	return nonce
+}
+
+// release returns nonce of transaction that failed to be sent. If it's the last reserved one it's simply reused,
+// otherwise it's a gap that has to be filled, unless the nonce was already used outside of the pipeline.
+// In-flight slots are only taken by transactions sent with Send, gap fillers don't take them
+func (k *keyPipeline) release(nonce uint64, err error, slotTaken bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if slotTaken {
+		k.stats.SendFailures++
+		<-k.slots
+	}
+
+	if isNonceTooLowError(err) {
+		k.needsResync = true
+		return
+	}
+	k.gaps[nonce] = time.Now()
+	for {
+		if k.nextNonce == 0 {
+			break
+		}
+		if _, ok := k.gaps[k.nextNonce-1]; !ok {
+			break
+		}
+		delete(k.gaps, k.nextNonce-1)
+		k.nextNonce--
+	}
+}
+
+func (k *keyPipeline) track(tx *types.Transaction, nonce uint64, filler bool) *PipelinedTx {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	pt := &PipelinedTx{
+		Tx:     tx,
+		KeyNum: k.keyNum,
+		Nonce:  nonce,
+		SentAt: time.Now(),
+		filler: filler,
+		done:   make(chan struct{}),
+	}
+	k.inFlight[nonce] = pt
+	if !filler {
+		k.stats.Sent++
+		if len(k.slots) > k.stats.MaxInFlight {
+			k.stats.MaxInFlight = len(k.slots)
+		}
+	}
+	return pt
+}
+
+func (k *keyPipeline) complete(tx *PipelinedTx, receipt *types.Receipt, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.inFlight[tx.Nonce] != tx {
+		return
+	}
+	delete(k.inFlight, tx.Nonce)
+	tx.receipt = receipt
+	tx.err = err
+	close(tx.done)
+
+	if tx.filler {
+		return
+	}
+	<-k.slots
+	switch {
+	case err != nil:
+		k.stats.Replaced++
+	case receipt.Status == types.ReceiptStatusFailed:
+		k.stats.Mined++
+		k.stats.Reverted++
+	default:
+		k.stats.Mined++
+	}
+}
+
+// abandon completes all transactions in flight with the error, without waiting for them to be mined
+func (k *keyPipeline) abandon(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for nonce, tx := range k.inFlight {
+		delete(k.inFlight, nonce)
+		tx.err = err
+		close(tx.done)
+		if !tx.filler {
+			<-k.slots
+		}
+	}
+}
+
+func (k *keyPipeline) snapshot() PipelineKeyStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	stats := k.stats
+	stats.InFlight = len(k.slots)
+	stats.NextNonce = k.nextNonce
+	stats.ConfirmedNonce = k.confirmedNonce
+	return stats
+}
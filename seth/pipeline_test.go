@@ -0,0 +1,415 @@
+package seth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/seth"
+)
+
+// fakeMempool is a node that keeps sent transactions in a mempool and mines them in nonce order
+type fakeMempool struct {
+	mu        sync.Mutex
+	signer    types.Signer
+	confirmed map[common.Address]uint64
+	pool      map[common.Address]map[uint64]*types.Transaction
+	receipts  map[common.Hash]*types.Receipt
+	// drop decides if sent transaction is accepted, but never added to the mempool
+	drop func(tx *types.Transaction) bool
+	sent int
+}
+
+func newFakeMempool(t *testing.T) (*fakeMempool, *fakeRPC) {
+	m := &fakeMempool{
+		signer:    types.LatestSignerForChainID(big.NewInt(1337)),
+		confirmed: make(map[common.Address]uint64),
+		pool:      make(map[common.Address]map[uint64]*types.Transaction),
+		receipts:  make(map[common.Hash]*types.Receipt),
+	}
+	node := newFakeRPC(t)
+	node.handlers.Store("eth_getTransactionCount", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		var address common.Address
+		var tag string
+		if err := json.Unmarshal(params[0], &address); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(params[1], &tag); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		nonce := m.confirmed[address]
+		if tag == "pending" {
+			for m.pool[address][nonce] != nil {
+				nonce++
+			}
+		}
+		return hexutil.Uint64(nonce), nil
+	}))
+	node.handlers.Store("eth_sendRawTransaction", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		var raw hexutil.Bytes
+		if err := json.Unmarshal(params[0], &raw); err != nil {
+			return nil, err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return nil, err
+		}
+		from, err := types.Sender(m.signer, tx)
+		if err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.sent++
+		if tx.Nonce() < m.confirmed[from] {
+			return nil, errors.New("nonce too low")
+		}
+		if m.drop != nil && m.drop(tx) {
+			return tx.Hash(), nil
+		}
+		if m.pool[from] == nil {
+			m.pool[from] = make(map[uint64]*types.Transaction)
+		}
+		m.pool[from][tx.Nonce()] = tx
+		return tx.Hash(), nil
+	}))
+	node.handlers.Store("eth_getTransactionReceipt", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		var hash common.Hash
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if r, ok := m.receipts[hash]; ok {
+			return r, nil
+		}
+		return nil, nil
+	}))
+	node.handlers.Store("eth_getTransactionByHash", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		var hash common.Hash
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, txs := range m.pool {
+			for _, tx := range txs {
+				if tx.Hash() == hash {
+					return tx, nil
+				}
+			}
+		}
+		return nil, nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.mine()
+			}
+		}
+	}()
+	return m, node
+}
+
+// mine includes all transactions that have no nonce gaps before them
+func (m *fakeMempool) mine() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for from, txs := range m.pool {
+		for {
+			tx, ok := txs[m.confirmed[from]]
+			if !ok {
+				break
+			}
+			delete(txs, tx.Nonce())
+			m.confirmed[from]++
+			m.receipts[tx.Hash()] = &types.Receipt{
+				Status:            types.ReceiptStatusSuccessful,
+				TxHash:            tx.Hash(),
+				BlockNumber:       big.NewInt(1),
+				Logs:              []*types.Log{},
+				GasUsed:           21_000,
+				EffectiveGasPrice: big.NewInt(1_000_000_000),
+			}
+		}
+	}
+}
+
+func (m *fakeMempool) confirmedNonce(address common.Address) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.confirmed[address]
+}
+
+func newPipelineTestClient(t *testing.T, url string) *seth.Client {
+	pk, err := crypto.GenerateKey()
+	require.NoError(t, err, "failed to generate key")
+	client, err := seth.NewClientBuilder().
+		WithRpcUrl(url).
+		WithNetworkChainId(1337).
+		WithPrivateKeys([]string{common.Bytes2Hex(crypto.FromECDSA(pk))}).
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithLegacyGasPrice(1_000_000_000).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithTransactionTimeout(10*time.Second).
+		WithProtections(false, false, nil).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	t.Cleanup(client.CancelFunc)
+	return client
+}
+
+func newPipelineTestSender(t *testing.T, client *seth.Client, cfg seth.PipelineConfig) *seth.PipelinedSender {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 50 * time.Millisecond
+	}
+	p, err := seth.NewPipelinedSender(client, cfg)
+	require.NoError(t, err, "failed to create pipelined sender")
+	t.Cleanup(p.Close)
+	return p
+}
+
+// transfer returns a function sending transfer of 1 wei to the address
+func transfer(client *seth.Client, to common.Address) func(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tx, err := opts.Signer(opts.From, types.NewTx(&types.LegacyTx{
+			Nonce:    opts.Nonce.Uint64(),
+			To:       &to,
+			Value:    big.NewInt(1),
+			Gas:      21_000,
+			GasPrice: opts.GasPrice,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		return tx, client.Client.SendTransaction(opts.Context, tx)
+	}
+}
+
+func TestPipelinedSenderKeepsTransactionsInFlight(t *testing.T) {
+	mempool, node := newFakeMempool(t)
+	client := newPipelineTestClient(t, node.URL)
+	p := newPipelineTestSender(t, client, seth.PipelineConfig{MaxInFlightPerKey: 10})
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	txs := make(chan *seth.PipelinedTx, 50)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx, err := p.SendWithAnyKey(ctx, transfer(client, to))
+			require.NoError(t, err, "failed to send transaction")
+			txs <- tx
+		}()
+	}
+	wg.Wait()
+	close(txs)
+
+	nonces := make(map[uint64]bool)
+	for tx := range txs {
+		receipt, err := tx.Wait(ctx)
+		require.NoError(t, err, "failed to wait for transaction")
+		require.Equal(t, types.ReceiptStatusSuccessful, receipt.Status, "transaction should succeed")
+		require.False(t, nonces[tx.Nonce], "nonce %d was used twice", tx.Nonce)
+		nonces[tx.Nonce] = true
+	}
+	require.NoError(t, p.Flush(ctx), "failed to flush")
+
+	stats := p.Stats()
+	require.Len(t, stats, 1, "root key should be the only key")
+	require.Equal(t, uint64(50), stats[0].Sent, "expected different number of sent transactions")
+	require.Equal(t, uint64(50), stats[0].Mined, "expected different number of mined transactions")
+	require.Equal(t, 0, stats[0].InFlight, "no transactions should be in flight")
+	require.LessOrEqual(t, stats[0].MaxInFlight, 10, "too many transactions were in flight")
+	require.Equal(t, uint64(50), stats[0].NextNonce, "expected different next nonce")
+	require.Equal(t, uint64(50), mempool.confirmedNonce(client.Addresses[0]), "expected different confirmed nonce")
+}
+
+func TestPipelinedSenderFillsNonceGaps(t *testing.T) {
+	mempool, node := newFakeMempool(t)
+	client := newPipelineTestClient(t, node.URL)
+	p := newPipelineTestSender(t, client, seth.PipelineConfig{MaxInFlightPerKey: 5})
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// first transaction takes nonce 0 and blocks until the second one is sent with nonce 1
+	sending := make(chan struct{})
+	sent := make(chan struct{})
+	failed := make(chan error, 1)
+	go func() {
+		_, err := p.Send(ctx, 0, func(_ *bind.TransactOpts) (*types.Transaction, error) {
+			close(sending)
+			<-sent
+			return nil, errors.New("execution reverted")
+		})
+		failed <- err
+	}()
+	<-sending
+	second, err := p.Send(ctx, 0, transfer(client, to))
+	require.NoError(t, err, "failed to send transaction")
+	require.Equal(t, uint64(1), second.Nonce, "expected different nonce")
+	close(sent)
+	require.Error(t, <-failed, "expected send error")
+
+	receipt, err := second.Wait(ctx)
+	require.NoError(t, err, "transaction with nonce after the gap should be mined")
+	require.Equal(t, second.Tx.Hash(), receipt.TxHash, "expected different receipt")
+	require.NoError(t, p.Flush(ctx), "failed to flush")
+
+	stats, err := p.KeyStats(0)
+	require.NoError(t, err, "failed to get key stats")
+	require.Equal(t, uint64(1), stats.SendFailures, "expected one send failure")
+	require.Equal(t, uint64(1), stats.GapsFilled, "expected one gap filled")
+	require.Equal(t, uint64(2), mempool.confirmedNonce(client.Addresses[0]), "expected different confirmed nonce")
+
+	// nonce of the last transaction is reused, if it fails to be sent
+	_, err = p.Send(ctx, 0, func(_ *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, errors.New("execution reverted")
+	})
+	require.Error(t, err, "expected send error")
+	third, err := p.Send(ctx, 0, transfer(client, to))
+	require.NoError(t, err, "failed to send transaction")
+	require.Equal(t, uint64(2), third.Nonce, "nonce should be reused")
+	_, err = third.Wait(ctx)
+	require.NoError(t, err, "failed to wait for transaction")
+
+	_, err = p.Send(ctx, 1, transfer(client, to))
+	require.Error(t, err, "expected error for unknown key")
+}
+
+func TestPipelinedSenderRebroadcastsDroppedTransactions(t *testing.T) {
+	mempool, node := newFakeMempool(t)
+	dropped := false
+	mempool.drop = func(tx *types.Transaction) bool {
+		if tx.Nonce() == 0 && !dropped {
+			dropped = true
+			return true
+		}
+		return false
+	}
+	client := newPipelineTestClient(t, node.URL)
+	p := newPipelineTestSender(t, client, seth.PipelineConfig{
+		MaxInFlightPerKey: 5,
+		DroppedTxTimeout:  200 * time.Millisecond,
+	})
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var txs []*seth.PipelinedTx
+	for i := 0; i < 3; i++ {
+		tx, err := p.Send(ctx, 0, transfer(client, to))
+		require.NoError(t, err, "failed to send transaction")
+		txs = append(txs, tx)
+	}
+	for _, tx := range txs {
+		_, err := tx.Wait(ctx)
+		require.NoError(t, err, "failed to wait for transaction")
+	}
+
+	stats, err := p.KeyStats(0)
+	require.NoError(t, err, "failed to get key stats")
+	require.Equal(t, uint64(1), stats.Rebroadcasts, "dropped transaction should be sent again")
+	require.Equal(t, uint64(3), stats.Mined, "expected different number of mined transactions")
+}
+
+func TestPipelinedSenderConfig(t *testing.T) {
+	_, node := newFakeMempool(t)
+	client := newPipelineTestClient(t, node.URL)
+
+	_, err := seth.NewPipelinedSender(client, seth.PipelineConfig{KeyNums: []int{1}})
+	require.Error(t, err, "expected error for missing key")
+	_, err = seth.NewPipelinedSender(client, seth.PipelineConfig{MaxInFlightPerKey: -1})
+	require.Error(t, err, "expected error for negative max in-flight")
+}
+
+func TestPipelinedSenderCloseCompletesTransactionsInFlight(t *testing.T) {
+	mempool, node := newFakeMempool(t)
+	mempool.drop = func(_ *types.Transaction) bool {
+		return true
+	}
+	client := newPipelineTestClient(t, node.URL)
+	p := newPipelineTestSender(t, client, seth.PipelineConfig{MaxInFlightPerKey: 5})
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var txs []*seth.PipelinedTx
+	for i := 0; i < 2; i++ {
+		tx, err := p.Send(ctx, 0, transfer(client, to))
+		require.NoError(t, err, "failed to send transaction")
+		txs = append(txs, tx)
+	}
+	p.Close()
+
+	for _, tx := range txs {
+		select {
+		case <-tx.Done():
+		default:
+			t.Fatal("transaction in flight should be done after close")
+		}
+		_, err := tx.Wait(ctx)
+		require.EqualError(t, err, seth.ErrPipelineClosed, "expected closed sender error")
+	}
+	stats, err := p.KeyStats(0)
+	require.NoError(t, err, "failed to get key stats")
+	require.Equal(t, 0, stats.InFlight, "no transactions should be in flight")
+
+	_, err = p.Send(ctx, 0, transfer(client, to))
+	require.EqualError(t, err, seth.ErrPipelineClosed, "expected closed sender error")
+}
+
+func TestPipelinedSenderRejectsMissingTransaction(t *testing.T) {
+	_, node := newFakeMempool(t)
+	client := newPipelineTestClient(t, node.URL)
+	p := newPipelineTestSender(t, client, seth.PipelineConfig{MaxInFlightPerKey: 1})
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := p.Send(ctx, 0, func(_ *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, nil
+	})
+	require.EqualError(t, err, seth.ErrPipelineNoTx, "expected missing transaction error")
+
+	// in-flight slot is released and nonce is reused
+	tx, err := p.Send(ctx, 0, transfer(client, to))
+	require.NoError(t, err, "failed to send transaction")
+	require.Equal(t, uint64(0), tx.Nonce, "nonce should be reused")
+	_, err = tx.Wait(ctx)
+	require.NoError(t, err, "failed to wait for transaction")
+
+	stats, err := p.KeyStats(0)
+	require.NoError(t, err, "failed to get key stats")
+	require.Equal(t, uint64(1), stats.SendFailures, "expected one send failure")
+}
@@ -0,0 +1,363 @@
+package seth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ErrSimulationNoRPC         = "simulation requires RPC connection to the node, it's not supported with simulated backend"
+	ErrSimulationTxPreparation = "failed to prepare transaction for simulation"
+
+	simulationTracePrefix = "simulation_"
+)
+
+// AccountOverride overrides state of a single account during simulation. Only set fields are overridden.
+type AccountOverride struct {
+	Balance *big.Int
+	Nonce   *uint64
+	Code    []byte
+	// State replaces the whole storage of the account
+	State map[common.Hash]common.Hash
+	// StateDiff overrides only given storage slots
+	StateDiff map[common.Hash]common.Hash
+}
+
+// MarshalJSON encodes override in the format expected by 'eth_call', 'eth_estimateGas' and 'debug_traceCall'
+func (a AccountOverride) MarshalJSON() ([]byte, error) {
+	type override struct {
+		Balance   *hexutil.Big                `json:"balance,omitempty"`
+		Nonce     *hexutil.Uint64             `json:"nonce,omitempty"`
+		Code      *hexutil.Bytes              `json:"code,omitempty"`
+		State     map[common.Hash]common.Hash `json:"state,omitempty"`
+		StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+	}
+	o := override{
+		Balance:   (*hexutil.Big)(a.Balance),
+		State:     a.State,
+		StateDiff: a.StateDiff,
+	}
+	if a.Nonce != nil {
+		nonce := hexutil.Uint64(*a.Nonce)
+		o.Nonce = &nonce
+	}
+	if a.Code != nil {
+		code := hexutil.Bytes(a.Code)
+		o.Code = &code
+	}
+	return json.Marshal(o)
+}
+
+// StateOverrides overrides state of accounts during simulation, by account address
+type StateOverrides map[common.Address]AccountOverride
+
+// SimulatedTransaction is the result of transaction simulation
+type SimulatedTransaction struct {
+	CommonData
+	From        common.Address     `json:"from"`
+	To          *common.Address    `json:"to,omitempty"`
+	Value       *big.Int           `json:"value,omitempty"`
+	ReturnData  hexutil.Bytes      `json:"return_data,omitempty"`
+	Reverted    bool               `json:"reverted"`
+	GasEstimate uint64             `json:"gas_estimate,omitempty"`
+	GasUsed     uint64             `json:"gas_used,omitempty"`
+	Events      []DecodedCommonLog `json:"events,omitempty"`
+	// Calls is decoded call tree, it's empty if node doesn't support 'debug_traceCall'
+	Calls []*DecodedCall `json:"calls,omitempty"`
+}
+
+// Simulate executes transaction on top of the latest block without sending it, so it doesn't spend gas nor change chain state.
+// Call should call a method of a Geth wrapper with given opts and return the transaction, e.g.
+//
+//	c.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+//		return contract.Set(opts, big.NewInt(1))
+//	}, nil)
+//
+// Transaction is sent from the root key, unless WithFrom option is used. Since it's never signed, it can be sent from any address.
+// Overrides are applied to the state before execution, e.g. to give the sender enough balance or to replace contract's code.
+// Returned simulation contains decoded inputs and outputs, gas estimate and, if node supports 'debug_traceCall', decoded call tree
+// with all emitted events. If transaction reverted the error returned will be revert error, together with the simulation.
+func (m *Client) Simulate(call func(opts *bind.TransactOpts) (*types.Transaction, error), overrides StateOverrides, o ...TransactOpt) (*SimulatedTransaction, error) {
+	if m.Tracer == nil {
+		return nil, errors.New(ErrSimulationNoRPC)
+	}
+
+	opts, err := m.newSimulationTXOpts(o...)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrSimulationTxPreparation)
+	}
+	tx, err := call(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrSimulationTxPreparation)
+	}
+
+	return m.SimulateCallMsg(ethereum.CallMsg{
+		From:  opts.From,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}, overrides)
+}
+
+// SimulateCallMsg executes call on top of the latest block with given overrides, see Simulate for details.
+// Gas price fields are ignored, so that sender doesn't need any balance to pay for gas.
+func (m *Client) SimulateCallMsg(msg ethereum.CallMsg, overrides StateOverrides) (*SimulatedTransaction, error) {
+	if m.Tracer == nil {
+		return nil, errors.New(ErrSimulationNoRPC)
+	}
+
+	msg.GasPrice, msg.GasFeeCap, msg.GasTipCap = nil, nil, nil
+	l := L.With().Str("From", msg.From.Hex()).Logger()
+	if msg.To != nil {
+		l = l.With().Str("To", msg.To.Hex()).Logger()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Cfg.Network.TxnTimeout.Duration())
+	defer cancel()
+
+	simulated := &SimulatedTransaction{
+		From:  msg.From,
+		To:    msg.To,
+		Value: msg.Value,
+	}
+
+	var revertErr error
+	returnData, callErr := m.Tracer.callWithOverrides(ctx, msg, overrides)
+	switch {
+	case callErr == nil:
+		simulated.ReturnData = returnData
+	case isRevertError(callErr):
+		simulated.Reverted = true
+		revertErr = callErr
+		decodedABIErrString, err := m.DecodeCustomABIErr(callErr)
+		if err != nil {
+			l.Debug().Err(err).Msg("Failed to decode custom revert reason")
+		}
+		if decodedABIErrString != "" {
+			revertErr = errors.New(decodedABIErrString)
+		}
+	default:
+		return nil, errors.Wrap(callErr, "failed to simulate transaction")
+	}
+
+	if !simulated.Reverted {
+		gas, err := m.Tracer.estimateGasWithOverrides(ctx, msg, overrides)
+		if err != nil {
+			l.Debug().Err(err).Msg("Failed to estimate gas of simulated transaction")
+		}
+		simulated.GasEstimate = gas
+	}
+
+	var decodedCalls []*DecodedCall
+	callTrace, err := m.Tracer.traceCallWithOverrides(ctx, msg, overrides)
+	if err != nil {
+		l.Debug().Err(err).Msg("Failed to trace simulated transaction. Call tree and events won't be available")
+	} else {
+		simulated.GasUsed = parseHexUint64(callTrace.GasUsed)
+		if len(msg.Data) >= 4 {
+			decodedCalls, err = m.Tracer.DecodeTrace(l, Trace{
+				TxHash:    simulationTraceKey(msg),
+				CallTrace: callTrace,
+			})
+			if err != nil {
+				l.Debug().Err(err).Msg("Failed to decode trace of simulated transaction")
+			}
+		}
+	}
+
+	if len(decodedCalls) > 0 {
+		simulated.CommonData = decodedCalls[0].CommonData
+		simulated.Calls = decodedCalls
+		for _, c := range decodedCalls {
+			simulated.Events = append(simulated.Events, c.Events...)
+		}
+	} else {
+		simulated.CommonData = m.decodeSimulatedCall(l, msg, simulated.ReturnData)
+	}
+	if revertErr != nil {
+		simulated.Error = revertErr.Error()
+	}
+
+	l.Debug().
+		Str("Method", simulated.Method).
+		Interface("Inputs", simulated.Input).
+		Interface("Outputs", simulated.Output).
+		Bool("Reverted", simulated.Reverted).
+		Uint64("Gas estimate", simulated.GasEstimate).
+		Int("Events", len(simulated.Events)).
+		Msg("Simulated transaction")
+
+	return simulated, revertErr
+}
+
+// newSimulationTXOpts returns opts that make Geth wrappers return unsigned transaction without sending it or calling the node
+func (m *Client) newSimulationTXOpts(o ...TransactOpt) (*bind.TransactOpts, error) {
+	opts := &bind.TransactOpts{
+		Nonce:    big.NewInt(0),
+		GasPrice: big.NewInt(0),
+		GasLimit: m.Cfg.Network.GasLimit,
+		Context:  context.Background(),
+	}
+	if len(m.Addresses) > 0 {
+		opts.From = m.Addresses[0]
+	}
+	for _, f := range o {
+		f(opts)
+	}
+	if opts.GasFeeCap != nil || opts.GasTipCap != nil {
+		opts.GasPrice = nil
+	}
+	opts.NoSend = true
+	opts.Signer = func(_ common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		return tx, nil
+	}
+
+	// gas estimation done by Geth wrappers wouldn't use state overrides, so we use block gas limit instead
+	if opts.GasLimit == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), m.Cfg.Network.TxnTimeout.Duration())
+		defer cancel()
+		header, err := m.Client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get latest block")
+		}
+		opts.GasLimit = header.GasLimit
+	}
+
+	return opts, nil
+}
+
+// decodeSimulatedCall decodes method, inputs and outputs of a call when trace is not available
+func (m *Client) decodeSimulatedCall(l zerolog.Logger, msg ethereum.CallMsg, returnData []byte) CommonData {
+	decoded := CommonData{
+		Signature: UNKNOWN,
+		Method:    UNKNOWN,
+	}
+	if len(msg.Data) < 4 || m.ABIFinder == nil || m.ContractStore == nil {
+		return decoded
+	}
+
+	address := UNKNOWN
+	if msg.To != nil {
+		address = msg.To.String()
+	}
+	abiResult, err := m.ABIFinder.FindABIByMethod(address, msg.Data[:4])
+	if err != nil {
+		l.Debug().Err(err).Msg("Failed to find ABI of simulated transaction")
+		return decoded
+	}
+	decoded.Signature = common.Bytes2Hex(abiResult.Method.ID)
+	decoded.Method = abiResult.Method.Sig
+
+	decoded.Input, err = decodeTxInputs(l, msg.Data, abiResult.Method)
+	if err != nil {
+		l.Debug().Err(err).Msg(ErrDecodeInput)
+	}
+	decoded.Output, err = decodeTxOutputs(l, returnData, abiResult.Method)
+	if err != nil {
+		l.Debug().Err(err).Msg(ErrDecodeOutput)
+	}
+	return decoded
+}
+
+// callWithOverrides executes 'eth_call' on top of the latest block
+func (t *Tracer) callWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides StateOverrides) (hexutil.Bytes, error) {
+	var result hexutil.Bytes
+	if err := t.call(ctx, &result, "eth_call", simulationParams(msg, overrides)...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// estimateGasWithOverrides executes 'eth_estimateGas' on top of the latest block
+func (t *Tracer) estimateGasWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides StateOverrides) (uint64, error) {
+	var result hexutil.Uint64
+	if err := t.call(ctx, &result, "eth_estimateGas", simulationParams(msg, overrides)...); err != nil {
+		return 0, err
+	}
+	return uint64(result), nil
+}
+
+// traceCallWithOverrides executes 'debug_traceCall' with call tracer on top of the latest block
+func (t *Tracer) traceCallWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides StateOverrides) (*TXCallTraceOutput, error) {
+	config := map[string]interface{}{
+		"tracer": "callTracer",
+		"tracerConfig": map[string]interface{}{
+			"withLog": true,
+		},
+	}
+	if len(overrides) > 0 {
+		config["stateOverrides"] = overrides
+	}
+	var trace *TXCallTraceOutput
+	if err := t.call(ctx, &trace, "debug_traceCall", toSimulationCallArg(msg), "latest", config); err != nil {
+		return nil, err
+	}
+	if trace == nil {
+		return nil, errors.New(ErrNoTrace)
+	}
+	return trace, nil
+}
+
+func simulationParams(msg ethereum.CallMsg, overrides StateOverrides) []interface{} {
+	params := []interface{}{toSimulationCallArg(msg), "latest"}
+	if len(overrides) > 0 {
+		params = append(params, overrides)
+	}
+	return params
+}
+
+func toSimulationCallArg(msg ethereum.CallMsg) interface{} {
+	arg := map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+	}
+	if len(msg.Data) > 0 {
+		arg["input"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	return arg
+}
+
+// simulationTraceKey returns key under which decoded calls of simulated transaction are saved, it's never a hash of a real transaction
+func simulationTraceKey(msg ethereum.CallMsg) string {
+	tx := types.NewTx(&types.LegacyTx{
+		To:    msg.To,
+		Value: msg.Value,
+		Gas:   msg.Gas,
+		Data:  msg.Data,
+	})
+	return simulationTracePrefix + tx.Hash().Hex()
+}
+
+func isRevertError(err error) bool {
+	//nolint
+	if dataErr, ok := err.(rpc.DataError); ok && dataErr.ErrorData() != nil {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "revert")
+}
+
+func parseHexUint64(s string) uint64 {
+	v, err := hexutil.DecodeUint64(s)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,303 @@
+package seth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/seth"
+	network_debug_contract "github.com/smartcontractkit/chainlink-testing-framework/seth/contracts/bind/NetworkDebugContract"
+	network_sub_contract "github.com/smartcontractkit/chainlink-testing-framework/seth/contracts/bind/NetworkDebugSubContract"
+)
+
+var (
+	simulationContract    = common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3")
+	simulationSubContract = common.HexToAddress("0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512")
+	simulationSender      = common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+)
+
+// fakeSimulationNode answers simulation calls as if NetworkDebugContract.trace(x, y) or NetworkDebugContract.alwaysRevertsCustomError() was called
+type fakeSimulationNode struct {
+	mu        sync.Mutex
+	overrides map[string]json.RawMessage
+	noTracing bool
+}
+
+func newFakeSimulationNode(t *testing.T) (*fakeSimulationNode, *fakeRPC) {
+	debugABI, err := network_debug_contract.NetworkDebugContractMetaData.GetAbi()
+	require.NoError(t, err, "failed to get ABI")
+	subABI, err := network_sub_contract.NetworkDebugSubContractMetaData.GetAbi()
+	require.NoError(t, err, "failed to get ABI")
+
+	f := &fakeSimulationNode{overrides: make(map[string]json.RawMessage)}
+	node := newFakeRPC(t)
+
+	// returns x and y of trace(x, y) call or error if it's a call that reverts
+	parseCall := func(method string, params []json.RawMessage) (*big.Int, *big.Int, error) {
+		var args struct {
+			Input hexutil.Bytes `json:"input"`
+		}
+		if err := json.Unmarshal(params[0], &args); err != nil {
+			return nil, nil, err
+		}
+		f.mu.Lock()
+		if len(params) > 2 && method != "debug_traceCall" {
+			f.overrides[method] = params[2]
+		}
+		if method == "debug_traceCall" {
+			var config struct {
+				StateOverrides json.RawMessage `json:"stateOverrides"`
+			}
+			if err := json.Unmarshal(params[2], &config); err != nil {
+				f.mu.Unlock()
+				return nil, nil, err
+			}
+			f.overrides[method] = config.StateOverrides
+		}
+		f.mu.Unlock()
+
+		revertErr := debugABI.Errors["CustomErr"]
+		if common.Bytes2Hex(args.Input[:4]) == common.Bytes2Hex(debugABI.Methods["alwaysRevertsCustomError"].ID) {
+			data, err := revertErr.Inputs.Pack(big.NewInt(12), big.NewInt(21))
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, fakeRPCDataError{message: "execution reverted", data: hexutil.Encode(append(revertErr.ID[:4], data...))}
+		}
+		values, err := debugABI.Methods["trace"].Inputs.Unpack(args.Input[4:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return values[0].(*big.Int), values[1].(*big.Int), nil
+	}
+
+	node.handlers.Store("eth_getBlockByNumber", fakeRPCHandler(func(_ []json.RawMessage) (interface{}, error) {
+		return &types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(0), GasLimit: 30_000_000}, nil
+	}))
+	node.handlers.Store("eth_call", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		x, y, err := parseCall("eth_call", params)
+		if err != nil {
+			return nil, err
+		}
+		out, err := debugABI.Methods["trace"].Outputs.Pack(new(big.Int).Add(x, new(big.Int).Add(y, big.NewInt(2))))
+		if err != nil {
+			return nil, err
+		}
+		return hexutil.Bytes(out), nil
+	}))
+	node.handlers.Store("eth_estimateGas", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		if _, _, err := parseCall("eth_estimateGas", params); err != nil {
+			return nil, err
+		}
+		return hexutil.Uint64(52_000), nil
+	}))
+	node.handlers.Store("debug_traceCall", fakeRPCHandler(func(params []json.RawMessage) (interface{}, error) {
+		f.mu.Lock()
+		noTracing := f.noTracing
+		f.mu.Unlock()
+		if noTracing {
+			return nil, errors.New("the method debug_traceCall does not exist/is not available")
+		}
+		x, y, err := parseCall("debug_traceCall", params)
+		if err != nil {
+			return nil, err
+		}
+		subInput, err := subABI.Pack("trace", x, y)
+		if err != nil {
+			return nil, err
+		}
+		subOutput, err := subABI.Methods["trace"].Outputs.Pack(new(big.Int).Add(x, new(big.Int).Add(y, big.NewInt(2))))
+		if err != nil {
+			return nil, err
+		}
+		input, err := debugABI.Pack("trace", x, y)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"from":    simulationSender,
+			"to":      simulationContract,
+			"type":    "CALL",
+			"gas":     "0x1c9c380",
+			"gasUsed": "0xc350",
+			"input":   hexutil.Encode(input),
+			"output":  hexutil.Encode(subOutput),
+			"calls": []interface{}{
+				map[string]interface{}{
+					"from":    simulationContract,
+					"to":      simulationSubContract,
+					"type":    "CALL",
+					"gas":     "0x1c9c380",
+					"gasUsed": "0x2710",
+					"input":   hexutil.Encode(subInput),
+					"output":  hexutil.Encode(subOutput),
+					"logs":    []interface{}{twoIndexEventLog(subABI, simulationSubContract, new(big.Int).Add(y, big.NewInt(2)), simulationContract)},
+				},
+			},
+			"logs": []interface{}{twoIndexEventLog(debugABI, simulationContract, y, simulationSender)},
+		}, nil
+	}))
+	return f, node
+}
+
+func twoIndexEventLog(a *abi.ABI, address common.Address, roundID *big.Int, startedBy common.Address) map[string]interface{} {
+	return map[string]interface{}{
+		"address": address,
+		"topics": []common.Hash{
+			a.Events["TwoIndexEvent"].ID,
+			common.BigToHash(roundID),
+			common.BytesToHash(startedBy.Bytes()),
+		},
+		"data": "0x",
+	}
+}
+
+func (f *fakeSimulationNode) receivedOverrides(method string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var overrides map[string]interface{}
+	_ = json.Unmarshal(f.overrides[method], &overrides)
+	return overrides
+}
+
+func newSimulationTestClient(t *testing.T, urls ...string) (*seth.Client, *network_debug_contract.NetworkDebugContract) {
+	client, err := seth.NewClientBuilder().
+		WithRpcUrls(urls).
+		WithReadOnlyMode().
+		WithGasPriceEstimations(false, 0, "", 0).
+		WithTracing(seth.TracingLevel_None, nil).
+		WithTransactionTimeout(10 * time.Second).
+		WithGethWrappersFolders([]string{"./contracts/bind"}).
+		Build()
+	require.NoError(t, err, "failed to build client")
+	t.Cleanup(client.CancelFunc)
+	client.ContractAddressToNameMap.AddContract(simulationContract.Hex(), "NetworkDebugContract")
+	client.ContractAddressToNameMap.AddContract(simulationSubContract.Hex(), "NetworkDebugSubContract")
+
+	contract, err := network_debug_contract.NewNetworkDebugContract(simulationContract, client.Client)
+	require.NoError(t, err, "failed to bind contract")
+	return client, contract
+}
+
+func TestSimulate(t *testing.T) {
+	node, rpc := newFakeSimulationNode(t)
+	client, contract := newSimulationTestClient(t, rpc.URL)
+
+	nonce := uint64(7)
+	overrides := seth.StateOverrides{
+		simulationSender: {Balance: big.NewInt(1_000_000_000_000_000_000), Nonce: &nonce},
+		simulationSubContract: {
+			Code:      []byte{0x60, 0x00},
+			StateDiff: map[common.Hash]common.Hash{common.HexToHash("0x1"): common.HexToHash("0x2")},
+		},
+	}
+	simulated, err := client.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Trace(opts, big.NewInt(2), big.NewInt(4))
+	}, overrides, seth.WithFrom(simulationSender))
+	require.NoError(t, err, "failed to simulate transaction")
+
+	require.False(t, simulated.Reverted, "transaction shouldn't revert")
+	require.Equal(t, simulationSender, simulated.From, "expected different sender")
+	require.Equal(t, "trace(int256,int256)", simulated.Method, "expected different method")
+	require.Equal(t, map[string]interface{}{"x": big.NewInt(2), "y": big.NewInt(4)}, simulated.Input, "expected different inputs")
+	require.Equal(t, map[string]interface{}{"0": big.NewInt(8)}, simulated.Output, "expected different outputs")
+	require.Equal(t, uint64(52_000), simulated.GasEstimate, "expected different gas estimate")
+	require.Equal(t, uint64(50_000), simulated.GasUsed, "expected different gas used")
+
+	require.Len(t, simulated.Calls, 2, "expected call to contract and to sub contract")
+	require.Equal(t, "NetworkDebugSubContract", simulated.Calls[1].To, "expected call to sub contract")
+	require.Equal(t, 1, simulated.Calls[1].NestingLevel, "expected nested call")
+	require.Len(t, simulated.Events, 2, "expected event from contract and from sub contract")
+	for _, e := range simulated.Events {
+		require.Equal(t, "TwoIndexEvent(uint256,address)", e.Signature, "expected different event")
+	}
+	require.Equal(t, big.NewInt(4), simulated.Events[0].EventData["roundId"], "expected different event data")
+	require.Equal(t, big.NewInt(6), simulated.Events[1].EventData["roundId"], "expected different event data")
+
+	for _, method := range []string{"eth_call", "eth_estimateGas", "debug_traceCall"} {
+		received := node.receivedOverrides(method)
+		require.Equal(t, map[string]interface{}{"balance": "0xde0b6b3a7640000", "nonce": "0x7"}, received[hexutil.Encode(simulationSender.Bytes())], "expected different sender override in %s", method)
+		require.Equal(t, map[string]interface{}{
+			"code":      "0x6000",
+			"stateDiff": map[string]interface{}{common.HexToHash("0x1").Hex(): common.HexToHash("0x2").Hex()},
+		}, received[hexutil.Encode(simulationSubContract.Bytes())], "expected different contract override in %s", method)
+	}
+}
+
+func TestSimulateWithoutTracing(t *testing.T) {
+	node, rpc := newFakeSimulationNode(t)
+	node.mu.Lock()
+	node.noTracing = true
+	node.mu.Unlock()
+	client, contract := newSimulationTestClient(t, rpc.URL)
+
+	simulated, err := client.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Trace(opts, big.NewInt(1), big.NewInt(1))
+	}, nil)
+	require.NoError(t, err, "failed to simulate transaction")
+	require.Equal(t, "trace(int256,int256)", simulated.Method, "method should be decoded without trace")
+	require.Equal(t, map[string]interface{}{"0": big.NewInt(4)}, simulated.Output, "outputs should be decoded without trace")
+	require.Empty(t, simulated.Calls, "call tree shouldn't be available")
+	require.Empty(t, node.receivedOverrides("eth_call"), "no overrides should be sent")
+}
+
+func TestSimulateFailsOverBetweenEndpoints(t *testing.T) {
+	_, rpc := newFakeSimulationNode(t)
+	down := newFakeRPC(t)
+	client, contract := newSimulationTestClient(t, down.URL, rpc.URL)
+	// the endpoint goes down after the client was created, so it's still considered healthy
+	down.failing.Store(true)
+
+	simulated, err := client.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.Trace(opts, big.NewInt(2), big.NewInt(4))
+	}, nil)
+	require.NoError(t, err, "failed to simulate transaction")
+	require.Len(t, simulated.Calls, 2, "call tree should be traced by the healthy endpoint")
+	require.False(t, client.Client.(*seth.MultiClient).Endpoints[0].Healthy(), "failed endpoint should be marked unhealthy")
+}
+
+func TestSimulateRevert(t *testing.T) {
+	_, rpc := newFakeSimulationNode(t)
+	client, contract := newSimulationTestClient(t, rpc.URL)
+
+	simulated, err := client.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return contract.AlwaysRevertsCustomError(opts)
+	}, nil)
+	require.Error(t, err, "expected revert error")
+	require.Equal(t, "error type: CustomErr, error values: [12 21]", err.Error(), "expected decoded custom error")
+	require.NotNil(t, simulated, "simulation should be returned together with revert error")
+	require.True(t, simulated.Reverted, "transaction should revert")
+	require.Equal(t, err.Error(), simulated.Error, "expected revert reason in simulation")
+	require.Equal(t, "alwaysRevertsCustomError()", simulated.Method, "expected different method")
+	require.Zero(t, simulated.GasEstimate, "reverted transaction has no gas estimate")
+}
+
+func TestSimulateDoesNotChangeState(t *testing.T) {
+	c := newClientWithContractMapFromEnv(t)
+
+	before, err := TestEnv.DebugContract.Get(c.NewCallOpts())
+	require.NoError(t, err, "failed to get stored value")
+
+	x := new(big.Int).Add(before, big.NewInt(1))
+	simulated, err := c.Simulate(func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return TestEnv.DebugContract.Set(opts, x)
+	}, nil)
+	require.NoError(t, err, "failed to simulate transaction")
+	require.Equal(t, "set(int256)", simulated.Method, "expected different method")
+	require.Equal(t, map[string]interface{}{"value": x}, simulated.Output, "expected different outputs")
+	require.Greater(t, simulated.GasEstimate, uint64(0), "expected gas estimate")
+
+	after, err := TestEnv.DebugContract.Get(c.NewCallOpts())
+	require.NoError(t, err, "failed to get stored value")
+	require.Equal(t, before, after, "simulation shouldn't change stored value")
+}
@@ -21,6 +21,7 @@ const (
 	ErrNoAbiFound             = "no ABI found in Contract Store"
 	ErrNoFourByteFound        = "no method signatures found in tracing data"
 	ErrInvalidMethodSignature = "no method signature found or it's not 4 bytes long"
+	ErrTracerNoRPCClient      = "tracer has no RPC client, tracers created for multiple URLs must be used with a Client"
 	WrnMissingCallTrace       = "This call was missing from call trace, but it's signature was present in 4bytes trace. Most data is missing; Call order remains unknown"
 
 	FAILED_TO_DECODE = "failed to decode"
@@ -30,9 +31,14 @@ const (
 	CommentMissingABI = "Call not decoded due to missing ABI instance"
 )
 
+// rpcCaller makes raw JSON-RPC calls, it's implemented by rpc.Client and MultiClient
+type rpcCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
 type Tracer struct {
 	Cfg                      *Config
-	rpcClient                *rpc.Client
+	rpcClient                rpcCaller
 	traces                   map[string]*Trace
 	Addresses                []common.Address
 	ContractStore            *ContractStore
@@ -126,12 +132,18 @@ type Call struct {
 	Calls   []Call     `json:"calls"`
 }
 
+// NewTracer creates a tracer connected to the network URL. With multiple URLs no connection is made, the tracer
+// uses MultiClient of the Client it's set on, so tracing calls fail over between endpoints like all other calls.
 func NewTracer(cs *ContractStore, abiFinder *ABIFinder, cfg *Config, contractAddressToNameMap ContractMap, addresses []common.Address) (*Tracer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.Network.DialTimeout.Duration())
-	defer cancel()
-	c, err := rpc.DialOptions(ctx, cfg.MustFirstNetworkURL(), rpc.WithHeaders(cfg.RPCHeaders))
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to '%s' due to: %w", cfg.MustFirstNetworkURL(), err)
+	var c rpcCaller
+	if len(cfg.Network.URLs) <= 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Network.DialTimeout.Duration())
+		defer cancel()
+		rpcClient, err := rpc.DialOptions(ctx, cfg.MustFirstNetworkURL(), rpc.WithHeaders(cfg.RPCHeaders))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to '%s' due to: %w", cfg.MustFirstNetworkURL(), err)
+		}
+		c = rpcClient
 	}
 
 	return &Tracer{
@@ -148,6 +160,14 @@ func NewTracer(cs *ContractStore, abiFinder *ABIFinder, cfg *Config, contractAdd
 	}, nil
 }
 
+// call makes a raw JSON-RPC call with the tracer client
+func (t *Tracer) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if t.rpcClient == nil {
+		return errors.New(ErrTracerNoRPCClient)
+	}
+	return t.rpcClient.CallContext(ctx, result, method, args...)
+}
+
 func (t *Tracer) TraceGethTX(txHash string) ([]*DecodedCall, error) {
 	fourByte, err := t.trace4Byte(txHash)
 	if err != nil {
@@ -191,7 +211,7 @@ func (t *Tracer) PrintTXTrace(txHash string) error {
 
 func (t *Tracer) trace4Byte(txHash string) (map[string]*TXFourByteMetadataOutput, error) {
 	var trace map[string]int
-	if err := t.rpcClient.Call(&trace, "debug_traceTransaction", txHash, map[string]interface{}{"tracer": "4byteTracer"}); err != nil {
+	if err := t.call(context.Background(), &trace, "debug_traceTransaction", txHash, map[string]interface{}{"tracer": "4byteTracer"}); err != nil {
 		return nil, err
 	}
 	out := make(map[string]*TXFourByteMetadataOutput)
@@ -208,7 +228,8 @@ func (t *Tracer) trace4Byte(txHash string) (map[string]*TXFourByteMetadataOutput
 
 func (t *Tracer) traceCallTracer(txHash string) (*TXCallTraceOutput, error) {
 	var trace *TXCallTraceOutput
-	if err := t.rpcClient.Call(
+	if err := t.call(
+		context.Background(),
 		&trace,
 		"debug_traceTransaction",
 		txHash,
@@ -225,7 +246,7 @@ func (t *Tracer) traceCallTracer(txHash string) (*TXCallTraceOutput, error) {
 
 func (t *Tracer) traceOpCodesTracer(txHash string) (map[string]interface{}, error) {
 	var trace map[string]interface{}
-	if err := t.rpcClient.Call(&trace, "debug_traceTransaction", txHash); err != nil {
+	if err := t.call(context.Background(), &trace, "debug_traceTransaction", txHash); err != nil {
 		return nil, err
 	}
 	return trace, nil
@@ -0,0 +1,343 @@
+package wasp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultAbortCheckInterval is how often conditions without a window are checked against the totals of the run
+	DefaultAbortCheckInterval = 1 * time.Second
+)
+
+var (
+	ErrAborted               = errors.New("load generation was aborted by an abort condition")
+	ErrInvalidAbortCondition = errors.New("invalid abort condition")
+)
+
+// AbortMetric is a live generator metric that can be checked by an AbortCondition
+type AbortMetric string
+
+const (
+	// AbortMetricErrorRate is the ratio of failed calls, including timeouts, to all calls, 0-1
+	AbortMetricErrorRate AbortMetric = "error_rate"
+	// AbortMetricFailures is the amount of failed calls, including timeouts
+	AbortMetricFailures AbortMetric = "failures"
+	// AbortMetricTimeouts is the amount of timed out calls
+	AbortMetricTimeouts AbortMetric = "timeouts"
+	// AbortMetricLatency is a latency percentile of calls
+	AbortMetricLatency AbortMetric = "latency"
+)
+
+// AbortCondition stops the load when a metric breaches its threshold, it is checked continuously against live Stats.
+// With Window set, the metric is computed only from calls finished in the last window, windows don't overlap,
+// without it the metric is computed from all calls of the run and checked every DefaultAbortCheckInterval.
+type AbortCondition struct {
+	Metric AbortMetric `json:"metric"`
+	// Threshold is the max error ratio for AbortMetricErrorRate, ex.: 0.05, or the max amount of calls for AbortMetricFailures and AbortMetricTimeouts
+	Threshold float64 `json:"threshold,omitempty"`
+	// Percentile is checked for AbortMetricLatency, ex.: 99
+	Percentile float64 `json:"percentile,omitempty"`
+	// Latency is the max latency for AbortMetricLatency
+	Latency time.Duration `json:"latency,omitempty"`
+	// Group checks latency of a single Response.Group, all calls are checked if empty
+	Group string `json:"group,omitempty"`
+	// Window is the duration of a single evaluation window
+	Window time.Duration `json:"window,omitempty"`
+	// ConsecutiveWindows is the amount of consecutive breached windows required to abort, default is 1
+	ConsecutiveWindows int `json:"consecutive_windows,omitempty"`
+	// MinCalls is the amount of calls required in a window to check error rate or latency, so a few calls can't trigger it
+	MinCalls int64 `json:"min_calls,omitempty"`
+}
+
+// ErrorRateAbove aborts when the error rate of calls in a window is higher than ratio, ex.: 0.05 for 5%.
+func ErrorRateAbove(ratio float64, window time.Duration) *AbortCondition {
+	return &AbortCondition{Metric: AbortMetricErrorRate, Threshold: ratio, Window: window}
+}
+
+// LatencyAbove aborts when a latency percentile of calls is higher than latency for a number of consecutive windows.
+func LatencyAbove(percentile float64, latency time.Duration, window time.Duration, consecutiveWindows int) *AbortCondition {
+	return &AbortCondition{
+		Metric:             AbortMetricLatency,
+		Percentile:         percentile,
+		Latency:            latency,
+		Window:             window,
+		ConsecutiveWindows: consecutiveWindows,
+	}
+}
+
+// FailuresAbove aborts when the run has more than n failed calls.
+func FailuresAbove(n int64) *AbortCondition {
+	return &AbortCondition{Metric: AbortMetricFailures, Threshold: float64(n)}
+}
+
+// TimeoutsAbove aborts when the run has more than n timed out calls.
+func TimeoutsAbove(n int64) *AbortCondition {
+	return &AbortCondition{Metric: AbortMetricTimeouts, Threshold: float64(n)}
+}
+
+// Validate checks the condition fields and sets the default amount of consecutive windows.
+func (m *AbortCondition) Validate() error {
+	if m == nil {
+		return errors.Wrap(ErrInvalidAbortCondition, "condition is nil")
+	}
+	if m.Window < 0 {
+		return errors.Wrap(ErrInvalidAbortCondition, "window must be >= 0")
+	}
+	if m.ConsecutiveWindows < 0 {
+		return errors.Wrap(ErrInvalidAbortCondition, "consecutive windows must be >= 0")
+	}
+	if m.ConsecutiveWindows == 0 {
+		m.ConsecutiveWindows = 1
+	}
+	switch m.Metric {
+	case AbortMetricErrorRate:
+		if m.Threshold < 0 || m.Threshold >= 1 {
+			return errors.Wrap(ErrInvalidAbortCondition, "error rate threshold must be in [0, 1)")
+		}
+	case AbortMetricFailures, AbortMetricTimeouts:
+		if m.Threshold < 0 {
+			return errors.Wrapf(ErrInvalidAbortCondition, "%s threshold must be >= 0", m.Metric)
+		}
+	case AbortMetricLatency:
+		if m.Percentile <= 0 || m.Percentile > 100 {
+			return errors.Wrap(ErrInvalidAbortCondition, "latency percentile must be in (0, 100]")
+		}
+		if m.Latency <= 0 {
+			return errors.Wrap(ErrInvalidAbortCondition, "latency must be > 0")
+		}
+	default:
+		return errors.Wrapf(ErrInvalidAbortCondition, "unknown metric %q, use error_rate, failures, timeouts or latency", m.Metric)
+	}
+	return nil
+}
+
+// String describes the condition, ex.: "p99 latency > 2s for 3 consecutive 10s windows"
+func (m *AbortCondition) String() string {
+	var sb strings.Builder
+	switch m.Metric {
+	case AbortMetricErrorRate:
+		sb.WriteString(fmt.Sprintf("error rate > %.2f%%", m.Threshold*100))
+	case AbortMetricLatency:
+		sb.WriteString(fmt.Sprintf("p%s latency", formatPercentile(m.Percentile)))
+		if m.Group != "" {
+			sb.WriteString(fmt.Sprintf(" of group %s", m.Group))
+		}
+		sb.WriteString(fmt.Sprintf(" > %s", m.Latency))
+	default:
+		sb.WriteString(fmt.Sprintf("%s > %d", m.Metric, int64(m.Threshold)))
+	}
+	switch {
+	case m.Window > 0 && m.ConsecutiveWindows > 1:
+		sb.WriteString(fmt.Sprintf(" for %d consecutive %s windows", m.ConsecutiveWindows, m.Window))
+	case m.Window > 0:
+		sb.WriteString(fmt.Sprintf(" over %s window", m.Window))
+	}
+	return sb.String()
+}
+
+func formatPercentile(p float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", p), "0"), ".")
+}
+
+// AbortError is the structured reason of an aborted run, use errors.As to get it from Profile.Run
+type AbortError struct {
+	// GenName is the name of the generator that breached the condition
+	GenName   string          `json:"gen_name"`
+	Condition *AbortCondition `json:"condition"`
+	// Value is the observed error ratio or amount of calls, for latency it's the observed latency in nanoseconds
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("generator %s aborted, %s: observed %s", e.GenName, e.Condition, e.observed())
+}
+
+// Is makes errors.Is(err, ErrAborted) work for any AbortError
+func (e *AbortError) Is(target error) bool {
+	return target == ErrAborted
+}
+
+func (e *AbortError) observed() string {
+	return e.Condition.formatValue(e.Value)
+}
+
+// formatValue formats an observed metric value, error rate as percentage and latency as duration
+func (m *AbortCondition) formatValue(v float64) string {
+	switch m.Metric {
+	case AbortMetricErrorRate:
+		return fmt.Sprintf("%.2f%%", v*100)
+	case AbortMetricLatency:
+		return time.Duration(v).String()
+	default:
+		return fmt.Sprint(int64(v))
+	}
+}
+
+// statsWindow is the state of the live Stats at the start or the end of an evaluation window
+type statsWindow struct {
+	success  int64
+	failed   int64
+	timeouts int64
+	latency  *hdrhistogram.Snapshot
+}
+
+// statsWindow captures live Stats counters, with latencies of a single Response.Group, or of all calls if group is empty
+func (g *Generator) statsWindow(withLatency bool, group string) *statsWindow {
+	s := &statsWindow{
+		success:  g.stats.Success.Load(),
+		failed:   g.stats.Failed.Load(),
+		timeouts: g.stats.CallTimeout.Load(),
+	}
+	if withLatency {
+		s.latency = g.stats.Latencies.histogramSnapshot(group)
+	}
+	return s
+}
+
+func (g *Generator) abortWindowState(c *AbortCondition) *statsWindow {
+	return g.statsWindow(c.Metric == AbortMetricLatency, c.Group)
+}
+
+// latencies returns the histogram of calls finished between the start and the end state
+func (s *statsWindow) latencies(end *statsWindow) *hdrhistogram.Histogram {
+	return hdrhistogram.Import(subtractHDRSnapshots(end.latency, s.latency))
+}
+
+// evaluate returns the metric value computed from the calls finished since the start state and whether it was computed,
+// error rate and latency are not computed if there were less than MinCalls calls
+func (s *statsWindow) evaluate(c *AbortCondition, end *statsWindow) (float64, bool) {
+	success := end.success - s.success
+	failed := end.failed - s.failed
+	switch c.Metric {
+	case AbortMetricErrorRate:
+		total := success + failed
+		if total == 0 || total < c.MinCalls {
+			return 0, false
+		}
+		return float64(failed) / float64(total), true
+	case AbortMetricFailures:
+		return float64(failed), true
+	case AbortMetricTimeouts:
+		return float64(end.timeouts - s.timeouts), true
+	case AbortMetricLatency:
+		h := s.latencies(end)
+		if h.TotalCount() == 0 || h.TotalCount() < c.MinCalls {
+			return 0, false
+		}
+		return float64(time.Duration(h.ValueAtQuantile(c.Percentile)) * time.Microsecond), true
+	}
+	return 0, false
+}
+
+func (c *AbortCondition) breached(value float64) bool {
+	if c.Metric == AbortMetricLatency {
+		return value > float64(c.Latency)
+	}
+	return value > c.Threshold
+}
+
+// checkAbortConditions starts a background loop for every abort condition, it stops the run on the first breach.
+func (g *Generator) checkAbortConditions() {
+	for _, c := range g.abortConditions {
+		c := c
+		g.ResponsesWaitGroup.Add(1)
+		go func() {
+			defer g.ResponsesWaitGroup.Done()
+			interval := c.Window
+			if interval == 0 {
+				interval = DefaultAbortCheckInterval
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			// without a window all the calls of the run are checked
+			start := &statsWindow{}
+			if c.Window > 0 {
+				start = g.abortWindowState(c)
+			}
+			breaches := 0
+			for {
+				select {
+				case <-g.ResponsesCtx.Done():
+					return
+				case <-ticker.C:
+					end := g.abortWindowState(c)
+					value, ok := start.evaluate(c, end)
+					if c.Window > 0 {
+						start = end
+					}
+					if !ok || !c.breached(value) {
+						breaches = 0
+						continue
+					}
+					breaches++
+					g.Log.Warn().
+						Str("Condition", c.String()).
+						Float64("Value", value).
+						Int("Breaches", breaches).
+						Msg("Abort condition breached")
+					if breaches < c.ConsecutiveWindows {
+						continue
+					}
+					err := &AbortError{GenName: g.Cfg.GenName, Condition: c, Value: value, Time: time.Now()}
+					if g.abort(err) && g.onAbort != nil {
+						g.onAbort(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+}
+
+// abort stops the generator without waiting for it, so it's safe to call from the generator's own goroutines.
+// It returns false if the generator was already aborted.
+func (g *Generator) abort(err *AbortError) bool {
+	if !g.abortErr.CompareAndSwap(nil, err) {
+		return false
+	}
+	g.Log.Error().Err(err).Msg("Generator was aborted")
+	g.stats.RunStopped.Store(true)
+	g.stats.RunFailed.Store(true)
+	g.responsesCancel()
+	g.callsCancel()
+	return true
+}
+
+// Aborted returns the reason the generator was aborted, or nil if no abort condition was breached.
+func (g *Generator) Aborted() *AbortError {
+	return g.abortErr.Load()
+}
+
+// WithAbortConditions adds abort conditions checked for every generator of the profile,
+// when any generator breaches a condition all the generators are stopped and Run returns an *AbortError.
+func (m *Profile) WithAbortConditions(conditions ...*AbortCondition) *Profile {
+	for _, c := range conditions {
+		if err := c.Validate(); err != nil {
+			m.bootstrapErr = err
+			return m
+		}
+	}
+	m.abortConditions = append(m.abortConditions, conditions...)
+	return m
+}
+
+// Aborted returns the reason the profile was aborted, or nil if no abort condition was breached.
+func (m *Profile) Aborted() *AbortError {
+	return m.abortErr.Load()
+}
+
+// abort stops all the generators of the profile, the first breach is kept as the reason.
+func (m *Profile) abort(err *AbortError) {
+	if !m.abortErr.CompareAndSwap(nil, err) {
+		return
+	}
+	for _, g := range m.Generators {
+		g.abort(err)
+	}
+}
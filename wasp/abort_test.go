@@ -0,0 +1,179 @@
+package wasp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmokeAbortConditionValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		c    *AbortCondition
+		err  bool
+	}{
+		{name: "error rate", c: ErrorRateAbove(0.05, 30*time.Second)},
+		{name: "latency", c: LatencyAbove(99, 2*time.Second, 10*time.Second, 3)},
+		{name: "timeouts", c: TimeoutsAbove(10)},
+		{name: "failures", c: FailuresAbove(0)},
+		{name: "error rate is a ratio", c: ErrorRateAbove(5, time.Second), err: true},
+		{name: "latency must be set", c: LatencyAbove(99, 0, time.Second, 1), err: true},
+		{name: "percentile out of range", c: LatencyAbove(101, time.Second, time.Second, 1), err: true},
+		{name: "unknown metric", c: &AbortCondition{Metric: "rps"}, err: true},
+		{name: "negative window", c: ErrorRateAbove(0.05, -time.Second), err: true},
+	}
+	for _, tc := range tests {
+		err := tc.c.Validate()
+		if tc.err {
+			require.ErrorIs(t, err, ErrInvalidAbortCondition, tc.name)
+		} else {
+			require.NoError(t, err, tc.name)
+			require.GreaterOrEqual(t, tc.c.ConsecutiveWindows, 1, tc.name)
+		}
+	}
+	require.Equal(t, "p99 latency > 2s for 3 consecutive 10s windows", LatencyAbove(99, 2*time.Second, 10*time.Second, 3).String())
+	require.Equal(t, "error rate > 5.00% over 30s window", ErrorRateAbove(0.05, 30*time.Second).String())
+	require.Equal(t, "timeouts > 10", TimeoutsAbove(10).String())
+
+	_, err := NewGenerator(&Config{
+		LoadType:        RPS,
+		Schedule:        Plain(1, time.Second),
+		Gun:             NewMockGun(&MockGunConfig{}),
+		AbortConditions: []*AbortCondition{ErrorRateAbove(2, time.Second)},
+	})
+	require.ErrorIs(t, err, ErrInvalidAbortCondition)
+}
+
+func TestSmokeAbortProfileOnErrorRate(t *testing.T) {
+	t.Parallel()
+	failing, err := NewGenerator(&Config{
+		T:        t,
+		GenName:  "failing",
+		LoadType: RPS,
+		Schedule: Plain(50, 20*time.Second),
+		Gun: NewMockGun(&MockGunConfig{
+			FailRatio: 50,
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	healthy, err := NewGenerator(&Config{
+		T:        t,
+		GenName:  "healthy",
+		LoadType: VU,
+		Schedule: Plain(2, 20*time.Second),
+		VU: NewMockVU(&MockVirtualUserConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	p, err := NewProfile().
+		Add(failing, nil).
+		Add(healthy, nil).
+		WithAbortConditions(ErrorRateAbove(0.2, 1*time.Second)).
+		Run(true)
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.ErrorIs(t, err, ErrAborted)
+	var abortErr *AbortError
+	require.True(t, errors.As(err, &abortErr))
+	require.Equal(t, "failing", abortErr.GenName)
+	require.Equal(t, AbortMetricErrorRate, abortErr.Condition.Metric)
+	require.Greater(t, abortErr.Value, 0.2)
+	require.Equal(t, abortErr, p.Aborted())
+	// all the generators are stopped with the same reason
+	for _, g := range p.Generators {
+		require.Equal(t, abortErr, g.Aborted())
+		require.True(t, g.Stats().RunStopped.Load())
+		require.True(t, g.Stats().RunFailed.Load())
+	}
+}
+
+func TestSmokeAbortOnConsecutiveLatencyWindows(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Plain(20, 20*time.Second),
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 50 * time.Millisecond,
+		}),
+		AbortConditions: []*AbortCondition{
+			LatencyAbove(99, 20*time.Millisecond, 500*time.Millisecond, 3),
+		},
+	})
+	require.NoError(t, err)
+	start := time.Now()
+	_, failed := gen.Run(true)
+	require.True(t, failed)
+	// three windows must be breached before the abort
+	require.GreaterOrEqual(t, time.Since(start), 1500*time.Millisecond)
+	require.Less(t, time.Since(start), 10*time.Second)
+	abortErr := gen.Aborted()
+	require.NotNil(t, abortErr)
+	require.GreaterOrEqual(t, time.Duration(abortErr.Value), 50*time.Millisecond)
+}
+
+func TestSmokeAbortOnTimeouts(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:           t,
+		LoadType:    RPS,
+		CallTimeout: 25 * time.Millisecond,
+		Schedule:    Plain(20, 20*time.Second),
+		Gun: NewMockGun(&MockGunConfig{
+			TimeoutRatio: 50,
+			CallSleep:    10 * time.Millisecond,
+		}),
+		AbortConditions: []*AbortCondition{TimeoutsAbove(5)},
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.True(t, failed)
+	abortErr := gen.Aborted()
+	require.NotNil(t, abortErr)
+	require.Greater(t, abortErr.Value, float64(5))
+	require.Greater(t, gen.Stats().CallTimeout.Load(), int64(5))
+}
+
+func TestSmokeAbortConditionNotBreached(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Plain(10, 2*time.Second),
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+		AbortConditions: []*AbortCondition{
+			ErrorRateAbove(0.05, 500*time.Millisecond),
+			LatencyAbove(99, 1*time.Second, 500*time.Millisecond, 1),
+		},
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	require.Nil(t, gen.Aborted())
+}
+
+func TestSmokeAbortConditionsAttachedOncePerRun(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:               t,
+		LoadType:        RPS,
+		Schedule:        Plain(1, time.Second),
+		Gun:             NewMockGun(&MockGunConfig{}),
+		AbortConditions: []*AbortCondition{TimeoutsAbove(10)},
+	})
+	require.NoError(t, err)
+	p := NewProfile().WithAbortConditions(ErrorRateAbove(0.05, time.Second)).Add(gen, nil)
+	p.attachAbortConditions()
+	p.attachAbortConditions()
+	require.Len(t, gen.abortConditions, 2)
+	require.Equal(t, AbortMetricTimeouts, gen.abortConditions[0].Metric)
+	require.Equal(t, AbortMetricErrorRate, gen.abortConditions[1].Metric)
+}
@@ -0,0 +1,306 @@
+package wasp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// AgentConfig configures an Agent
+type AgentConfig struct {
+	// ListenAddr is the address of the agent API, use "127.0.0.1:0" for a random local port
+	ListenAddr string
+	// ID identifies the agent in the stats, a random one is used if it's empty
+	ID string
+}
+
+// Agent runs a part of a distributed profile, it's controlled by a Coordinator with a JSON API over HTTP:
+//   - POST /v1/prepare creates the generators of the profile sent by the coordinator
+//   - POST /v1/start runs them at the requested time
+//   - POST /v1/pause, /v1/resume and /v1/stop control the running profile
+//   - GET /v1/stats returns the agent state and live generator stats
+//
+// Guns and VUs used by the profile must be registered in the agent process, see RegisterGun and RegisterVU.
+// An agent runs one profile at a time, a new one can be prepared when the previous run has finished.
+type Agent struct {
+	cfg        *AgentConfig
+	lis        net.Listener
+	srv        *http.Server
+	mu         *sync.Mutex
+	state      AgentState
+	runID      string
+	profile    *Profile
+	startTimer *time.Timer
+	err        error
+	// released is set when the resources of profile were freed, see releaseProfile
+	released bool
+}
+
+// NewAgent listens on the configured address, use Run to start serving.
+func NewAgent(cfg *AgentConfig) (*Agent, error) {
+	if cfg == nil {
+		cfg = &AgentConfig{}
+	}
+	if cfg.ID == "" {
+		cfg.ID = uuid.NewString()[0:8]
+	}
+	lis, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{
+		cfg:   cfg,
+		lis:   lis,
+		mu:    &sync.Mutex{},
+		state: AgentStateIdle,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/prepare", a.handlePrepare)
+	mux.HandleFunc("POST /v1/start", a.handleStart)
+	mux.HandleFunc("POST /v1/pause", a.handleControl(func(p *Profile) { p.Pause() }))
+	mux.HandleFunc("POST /v1/resume", a.handleControl(func(p *Profile) { p.Resume() }))
+	mux.HandleFunc("POST /v1/stop", a.handleStop)
+	mux.HandleFunc("GET /v1/stats", a.handleStats)
+	a.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return a, nil
+}
+
+// Run starts serving the agent API in a separate goroutine.
+func (a *Agent) Run() {
+	go func() {
+		if err := a.srv.Serve(a.lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Err(err).Str("Addr", a.Addr()).Msg("Agent server failed")
+		}
+	}()
+}
+
+// Addr returns the address the agent listens on.
+func (a *Agent) Addr() string {
+	return a.lis.Addr().String()
+}
+
+// ID returns the agent ID.
+func (a *Agent) ID() string {
+	return a.cfg.ID
+}
+
+// Shutdown stops the running profile, releases its sinks and stops the agent API.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	a.stop()
+	a.mu.Lock()
+	a.releaseProfile()
+	a.mu.Unlock()
+	return a.srv.Shutdown(ctx)
+}
+
+// Status returns the agent state and the live stats of its generators.
+func (a *Agent) Status() *AgentStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := &AgentStatus{
+		ID:         a.cfg.ID,
+		RunID:      a.runID,
+		State:      a.state,
+		Generators: make([]*GeneratorStatus, 0),
+	}
+	if a.err != nil {
+		s.Error = a.err.Error()
+	}
+	if a.profile != nil {
+		for _, g := range a.profile.Generators {
+			s.Generators = append(s.Generators, NewGeneratorStatus(g))
+		}
+	}
+	return s
+}
+
+func (a *Agent) prepare(req *AgentPrepareRequest) error {
+	if req.Profile == nil {
+		return fmt.Errorf("profile is empty")
+	}
+	if err := req.Profile.Validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == AgentStatePrepared || a.state == AgentStateRunning {
+		return ErrAgentBusy
+	}
+	// sinks of the previous run are kept until now, so its final metrics can still be scraped
+	a.releaseProfile()
+	p, err := req.Profile.NewProfile(nil)
+	if err != nil {
+		return err
+	}
+	a.profile = p
+	a.released = false
+	a.runID = req.RunID
+	a.err = nil
+	a.state = AgentStatePrepared
+	log.Info().Str("RunID", a.runID).Int("Generators", len(p.Generators)).Msg("Agent prepared the profile")
+	return nil
+}
+
+func (a *Agent) start(req *AgentStartRequest) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state != AgentStatePrepared || req.RunID != a.runID {
+		return errors.Wrapf(ErrAgentState, "can't start run %s, agent is %s with run %s", req.RunID, a.state, a.runID)
+	}
+	p := a.profile
+	delay := time.Until(req.StartAt)
+	log.Info().Str("RunID", a.runID).Time("StartAt", req.StartAt).Dur("In", delay).Msg("Agent scheduled the profile start")
+	a.startTimer = time.AfterFunc(delay, func() {
+		a.mu.Lock()
+		if a.state != AgentStatePrepared {
+			a.mu.Unlock()
+			return
+		}
+		a.state = AgentStateRunning
+		a.mu.Unlock()
+		_, err := p.Run(true)
+		a.mu.Lock()
+		a.err = err
+		a.state = AgentStateFinished
+		a.mu.Unlock()
+		log.Info().Str("RunID", req.RunID).Msg("Agent finished the profile")
+	})
+	return nil
+}
+
+// stop cancels a scheduled start or stops the running profile
+func (a *Agent) stop() {
+	a.mu.Lock()
+	switch a.state {
+	case AgentStatePrepared:
+		if a.startTimer != nil {
+			a.startTimer.Stop()
+		}
+		// generators were never run, so nothing else would stop their Loki clients and close their sinks
+		for _, g := range a.profile.Generators {
+			g.responsesCancel()
+			g.callsCancel()
+			g.dataCancel()
+			g.stopLokiStream()
+		}
+		a.releaseProfile()
+		a.state = AgentStateFinished
+		a.mu.Unlock()
+		return
+	case AgentStateRunning:
+		p := a.profile
+		a.mu.Unlock()
+		p.Stop()
+		return
+	default:
+		a.mu.Unlock()
+	}
+}
+
+// releaseProfile closes the results files and shuts down the metrics servers of the profile sinks,
+// so the next profile prepared on the agent can open the same file and listen on the same port, must be called with a.mu held
+func (a *Agent) releaseProfile() {
+	if a.profile == nil || a.released {
+		return
+	}
+	a.released = true
+	released := make(map[ResultsSink]bool)
+	for _, g := range a.profile.Generators {
+		for _, s := range g.Cfg.Sinks {
+			if released[s] {
+				continue
+			}
+			released[s] = true
+			var err error
+			switch sink := s.(type) {
+			case interface{ Close() error }:
+				err = sink.Close()
+			case interface {
+				Shutdown(ctx context.Context) error
+			}:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				err = sink.Shutdown(ctx)
+				cancel()
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("RunID", a.runID).Msg("Failed to release a sink")
+			}
+		}
+	}
+}
+
+func (a *Agent) handlePrepare(w http.ResponseWriter, r *http.Request) {
+	req := &AgentPrepareRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.prepare(req); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, ErrAgentBusy) {
+			code = http.StatusConflict
+		}
+		writeJSONError(w, code, err)
+		return
+	}
+	writeJSON(w, &AgentPrepareResponse{ID: a.cfg.ID, Time: time.Now()})
+}
+
+func (a *Agent) handleStart(w http.ResponseWriter, r *http.Request) {
+	req := &AgentStartRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.start(req); err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, a.Status())
+}
+
+func (a *Agent) handleControl(fn func(p *Profile)) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		a.mu.Lock()
+		p, state := a.profile, a.state
+		a.mu.Unlock()
+		if p == nil || (state != AgentStatePrepared && state != AgentStateRunning) {
+			writeJSONError(w, http.StatusConflict, errors.Wrapf(ErrAgentState, "agent is %s", state))
+			return
+		}
+		fn(p)
+		writeJSON(w, a.Status())
+	}
+}
+
+func (a *Agent) handleStop(w http.ResponseWriter, _ *http.Request) {
+	// stop waits for the generators, so the response has the final stats
+	a.stop()
+	writeJSON(w, a.Status())
+}
+
+func (a *Agent) handleStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, a.Status())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Err(err).Msg("Failed to write JSON response")
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	//nolint
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,78 @@
+package wasp
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/ratelimit"
+)
+
+// scheduledLimiter is a ratelimit.Limiter that issues calls on an absolute timeline,
+// every Take returns the time the call was scheduled at, even if the caller is late
+type scheduledLimiter struct {
+	mu       *sync.Mutex
+	next     time.Time
+	interval func() time.Duration
+}
+
+// newUniformLimiter creates a limiter that lets through 'rate' calls per 'per' duration with equal intervals.
+// Unlike ratelimit.WithoutSlack the late call keeps the time it was scheduled at, so it can be used to correct
+// coordinated omission. Catch-up after a stall is capped at one interval, see scheduledLimiter.take.
+func newUniformLimiter(rate int64, per time.Duration) ratelimit.Limiter {
+	mean := per / time.Duration(rate)
+	return &scheduledLimiter{
+		mu: &sync.Mutex{},
+		interval: func() time.Duration {
+			return mean
+		},
+	}
+}
+
+// newPoissonLimiter creates a limiter that lets through 'rate' calls per 'per' duration on average.
+// Intervals between calls follow an exponential distribution, which makes arrivals a Poisson process.
+func newPoissonLimiter(rate int64, per time.Duration) ratelimit.Limiter {
+	mean := per / time.Duration(rate)
+	//nolint
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &scheduledLimiter{
+		mu: &sync.Mutex{},
+		interval: func() time.Duration {
+			return time.Duration(rnd.ExpFloat64() * float64(mean))
+		},
+	}
+}
+
+// Take blocks until the next scheduled arrival and returns the time it was scheduled at.
+func (m *scheduledLimiter) Take() time.Time {
+	next, _ := m.take()
+	return next
+}
+
+// take blocks until the next scheduled arrival and returns the time it was scheduled at together with the arrivals skipped before it.
+// Arrivals are scheduled on an absolute timeline, so a slightly late caller does not reduce the overall rate.
+// After a longer stall the late call is let through right away with its scheduled time, but the timeline is moved
+// so that at most one interval's worth of calls is owed, otherwise a slow caller would cause a burst far above the rate.
+// Arrivals dropped by moving the timeline are returned, so the caller can account for them instead of omitting them.
+func (m *scheduledLimiter) take() (time.Time, []time.Time) {
+	m.mu.Lock()
+	now := time.Now()
+	if m.next.IsZero() {
+		m.next = now
+	}
+	interval := m.interval()
+	m.next = m.next.Add(interval)
+	next := m.next
+	var skipped []time.Time
+	if floor := now.Add(-interval); m.next.Before(floor) {
+		for t := m.next.Add(m.interval()); !t.After(floor); t = t.Add(m.interval()) {
+			skipped = append(skipped, t)
+		}
+		m.next = floor
+	}
+	m.mu.Unlock()
+	if d := next.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+	return next, skipped
+}
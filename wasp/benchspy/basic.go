@@ -3,6 +3,7 @@ package benchspy
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/pkg/errors"
@@ -44,12 +45,13 @@ func NewBasicData(commitOrTag string, generators ...*wasp.Generator) (*BasicData
 		return nil, errors.New("at least one generator is required")
 	}
 
-	if generators[0].Cfg.T == nil {
+	testName := generatorTestName(generators[0])
+	if testName == "" {
 		return nil, errors.New("generators are not associated with a testing.T instance. Please set it as generator.Cfg.T and try again")
 	}
 
 	b := &BasicData{
-		TestName:         generators[0].Cfg.T.Name(),
+		TestName:         testName,
 		CommitOrTag:      commitOrTag,
 		GeneratorConfigs: make(map[string]*wasp.Config),
 	}
@@ -69,6 +71,15 @@ func NewBasicData(commitOrTag string, generators ...*wasp.Generator) (*BasicData
 	return b, nil
 }
 
+// generatorTestName returns the name of the test the generator was run in,
+// generators loaded from a results file have no testing.T, but keep it in the go_test_name label
+func generatorTestName(g *wasp.Generator) string {
+	if g.Cfg.T != nil {
+		return g.Cfg.T.Name()
+	}
+	return g.Cfg.Labels["go_test_name"]
+}
+
 // FillStartEndTimes calculates the earliest start time and latest end time from generator schedules.
 // It updates the BasicData instance with these times, ensuring all segments have valid start and end times.
 func (b *BasicData) FillStartEndTimes() error {
@@ -174,6 +185,14 @@ func compareGeneratorConfigs(cfg1, cfg2 *wasp.Config) error {
 		return fmt.Errorf("load types are different. Expected %s, got %s", cfg1.LoadType, cfg2.LoadType)
 	}
 
+	if cfg1.CapacitySearch != nil || cfg2.CapacitySearch != nil {
+		// capacity search schedule depends on the results, so only the search configs are compared
+		if !reflect.DeepEqual(cfg1.CapacitySearch, cfg2.CapacitySearch) {
+			return fmt.Errorf("capacity search configs are different. Expected %s, got %s", mustMarshallJSON(cfg1.CapacitySearch), mustMarshallJSON(cfg2.CapacitySearch))
+		}
+		return compareGeneratorRunConfigs(cfg1, cfg2)
+	}
+
 	if len(cfg1.Schedule) != len(cfg2.Schedule) {
 		return fmt.Errorf("schedules are different. Expected %d, got %d", len(cfg1.Schedule), len(cfg2.Schedule))
 	}
@@ -195,6 +214,10 @@ func compareGeneratorConfigs(cfg1, cfg2 *wasp.Config) error {
 		}
 	}
 
+	return compareGeneratorRunConfigs(cfg1, cfg2)
+}
+
+func compareGeneratorRunConfigs(cfg1, cfg2 *wasp.Config) error {
 	if cfg1.CallTimeout != cfg2.CallTimeout {
 		return fmt.Errorf("call timeouts are different. Expected %s, got %s", cfg1.CallTimeout, cfg2.CallTimeout)
 	}
@@ -203,14 +226,22 @@ func compareGeneratorConfigs(cfg1, cfg2 *wasp.Config) error {
 		return fmt.Errorf("rate limit unit durations are different. Expected %s, got %s", cfg1.RateLimitUnitDuration, cfg2.RateLimitUnitDuration)
 	}
 
+	if cfg1.CorrectCoordinatedOmission != cfg2.CorrectCoordinatedOmission {
+		return fmt.Errorf("coordinated omission corrections are different. Expected %t, got %t", cfg1.CorrectCoordinatedOmission, cfg2.CorrectCoordinatedOmission)
+	}
+
 	return nil
 }
 
 func mustMarshallSegment(segment *wasp.Segment) string {
-	segmentBytes, err := json.MarshalIndent(segment, "", " ")
+	return mustMarshallJSON(segment)
+}
+
+func mustMarshallJSON(v interface{}) string {
+	b, err := json.MarshalIndent(v, "", " ")
 	if err != nil {
 		panic(err)
 	}
 
-	return string(segmentBytes)
+	return string(b)
 }
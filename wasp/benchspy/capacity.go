@@ -0,0 +1,288 @@
+package benchspy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+)
+
+const (
+	// MaxSustainableRate is the highest RPS or amount of VUs that met the SLO during the capacity search
+	MaxSustainableRate = "max_sustainable_rate"
+)
+
+// CapacityQueryExecutor reports the result of the wasp capacity search, the max sustainable rate and the explored load curve
+type CapacityQueryExecutor struct {
+	KindName     string                 `json:"kind"`
+	Generator    *wasp.Generator        `json:"generator_config"`
+	Result       *wasp.CapacityResult   `json:"capacity_result"`
+	QueryResults map[string]interface{} `json:"query_results"`
+}
+
+// NewCapacityQueryExecutor creates a CapacityQueryExecutor for a generator run with wasp.Config.CapacitySearch.
+func NewCapacityQueryExecutor(generator *wasp.Generator) (*CapacityQueryExecutor, error) {
+	if generator == nil {
+		return nil, errors.New("generator is not set")
+	}
+	if generator.Cfg.CapacitySearch == nil {
+		return nil, fmt.Errorf("generator %s was not run with capacity search", generator.Cfg.GenName)
+	}
+
+	L.Debug().
+		Str("Generator", generator.Cfg.GenName).
+		Msg("Creating new Capacity query executor")
+
+	return &CapacityQueryExecutor{
+		KindName:     string(StandardQueryExecutor_Capacity),
+		Generator:    generator,
+		QueryResults: make(map[string]interface{}),
+	}, nil
+}
+
+// GeneratorName returns the name of the generator associated with the query executor.
+func (c *CapacityQueryExecutor) GeneratorName() string {
+	if c.Generator == nil {
+		return ""
+	}
+	return c.Generator.Cfg.GenName
+}
+
+// Kind returns the type of the query executor as a string.
+func (c *CapacityQueryExecutor) Kind() string {
+	return c.KindName
+}
+
+// Results returns the max sustainable rate as float64, the explored curve is available in Result.
+func (c *CapacityQueryExecutor) Results() map[string]interface{} {
+	return c.QueryResults
+}
+
+// Validate checks that the generator is set and was run with capacity search.
+func (c *CapacityQueryExecutor) Validate() error {
+	if c.Generator == nil {
+		return errors.New("generator is not set")
+	}
+	if c.Generator.Cfg.CapacitySearch == nil {
+		return fmt.Errorf("generator %s was not run with capacity search", c.Generator.Cfg.GenName)
+	}
+	return nil
+}
+
+// Execute reads the capacity search result from the generator, it fails if the search has not finished.
+func (c *CapacityQueryExecutor) Execute(_ context.Context) error {
+	if c.Generator == nil {
+		return errors.New("generator is not set")
+	}
+	res := c.Generator.CapacityResult()
+	if res == nil {
+		return fmt.Errorf("generator %s has no capacity search result. Did it finish running?", c.Generator.Cfg.GenName)
+	}
+	c.Result = res
+	c.QueryResults[MaxSustainableRate] = float64(res.MaxRate)
+
+	L.Info().
+		Str("Generator", c.Generator.Cfg.GenName).
+		Int64("Max sustainable rate", res.MaxRate).
+		Int("Steps", len(res.Steps)).
+		Msg("Capacity search results collected")
+
+	return nil
+}
+
+// IsComparable checks if the other QueryExecutor is a CapacityQueryExecutor with the same generator and capacity search config.
+func (c *CapacityQueryExecutor) IsComparable(otherQueryExecutor QueryExecutor) error {
+	otherType := reflect.TypeOf(otherQueryExecutor)
+	if otherType != reflect.TypeOf(c) {
+		return fmt.Errorf("expected type %s, got %s", reflect.TypeOf(c), otherType)
+	}
+	other := otherQueryExecutor.(*CapacityQueryExecutor)
+	if compareGeneratorConfigs(c.Generator.Cfg, other.Generator.Cfg) != nil {
+		return errors.New("generators are not comparable")
+	}
+	return nil
+}
+
+// TimeRange is a no-op, the capacity search result already covers the whole run.
+func (c *CapacityQueryExecutor) TimeRange(_, _ time.Time) {}
+
+// MarshalJSON keeps only the generator config instead of the whole generator.
+func (c *CapacityQueryExecutor) MarshalJSON() ([]byte, error) {
+	type QueryExecutor struct {
+		Kind         string                 `json:"kind"`
+		Generator    interface{}            `json:"generator_config"`
+		Result       *wasp.CapacityResult   `json:"capacity_result"`
+		QueryResults map[string]interface{} `json:"query_results"`
+	}
+
+	return json.Marshal(&QueryExecutor{
+		Kind: c.KindName,
+		Generator: func() interface{} {
+			if c.Generator != nil {
+				return c.Generator.Cfg
+			}
+			return nil
+		}(),
+		Result:       c.Result,
+		QueryResults: c.QueryResults,
+	})
+}
+
+// UnmarshalJSON decodes the executor and rebuilds a generator with the stored config.
+func (c *CapacityQueryExecutor) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Kind         string                 `json:"kind"`
+		GeneratorCfg wasp.Config            `json:"generator_config"`
+		Result       *wasp.CapacityResult   `json:"capacity_result"`
+		QueryResults map[string]interface{} `json:"query_results"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	convertedTypes, conversionErr := convertQueryResults(raw.QueryResults)
+	if conversionErr != nil {
+		return conversionErr
+	}
+
+	c.KindName = raw.Kind
+	c.Result = raw.Result
+	c.QueryResults = convertedTypes
+	c.Generator = &wasp.Generator{
+		Cfg: &raw.GeneratorCfg,
+	}
+	return nil
+}
+
+// MustAllCapacityResults returns capacity search results of all generators in the report, by generator name.
+func MustAllCapacityResults(sr *StandardReport) map[string]*wasp.CapacityResult {
+	results := make(map[string]*wasp.CapacityResult)
+
+	for _, queryExecutor := range sr.QueryExecutors {
+		if strings.EqualFold(queryExecutor.Kind(), string(StandardQueryExecutor_Capacity)) {
+			asCapacity, ok := queryExecutor.(*CapacityQueryExecutor)
+			if !ok {
+				panic(fmt.Errorf("expected *CapacityQueryExecutor, got %T", queryExecutor))
+			}
+			results[asCapacity.GeneratorName()] = asCapacity.Result
+		}
+	}
+
+	return results
+}
+
+// CompareCapacityWithThreshold checks if the max sustainable rate of any generator dropped by more than maxDropPercentage since the previous report.
+// It returns true and all the drops found as an error, the explored curves of both reports are printed.
+func CompareCapacityWithThreshold(maxDropPercentage float64, currentReport, previousReport *StandardReport) (bool, error) {
+	if currentReport == nil || previousReport == nil {
+		return true, errors.New("one or both reports are nil")
+	}
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Float64("Max drop percentage", maxDropPercentage).
+		Msg("Comparing capacity with threshold")
+
+	if maxDropPercentage < 0 || maxDropPercentage > 100 {
+		return true, fmt.Errorf("capacity drop threshold %.4f is not in the range [0, 100]", maxDropPercentage)
+	}
+
+	currentResults := MustAllCapacityResults(currentReport)
+	previousResults := MustAllCapacityResults(previousReport)
+
+	errors := make(map[string][]error)
+	for name, current := range currentResults {
+		previous, ok := previousResults[name]
+		if !ok || previous == nil {
+			errors[name] = append(errors[name], fmt.Errorf("capacity results were missing from previous report"))
+			continue
+		}
+		if current == nil {
+			errors[name] = append(errors[name], fmt.Errorf("capacity results were missing from current report"))
+			continue
+		}
+		// a drop in capacity is a regression, so the diff is inverted
+		drop := -calculateDiffPercentage(float64(current.MaxRate), float64(previous.MaxRate))
+		if drop > maxDropPercentage {
+			errors[name] = append(errors[name], fmt.Errorf("%s dropped by %.4f%% from %d to %d, which is more than the threshold %.4f%%", MaxSustainableRate, drop, previous.MaxRate, current.MaxRate, maxDropPercentage))
+		}
+	}
+
+	PrintCapacityCurves(currentReport, previousReport)
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Number of meaningful differences", len(errors)).
+		Msg("Finished comparing capacity with threshold")
+
+	return len(errors) > 0, concatenateGeneratorErrors(errors)
+}
+
+// PrintCapacityCurves prints the max sustainable rate and the explored steps of both reports for every capacity search generator.
+func PrintCapacityCurves(currentReport, previousReport *StandardReport) {
+	currentResults := MustAllCapacityResults(currentReport)
+	previousResults := MustAllCapacityResults(previousReport)
+
+	for name, current := range currentResults {
+		table := tablewriter.NewWriter(os.Stderr)
+		table.SetHeader([]string{"Rate", previousReport.CommitOrTag, currentReport.CommitOrTag})
+
+		rows := make(map[int64][2]string)
+		var rates []int64
+		addSteps := func(res *wasp.CapacityResult, idx int) {
+			if res == nil {
+				return
+			}
+			for _, s := range res.Steps {
+				row, ok := rows[s.Rate]
+				if !ok {
+					rates = append(rates, s.Rate)
+				}
+				row[idx] = formatCapacityStep(s)
+				rows[s.Rate] = row
+			}
+		}
+		addSteps(previousResults[name], 0)
+		addSteps(current, 1)
+		sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+		for _, r := range rates {
+			table.Append([]string{fmt.Sprint(r), rows[r][0], rows[r][1]})
+		}
+		table.SetFooter([]string{MaxSustainableRate, formatMaxRate(previousResults[name]), formatMaxRate(current)})
+
+		table.SetBorder(true)
+		table.SetRowLine(true)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+		title := "Capacity of generator: " + name
+		fmt.Println(title)
+		fmt.Println(strings.Repeat("=", len(title)))
+
+		table.Render()
+	}
+}
+
+func formatCapacityStep(s *wasp.CapacityStep) string {
+	status := "PASS"
+	if !s.Passed {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("%s err: %.2f%% p95: %s", status, s.ErrorRate*100, s.Latency.P95)
+}
+
+func formatMaxRate(res *wasp.CapacityResult) string {
+	if res == nil {
+		return "-"
+	}
+	return fmt.Sprint(res.MaxRate)
+}
@@ -0,0 +1,168 @@
+package benchspy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func capacityReport(t *testing.T, commit string, maxRate int64) *StandardReport {
+	gen := &wasp.Generator{
+		Cfg: &wasp.Config{
+			T:        t,
+			GenName:  "capacity-gen",
+			LoadType: wasp.RPS,
+			CapacitySearch: &wasp.CapacitySearchConfig{
+				From:         10,
+				Step:         10,
+				Max:          100,
+				StepDuration: time.Second,
+				SLO:          []*wasp.AbortCondition{wasp.ErrorRateAbove(0.1, 0)},
+			},
+		},
+	}
+	return &StandardReport{
+		BasicData: BasicData{
+			TestName:    "capacity",
+			CommitOrTag: commit,
+			GeneratorConfigs: map[string]*wasp.Config{
+				gen.Cfg.GenName: gen.Cfg,
+			},
+		},
+		QueryExecutors: []QueryExecutor{
+			&CapacityQueryExecutor{
+				KindName:  string(StandardQueryExecutor_Capacity),
+				Generator: gen,
+				Result: &wasp.CapacityResult{
+					LoadType:  wasp.RPS,
+					MaxRate:   maxRate,
+					Completed: true,
+					Steps: []*wasp.CapacityStep{
+						{Rate: maxRate, Passed: true},
+						{Rate: maxRate + 10, Passed: false, Breached: []string{"error rate > 10.00%"}},
+					},
+				},
+				QueryResults: map[string]interface{}{MaxSustainableRate: float64(maxRate)},
+			},
+		},
+	}
+}
+
+func TestBenchSpy_NewCapacityQueryExecutor(t *testing.T) {
+	t.Run("generator without capacity search", func(t *testing.T) {
+		_, err := NewCapacityQueryExecutor(&wasp.Generator{Cfg: &wasp.Config{GenName: "gen"}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "was not run with capacity search")
+	})
+
+	t.Run("nil generator", func(t *testing.T) {
+		_, err := NewCapacityQueryExecutor(nil)
+		require.Error(t, err)
+	})
+
+	t.Run("standard report skips generators without capacity search", func(t *testing.T) {
+		gen := &wasp.Generator{
+			Cfg: &wasp.Config{
+				T:        t,
+				GenName:  "plain",
+				LoadType: wasp.RPS,
+				Schedule: []*wasp.Segment{{StartTime: time.Now(), EndTime: time.Now().Add(time.Second)}},
+			},
+		}
+		report, err := NewStandardReport("v1", WithStandardQueries(StandardQueryExecutor_Direct, StandardQueryExecutor_Capacity), WithGenerators(gen))
+		require.NoError(t, err)
+		require.Len(t, report.QueryExecutors, 1)
+		assert.Equal(t, string(StandardQueryExecutor_Direct), report.QueryExecutors[0].Kind())
+	})
+}
+
+func TestBenchSpy_CapacityQueryExecutor_Execute(t *testing.T) {
+	gen, err := wasp.NewGenerator(&wasp.Config{
+		T:        t,
+		GenName:  "capacity-gen",
+		LoadType: wasp.RPS,
+		Gun:      wasp.NewMockGun(&wasp.MockGunConfig{CallSleep: 5 * time.Millisecond}),
+		CapacitySearch: &wasp.CapacitySearchConfig{
+			From:         5,
+			Step:         5,
+			Max:          10,
+			StepDuration: 500 * time.Millisecond,
+			SLO:          []*wasp.AbortCondition{wasp.ErrorRateAbove(0.1, 0)},
+		},
+	})
+	require.NoError(t, err)
+
+	executor, err := NewCapacityQueryExecutor(gen)
+	require.NoError(t, err)
+	require.Error(t, executor.Execute(context.Background()), "search has not finished yet")
+
+	_, _ = gen.Run(true)
+
+	report, err := NewStandardReport("v1", WithStandardQueries(StandardQueryExecutor_Capacity), WithGenerators(gen))
+	require.NoError(t, err)
+	require.NoError(t, report.FetchData(context.Background()))
+
+	results := MustAllCapacityResults(report)
+	require.Contains(t, results, "capacity-gen")
+	assert.Equal(t, int64(10), results["capacity-gen"].MaxRate)
+	assert.Len(t, results["capacity-gen"].Steps, 2)
+	assert.Equal(t, float64(10), report.QueryExecutors[0].Results()[MaxSustainableRate])
+}
+
+func TestBenchSpy_CapacityQueryExecutor_JSONMarshalling(t *testing.T) {
+	report := capacityReport(t, "v1", 40)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	var loaded StandardReport
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	require.Len(t, loaded.QueryExecutors, 1)
+
+	executor, ok := loaded.QueryExecutors[0].(*CapacityQueryExecutor)
+	require.True(t, ok)
+	assert.Equal(t, "capacity-gen", executor.GeneratorName())
+	assert.Equal(t, int64(40), executor.Result.MaxRate)
+	assert.Len(t, executor.Result.Steps, 2)
+	assert.Equal(t, float64(40), executor.Results()[MaxSustainableRate])
+	assert.Equal(t, int64(10), executor.Generator.Cfg.CapacitySearch.Step)
+}
+
+func TestBenchSpy_CompareCapacityWithThreshold(t *testing.T) {
+	t.Run("drop within threshold", func(t *testing.T) {
+		failed, err := CompareCapacityWithThreshold(10, capacityReport(t, "v2", 38), capacityReport(t, "v1", 40))
+		require.NoError(t, err)
+		assert.False(t, failed)
+	})
+
+	t.Run("increase is never a regression", func(t *testing.T) {
+		failed, err := CompareCapacityWithThreshold(0, capacityReport(t, "v2", 80), capacityReport(t, "v1", 40))
+		require.NoError(t, err)
+		assert.False(t, failed)
+	})
+
+	t.Run("drop above threshold", func(t *testing.T) {
+		failed, err := CompareCapacityWithThreshold(10, capacityReport(t, "v2", 30), capacityReport(t, "v1", 40))
+		require.Error(t, err)
+		assert.True(t, failed)
+		assert.Contains(t, err.Error(), "max_sustainable_rate dropped by 25.0000% from 40 to 30")
+	})
+
+	t.Run("invalid threshold", func(t *testing.T) {
+		failed, err := CompareCapacityWithThreshold(101, capacityReport(t, "v2", 40), capacityReport(t, "v1", 40))
+		require.Error(t, err)
+		assert.True(t, failed)
+	})
+
+	t.Run("different capacity search configs are not comparable", func(t *testing.T) {
+		current := capacityReport(t, "v2", 40)
+		current.GeneratorConfigs["capacity-gen"].CapacitySearch.Step = 5
+		err := current.IsComparable(capacityReport(t, "v1", 40))
+		require.Error(t, err)
+	})
+}
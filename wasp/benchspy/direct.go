@@ -4,31 +4,46 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"time"
 
-	"github.com/montanaflynn/stats"
 	"github.com/pkg/errors"
 	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
 )
 
 type DirectQueryFn = func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error)
 
+// MaxLatencySamples is the most latency samples a DirectQueryExecutor keeps for statistical comparison
+const MaxLatencySamples = 10_000
+
 type DirectQueryExecutor struct {
 	KindName     string                   `json:"kind"`
 	Generator    *wasp.Generator          `json:"generator_config"`
 	Queries      map[string]DirectQueryFn `json:"queries"`
 	QueryResults map[string]interface{}   `json:"query_results"`
+	// Samples are sorted latencies of the responses in milliseconds, used by statistical tests, see CompareDirectWithStatisticalTests
+	Samples []float64 `json:"latency_samples,omitempty"`
+	// IncludeFailedSamples adds latencies of failed responses to Samples, by default only successful responses are sampled,
+	// because fast failures would make a run that introduced errors look faster
+	IncludeFailedSamples bool `json:"include_failed_samples,omitempty"`
 }
 
 // NewStandardDirectQueryExecutor creates a new DirectQueryExecutor configured for standard queries.
-// It initializes the executor and generates the necessary queries, returning the executor or an error if the process fails.
+// It initializes the executor and generates queries of all Direct metrics in the DefaultMetricRegistry, returning the executor or an error if the process fails.
 func NewStandardDirectQueryExecutor(generator *wasp.Generator) (*DirectQueryExecutor, error) {
+	return NewDirectQueryExecutorFromRegistry(generator, DefaultMetricRegistry)
+}
+
+// NewDirectQueryExecutorFromRegistry creates a new DirectQueryExecutor with queries of all metrics in the registry that support the Direct executor.
+func NewDirectQueryExecutorFromRegistry(generator *wasp.Generator, registry *MetricRegistry) (*DirectQueryExecutor, error) {
 	g := &DirectQueryExecutor{
-		KindName: string(StandardQueryExecutor_Direct),
+		KindName:  string(StandardQueryExecutor_Direct),
+		Generator: generator,
 	}
 
-	queries, err := g.generateStandardQueries()
+	queries, err := g.generateStandardQueries(registry)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +190,7 @@ func (g *DirectQueryExecutor) Execute(_ context.Context) error {
 			allResponses.Append(response)
 		}
 
-		if len(allResponses.Data) == 0 {
+		if len(allResponses.Data) == 0 && g.latencyPercentiles() == nil {
 			return fmt.Errorf("no responses found for generator %s", g.Generator.Cfg.GenName)
 		}
 
@@ -192,6 +207,10 @@ func (g *DirectQueryExecutor) Execute(_ context.Context) error {
 			Msg("Direct query executed successfully")
 	}
 
+	if g.Generator.GetData() != nil {
+		g.Samples = latencySamples(g.Generator.GetData(), MaxLatencySamples, g.IncludeFailedSamples)
+	}
+
 	L.Info().
 		Str("Generator", g.Generator.Cfg.GenName).
 		Int("Queries", len(g.Queries)).
@@ -200,24 +219,56 @@ func (g *DirectQueryExecutor) Execute(_ context.Context) error {
 	return nil
 }
 
+// LatencySamples returns sorted latencies of the responses in milliseconds recorded during Execute.
+func (g *DirectQueryExecutor) LatencySamples() []float64 {
+	return g.Samples
+}
+
+// latencySamples returns sorted latencies of successful responses in milliseconds, failed ones are added only if includeFailed is set,
+// if there are more than maxSamples evenly spaced order statistics are kept, so the distribution shape is preserved
+func latencySamples(data *wasp.ResponseData, maxSamples int, includeFailed bool) []float64 {
+	samples := make([]float64, 0, len(data.OKResponses.Data)+len(data.FailResponses.Data))
+	for _, r := range data.OKResponses.Data {
+		samples = append(samples, float64(r.Duration.Nanoseconds())/1_000_000)
+	}
+	if includeFailed {
+		for _, r := range data.FailResponses.Data {
+			samples = append(samples, float64(r.Duration.Nanoseconds())/1_000_000)
+		}
+	}
+	sort.Float64s(samples)
+	if len(samples) <= maxSamples {
+		return samples
+	}
+	downsampled := make([]float64, maxSamples)
+	step := float64(len(samples)-1) / float64(maxSamples-1)
+	for i := range downsampled {
+		downsampled[i] = samples[int(math.Round(float64(i)*step))]
+	}
+	return downsampled
+}
+
 // TimeRange ensures that the query executor operates within the specified time range.
 // It is a no-op for executors that already have responses stored in the correct time range.
 func (g *DirectQueryExecutor) TimeRange(_, _ time.Time) {
 	// nothing to do here, since all responses stored in the generator are already in the right time range
 }
 
-func (g *DirectQueryExecutor) generateStandardQueries() (map[string]DirectQueryFn, error) {
+func (g *DirectQueryExecutor) generateStandardQueries(registry *MetricRegistry) (map[string]DirectQueryFn, error) {
 	L.Debug().
 		Msg("Generating standard Direct queries")
 
+	if registry == nil {
+		return nil, errors.New("metric registry is nil")
+	}
+
 	standardQueries := make(map[string]DirectQueryFn)
 
-	for _, metric := range StandardLoadMetrics {
-		query, err := g.standardQuery(metric)
-		if err != nil {
-			return nil, err
+	for _, metric := range registry.Metrics(StandardQueryExecutor_Direct) {
+		metricFn := metric.Direct
+		standardQueries[metric.Name] = func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+			return metricFn(g.Generator, responses)
 		}
-		standardQueries[string(metric)] = query
 	}
 
 	L.Debug().
@@ -227,57 +278,9 @@ func (g *DirectQueryExecutor) generateStandardQueries() (map[string]DirectQueryF
 	return standardQueries, nil
 }
 
-func (g *DirectQueryExecutor) standardQuery(standardMetric StandardLoadMetric) (DirectQueryFn, error) {
-	var responsesToDurationFn = func(responses *wasp.SliceBuffer[*wasp.Response]) []float64 {
-		var asMiliDuration []float64
-		for _, response := range responses.Data {
-			// get duration as nanoseconds and convert to milliseconds in order to not lose precision
-			// otherwise, the duration will be rounded to the nearest millisecond
-			asMiliDuration = append(asMiliDuration, float64(response.Duration.Nanoseconds())/1_000_000)
-		}
-
-		return asMiliDuration
-	}
-
-	var calculateFailureRateFn = func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
-		if len(responses.Data) == 0 {
-			return 0, nil
-		}
-
-		failedCount := 0.0
-		successfulCount := 0.0
-		for _, response := range responses.Data {
-			if response.Failed || response.Timeout {
-				failedCount = failedCount + 1
-			} else {
-				successfulCount = successfulCount + 1
-			}
-		}
-
-		return failedCount / (failedCount + successfulCount), nil
-	}
-
-	switch standardMetric {
-	case MedianLatency:
-		medianFn := func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
-			return stats.Median(responsesToDurationFn(responses))
-		}
-		return medianFn, nil
-	case Percentile95Latency:
-		p95Fn := func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
-			return stats.Percentile(responsesToDurationFn(responses), 95)
-		}
-		return p95Fn, nil
-	case MaxLatency:
-		maxFn := func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
-			return stats.Max(responsesToDurationFn(responses))
-		}
-		return maxFn, nil
-	case ErrorRate:
-		return calculateFailureRateFn, nil
-	default:
-		return nil, fmt.Errorf("unsupported standard metric %s", standardMetric)
-	}
+// latencyPercentiles returns percentiles from generator's latency histogram or nil if it has no data
+func (g *DirectQueryExecutor) latencyPercentiles() *wasp.LatencyPercentiles {
+	return generatorLatencyPercentiles(g.Generator)
 }
 
 // MarshalJSON customizes the JSON representation of the DirectQueryExecutor.
@@ -290,6 +293,7 @@ func (g *DirectQueryExecutor) MarshalJSON() ([]byte, error) {
 		Generator    interface{}            `json:"generator_config"`
 		Queries      []string               `json:"queries"`
 		QueryResults map[string]interface{} `json:"query_results"`
+		Samples      []float64              `json:"latency_samples,omitempty"`
 	}
 
 	return json.Marshal(&QueryExecutor{
@@ -308,6 +312,7 @@ func (g *DirectQueryExecutor) MarshalJSON() ([]byte, error) {
 			return keys
 		}(),
 		QueryResults: g.QueryResults,
+		Samples:      g.Samples,
 	})
 }
 
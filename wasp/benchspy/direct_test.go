@@ -248,6 +248,12 @@ func TestBenchSpy_DirectQueryExecutor_Execute(t *testing.T) {
 		// error rate is the number of failures divided by the total number of responses
 		expectedErrorRate := float64(actualFailures) / (float64(fakeGun.maxSuccesses) + float64(actualFailures))
 		assert.Equal(t, expectedErrorRate, errorRate)
+
+		// raw latencies of successful responses are kept sorted for statistical comparison
+		samples := executor.LatencySamples()
+		require.Len(t, samples, fakeGun.maxSuccesses)
+		require.IsNonDecreasing(t, samples)
+		require.InDelta(t, 150.0, samples[0], 2.0)
 	})
 
 	t.Run("all responses failed", func(t *testing.T) {
@@ -293,6 +299,108 @@ func TestBenchSpy_DirectQueryExecutor_Execute(t *testing.T) {
 		assert.Equal(t, 1.0, errorRate)
 	})
 
+	t.Run("sampled responses use latency histogram", func(t *testing.T) {
+		cfg := &wasp.Config{
+			GenName:  "my_gen",
+			LoadType: wasp.RPS,
+			Schedule: []*wasp.Segment{
+				{
+					Type:     "plain",
+					From:     1,
+					Duration: 5 * time.Second,
+				},
+			},
+			SamplerConfig: &wasp.SamplerConfig{SuccessfulCallResultRecordRatio: 0},
+		}
+
+		fakeGun := &fakeGun{
+			maxSuccesses: 4,
+			maxFailures:  3,
+			schedule:     cfg.Schedule[0],
+		}
+
+		cfg.Gun = fakeGun
+
+		gen, err := wasp.NewGenerator(cfg)
+		require.NoError(t, err)
+
+		gen.Run(true)
+
+		require.Equal(t, 0, len(gen.GetData().OKResponses.Data), "expected successful responses to be skipped")
+		actualFailures := len(gen.GetData().FailResponses.Data)
+
+		executor, err := NewStandardDirectQueryExecutor(gen)
+		assert.NoError(t, err)
+
+		err = executor.Execute(context.Background())
+		assert.NoError(t, err)
+
+		resultsAsFloats, err := ResultsAs(0.0, executor, string(MedianLatency), string(ErrorRate))
+		assert.NoError(t, err)
+		require.InDelta(t, 151.0, resultsAsFloats[string(MedianLatency)], 1.0)
+
+		expectedErrorRate := float64(actualFailures) / (float64(fakeGun.maxSuccesses) + float64(actualFailures))
+		assert.Equal(t, expectedErrorRate, resultsAsFloats[string(ErrorRate)])
+	})
+
+	t.Run("coordinated omission correction doesn't count skipped arrivals as calls", func(t *testing.T) {
+		cfg := &wasp.Config{
+			GenName:                    "my_gen",
+			LoadType:                   wasp.RPS,
+			CorrectCoordinatedOmission: true,
+			Schedule: []*wasp.Segment{
+				{
+					Type:     "plain",
+					From:     1,
+					Duration: 5 * time.Second,
+				},
+			},
+		}
+
+		fakeGun := &fakeGun{
+			maxSuccesses: 4,
+			maxFailures:  3,
+			schedule:     cfg.Schedule[0],
+		}
+
+		cfg.Gun = fakeGun
+
+		gen, err := wasp.NewGenerator(cfg)
+		require.NoError(t, err)
+
+		gen.Run(true)
+
+		// charge arrivals that a slow gun made the generator skip, the same way the generator does it
+		stats := gen.Stats()
+		calls := stats.Calls()
+		for i := 0; i < 20; i++ {
+			stats.Latencies.Record("", time.Second)
+		}
+		stats.ArrivalsSkipped.Add(20)
+		require.Equal(t, calls+20, stats.Latencies.Percentiles().Count)
+
+		registry := StandardMetricRegistry()
+		require.NoError(t, registry.Register(ThroughputMetric(5)))
+		executor, err := NewDirectQueryExecutorFromRegistry(gen, registry)
+		require.NoError(t, err)
+		require.NoError(t, executor.Execute(context.Background()))
+
+		resultsAsFloats, err := ResultsAs(0.0, executor, string(ErrorRate), Throughput)
+		require.NoError(t, err)
+		assert.Equal(t, float64(stats.Failed.Load())/float64(calls), resultsAsFloats[string(ErrorRate)])
+
+		var first, last time.Time
+		for _, r := range append(gen.GetData().OKResponses.Data, gen.GetData().FailResponses.Data...) {
+			if first.IsZero() || r.StartedAt.Before(first) {
+				first = *r.StartedAt
+			}
+			if r.FinishedAt.After(last) {
+				last = *r.FinishedAt
+			}
+		}
+		assert.InDelta(t, float64(calls)/last.Sub(first).Seconds(), resultsAsFloats[Throughput], 0.001)
+	})
+
 	t.Run("no responses", func(t *testing.T) {
 		cfg := &wasp.Config{
 			GenName:  "my_gen",
@@ -340,6 +448,7 @@ func TestBenchSpy_DirectQueryExecutor_MarshalJSON(t *testing.T) {
 		original, _ := NewStandardDirectQueryExecutor(gen)
 		original.QueryResults["test"] = 2.0
 		original.QueryResults["test2"] = 12.1
+		original.Samples = []float64{1.5, 2.25, 3.0}
 
 		original.Queries = map[string]DirectQueryFn{
 			"test": func(responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
@@ -360,6 +469,7 @@ func TestBenchSpy_DirectQueryExecutor_MarshalJSON(t *testing.T) {
 		assert.Equal(t, original.KindName, recovered.KindName)
 		assert.Equal(t, original.QueryResults, recovered.QueryResults)
 		assert.Equal(t, len(original.Queries), len(recovered.Queries))
+		assert.Equal(t, original.Samples, recovered.LatencySamples())
 	})
 
 	t.Run("marshal with nil generator", func(t *testing.T) {
@@ -376,6 +486,31 @@ func TestBenchSpy_DirectQueryExecutor_MarshalJSON(t *testing.T) {
 	})
 }
 
+func TestBenchSpy_DirectQueryExecutor_LatencySamples(t *testing.T) {
+	data := &wasp.ResponseData{
+		OKResponses:   wasp.NewSliceBuffer[*wasp.Response](100),
+		FailResponses: wasp.NewSliceBuffer[*wasp.Response](100),
+	}
+	for i := 100; i > 0; i-- {
+		data.OKResponses.Append(&wasp.Response{Duration: time.Duration(i) * time.Millisecond})
+	}
+	data.FailResponses.Append(&wasp.Response{Duration: 500 * time.Microsecond, Failed: true})
+
+	// fast failures are not sampled by default
+	samples := latencySamples(data, 1000, false)
+	require.Len(t, samples, 100)
+	require.Equal(t, 1.0, samples[0])
+
+	samples = latencySamples(data, 1000, true)
+	require.Len(t, samples, 101)
+	require.Equal(t, 0.5, samples[0])
+	require.Equal(t, 100.0, samples[100])
+
+	// down-sampling keeps evenly spaced order statistics including min and max
+	samples = latencySamples(data, 11, true)
+	require.Equal(t, []float64{0.5, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, samples)
+}
+
 func TestBenchSpy_DirectQueryExecutor_TimeRange(t *testing.T) {
 	executor := &DirectQueryExecutor{}
 	start := time.Now()
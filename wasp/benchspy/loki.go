@@ -281,16 +281,29 @@ func (l *LokiQueryExecutor) UnmarshalJSON(data []byte) error {
 }
 
 // NewStandardMetricsLokiExecutor creates a LokiQueryExecutor configured with standard metrics queries.
-// It generates queries based on provided test parameters and time range, returning the executor or an error if query generation fails.
+// It generates queries of all Loki metrics in the DefaultMetricRegistry based on provided test parameters and time range,
+// returning the executor or an error if query generation fails.
 func NewStandardMetricsLokiExecutor(lokiConfig *wasp.LokiConfig, testName, generatorName, branch, commit string, startTime, endTime time.Time) (*LokiQueryExecutor, error) {
+	return NewLokiQueryExecutorFromRegistry(DefaultMetricRegistry, lokiConfig, MetricQueryParams{
+		TestName:      testName,
+		GeneratorName: generatorName,
+		Branch:        branch,
+		Commit:        commit,
+		StartTime:     startTime,
+		EndTime:       endTime,
+	})
+}
+
+// NewLokiQueryExecutorFromRegistry creates a LokiQueryExecutor with queries of all metrics in the registry that support Loki.
+func NewLokiQueryExecutorFromRegistry(registry *MetricRegistry, lokiConfig *wasp.LokiConfig, params MetricQueryParams) (*LokiQueryExecutor, error) {
 	lq := &LokiQueryExecutor{
 		KindName:            string(StandardQueryExecutor_Loki),
-		GeneratorNameString: generatorName,
+		GeneratorNameString: params.GeneratorName,
 		Config:              lokiConfig,
 		QueryResults:        make(map[string]interface{}),
 	}
 
-	standardQueries, queryErr := lq.generateStandardQueries(testName, generatorName, branch, commit, startTime, endTime)
+	standardQueries, queryErr := lq.generateStandardQueries(registry, params)
 	if queryErr != nil {
 		return nil, queryErr
 	}
@@ -300,36 +313,20 @@ func NewStandardMetricsLokiExecutor(lokiConfig *wasp.LokiConfig, testName, gener
 	return lq, nil
 }
 
-func (l *LokiQueryExecutor) standardQuery(standardMetric StandardLoadMetric, testName, generatorName, branch, commit string, startTime, endTime time.Time) (string, error) {
-	// if we decide to include only plain segments for the calculation, we we will need to execute this function for each of them
-	// and then aggregate the results
-	switch standardMetric {
-	case MedianLatency:
-		return fmt.Sprintf(Loki_MedianQuery, branch, commit, testName, generatorName), nil
-	case Percentile95Latency:
-		return fmt.Sprintf(Loki_95thQuery, branch, commit, testName, generatorName), nil
-	case MaxLatency:
-		return fmt.Sprintf(Loki_MaxQuery, branch, commit, testName, generatorName), nil
-	case ErrorRate:
-		queryRange := calculateTimeRange(startTime, endTime)
-		return fmt.Sprintf(Loki_ErrorRate, branch, commit, testName, generatorName, queryRange), nil
-	default:
-		return "", fmt.Errorf("unsupported standard metric %s", standardMetric)
-	}
-}
-
-func (l *LokiQueryExecutor) generateStandardQueries(testName, generatorName, branch, commit string, startTime, endTime time.Time) (map[string]string, error) {
+func (l *LokiQueryExecutor) generateStandardQueries(registry *MetricRegistry, params MetricQueryParams) (map[string]string, error) {
 	L.Debug().
 		Msg("Generating standard Loki queries")
 
+	if registry == nil {
+		return nil, errors.New("metric registry is nil")
+	}
+
 	standardQueries := make(map[string]string)
 
-	for _, metric := range StandardLoadMetrics {
-		query, err := l.standardQuery(metric, testName, generatorName, branch, commit, startTime, endTime)
-		if err != nil {
-			return nil, err
-		}
-		standardQueries[string(metric)] = query
+	// if we decide to include only plain segments for the calculation, we we will need to generate queries for each of them
+	// and then aggregate the results
+	for _, metric := range registry.Metrics(StandardQueryExecutor_Loki) {
+		standardQueries[metric.Name] = metric.Loki(params)
 	}
 
 	L.Debug().
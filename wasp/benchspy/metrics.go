@@ -1,7 +1,17 @@
 package benchspy
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
+
+	"github.com/montanaflynn/stats"
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
 )
 
 // StringSliceToFloat64Slice converts a slice of strings to a slice of float64 values.
@@ -17,3 +27,520 @@ func StringSliceToFloat64Slice(s []string) ([]float64, error) {
 	}
 	return numbers, nil
 }
+
+// MetricDirection tells whether lower or higher values of a metric are better
+type MetricDirection string
+
+const (
+	LowerIsBetter  MetricDirection = "lower_is_better"
+	HigherIsBetter MetricDirection = "higher_is_better"
+)
+
+// NoThreshold is the threshold of metrics that are compared and printed, but never fail the comparison
+const NoThreshold = -1.0
+
+// Throughput is the name of the metric created by ThroughputMetric
+const Throughput = "throughput"
+
+// DirectMetricFn computes a metric from the generator and all responses it stored during the test.
+// Generator gives access to the latency histogram, which unlike responses is never sampled, it might be nil
+// for generators loaded from reports.
+type DirectMetricFn = func(generator *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error)
+
+// MetricQueryParams are the values Loki and Prometheus queries of a metric are built from
+type MetricQueryParams struct {
+	TestName      string
+	GeneratorName string
+	Branch        string
+	Commit        string
+	// NameRegexPattern matches names of the containers Prometheus queries are executed for
+	NameRegexPattern string
+	StartTime        time.Time
+	EndTime          time.Time
+}
+
+// QueryRange returns the duration of the test formatted as a LogQL or PromQL range, e.g. "5m"
+func (p MetricQueryParams) QueryRange() string {
+	return calculateTimeRange(p.StartTime, p.EndTime)
+}
+
+// Metric describes how a metric is computed by each kind of query executor, which of its values are better
+// and how much it can get worse before the comparison fails. At least one of Direct, Loki or Prometheus is needed,
+// the metric is computed only by the executors it has a definition for.
+type Metric struct {
+	Name string
+	// Direction is LowerIsBetter if not set
+	Direction MetricDirection
+	// Threshold is the largest change for the worse in percent, from 0 to 100, that is still accepted.
+	// Metrics with NoThreshold are only printed.
+	Threshold float64
+	// Direct computes the metric from responses of the generator
+	Direct DirectMetricFn
+	// Loki returns the LogQL query of the metric
+	Loki func(params MetricQueryParams) string
+	// Prometheus returns the PromQL query of the metric
+	Prometheus func(params MetricQueryParams) string
+	// Aggregate reduces values returned by the Loki query, or by a single series of a Prometheus range query,
+	// to one value that is compared, mean is used if it's not set
+	Aggregate func(values []float64) (float64, error)
+}
+
+// HigherIsBetter returns true if an increase of the metric is an improvement
+func (m *Metric) HigherIsBetter() bool {
+	return m.Direction == HigherIsBetter
+}
+
+// Supports returns true if the metric can be computed by the query executor of given kind
+func (m *Metric) Supports(kind StandardQueryExecutorType) bool {
+	switch kind {
+	case StandardQueryExecutor_Direct:
+		return m.Direct != nil
+	case StandardQueryExecutor_Loki:
+		return m.Loki != nil
+	case StandardQueryExecutor_Prometheus:
+		return m.Prometheus != nil
+	default:
+		return false
+	}
+}
+
+// Validate checks that the metric has a name, a valid direction and threshold and can be computed by at least one executor
+func (m *Metric) Validate() error {
+	if m.Name == "" {
+		return errors.New("metric name is missing")
+	}
+	if m.Direction != "" && m.Direction != LowerIsBetter && m.Direction != HigherIsBetter {
+		return fmt.Errorf("unknown direction %s, use %s or %s", m.Direction, LowerIsBetter, HigherIsBetter)
+	}
+	if m.Threshold != NoThreshold && (m.Threshold < 0 || m.Threshold > 100) {
+		return fmt.Errorf("threshold %.4f is not in the range [0, 100]", m.Threshold)
+	}
+	if m.Direct == nil && m.Loki == nil && m.Prometheus == nil {
+		return errors.New("at least one of Direct, Loki or Prometheus definitions is needed")
+	}
+	return nil
+}
+
+func (m *Metric) hasThreshold() bool {
+	return m.Threshold != NoThreshold
+}
+
+func (m *Metric) aggregate(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, errors.New("there are no values to aggregate")
+	}
+	if m.Aggregate != nil {
+		return m.Aggregate(values)
+	}
+	return meanValue(values)
+}
+
+// MetricRegistry keeps metrics in the order they were registered, standard executors compute all registered
+// metrics they support and CompareMetricsWithThresholds and PrintMetrics compare and print them.
+type MetricRegistry struct {
+	mu      sync.RWMutex
+	metrics []*Metric
+}
+
+// DefaultMetricRegistry is used by standard query executors, CompareDirectWithThresholds and PrintStandardDirectMetrics.
+// It has the standard load and resource metrics, register your own metrics with RegisterMetric before creating the report.
+var DefaultMetricRegistry = StandardMetricRegistry()
+
+// RegisterMetric adds metrics to the DefaultMetricRegistry
+func RegisterMetric(metrics ...*Metric) error {
+	return DefaultMetricRegistry.Register(metrics...)
+}
+
+// NewMetricRegistry creates a registry with given metrics, it returns an error if any of them is invalid or registered twice
+func NewMetricRegistry(metrics ...*Metric) (*MetricRegistry, error) {
+	r := &MetricRegistry{}
+	if err := r.Register(metrics...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// StandardMetricRegistry creates a registry with all StandardLoadMetrics and StandardResourceMetrics.
+// Standard metrics have NoThreshold, use SetThreshold to fail comparisons on them.
+func StandardMetricRegistry() *MetricRegistry {
+	r, err := NewMetricRegistry(standardMetrics()...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Register adds metrics to the registry, none are added if any of them is invalid or is already registered
+func (r *MetricRegistry) Register(metrics ...*Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		if m == nil {
+			return errors.New("metric is nil")
+		}
+		if err := m.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid metric %s", m.Name)
+		}
+		if _, ok := names[m.Name]; ok || r.get(m.Name) != nil {
+			return fmt.Errorf("metric %s is already registered", m.Name)
+		}
+		names[m.Name] = struct{}{}
+	}
+	r.metrics = append(r.metrics, metrics...)
+
+	return nil
+}
+
+// Get returns the metric with given name
+func (r *MetricRegistry) Get(name string) (*Metric, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m := r.get(name)
+	return m, m != nil
+}
+
+func (r *MetricRegistry) get(name string) *Metric {
+	for _, m := range r.metrics {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Metrics returns registered metrics supported by any of given executor kinds, or all of them if no kinds are given
+func (r *MetricRegistry) Metrics(kinds ...StandardQueryExecutorType) []*Metric {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var metrics []*Metric
+	for _, m := range r.metrics {
+		if len(kinds) == 0 {
+			metrics = append(metrics, m)
+			continue
+		}
+		for _, kind := range kinds {
+			if m.Supports(kind) {
+				metrics = append(metrics, m)
+				break
+			}
+		}
+	}
+	return metrics
+}
+
+// SetThreshold changes the threshold of a registered metric, use NoThreshold to stop failing comparisons on it
+func (r *MetricRegistry) SetThreshold(name string, threshold float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.get(name)
+	if m == nil {
+		return fmt.Errorf("metric %s is not registered", name)
+	}
+	if threshold != NoThreshold && (threshold < 0 || threshold > 100) {
+		return fmt.Errorf("%s threshold %.4f is not in the range [0, 100]", name, threshold)
+	}
+	m.Threshold = threshold
+	return nil
+}
+
+// Clone returns a copy of the registry, thresholds changed in the copy don't affect the original
+func (r *MetricRegistry) Clone() *MetricRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := &MetricRegistry{metrics: make([]*Metric, 0, len(r.metrics))}
+	for _, m := range r.metrics {
+		copied := *m
+		clone.metrics = append(clone.metrics, &copied)
+	}
+	return clone
+}
+
+// LatencyPercentileMetric creates a metric of given latency percentile in milliseconds, e.g. 99.9,
+// percentiles available in wasp.LatencyPercentiles are read from the generator's latency histogram
+func LatencyPercentileMetric(name string, percentile float64, threshold float64) *Metric {
+	fromHistogram := map[float64]func(p *wasp.LatencyPercentiles) time.Duration{
+		50:   func(p *wasp.LatencyPercentiles) time.Duration { return p.P50 },
+		90:   func(p *wasp.LatencyPercentiles) time.Duration { return p.P90 },
+		95:   func(p *wasp.LatencyPercentiles) time.Duration { return p.P95 },
+		99:   func(p *wasp.LatencyPercentiles) time.Duration { return p.P99 },
+		99.9: func(p *wasp.LatencyPercentiles) time.Duration { return p.P999 },
+		100:  func(p *wasp.LatencyPercentiles) time.Duration { return p.Max },
+	}[percentile]
+
+	return &Metric{
+		Name:      name,
+		Direction: LowerIsBetter,
+		Threshold: threshold,
+		Direct: func(generator *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+			if p := generatorLatencyPercentiles(generator); p != nil && fromHistogram != nil {
+				return durationToMilliseconds(fromHistogram(p)), nil
+			}
+			return stats.Percentile(responsesToMilliseconds(responses), percentile)
+		},
+		Loki: func(p MetricQueryParams) string {
+			return fmt.Sprintf(`quantile_over_time(%s, {branch=~"%s", commit=~"%s", go_test_name=~"%s", test_data_type=~"responses", gen_name=~"%s"} | json| unwrap duration [10s]) by (go_test_name, gen_name) / 1e6`,
+				strconv.FormatFloat(math.Round(percentile*1e6)/1e8, 'f', -1, 64), p.Branch, p.Commit, p.TestName, p.GeneratorName)
+		},
+	}
+}
+
+// ThroughputMetric creates a metric of completed calls per second, higher throughput is better.
+// Direct executor divides the number of calls by the time between the first and the last stored response,
+// Loki computes it over 10s intervals.
+func ThroughputMetric(threshold float64) *Metric {
+	return &Metric{
+		Name:      Throughput,
+		Direction: HigherIsBetter,
+		Threshold: threshold,
+		Direct: func(generator *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+			var first, last time.Time
+			for _, r := range responses.Data {
+				if r.StartedAt != nil && (first.IsZero() || r.StartedAt.Before(first)) {
+					first = *r.StartedAt
+				}
+				if r.FinishedAt != nil && r.FinishedAt.After(last) {
+					last = *r.FinishedAt
+				}
+			}
+			if first.IsZero() || !last.After(first) {
+				return 0, errors.New("responses have no start and finish times, throughput can't be calculated")
+			}
+			calls := float64(len(responses.Data))
+			// stored responses might be sampled, generator stats count all of them
+			if c := generatorCalls(generator); c > 0 {
+				calls = float64(c)
+			}
+			return calls / last.Sub(first).Seconds(), nil
+		},
+		Loki: func(p MetricQueryParams) string {
+			return fmt.Sprintf(`sum(count_over_time({branch=~"%s", commit=~"%s", go_test_name=~"%s", test_data_type=~"responses", gen_name=~"%s"} [10s])) / 10`,
+				p.Branch, p.Commit, p.TestName, p.GeneratorName)
+		},
+	}
+}
+
+// ResponseDataMetric creates a Direct metric of custom values stored in Response.Data, value extracts the number
+// from the data and returns false for responses without it, aggregate reduces values of all responses, mean is used if it's nil
+func ResponseDataMetric(name string, direction MetricDirection, threshold float64, value func(data interface{}) (float64, bool), aggregate func(values []float64) (float64, error)) *Metric {
+	if aggregate == nil {
+		aggregate = meanValue
+	}
+	return &Metric{
+		Name:      name,
+		Direction: direction,
+		Threshold: threshold,
+		Direct: func(_ *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+			var values []float64
+			for _, r := range responses.Data {
+				if v, ok := value(r.Data); ok {
+					values = append(values, v)
+				}
+			}
+			if len(values) == 0 {
+				return 0, fmt.Errorf("no responses have %s data", name)
+			}
+			return aggregate(values)
+		},
+	}
+}
+
+func standardMetrics() []*Metric {
+	return []*Metric{
+		{
+			Name:      string(MedianLatency),
+			Threshold: NoThreshold,
+			Direct: standardLatencyFn(func(p *wasp.LatencyPercentiles) time.Duration { return p.P50 }, func(values []float64) (float64, error) {
+				return stats.Median(values)
+			}),
+			Loki: standardLokiQuery(&Loki_MedianQuery),
+		},
+		{
+			Name:      string(Percentile95Latency),
+			Threshold: NoThreshold,
+			Direct: standardLatencyFn(func(p *wasp.LatencyPercentiles) time.Duration { return p.P95 }, func(values []float64) (float64, error) {
+				return stats.Percentile(values, 95)
+			}),
+			Loki: standardLokiQuery(&Loki_95thQuery),
+		},
+		{
+			Name:      string(MaxLatency),
+			Threshold: NoThreshold,
+			Direct:    standardLatencyFn(func(p *wasp.LatencyPercentiles) time.Duration { return p.Max }, maxValue),
+			Loki:      standardLokiQuery(&Loki_MaxQuery),
+			Aggregate: maxValue,
+		},
+		{
+			Name:      string(ErrorRate),
+			Threshold: NoThreshold,
+			Direct:    errorRateFn,
+			Loki: func(p MetricQueryParams) string {
+				return fmt.Sprintf(Loki_ErrorRate, p.Branch, p.Commit, p.TestName, p.GeneratorName, p.QueryRange())
+			},
+		},
+		{Name: string(MedianCPUUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_MedianCPU)},
+		{Name: string(MedianMemUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_MedianMem)},
+		{Name: string(P95CPUUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_P95CPU)},
+		{Name: string(P95MemUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_P95Mem)},
+		{Name: string(MaxCPUUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_MaxCPU), Aggregate: maxValue},
+		{Name: string(MaxMemUsage), Threshold: NoThreshold, Prometheus: standardPrometheusQuery(&Prometheus_MaxMem), Aggregate: maxValue},
+	}
+}
+
+// standardLokiQuery formats the query template when the query is built, so changes to templates made before that are used
+func standardLokiQuery(template *string) func(p MetricQueryParams) string {
+	return func(p MetricQueryParams) string {
+		return fmt.Sprintf(*template, p.Branch, p.Commit, p.TestName, p.GeneratorName)
+	}
+}
+
+func standardPrometheusQuery(template *string) func(p MetricQueryParams) string {
+	return func(p MetricQueryParams) string {
+		return fmt.Sprintf(*template, p.NameRegexPattern, p.QueryRange())
+	}
+}
+
+func standardLatencyFn(fromHistogram func(p *wasp.LatencyPercentiles) time.Duration, fromResponses func(values []float64) (float64, error)) DirectMetricFn {
+	return func(generator *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+		if p := generatorLatencyPercentiles(generator); p != nil {
+			return durationToMilliseconds(fromHistogram(p)), nil
+		}
+		return fromResponses(responsesToMilliseconds(responses))
+	}
+}
+
+func errorRateFn(generator *wasp.Generator, responses *wasp.SliceBuffer[*wasp.Response]) (float64, error) {
+	// failed calls are never sampled, but successful ones might be, so we use total count from generator stats
+	if c := generatorCalls(generator); c > 0 {
+		return float64(generator.Stats().Failed.Load()) / float64(c), nil
+	}
+
+	if len(responses.Data) == 0 {
+		return 0, nil
+	}
+
+	failedCount := 0.0
+	successfulCount := 0.0
+	for _, response := range responses.Data {
+		if response.Failed || response.Timeout {
+			failedCount = failedCount + 1
+		} else {
+			successfulCount = successfulCount + 1
+		}
+	}
+
+	return failedCount / (failedCount + successfulCount), nil
+}
+
+// generatorLatencyPercentiles returns percentiles from generator's latency histogram or nil if it has no data,
+// histogram is never sampled, so whenever it's available it's more accurate than stored responses
+func generatorLatencyPercentiles(generator *wasp.Generator) *wasp.LatencyPercentiles {
+	if generator == nil || generator.Stats() == nil || generator.Stats().Latencies == nil {
+		return nil
+	}
+	p := generator.Stats().Latencies.Percentiles()
+	if p.Count == 0 {
+		return nil
+	}
+	return &p
+}
+
+// generatorCalls returns the amount of calls made by the generator or 0 if it has no stats,
+// unlike the histogram count it doesn't include arrivals skipped with CorrectCoordinatedOmission
+func generatorCalls(generator *wasp.Generator) int64 {
+	if generator == nil || generator.Stats() == nil {
+		return 0
+	}
+	return generator.Stats().Calls()
+}
+
+func durationToMilliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1_000_000
+}
+
+func responsesToMilliseconds(responses *wasp.SliceBuffer[*wasp.Response]) []float64 {
+	var asMiliDuration []float64
+	for _, response := range responses.Data {
+		// get duration as nanoseconds and convert to milliseconds in order to not lose precision
+		// otherwise, the duration will be rounded to the nearest millisecond
+		asMiliDuration = append(asMiliDuration, durationToMilliseconds(response.Duration))
+	}
+
+	return asMiliDuration
+}
+
+// metricValues returns the values of a metric computed by a query executor, keyed by the series they belong to.
+// Direct results, Loki results and Prometheus scalars have a single series with an empty key, Prometheus vectors
+// and matrices have a series for every label set.
+func metricValues(m *Metric, result interface{}) (map[string]float64, error) {
+	values := make(map[string]float64)
+	switch r := result.(type) {
+	case float64:
+		values[""] = r
+	case []string:
+		numbers, err := StringSliceToFloat64Slice(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s values", m.Name)
+		}
+		v, err := m.aggregate(numbers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to aggregate %s values", m.Name)
+		}
+		values[""] = v
+	case model.Scalar:
+		values[""] = float64(r.Value)
+	case *model.Scalar:
+		values[""] = float64(r.Value)
+	case *model.Vector:
+		return metricValues(m, *r)
+	case *model.Matrix:
+		return metricValues(m, *r)
+	case model.Vector:
+		for _, sample := range r {
+			values[sample.Metric.String()] = float64(sample.Value)
+		}
+	case model.Matrix:
+		for _, stream := range r {
+			numbers := make([]float64, 0, len(stream.Values))
+			for _, pair := range stream.Values {
+				numbers = append(numbers, float64(pair.Value))
+			}
+			v, err := m.aggregate(numbers)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to aggregate %s values of %s", m.Name, stream.Metric.String())
+			}
+			values[stream.Metric.String()] = v
+		}
+	default:
+		return nil, fmt.Errorf("%s results of type %T can't be compared", m.Name, result)
+	}
+	return values, nil
+}
+
+// sortedSeries returns series keys in a stable order
+func sortedSeries(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// worseBy returns by how many percent the metric got worse, negative values are improvements
+func (m *Metric) worseBy(current, previous float64) float64 {
+	diff := calculateDiffPercentage(current, previous)
+	if m.HigherIsBetter() {
+		return -diff
+	}
+	return diff
+}
+
+func meanValue(values []float64) (float64, error) {
+	return stats.Mean(values)
+}
+
+func maxValue(values []float64) (float64, error) {
+	return stats.Max(values)
+}
@@ -1,9 +1,14 @@
 package benchspy
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/prometheus/common/model"
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBenchSpy_StringSliceToFloat64Slice(t *testing.T) {
@@ -39,3 +44,235 @@ func TestBenchSpy_StringSliceToFloat64Slice(t *testing.T) {
 		assert.Equal(t, expected, result)
 	})
 }
+
+func TestBenchSpy_MetricRegistry(t *testing.T) {
+	t.Run("standard metrics", func(t *testing.T) {
+		registry := StandardMetricRegistry()
+		require.Len(t, registry.Metrics(StandardQueryExecutor_Direct), len(StandardLoadMetrics))
+		require.Len(t, registry.Metrics(StandardQueryExecutor_Loki), len(StandardLoadMetrics))
+		require.Len(t, registry.Metrics(StandardQueryExecutor_Prometheus), len(StandardResourceMetrics))
+		require.Len(t, registry.Metrics(StandardQueryExecutor_Direct, StandardQueryExecutor_Prometheus), len(StandardLoadMetrics)+len(StandardResourceMetrics))
+
+		median, ok := registry.Get(string(MedianLatency))
+		require.True(t, ok)
+		assert.False(t, median.HigherIsBetter())
+		assert.Equal(t, NoThreshold, median.Threshold)
+
+		query := median.Loki(MetricQueryParams{TestName: "test", GeneratorName: "gen", Branch: "main", Commit: "abc"})
+		assert.Equal(t, fmt.Sprintf(Loki_MedianQuery, "main", "abc", "test", "gen"), query)
+		cpu, ok := registry.Get(string(MaxCPUUsage))
+		require.True(t, ok)
+		start := time.Now()
+		assert.Equal(t, fmt.Sprintf(Prometheus_MaxCPU, "node", "5m"), cpu.Prometheus(MetricQueryParams{NameRegexPattern: "node", StartTime: start, EndTime: start.Add(5 * time.Minute)}))
+	})
+
+	t.Run("register", func(t *testing.T) {
+		registry := StandardMetricRegistry()
+		require.NoError(t, registry.Register(ThroughputMetric(5), LatencyPercentileMetric("p999_latency", 99.9, 10)))
+		require.Len(t, registry.Metrics(StandardQueryExecutor_Direct), len(StandardLoadMetrics)+2)
+
+		err := registry.Register(ThroughputMetric(5))
+		require.ErrorContains(t, err, "metric throughput is already registered")
+		err = registry.Register(&Metric{Name: "no_source"})
+		require.ErrorContains(t, err, "at least one of Direct, Loki or Prometheus definitions is needed")
+		err = registry.Register(ResponseDataMetric("bad_threshold", LowerIsBetter, 101, nil, nil))
+		require.ErrorContains(t, err, "threshold 101.0000 is not in the range [0, 100]")
+		err = registry.Register(ResponseDataMetric("bad_direction", "sideways", 1, nil, nil))
+		require.ErrorContains(t, err, "unknown direction sideways")
+
+		// nothing is registered if any metric is invalid
+		err = registry.Register(ResponseDataMetric("valid", LowerIsBetter, 1, nil, nil), &Metric{})
+		require.Error(t, err)
+		_, ok := registry.Get("valid")
+		require.False(t, ok)
+	})
+
+	t.Run("clone and thresholds", func(t *testing.T) {
+		registry := StandardMetricRegistry()
+		clone := registry.Clone()
+		require.NoError(t, clone.SetThreshold(string(ErrorRate), 5))
+		require.ErrorContains(t, clone.SetThreshold("unknown", 5), "metric unknown is not registered")
+		require.ErrorContains(t, clone.SetThreshold(string(ErrorRate), 200), "error_rate threshold 200.0000 is not in the range [0, 100]")
+
+		cloned, _ := clone.Get(string(ErrorRate))
+		original, _ := registry.Get(string(ErrorRate))
+		assert.Equal(t, 5.0, cloned.Threshold)
+		assert.Equal(t, NoThreshold, original.Threshold)
+	})
+
+	t.Run("executors use registry", func(t *testing.T) {
+		registry, err := NewMetricRegistry(
+			ThroughputMetric(5),
+			&Metric{Name: "queue_size", Prometheus: func(p MetricQueryParams) string { return "queue_size{name=~\"" + p.NameRegexPattern + "\"}" }},
+		)
+		require.NoError(t, err)
+
+		direct, err := NewDirectQueryExecutorFromRegistry(&wasp.Generator{Cfg: &wasp.Config{GenName: "gen"}}, registry)
+		require.NoError(t, err)
+		require.Len(t, direct.Queries, 1)
+		require.Contains(t, direct.Queries, Throughput)
+
+		loki, err := NewLokiQueryExecutorFromRegistry(registry, &wasp.LokiConfig{}, MetricQueryParams{GeneratorName: "gen", Branch: "main", Commit: "abc", TestName: "test"})
+		require.NoError(t, err)
+		require.Len(t, loki.Queries, 1)
+		assert.Contains(t, loki.Queries[Throughput], `gen_name=~"gen"`)
+
+		prometheus, err := NewPrometheusQueryExecutorFromRegistry(registry, time.Now(), time.Now().Add(time.Minute), &PrometheusConfig{Url: "http://localhost:9090", NameRegexPatterns: []string{"node"}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"queue_size": `queue_size{name=~"node"}`}, prometheus.Queries)
+	})
+}
+
+func TestBenchSpy_CustomMetrics(t *testing.T) {
+	start := time.Now()
+	responses := wasp.NewSliceBuffer[*wasp.Response](1000)
+	for i := 0; i < 1000; i++ {
+		startedAt := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		finishedAt := startedAt.Add(time.Duration(i+1) * time.Millisecond)
+		responses.Append(&wasp.Response{
+			Duration:   time.Duration(i+1) * time.Millisecond,
+			StartedAt:  &startedAt,
+			FinishedAt: &finishedAt,
+			Data:       map[string]int{"queue": i % 10},
+		})
+	}
+
+	t.Run("latency percentile", func(t *testing.T) {
+		p999, err := LatencyPercentileMetric("p999", 99.9, 10).Direct(nil, responses)
+		require.NoError(t, err)
+		assert.InDelta(t, 999, p999, 1)
+		assert.Contains(t, LatencyPercentileMetric("p999", 99.9, 10).Loki(MetricQueryParams{}), "quantile_over_time(0.999,")
+	})
+
+	t.Run("throughput", func(t *testing.T) {
+		throughput, err := ThroughputMetric(5).Direct(nil, responses)
+		require.NoError(t, err)
+		// the last call starts after 9.99s and takes 1s
+		assert.InDelta(t, 1000/10.99, throughput, 0.01)
+		assert.True(t, ThroughputMetric(5).HigherIsBetter())
+
+		_, err = ThroughputMetric(5).Direct(nil, wasp.NewSliceBuffer[*wasp.Response](1))
+		require.ErrorContains(t, err, "throughput can't be calculated")
+	})
+
+	t.Run("response data", func(t *testing.T) {
+		queue := func(data interface{}) (float64, bool) {
+			asMap, ok := data.(map[string]int)
+			if !ok {
+				return 0, false
+			}
+			return float64(asMap["queue"]), true
+		}
+		mean, err := ResponseDataMetric("queue", LowerIsBetter, 10, queue, nil).Direct(nil, responses)
+		require.NoError(t, err)
+		assert.InDelta(t, 4.5, mean, 0.001)
+
+		maxQueue, err := ResponseDataMetric("queue", LowerIsBetter, 10, queue, maxValue).Direct(nil, responses)
+		require.NoError(t, err)
+		assert.Equal(t, 9.0, maxQueue)
+
+		noData := wasp.NewSliceBuffer[*wasp.Response](1)
+		noData.Append(&wasp.Response{})
+		_, err = ResponseDataMetric("queue", LowerIsBetter, 10, queue, nil).Direct(nil, noData)
+		require.ErrorContains(t, err, "no responses have queue data")
+	})
+}
+
+func TestBenchSpy_CompareMetricsWithThresholds(t *testing.T) {
+	newReport := func(commit string, throughput, queue float64, lokiLatencies []string, memory float64) *StandardReport {
+		cfg := &wasp.Config{GenName: "gen"}
+		return &StandardReport{
+			BasicData: BasicData{
+				TestName:         "metrics",
+				CommitOrTag:      commit,
+				GeneratorConfigs: map[string]*wasp.Config{"gen": cfg},
+			},
+			QueryExecutors: []QueryExecutor{
+				&DirectQueryExecutor{
+					KindName:  string(StandardQueryExecutor_Direct),
+					Generator: &wasp.Generator{Cfg: cfg},
+					QueryResults: map[string]interface{}{
+						Throughput:            throughput,
+						"queue":               queue,
+						string(MedianLatency): 10.0,
+					},
+				},
+				&LokiQueryExecutor{
+					KindName:            string(StandardQueryExecutor_Loki),
+					GeneratorNameString: "gen",
+					QueryResults: map[string]interface{}{
+						string(MedianLatency): lokiLatencies,
+						Throughput:            []string{"100", "110"},
+					},
+				},
+				&PrometheusQueryExecutor{
+					KindName: string(StandardQueryExecutor_Prometheus),
+					QueryResults: map[string]interface{}{
+						string(MaxMemUsage): model.Vector{&model.Sample{Metric: model.Metric{"name": "node"}, Value: model.SampleValue(memory)}},
+					},
+				},
+			},
+		}
+	}
+
+	registry := StandardMetricRegistry()
+	require.NoError(t, registry.Register(
+		ThroughputMetric(10),
+		ResponseDataMetric("queue", LowerIsBetter, NoThreshold, func(interface{}) (float64, bool) { return 0, false }, nil),
+	))
+	require.NoError(t, registry.SetThreshold(string(MedianLatency), 10))
+	require.NoError(t, registry.SetThreshold(string(MaxMemUsage), 20))
+
+	previous := newReport("v1", 100, 5, []string{"10", "20"}, 100)
+
+	t.Run("within thresholds", func(t *testing.T) {
+		// higher throughput is an improvement and queue has no threshold
+		current := newReport("v2", 150, 50, []string{"15", "16"}, 110)
+		failed, err := CompareMetricsWithThresholds(registry, current, previous)
+		require.NoError(t, err)
+		require.False(t, failed)
+	})
+
+	t.Run("exceeding thresholds", func(t *testing.T) {
+		current := newReport("v2", 80, 5, []string{"20", "22"}, 150)
+		failed, err := CompareMetricsWithThresholds(registry, current, previous)
+		require.True(t, failed)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "[gen] throughput is -20.0000% different, which is lower than the threshold -10.0000%")
+		assert.Contains(t, err.Error(), "[loki gen] median_latency is 40.0000% different, which is higher than the threshold 10.0000%")
+		assert.Contains(t, err.Error(), `[prometheus] max_mem_usage{name="node"} is 50.0000% different, which is higher than the threshold 20.0000%`)
+	})
+
+	t.Run("missing and invalid results", func(t *testing.T) {
+		current := newReport("v2", 100, 5, []string{"not a number"}, 100)
+		current.QueryExecutors[2].(*PrometheusQueryExecutor).QueryResults[string(MaxMemUsage)] = model.Vector{}
+		delete(current.QueryExecutors[0].(*DirectQueryExecutor).QueryResults, Throughput)
+		failed, err := CompareMetricsWithThresholds(registry, current, previous)
+		require.True(t, failed)
+		assert.Contains(t, err.Error(), "[gen] throughput metric results were missing from current report for generator gen")
+		assert.Contains(t, err.Error(), "[loki gen] failed to parse median_latency values")
+		assert.Contains(t, err.Error(), `[prometheus] max_mem_usage{name="node"} metric results were missing from current report`)
+	})
+
+	t.Run("direct comparison uses registered metrics", func(t *testing.T) {
+		require.NoError(t, RegisterMetric(ThroughputMetric(10)))
+		defer func() {
+			DefaultMetricRegistry = StandardMetricRegistry()
+		}()
+
+		current := newReport("v2", 50, 5, nil, 100)
+		previous := newReport("v1", 100, 5, nil, 100)
+		for _, r := range []*StandardReport{current, previous} {
+			for _, m := range []StandardLoadMetric{Percentile95Latency, MaxLatency, ErrorRate} {
+				r.QueryExecutors[0].(*DirectQueryExecutor).QueryResults[string(m)] = 1.0
+			}
+		}
+
+		failed, err := CompareDirectWithThresholds(10, 10, 10, 10, current, previous)
+		require.True(t, failed)
+		assert.Equal(t, "[gen] throughput is -50.0000% different, which is lower than the threshold -10.0000%", err.Error())
+
+		// trend analysis and HTML reports know the direction of registered metrics
+		assert.True(t, (&TrendConfig{}).higherIsBetter(Throughput))
+	})
+}
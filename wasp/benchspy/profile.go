@@ -0,0 +1,758 @@
+package benchspy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ProfileQueryExecutorKind is the kind of ProfileQueryExecutor
+	ProfileQueryExecutorKind = "profile"
+
+	// ProfileCPU is the CPU time spent in functions
+	ProfileCPU = "cpu"
+	// ProfileHeap is the memory in use at the end of the test
+	ProfileHeap = "heap"
+	// ProfileAlloc is the memory allocated during the test
+	ProfileAlloc = "alloc"
+
+	// DefaultCPUProfileWindow is the duration of a single CPU profile fetched from pprof, profiles of the whole test are merged
+	DefaultCPUProfileWindow = 10 * time.Second
+	// DefaultProfileTopN is the default number of functions in a profile diff
+	DefaultProfileTopN = 10
+	// MaxProfileFunctions is the number of functions with the highest flat value kept in the report for every profile type
+	MaxProfileFunctions = 500
+)
+
+type ProfileSource string
+
+const (
+	ProfileSource_Pprof     ProfileSource = "pprof"
+	ProfileSource_Pyroscope ProfileSource = "pyroscope"
+)
+
+var (
+	// pprofSampleTypes are sample types of pprof profiles used for every profile type
+	pprofSampleTypes = map[string]string{
+		ProfileCPU:   "cpu",
+		ProfileHeap:  "inuse_space",
+		ProfileAlloc: "alloc_space",
+	}
+	// pyroscopeProfileNames are names of profile types in Pyroscope application queries, ex.: my-app.cpu{}
+	pyroscopeProfileNames = map[string]string{
+		ProfileCPU:   "cpu",
+		ProfileHeap:  "inuse_space",
+		ProfileAlloc: "alloc_space",
+	}
+)
+
+// ProfileConfig selects where profiles are collected from, either pprof endpoints or Pyroscope
+type ProfileConfig struct {
+	// PprofURL is the base URL of net/http/pprof handlers, ex.: http://localhost:6060/debug/pprof
+	PprofURL string
+	// CPUProfileWindow is the duration of a single CPU profile fetched from pprof, DefaultCPUProfileWindow if not set
+	CPUProfileWindow time.Duration
+
+	// PyroscopeURL is the URL of a Pyroscope server, ex.: http://localhost:4040
+	PyroscopeURL string
+	// PyroscopeApplication is the application name profiles were sent with
+	PyroscopeApplication string
+	// PyroscopeLabels select profiles of the application, ex.: {"test": "my-test"}
+	PyroscopeLabels map[string]string
+	// PyroscopeKey is sent as a bearer token if set
+	PyroscopeKey string
+
+	// Client is used for all requests, http.DefaultClient if not set
+	Client *http.Client
+}
+
+// FunctionSample is the value of a function in a profile, flat is the value of the function itself, cum includes its callees
+type FunctionSample struct {
+	Name string `json:"name"`
+	Flat int64  `json:"flat"`
+	Cum  int64  `json:"cum"`
+}
+
+// FunctionProfile is a profile aggregated by function
+type FunctionProfile struct {
+	// Unit of values, ex.: nanoseconds or bytes
+	Unit string `json:"unit"`
+	// Total is the sum of flat values of all functions
+	Total int64 `json:"total"`
+	// Functions with the highest flat values, sorted by flat value
+	Functions []*FunctionSample `json:"functions"`
+	// Raw is the gzipped pprof profile, if it was collected from pprof, it can be opened with go tool pprof
+	Raw []byte `json:"raw,omitempty"`
+}
+
+// ProfileQueryExecutor collects CPU and memory profiles of the test window from pprof endpoints or Pyroscope
+// and stores them aggregated by function in the report, so DiffProfiles can show where the time went.
+//
+// pprof has no history, so CPU profiles have to be captured while the test runs: call Start before the test,
+// FetchData stops the capture. Pyroscope profiles are selected by the test time range.
+type ProfileQueryExecutor struct {
+	KindName     string                      `json:"kind"`
+	Name         string                      `json:"name"`
+	Source       ProfileSource               `json:"source"`
+	ProfileTypes []string                    `json:"profile_types"`
+	StartTime    time.Time                   `json:"start_time"`
+	EndTime      time.Time                   `json:"end_time"`
+	Profiles     map[string]*FunctionProfile `json:"profiles"`
+
+	config *ProfileConfig
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	cpu    []*profile.Profile
+	errs   []error
+}
+
+// NewProfileQueryExecutor creates an executor collecting profiles of the given types, ProfileCPU and ProfileHeap if none are given.
+// Name identifies the profiled service, so executors of different reports can be compared.
+func NewProfileQueryExecutor(name string, config *ProfileConfig, profileTypes ...string) (*ProfileQueryExecutor, error) {
+	if config == nil {
+		return nil, errors.New("profile config is nil")
+	}
+	if len(profileTypes) == 0 {
+		profileTypes = []string{ProfileCPU, ProfileHeap}
+	}
+	if config.CPUProfileWindow == 0 {
+		config.CPUProfileWindow = DefaultCPUProfileWindow
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+
+	source := ProfileSource_Pprof
+	if config.PyroscopeURL != "" {
+		source = ProfileSource_Pyroscope
+	}
+
+	L.Debug().
+		Str("Name", name).
+		Str("Source", string(source)).
+		Strs("Profile types", profileTypes).
+		Msg("Creating new profile query executor")
+
+	p := &ProfileQueryExecutor{
+		KindName:     ProfileQueryExecutorKind,
+		Name:         name,
+		Source:       source,
+		ProfileTypes: profileTypes,
+		Profiles:     make(map[string]*FunctionProfile),
+		config:       config,
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Kind returns the type of the query executor as a string.
+func (p *ProfileQueryExecutor) Kind() string {
+	return p.KindName
+}
+
+// Results returns *FunctionProfile of every profile type.
+func (p *ProfileQueryExecutor) Results() map[string]interface{} {
+	results := make(map[string]interface{}, len(p.Profiles))
+	for profileType, fp := range p.Profiles {
+		results[profileType] = fp
+	}
+	return results
+}
+
+// Validate checks if the profile source and profile types are set correctly.
+func (p *ProfileQueryExecutor) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is empty")
+	}
+	if len(p.ProfileTypes) == 0 {
+		return errors.New("no profile types are set")
+	}
+	for _, profileType := range p.ProfileTypes {
+		if _, ok := pprofSampleTypes[profileType]; !ok {
+			return fmt.Errorf("unknown profile type %s, supported types are: %s, %s, %s", profileType, ProfileCPU, ProfileHeap, ProfileAlloc)
+		}
+	}
+	if p.config == nil {
+		// loaded from a report, nothing to collect
+		return nil
+	}
+	switch p.Source {
+	case ProfileSource_Pprof:
+		if p.config.PprofURL == "" {
+			return errors.New("pprof URL or Pyroscope URL must be set")
+		}
+	case ProfileSource_Pyroscope:
+		if p.config.PyroscopeApplication == "" {
+			return errors.New("application name of Pyroscope profiles must be set")
+		}
+	default:
+		return fmt.Errorf("unknown profile source %s", p.Source)
+	}
+	return nil
+}
+
+// IsComparable checks if both executors collected the same profile types of the same service.
+func (p *ProfileQueryExecutor) IsComparable(otherQueryExecutor QueryExecutor) error {
+	other, ok := otherQueryExecutor.(*ProfileQueryExecutor)
+	if !ok {
+		return fmt.Errorf("expected query executor type %T, got %T", p, otherQueryExecutor)
+	}
+	if p.Name != other.Name {
+		return fmt.Errorf("profiled services are different. Expected %s, got %s", p.Name, other.Name)
+	}
+	if strings.Join(p.ProfileTypes, ",") != strings.Join(other.ProfileTypes, ",") {
+		return fmt.Errorf("profile types are different. Expected %s, got %s", strings.Join(p.ProfileTypes, ", "), strings.Join(other.ProfileTypes, ", "))
+	}
+	return nil
+}
+
+// TimeRange sets the time range of Pyroscope profiles, pprof profiles cover the time between Start and Execute.
+func (p *ProfileQueryExecutor) TimeRange(startTime, endTime time.Time) {
+	if p.Source == ProfileSource_Pyroscope || p.StartTime.IsZero() {
+		p.StartTime = startTime
+		p.EndTime = endTime
+	}
+}
+
+// Start captures CPU profiles from pprof in the background until Execute is called, it has to be called before the test starts.
+// It's a no-op for Pyroscope and when CPU profiles aren't collected.
+func (p *ProfileQueryExecutor) Start() {
+	if p.Source != ProfileSource_Pprof || !p.collects(ProfileCPU) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	p.StartTime = time.Now()
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	L.Info().
+		Str("Name", p.Name).
+		Str("URL", p.config.PprofURL).
+		Msg("Capturing CPU profiles")
+
+	go func() {
+		defer close(p.done)
+		for {
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+			// the profile in progress is finished even if the capture is stopped, so the end of the test is covered
+			prof, err := p.fetchPprof(context.Background(), fmt.Sprintf("profile?seconds=%d", int(math.Ceil(p.config.CPUProfileWindow.Seconds()))))
+			p.mu.Lock()
+			if err != nil {
+				p.errs = append(p.errs, err)
+			} else {
+				p.cpu = append(p.cpu, prof)
+			}
+			p.mu.Unlock()
+			if err != nil {
+				// don't retry a failing endpoint in a busy loop
+				select {
+				case <-p.stop:
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}()
+}
+
+// stopCapture waits for the CPU profile in progress and returns all captured profiles
+func (p *ProfileQueryExecutor) stopCapture(ctx context.Context) ([]*profile.Profile, error) {
+	p.mu.Lock()
+	if p.stop == nil {
+		p.mu.Unlock()
+		return nil, errors.New("CPU profiles from pprof weren't captured, call Start before the test")
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	p.EndTime = time.Now()
+	if len(p.cpu) == 0 {
+		return nil, errors.Wrap(goerrors.Join(p.errs...), "no CPU profiles were captured")
+	}
+	return p.cpu, nil
+}
+
+// Execute collects all profiles and aggregates them by function.
+func (p *ProfileQueryExecutor) Execute(ctx context.Context) error {
+	L.Info().
+		Str("Name", p.Name).
+		Str("Source", string(p.Source)).
+		Strs("Profile types", p.ProfileTypes).
+		Msg("Collecting profiles")
+
+	if p.config == nil {
+		return errors.New("profile config is not set")
+	}
+	for _, profileType := range p.ProfileTypes {
+		var (
+			fp  *FunctionProfile
+			err error
+		)
+		switch p.Source {
+		case ProfileSource_Pprof:
+			fp, err = p.executePprof(ctx, profileType)
+		case ProfileSource_Pyroscope:
+			fp, err = p.executePyroscope(ctx, profileType)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to collect %s profile of %s", profileType, p.Name)
+		}
+		p.Profiles[profileType] = fp
+	}
+
+	L.Info().
+		Str("Name", p.Name).
+		Msg("Profiles collected")
+
+	return nil
+}
+
+func (p *ProfileQueryExecutor) collects(profileType string) bool {
+	for _, t := range p.ProfileTypes {
+		if t == profileType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ProfileQueryExecutor) executePprof(ctx context.Context, profileType string) (*FunctionProfile, error) {
+	var (
+		prof *profile.Profile
+		err  error
+	)
+	if profileType == ProfileCPU {
+		profiles, err := p.stopCapture(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if prof, err = profile.Merge(profiles); err != nil {
+			return nil, errors.Wrap(err, "failed to merge CPU profiles")
+		}
+	} else if prof, err = p.fetchPprof(ctx, "heap"); err != nil {
+		return nil, err
+	}
+
+	fp, err := aggregatePprof(prof, pprofSampleTypes[profileType])
+	if err != nil {
+		return nil, err
+	}
+	raw := &bytes.Buffer{}
+	if err := prof.Write(raw); err != nil {
+		return nil, errors.Wrap(err, "failed to encode profile")
+	}
+	fp.Raw = raw.Bytes()
+	return fp, nil
+}
+
+func (p *ProfileQueryExecutor) fetchPprof(ctx context.Context, path string) (*profile.Profile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.PprofURL, "/")+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	prof, err := profile.ParseData(body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse profile from %s", req.URL)
+	}
+	return prof, nil
+}
+
+// aggregatePprof sums values of the sample type by function, flat by the leaf function and cum by every function on the stack
+func aggregatePprof(prof *profile.Profile, sampleType string) (*FunctionProfile, error) {
+	idx := -1
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return nil, fmt.Errorf("profile has no %s samples", sampleType)
+	}
+
+	fp := &FunctionProfile{Unit: prof.SampleType[idx].Unit}
+	functions := make(map[string]*FunctionSample)
+	function := func(name string) *FunctionSample {
+		if _, ok := functions[name]; !ok {
+			functions[name] = &FunctionSample{Name: name}
+		}
+		return functions[name]
+	}
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		if v == 0 {
+			continue
+		}
+		fp.Total += v
+		seen := make(map[string]struct{})
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				name := line.Function.Name
+				if i == 0 && j == 0 {
+					function(name).Flat += v
+				}
+				// recursive functions are counted once per sample
+				if _, ok := seen[name]; !ok {
+					seen[name] = struct{}{}
+					function(name).Cum += v
+				}
+			}
+		}
+	}
+	fp.Functions = topFunctions(functions)
+	return fp, nil
+}
+
+func topFunctions(functions map[string]*FunctionSample) []*FunctionSample {
+	sorted := make([]*FunctionSample, 0, len(functions))
+	for _, f := range functions {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Flat != sorted[j].Flat {
+			return sorted[i].Flat > sorted[j].Flat
+		}
+		if sorted[i].Cum != sorted[j].Cum {
+			return sorted[i].Cum > sorted[j].Cum
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > MaxProfileFunctions {
+		sorted = sorted[:MaxProfileFunctions]
+	}
+	return sorted
+}
+
+// flamebearer is the profile format returned by the Pyroscope render API
+type flamebearer struct {
+	Flamebearer struct {
+		Names  []string  `json:"names"`
+		Levels [][]int64 `json:"levels"`
+	} `json:"flamebearer"`
+	Metadata struct {
+		Units string `json:"units"`
+	} `json:"metadata"`
+}
+
+func (p *ProfileQueryExecutor) executePyroscope(ctx context.Context, profileType string) (*FunctionProfile, error) {
+	labels := make([]string, 0, len(p.config.PyroscopeLabels))
+	for k, v := range p.config.PyroscopeLabels {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(labels)
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("%s.%s{%s}", p.config.PyroscopeApplication, pyroscopeProfileNames[profileType], strings.Join(labels, ",")))
+	query.Set("from", fmt.Sprint(p.StartTime.Unix()))
+	query.Set("until", fmt.Sprint(p.EndTime.Unix()))
+	query.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.PyroscopeURL, "/")+"/render?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.PyroscopeKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.PyroscopeKey)
+	}
+	body, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	fb := &flamebearer{}
+	if err := json.Unmarshal(body, fb); err != nil {
+		return nil, errors.Wrap(err, "failed to decode Pyroscope response")
+	}
+	return aggregateFlamebearer(fb)
+}
+
+// aggregateFlamebearer sums flamebearer nodes by function. Every level is a list of nodes of 4 values:
+// offset from the end of the previous node on the level, total, self and the index of the name.
+// A node is a child of the node on the previous level its offset falls into.
+func aggregateFlamebearer(fb *flamebearer) (*FunctionProfile, error) {
+	type node struct {
+		start, total int64
+		name         string
+		parent       *node
+	}
+	fp := &FunctionProfile{Unit: fb.Metadata.Units}
+	functions := make(map[string]*FunctionSample)
+	var previous []*node
+	for levelIdx, level := range fb.Flamebearer.Levels {
+		if len(level)%4 != 0 {
+			return nil, fmt.Errorf("level %d has %d values, expected a multiple of 4", levelIdx, len(level))
+		}
+		current := make([]*node, 0, len(level)/4)
+		var x int64
+		parentIdx := 0
+		for i := 0; i < len(level); i += 4 {
+			offset, total, self, nameIdx := level[i], level[i+1], level[i+2], level[i+3]
+			if nameIdx < 0 || int(nameIdx) >= len(fb.Flamebearer.Names) {
+				return nil, fmt.Errorf("name index %d is out of range", nameIdx)
+			}
+			n := &node{start: x + offset, total: total, name: fb.Flamebearer.Names[nameIdx]}
+			x = n.start + total
+			for parentIdx < len(previous) && previous[parentIdx].start+previous[parentIdx].total <= n.start {
+				parentIdx++
+			}
+			if parentIdx < len(previous) {
+				n.parent = previous[parentIdx]
+			}
+			current = append(current, n)
+
+			// the root node is the total of the whole profile
+			if levelIdx == 0 {
+				continue
+			}
+			if _, ok := functions[n.name]; !ok {
+				functions[n.name] = &FunctionSample{Name: n.name}
+			}
+			functions[n.name].Flat += self
+			fp.Total += self
+			recursive := false
+			for a := n.parent; a != nil; a = a.parent {
+				if a.name == n.name {
+					recursive = true
+					break
+				}
+			}
+			if !recursive {
+				functions[n.name].Cum += total
+			}
+		}
+		previous = current
+	}
+	fp.Functions = topFunctions(functions)
+	return fp, nil
+}
+
+func (p *ProfileQueryExecutor) do(req *http.Request) ([]byte, error) {
+	resp, err := p.config.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to request %s", req.URL)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read response from %s", req.URL)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("request %s returned %d: %s", req.URL, resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// FunctionDiff is the change of the share of a function in the total of a profile, in percentage points
+type FunctionDiff struct {
+	Name         string  `json:"name"`
+	PreviousFlat float64 `json:"previous_flat_percent"`
+	CurrentFlat  float64 `json:"current_flat_percent"`
+	FlatDiff     float64 `json:"flat_diff"`
+	PreviousCum  float64 `json:"previous_cum_percent"`
+	CurrentCum   float64 `json:"current_cum_percent"`
+	CumDiff      float64 `json:"cum_diff"`
+}
+
+// ProfileDiff lists functions whose share of a profile changed the most between two reports
+type ProfileDiff struct {
+	Name        string          `json:"name"`
+	ProfileType string          `json:"profile_type"`
+	Unit        string          `json:"unit"`
+	Functions   []*FunctionDiff `json:"functions"`
+}
+
+// DiffProfiles compares profiles of all ProfileQueryExecutors of both reports and returns topN functions of every profile
+// whose flat share of the profile total changed the most. Shares are compared instead of absolute values,
+// so tests of different durations can be compared. DefaultProfileTopN is used if topN isn't positive.
+func DiffProfiles(currentReport, previousReport *StandardReport, topN int) ([]*ProfileDiff, error) {
+	if currentReport == nil || previousReport == nil {
+		return nil, errors.New("one or both reports are nil")
+	}
+	if topN <= 0 {
+		topN = DefaultProfileTopN
+	}
+	previousProfiles := allProfiles(previousReport)
+	var diffs []*ProfileDiff
+	for name, current := range allProfiles(currentReport) {
+		previous, ok := previousProfiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profiles of %s are missing from the previous report", name)
+		}
+		for _, profileType := range current.ProfileTypes {
+			cp, pp := current.Profiles[profileType], previous.Profiles[profileType]
+			if cp == nil || pp == nil {
+				return nil, fmt.Errorf("%s profile of %s is missing from one of the reports", profileType, name)
+			}
+			diffs = append(diffs, diffFunctionProfiles(name, profileType, cp, pp, topN))
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Name != diffs[j].Name {
+			return diffs[i].Name < diffs[j].Name
+		}
+		return diffs[i].ProfileType < diffs[j].ProfileType
+	})
+	return diffs, nil
+}
+
+// CompareProfilesWithThreshold checks if the flat share of any function in any profile of the reports grew by more than
+// maxFlatIncrease percentage points since the previous report, see DiffProfiles. It returns true and all such functions as an error,
+// DefaultProfileTopN functions of every profile diff are printed.
+func CompareProfilesWithThreshold(maxFlatIncrease float64, currentReport, previousReport *StandardReport) (bool, error) {
+	if currentReport == nil || previousReport == nil {
+		return true, errors.New("one or both reports are nil")
+	}
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Float64("Max flat increase", maxFlatIncrease).
+		Msg("Comparing profiles with threshold")
+
+	if maxFlatIncrease < 0 || maxFlatIncrease > 100 {
+		return true, fmt.Errorf("profile flat share increase threshold %.4f is not in the range [0, 100]", maxFlatIncrease)
+	}
+
+	// all functions are checked, the top ones might have only lost their share
+	diffs, err := DiffProfiles(currentReport, previousReport, math.MaxInt)
+	if err != nil {
+		return true, err
+	}
+
+	errors := make(map[string][]error)
+	for _, d := range diffs {
+		name := d.Name + " " + d.ProfileType
+		for _, f := range d.Functions {
+			if f.FlatDiff > maxFlatIncrease {
+				errors[name] = append(errors[name], fmt.Errorf("flat share of %s grew by %.4f percentage points from %.4f%% to %.4f%%, which is more than the threshold %.4f", f.Name, f.FlatDiff, f.PreviousFlat, f.CurrentFlat, maxFlatIncrease))
+			}
+		}
+		if len(d.Functions) > DefaultProfileTopN {
+			d.Functions = d.Functions[:DefaultProfileTopN]
+		}
+	}
+
+	PrintProfileDiffs(diffs)
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Number of meaningful differences", len(errors)).
+		Msg("Finished comparing profiles with threshold")
+
+	return len(errors) > 0, concatenateGeneratorErrors(errors)
+}
+
+func allProfiles(sr *StandardReport) map[string]*ProfileQueryExecutor {
+	profiles := make(map[string]*ProfileQueryExecutor)
+	for _, qe := range sr.QueryExecutors {
+		if p, ok := qe.(*ProfileQueryExecutor); ok {
+			profiles[p.Name] = p
+		}
+	}
+	return profiles
+}
+
+func diffFunctionProfiles(name, profileType string, current, previous *FunctionProfile, topN int) *ProfileDiff {
+	share := func(v, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(v) / float64(total)
+	}
+	byName := make(map[string]*FunctionDiff)
+	for _, f := range previous.Functions {
+		byName[f.Name] = &FunctionDiff{Name: f.Name, PreviousFlat: share(f.Flat, previous.Total), PreviousCum: share(f.Cum, previous.Total)}
+	}
+	for _, f := range current.Functions {
+		if _, ok := byName[f.Name]; !ok {
+			byName[f.Name] = &FunctionDiff{Name: f.Name}
+		}
+		byName[f.Name].CurrentFlat = share(f.Flat, current.Total)
+		byName[f.Name].CurrentCum = share(f.Cum, current.Total)
+	}
+	functions := make([]*FunctionDiff, 0, len(byName))
+	for _, f := range byName {
+		f.FlatDiff = f.CurrentFlat - f.PreviousFlat
+		f.CumDiff = f.CurrentCum - f.PreviousCum
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if math.Abs(functions[i].FlatDiff) != math.Abs(functions[j].FlatDiff) {
+			return math.Abs(functions[i].FlatDiff) > math.Abs(functions[j].FlatDiff)
+		}
+		return functions[i].Name < functions[j].Name
+	})
+	if len(functions) > topN {
+		functions = functions[:topN]
+	}
+	return &ProfileDiff{Name: name, ProfileType: profileType, Unit: current.Unit, Functions: functions}
+}
+
+// PrintProfileDiffs prints a table of every profile diff.
+func PrintProfileDiffs(diffs []*ProfileDiff) {
+	for _, d := range diffs {
+		table := tablewriter.NewWriter(os.Stderr)
+		table.SetHeader([]string{"Function", "Previous flat %", "Current flat %", "Flat diff", "Previous cum %", "Current cum %", "Cum diff"})
+		for _, f := range d.Functions {
+			table.Append([]string{
+				f.Name,
+				fmt.Sprintf("%.2f", f.PreviousFlat),
+				fmt.Sprintf("%.2f", f.CurrentFlat),
+				fmt.Sprintf("%+.2f", f.FlatDiff),
+				fmt.Sprintf("%.2f", f.PreviousCum),
+				fmt.Sprintf("%.2f", f.CurrentCum),
+				fmt.Sprintf("%+.2f", f.CumDiff),
+			})
+		}
+		table.SetBorder(true)
+		table.SetRowLine(true)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+		title := fmt.Sprintf("Profile: %s %s", d.Name, d.ProfileType)
+		fmt.Println(title)
+		fmt.Println(strings.Repeat("=", len(title)))
+
+		table.Render()
+	}
+}
@@ -0,0 +1,258 @@
+package benchspy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPprofProfile creates a profile with a sample of every stack, stacks are listed from the leaf function
+func newTestPprofProfile(sampleType, unit string, stacks [][]string, values []int64) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: sampleType, Unit: unit}},
+		PeriodType: &profile.ValueType{Type: sampleType, Unit: unit},
+		Period:     1,
+	}
+	functions := make(map[string]*profile.Function)
+	for i, stack := range stacks {
+		s := &profile.Sample{Value: []int64{values[i]}}
+		for _, name := range stack {
+			fn, ok := functions[name]
+			if !ok {
+				fn = &profile.Function{ID: uint64(len(functions) + 1), Name: name}
+				functions[name] = fn
+				p.Function = append(p.Function, fn)
+			}
+			loc := &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: fn}}}
+			p.Location = append(p.Location, loc)
+			s.Location = append(s.Location, loc)
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+func findFunction(t *testing.T, fp *FunctionProfile, name string) *FunctionSample {
+	for _, f := range fp.Functions {
+		if f.Name == name {
+			return f
+		}
+	}
+	require.FailNow(t, "function not found", name)
+	return nil
+}
+
+func TestBenchSpy_AggregatePprof(t *testing.T) {
+	p := newTestPprofProfile("cpu", "nanoseconds", [][]string{
+		{"foo", "main"},
+		{"bar", "foo", "main"},
+		// recursion is counted once in cum
+		{"foo", "foo", "main"},
+		{"main"},
+	}, []int64{10, 20, 30, 40})
+
+	fp, err := aggregatePprof(p, "cpu")
+	require.NoError(t, err)
+	assert.Equal(t, "nanoseconds", fp.Unit)
+	assert.Equal(t, int64(100), fp.Total)
+	assert.Equal(t, "main", fp.Functions[0].Name)
+	assert.Equal(t, &FunctionSample{Name: "main", Flat: 40, Cum: 100}, findFunction(t, fp, "main"))
+	assert.Equal(t, &FunctionSample{Name: "foo", Flat: 40, Cum: 60}, findFunction(t, fp, "foo"))
+	assert.Equal(t, &FunctionSample{Name: "bar", Flat: 20, Cum: 20}, findFunction(t, fp, "bar"))
+
+	_, err = aggregatePprof(p, "alloc_space")
+	require.ErrorContains(t, err, "profile has no alloc_space samples")
+}
+
+func TestBenchSpy_ProfileQueryExecutor_Pprof(t *testing.T) {
+	var cpuRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1", r.URL.Query().Get("seconds"))
+		cpuRequests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		_ = newTestPprofProfile("cpu", "nanoseconds", [][]string{{"handler", "main"}, {"main"}}, []int64{30, 10}).Write(w)
+	})
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, _ *http.Request) {
+		p := newTestPprofProfile("alloc_space", "bytes", [][]string{{"cache", "main"}}, []int64{1024})
+		p.SampleType = append(p.SampleType, &profile.ValueType{Type: "inuse_space", Unit: "bytes"})
+		p.Sample[0].Value = append(p.Sample[0].Value, 512)
+		_ = p.Write(w)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	executor, err := NewProfileQueryExecutor("node", &ProfileConfig{PprofURL: srv.URL + "/debug/pprof", CPUProfileWindow: time.Second})
+	require.NoError(t, err)
+	require.Equal(t, ProfileSource_Pprof, executor.Source)
+
+	t.Run("CPU profiles must be captured", func(t *testing.T) {
+		notStarted, err := NewProfileQueryExecutor("node", &ProfileConfig{PprofURL: srv.URL + "/debug/pprof"})
+		require.NoError(t, err)
+		require.ErrorContains(t, notStarted.Execute(context.Background()), "call Start before the test")
+	})
+
+	executor.Start()
+	require.Eventually(t, func() bool { return cpuRequests.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, executor.Execute(context.Background()))
+
+	cpu := executor.Profiles[ProfileCPU]
+	require.NotNil(t, cpu)
+	// all captured profiles are merged
+	captured := int64(cpuRequests.Load())
+	assert.Equal(t, captured*40, cpu.Total)
+	assert.Equal(t, &FunctionSample{Name: "handler", Flat: captured * 30, Cum: captured * 30}, findFunction(t, cpu, "handler"))
+	raw, err := profile.ParseData(cpu.Raw)
+	require.NoError(t, err)
+	assert.Len(t, raw.Sample, 2)
+
+	heap := executor.Profiles[ProfileHeap]
+	require.NotNil(t, heap)
+	assert.Equal(t, "bytes", heap.Unit)
+	assert.Equal(t, int64(512), heap.Total)
+
+	// results survive storing the report
+	report := &StandardReport{BasicData: BasicData{TestName: "profile", CommitOrTag: "v1"}, QueryExecutors: []QueryExecutor{executor}}
+	storage := LocalStorage{Directory: t.TempDir()}
+	_, err = storage.Store(report.TestName, report.CommitOrTag, report)
+	require.NoError(t, err)
+	loaded := &StandardReport{}
+	require.NoError(t, storage.Load(report.TestName, report.CommitOrTag, loaded))
+	require.Len(t, loaded.QueryExecutors, 1)
+	loadedExecutor, ok := loaded.QueryExecutors[0].(*ProfileQueryExecutor)
+	require.True(t, ok)
+	require.NoError(t, loadedExecutor.IsComparable(executor))
+	assert.Equal(t, executor.Profiles, loadedExecutor.Profiles)
+}
+
+func TestBenchSpy_ProfileQueryExecutor_Pyroscope(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/render", r.URL.Path)
+		require.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		require.Equal(t, `node.cpu{test="profile"}`, r.URL.Query().Get("query"))
+		require.Equal(t, "1700000000", r.URL.Query().Get("from"))
+		require.Equal(t, "1700000060", r.URL.Query().Get("until"))
+		_, _ = w.Write([]byte(`{
+			"flamebearer": {
+				"names": ["total", "main", "foo", "bar"],
+				"levels": [
+					[0, 100, 0, 0],
+					[0, 100, 10, 1],
+					[0, 60, 40, 2, 0, 30, 30, 3],
+					[0, 20, 20, 2]
+				]
+			},
+			"metadata": {"units": "samples"}
+		}`))
+	}))
+	defer srv.Close()
+
+	executor, err := NewProfileQueryExecutor("node", &ProfileConfig{
+		PyroscopeURL:         srv.URL,
+		PyroscopeApplication: "node",
+		PyroscopeLabels:      map[string]string{"test": "profile"},
+		PyroscopeKey:         "key",
+	}, ProfileCPU)
+	require.NoError(t, err)
+	executor.TimeRange(start, start.Add(time.Minute))
+	require.NoError(t, executor.Execute(context.Background()))
+
+	cpu := executor.Profiles[ProfileCPU]
+	assert.Equal(t, "samples", cpu.Unit)
+	assert.Equal(t, int64(100), cpu.Total)
+	assert.Equal(t, &FunctionSample{Name: "main", Flat: 10, Cum: 100}, findFunction(t, cpu, "main"))
+	// the recursive call of foo is counted once in cum
+	assert.Equal(t, &FunctionSample{Name: "foo", Flat: 60, Cum: 60}, findFunction(t, cpu, "foo"))
+	assert.Equal(t, &FunctionSample{Name: "bar", Flat: 30, Cum: 30}, findFunction(t, cpu, "bar"))
+
+	_, err = NewProfileQueryExecutor("node", &ProfileConfig{PyroscopeURL: srv.URL})
+	require.ErrorContains(t, err, "application name of Pyroscope profiles must be set")
+	_, err = NewProfileQueryExecutor("node", &ProfileConfig{PprofURL: srv.URL}, "goroutines")
+	require.ErrorContains(t, err, "unknown profile type goroutines")
+}
+
+func TestBenchSpy_DiffProfiles(t *testing.T) {
+	newReport := func(commit string, functions ...*FunctionSample) *StandardReport {
+		var total int64
+		for _, f := range functions {
+			total += f.Flat
+		}
+		return &StandardReport{
+			BasicData: BasicData{TestName: "profile", CommitOrTag: commit},
+			QueryExecutors: []QueryExecutor{&ProfileQueryExecutor{
+				KindName:     ProfileQueryExecutorKind,
+				Name:         "node",
+				ProfileTypes: []string{ProfileCPU},
+				Profiles:     map[string]*FunctionProfile{ProfileCPU: {Unit: "nanoseconds", Total: total, Functions: functions}},
+			}},
+		}
+	}
+	previous := newReport("v1",
+		&FunctionSample{Name: "main", Flat: 50, Cum: 100},
+		&FunctionSample{Name: "encode", Flat: 30, Cum: 30},
+		&FunctionSample{Name: "hash", Flat: 20, Cum: 20},
+	)
+	// twice as long test, encoding takes a larger share and a new function appeared
+	current := newReport("v2",
+		&FunctionSample{Name: "main", Flat: 80, Cum: 200},
+		&FunctionSample{Name: "encode", Flat: 90, Cum: 90},
+		&FunctionSample{Name: "hash", Flat: 20, Cum: 20},
+		&FunctionSample{Name: "compress", Flat: 10, Cum: 10},
+	)
+
+	diffs, err := DiffProfiles(current, previous, 2)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	d := diffs[0]
+	assert.Equal(t, "node", d.Name)
+	assert.Equal(t, ProfileCPU, d.ProfileType)
+	// the largest changes of the share come first
+	require.Len(t, d.Functions, 2)
+	encode := d.Functions[0]
+	assert.Equal(t, "encode", encode.Name)
+	assert.InDelta(t, 30, encode.PreviousFlat, 0.001)
+	assert.InDelta(t, 45, encode.CurrentFlat, 0.001)
+	assert.InDelta(t, 15, encode.FlatDiff, 0.001)
+	assert.Equal(t, "hash", d.Functions[1].Name)
+	assert.InDelta(t, -10, d.Functions[1].FlatDiff, 0.001)
+
+	diffs, err = DiffProfiles(current, previous, 0)
+	require.NoError(t, err)
+	require.Len(t, diffs[0].Functions, 4)
+	assert.Equal(t, "main", diffs[0].Functions[2].Name)
+	// main is still on every stack
+	assert.InDelta(t, 0, diffs[0].Functions[2].CumDiff, 0.001)
+	compress := diffs[0].Functions[3]
+	assert.Equal(t, "compress", compress.Name)
+	assert.InDelta(t, 5, compress.FlatDiff, 0.001)
+
+	html := &bytes.Buffer{}
+	require.NoError(t, current.HTML(html, previous))
+	assert.Contains(t, html.String(), "<h3>node: cpu</h3>")
+	assert.Contains(t, html.String(), `<td class="worse">&#43;15.00</td>`)
+
+	failed, err := CompareProfilesWithThreshold(20, current, previous)
+	require.NoError(t, err)
+	assert.False(t, failed)
+	failed, err = CompareProfilesWithThreshold(10, current, previous)
+	assert.True(t, failed)
+	require.ErrorContains(t, err, "flat share of encode grew by 15.0000 percentage points")
+	assert.NotContains(t, err.Error(), "compress")
+	_, err = CompareProfilesWithThreshold(-1, current, previous)
+	require.ErrorContains(t, err, "not in the range")
+
+	_, err = DiffProfiles(current, newReport("v3"), 2)
+	require.NoError(t, err)
+	previous.QueryExecutors = nil
+	_, err = DiffProfiles(current, previous, 2)
+	require.ErrorContains(t, err, "profiles of node are missing from the previous report")
+}
@@ -76,11 +76,17 @@ func NewPrometheusQueryExecutor(queries map[string]string, config *PrometheusCon
 // based on the provided time range and configuration. It simplifies the process of generating
 // queries for Prometheus, making it easier to integrate Prometheus data into reports.
 func NewStandardPrometheusQueryExecutor(startTime, endTime time.Time, config *PrometheusConfig) (*PrometheusQueryExecutor, error) {
+	return NewPrometheusQueryExecutorFromRegistry(DefaultMetricRegistry, startTime, endTime, config)
+}
+
+// NewPrometheusQueryExecutorFromRegistry creates a PrometheusQueryExecutor with queries of all metrics in the registry that support Prometheus,
+// generated for each of the name regex patterns from the configuration.
+func NewPrometheusQueryExecutorFromRegistry(registry *MetricRegistry, startTime, endTime time.Time, config *PrometheusConfig) (*PrometheusQueryExecutor, error) {
 	p := &PrometheusQueryExecutor{}
 
 	standardQueries := make(map[string]string)
 	for _, nameRegexPattern := range config.NameRegexPatterns {
-		queries, queryErr := p.generateStandardQueries(nameRegexPattern, startTime, endTime)
+		queries, queryErr := p.generateStandardQueries(registry, nameRegexPattern, startTime, endTime)
 		if queryErr != nil {
 			return nil, errors.Wrapf(queryErr, "failed to generate standard queries for %s", nameRegexPattern)
 		}
@@ -264,38 +270,19 @@ func (r *PrometheusQueryExecutor) TimeRange(startTime, endTime time.Time) {
 	r.EndTime = endTime
 }
 
-func (r *PrometheusQueryExecutor) standardQuery(metric StandardResourceMetric, nameRegexPattern string, startTime, endTime time.Time) (string, error) {
-	duration := calculateTimeRange(startTime, endTime)
-	switch metric {
-	case MedianCPUUsage:
-		return fmt.Sprintf(Prometheus_MedianCPU, nameRegexPattern, duration), nil
-	case P95CPUUsage:
-		return fmt.Sprintf(Prometheus_P95CPU, nameRegexPattern, duration), nil
-	case MaxCPUUsage:
-		return fmt.Sprintf(Prometheus_MaxCPU, nameRegexPattern, duration), nil
-	case MedianMemUsage:
-		return fmt.Sprintf(Prometheus_MedianMem, nameRegexPattern, duration), nil
-	case P95MemUsage:
-		return fmt.Sprintf(Prometheus_P95Mem, nameRegexPattern, duration), nil
-	case MaxMemUsage:
-		return fmt.Sprintf(Prometheus_MaxMem, nameRegexPattern, duration), nil
-	default:
-		return "", fmt.Errorf("unsupported standard metric %s", metric)
-	}
-}
-
-func (r *PrometheusQueryExecutor) generateStandardQueries(nameRegexPattern string, startTime, endTime time.Time) (map[string]string, error) {
+func (r *PrometheusQueryExecutor) generateStandardQueries(registry *MetricRegistry, nameRegexPattern string, startTime, endTime time.Time) (map[string]string, error) {
 	L.Debug().
 		Msg("Generating standard Prometheus queries")
 
+	if registry == nil {
+		return nil, errors.New("metric registry is nil")
+	}
+
 	standardQueries := make(map[string]string)
 
-	for _, metric := range StandardResourceMetrics {
-		query, err := r.standardQuery(metric, nameRegexPattern, startTime, endTime)
-		if err != nil {
-			return nil, err
-		}
-		standardQueries[string(metric)] = query
+	params := MetricQueryParams{NameRegexPattern: nameRegexPattern, StartTime: startTime, EndTime: endTime}
+	for _, metric := range registry.Metrics(StandardQueryExecutor_Prometheus) {
+		standardQueries[metric.Name] = metric.Prometheus(params)
 	}
 
 	L.Debug().
@@ -6,6 +6,7 @@ import (
 	goerrors "errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/olekukonko/tablewriter"
@@ -20,25 +21,34 @@ type StandardReport struct {
 	BasicData
 	LocalStorage
 	QueryExecutors []QueryExecutor `json:"query_executors"`
+	// Storage is used instead of LocalStorage if set, ex.: S3Storage or HTTPStorage
+	Storage ReportStorage `json:"-"`
 }
 
-// Store saves the report to local storage as a JSON file.
-// It returns the absolute path of the stored file and any error encountered.
+func (b *StandardReport) storage() ReportStorage {
+	if b.Storage != nil {
+		return b.Storage
+	}
+	return &b.LocalStorage
+}
+
+// Store saves the report to Storage, or to local storage as a JSON file if Storage isn't set.
+// It returns the location of the stored report and any error encountered.
 func (b *StandardReport) Store() (string, error) {
-	return b.LocalStorage.Store(b.TestName, b.CommitOrTag, b)
+	return b.storage().Store(b.TestName, b.CommitOrTag, b)
 }
 
 // Load retrieves a report based on the specified test name and commit or tag.
 // It utilizes local storage to find and decode the corresponding report file,
 // ensuring that the report is available for further processing or analysis.
 func (b *StandardReport) Load(testName, commitOrTag string) error {
-	return b.LocalStorage.Load(testName, commitOrTag, b)
+	return b.storage().Load(testName, commitOrTag, b)
 }
 
 // LoadLatest retrieves the most recent report for the specified test name from local storage.
 // It returns an error if the report cannot be loaded, enabling users to access historical test data efficiently.
 func (b *StandardReport) LoadLatest(testName string) error {
-	return b.LocalStorage.Load(testName, "", b)
+	return b.storage().Load(testName, "", b)
 }
 
 // ResultsAs retrieves and casts results from a query executor to a specified type.
@@ -167,6 +177,7 @@ func calculateDiffPercentage(current, previous float64) float64 {
 
 // CompareDirectWithThresholds evaluates the current and previous reports against specified thresholds.
 // It checks for significant differences in metrics and returns any discrepancies found, aiding in performance analysis.
+// Standard load metrics are compared with given thresholds, other Direct metrics of the DefaultMetricRegistry with their own ones.
 func CompareDirectWithThresholds(medianThreshold, p95Threshold, maxThreshold, errorRateThreshold float64, currentReport, previousReport *StandardReport) (bool, error) {
 	if currentReport == nil || previousReport == nil {
 		return true, errors.New("one or both reports are nil")
@@ -185,72 +196,199 @@ func CompareDirectWithThresholds(medianThreshold, p95Threshold, maxThreshold, er
 		return true, thresholdsErr
 	}
 
-	allCurrentResults := MustAllDirectResults(currentReport)
-	allPreviousResults := MustAllDirectResults(previousReport)
-
-	var compareValues = func(
-		metricName, generatorName string,
-		maxDiffPercentage float64,
-	) error {
-		if _, ok := allCurrentResults[generatorName]; !ok {
-			return fmt.Errorf("generator %s results were missing from current report", generatorName)
+	registry := DefaultMetricRegistry.Clone()
+	for metric, threshold := range map[StandardLoadMetric]float64{
+		MedianLatency:       medianThreshold,
+		Percentile95Latency: p95Threshold,
+		MaxLatency:          maxThreshold,
+		ErrorRate:           errorRateThreshold,
+	} {
+		if err := registry.SetThreshold(string(metric), threshold); err != nil {
+			return true, err
 		}
+	}
 
-		if _, ok := allPreviousResults[generatorName]; !ok {
-			return fmt.Errorf("generator %s results were missing from previous report", generatorName)
-		}
+	errors := compareResultsWithThresholds(registry, StandardQueryExecutor_Direct, currentReport, previousReport)
 
-		currentForGenerator := allCurrentResults[generatorName]
-		previousForGenerator := allPreviousResults[generatorName]
+	printMetrics(registry, StandardQueryExecutor_Direct, currentReport, previousReport)
 
-		if _, ok := currentForGenerator[metricName]; !ok {
-			return fmt.Errorf("%s metric results were missing from current report for generator %s", metricName, generatorName)
-		}
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Number of meaningful differences", len(errors)).
+		Msg("Finished comparing Direct metrics with thresholds")
+
+	return len(errors) > 0, concatenateGeneratorErrors(errors)
+}
+
+// CompareMetricsWithThresholds compares results of all Direct, Loki and Prometheus executors of both reports for every metric
+// in the registry that has a threshold. Metrics fail the comparison if they got worse, in the direction of the metric, by more than
+// their threshold. Errors are grouped by generator name for Direct executors, by "loki <generator name>" for Loki executors
+// and by "prometheus" for Prometheus ones.
+func CompareMetricsWithThresholds(registry *MetricRegistry, currentReport, previousReport *StandardReport) (bool, error) {
+	if currentReport == nil || previousReport == nil {
+		return true, errors.New("one or both reports are nil")
+	}
+	if registry == nil {
+		return true, errors.New("metric registry is nil")
+	}
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Metrics", len(registry.Metrics())).
+		Msg("Comparing metrics with thresholds")
 
-		if _, ok := previousForGenerator[metricName]; !ok {
-			return fmt.Errorf("%s metric results were missing from previous report for generator %s", metricName, generatorName)
+	errors := make(map[string][]error)
+	for _, kind := range []StandardQueryExecutorType{StandardQueryExecutor_Direct, StandardQueryExecutor_Loki, StandardQueryExecutor_Prometheus} {
+		if len(executorResults(currentReport, kind)) == 0 {
+			continue
+		}
+		for name, errs := range compareResultsWithThresholds(registry, kind, currentReport, previousReport) {
+			errors[name] = append(errors[name], errs...)
 		}
+	}
+
+	PrintMetrics(registry, currentReport, previousReport)
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Number of meaningful differences", len(errors)).
+		Msg("Finished comparing metrics with thresholds")
 
-		currentMetric := currentForGenerator[metricName]
-		previousMetric := previousForGenerator[metricName]
+	return len(errors) > 0, concatenateGeneratorErrors(errors)
+}
 
-		diffPrecentage := calculateDiffPercentage(currentMetric, previousMetric)
-		if diffPrecentage > maxDiffPercentage {
-			return fmt.Errorf("%s is %.4f%% different, which is higher than the threshold %.4f%%", metricName, diffPrecentage, maxDiffPercentage)
+// executorResults returns results of all executors of given kind by generator name,
+// results of executors without a generator, like Prometheus ones, are merged under an empty name
+func executorResults(sr *StandardReport, kind StandardQueryExecutorType) map[string]map[string]interface{} {
+	results := make(map[string]map[string]interface{})
+	for _, queryExecutor := range sr.QueryExecutors {
+		if !strings.EqualFold(queryExecutor.Kind(), string(kind)) {
+			continue
+		}
+		var name string
+		if asNamedGenerator, ok := queryExecutor.(NamedGenerator); ok {
+			name = asNamedGenerator.GeneratorName()
+		}
+		if _, ok := results[name]; !ok {
+			results[name] = make(map[string]interface{})
+		}
+		for queryName, result := range queryExecutor.Results() {
+			results[name][queryName] = result
 		}
+	}
+	return results
+}
 
-		return nil
+// executorLabel returns the name errors and printed tables of executors of given kind are grouped by
+func executorLabel(kind StandardQueryExecutorType, generatorName string) string {
+	switch kind {
+	case StandardQueryExecutor_Direct:
+		return generatorName
+	case StandardQueryExecutor_Prometheus:
+		return string(StandardQueryExecutor_Prometheus)
+	default:
+		return string(kind) + " " + generatorName
 	}
+}
 
-	errors := make(map[string][]error)
+func compareResultsWithThresholds(registry *MetricRegistry, kind StandardQueryExecutorType, currentReport, previousReport *StandardReport) map[string][]error {
+	allCurrentResults := executorResults(currentReport, kind)
+	allPreviousResults := executorResults(previousReport, kind)
 
-	for _, genCfg := range currentReport.GeneratorConfigs {
-		if err := compareValues(string(MedianLatency), genCfg.GenName, medianThreshold); err != nil {
-			errors[genCfg.GenName] = append(errors[genCfg.GenName], err)
+	var names []string
+	if kind == StandardQueryExecutor_Direct {
+		// every generator is expected to have Direct results
+		for _, genCfg := range currentReport.GeneratorConfigs {
+			names = append(names, genCfg.GenName)
+		}
+	} else {
+		for name := range allCurrentResults {
+			names = append(names, name)
 		}
+	}
 
-		if err := compareValues(string(Percentile95Latency), genCfg.GenName, p95Threshold); err != nil {
-			errors[genCfg.GenName] = append(errors[genCfg.GenName], err)
+	var missing = func(name, report string) error {
+		if kind == StandardQueryExecutor_Prometheus {
+			return fmt.Errorf("prometheus results were missing from %s report", report)
 		}
+		return fmt.Errorf("generator %s results were missing from %s report", name, report)
+	}
 
-		if err := compareValues(string(MaxLatency), genCfg.GenName, maxThreshold); err != nil {
-			errors[genCfg.GenName] = append(errors[genCfg.GenName], err)
+	errors := make(map[string][]error)
+	for _, name := range names {
+		label := executorLabel(kind, name)
+		currentForGenerator, ok := allCurrentResults[name]
+		if !ok {
+			errors[label] = append(errors[label], missing(name, "current"))
+			continue
+		}
+		previousForGenerator, ok := allPreviousResults[name]
+		if !ok {
+			errors[label] = append(errors[label], missing(name, "previous"))
+			continue
 		}
 
-		if err := compareValues(string(ErrorRate), genCfg.GenName, errorRateThreshold); err != nil {
-			errors[genCfg.GenName] = append(errors[genCfg.GenName], err)
+		for _, metric := range registry.Metrics(kind) {
+			if !metric.hasThreshold() {
+				continue
+			}
+			currentMetric, ok := currentForGenerator[metric.Name]
+			if !ok {
+				errors[label] = append(errors[label], fmt.Errorf("%s metric results were missing from current report for generator %s", metric.Name, name))
+				continue
+			}
+			previousMetric, ok := previousForGenerator[metric.Name]
+			if !ok {
+				errors[label] = append(errors[label], fmt.Errorf("%s metric results were missing from previous report for generator %s", metric.Name, name))
+				continue
+			}
+			if errs := compareMetric(metric, currentMetric, previousMetric); len(errs) > 0 {
+				errors[label] = append(errors[label], errs...)
+			}
 		}
 	}
 
-	PrintStandardDirectMetrics(currentReport, previousReport)
+	return errors
+}
 
-	L.Info().
-		Str("Current report", currentReport.CommitOrTag).
-		Str("Previous report", previousReport.CommitOrTag).
-		Int("Number of meaningful differences", len(errors)).
-		Msg("Finished comparing Direct metrics with thresholds")
+// compareMetric returns an error for every series of the metric that got worse by more than its threshold
+func compareMetric(metric *Metric, current, previous interface{}) []error {
+	currentValues, err := metricValues(metric, current)
+	if err != nil {
+		return []error{err}
+	}
+	previousValues, err := metricValues(metric, previous)
+	if err != nil {
+		return []error{err}
+	}
 
-	return len(errors) > 0, concatenateGeneratorErrors(errors)
+	var errs []error
+	for _, series := range sortedSeries(currentValues) {
+		name := metric.Name + series
+		previousValue, ok := previousValues[series]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s metric results were missing from previous report", name))
+			continue
+		}
+		if worse := metric.worseBy(currentValues[series], previousValue); worse > metric.Threshold {
+			diffPrecentage := calculateDiffPercentage(currentValues[series], previousValue)
+			if metric.HigherIsBetter() {
+				errs = append(errs, fmt.Errorf("%s is %.4f%% different, which is lower than the threshold -%.4f%%", name, diffPrecentage, metric.Threshold))
+			} else {
+				errs = append(errs, fmt.Errorf("%s is %.4f%% different, which is higher than the threshold %.4f%%", name, diffPrecentage, metric.Threshold))
+			}
+		}
+	}
+	for _, series := range sortedSeries(previousValues) {
+		if _, ok := currentValues[series]; !ok {
+			errs = append(errs, fmt.Errorf("%s metric results were missing from current report", metric.Name+series))
+		}
+	}
+
+	return errs
 }
 
 func concatenateGeneratorErrors(errors map[string][]error) error {
@@ -293,28 +431,69 @@ func validateThresholds(medianThreshold, p95Threshold, maxThreshold, errorRateTh
 }
 
 // PrintStandardDirectMetrics outputs a comparison of direct metrics between two reports.
-// It displays the current and previous values along with the percentage difference for each metric,
+// It displays the current and previous values along with the percentage difference for each Direct metric of the DefaultMetricRegistry,
 // helping users to quickly assess performance changes across different generator configurations.
 func PrintStandardDirectMetrics(currentReport, previousReport *StandardReport) {
-	currentResults := MustAllDirectResults(currentReport)
-	previousResults := MustAllDirectResults(previousReport)
+	printMetrics(DefaultMetricRegistry, StandardQueryExecutor_Direct, currentReport, previousReport)
+}
+
+// PrintMetrics outputs a comparison of all metrics of the registry computed by Direct, Loki and Prometheus executors of both reports.
+// It prints a table for each executor with the current and previous values and the percentage difference.
+func PrintMetrics(registry *MetricRegistry, currentReport, previousReport *StandardReport) {
+	for _, kind := range []StandardQueryExecutorType{StandardQueryExecutor_Direct, StandardQueryExecutor_Loki, StandardQueryExecutor_Prometheus} {
+		printMetrics(registry, kind, currentReport, previousReport)
+	}
+}
+
+func printMetrics(registry *MetricRegistry, kind StandardQueryExecutorType, currentReport, previousReport *StandardReport) {
+	currentResults := executorResults(currentReport, kind)
+	previousResults := executorResults(previousReport, kind)
 
-	for _, genCfg := range currentReport.GeneratorConfigs {
-		generatorName := genCfg.GenName
+	names := make([]string, 0, len(currentResults))
+	for name := range currentResults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
 		table := tablewriter.NewWriter(os.Stderr)
 		table.SetHeader([]string{"Metric", previousReport.CommitOrTag, currentReport.CommitOrTag, "Diff %"})
 
-		for _, metricName := range StandardLoadMetrics {
-			metricString := string(metricName)
-			diff := calculateDiffPercentage(currentResults[generatorName][metricString], previousResults[generatorName][metricString])
-			table.Append([]string{metricString, fmt.Sprintf("%.4f", previousResults[genCfg.GenName][metricString]), fmt.Sprintf("%.4f", currentResults[genCfg.GenName][metricString]), fmt.Sprintf("%.4f", diff)})
+		for _, metric := range registry.Metrics(kind) {
+			currentValues, currentErr := metricValuesIfPresent(metric, currentResults[name])
+			previousValues, previousErr := metricValuesIfPresent(metric, previousResults[name])
+			if currentErr != nil || previousErr != nil {
+				L.Warn().
+					AnErr("Current", currentErr).
+					AnErr("Previous", previousErr).
+					Str("Metric", metric.Name).
+					Msg("Failed to get metric values, skipping it")
+				continue
+			}
+			for _, series := range sortedSeries(currentValues) {
+				previousValue, ok := previousValues[series]
+				if !ok {
+					table.Append([]string{metric.Name + series, "-", fmt.Sprintf("%.4f", currentValues[series]), "-"})
+					continue
+				}
+				diff := calculateDiffPercentage(currentValues[series], previousValue)
+				table.Append([]string{metric.Name + series, fmt.Sprintf("%.4f", previousValue), fmt.Sprintf("%.4f", currentValues[series]), fmt.Sprintf("%.4f", diff)})
+			}
 		}
 
 		table.SetBorder(true)
 		table.SetRowLine(true)
 		table.SetAlignment(tablewriter.ALIGN_LEFT)
 
-		title := "Generator: " + generatorName
+		var title string
+		switch kind {
+		case StandardQueryExecutor_Direct:
+			title = "Generator: " + name
+		case StandardQueryExecutor_Prometheus:
+			title = "Prometheus"
+		default:
+			title = "Loki generator: " + name
+		}
 		fmt.Println(title)
 		fmt.Println(strings.Repeat("=", len(title)))
 
@@ -322,6 +501,15 @@ func PrintStandardDirectMetrics(currentReport, previousReport *StandardReport) {
 	}
 }
 
+// metricValuesIfPresent returns no values if the metric is not among the results
+func metricValuesIfPresent(metric *Metric, results map[string]interface{}) (map[string]float64, error) {
+	result, ok := results[metric.Name]
+	if !ok {
+		return map[string]float64{}, nil
+	}
+	return metricValues(metric, result)
+}
+
 // FetchData retrieves data for the report within the specified time range.
 // It validates the time range and executes queries in parallel, returning any errors encountered during execution.
 func (b *StandardReport) FetchData(ctx context.Context) error {
@@ -404,9 +592,14 @@ func (b *StandardReport) IsComparable(otherReport Reporter) error {
 type standardReportConfig struct {
 	executorTypes    []StandardQueryExecutorType
 	generators       []*wasp.Generator
+	metricRegistry   *MetricRegistry
 	prometheusConfig *PrometheusConfig
 	queryExecutors   []QueryExecutor
 	reportDirectory  string
+	reportStorage    ReportStorage
+	resultsFile      string
+	// includeFailedSamples is passed to DirectQueryExecutor.IncludeFailedSamples
+	includeFailedSamples bool
 }
 
 type StandardReportOption func(*standardReportConfig)
@@ -428,6 +621,14 @@ func WithGenerators(generators ...*wasp.Generator) StandardReportOption {
 	}
 }
 
+// WithMetricRegistry sets the registry standard Direct, Loki and Prometheus query executors generate their queries from.
+// DefaultMetricRegistry is used if it's not set.
+func WithMetricRegistry(registry *MetricRegistry) StandardReportOption {
+	return func(c *standardReportConfig) {
+		c.metricRegistry = registry
+	}
+}
+
 // WithPrometheusConfig sets the Prometheus configuration for the standard report.
 // It returns a StandardReportOption that can be used to customize report generation.
 func WithPrometheusConfig(prometheusConfig *PrometheusConfig) StandardReportOption {
@@ -436,6 +637,14 @@ func WithPrometheusConfig(prometheusConfig *PrometheusConfig) StandardReportOpti
 	}
 }
 
+// WithResultsFile adds generators loaded from a results file written by wasp.FileSink.
+// It allows building a report offline, without Loki and without running the generators in the same process.
+func WithResultsFile(path string) StandardReportOption {
+	return func(c *standardReportConfig) {
+		c.resultsFile = path
+	}
+}
+
 // WithReportDirectory sets the directory for storing report files.
 // This function is useful for configuring the output location of reports
 // generated by the standard reporting system.
@@ -445,6 +654,22 @@ func WithReportDirectory(reportDirectory string) StandardReportOption {
 	}
 }
 
+// WithReportStorage sets the storage reports are stored to and loaded from instead of the local report directory.
+// Use it with S3Storage or HTTPStorage to keep baselines between ephemeral CI runs.
+func WithReportStorage(storage ReportStorage) StandardReportOption {
+	return func(c *standardReportConfig) {
+		c.reportStorage = storage
+	}
+}
+
+// WithFailedLatencySamples adds latencies of failed responses to the latency samples of Direct query executors.
+// By default only successful responses are sampled, so fast failures can't make a run look faster in statistical tests.
+func WithFailedLatencySamples() StandardReportOption {
+	return func(c *standardReportConfig) {
+		c.includeFailedSamples = true
+	}
+}
+
 // WithQueryExecutors sets the query executors for a standard report configuration.
 // It allows customization of how queries are executed, enhancing report generation flexibility.
 func WithQueryExecutors(queryExecutors ...QueryExecutor) StandardReportOption {
@@ -475,6 +700,10 @@ func (c *standardReportConfig) validate() error {
 		return errors.New("generators are not set, at least one is required")
 	}
 
+	if c.metricRegistry == nil {
+		return errors.New("metric registry is nil")
+	}
+
 	if c.prometheusConfig != WithoutPrometheus {
 		if !hasPrometehus {
 			return errors.New("prometheus config is set, but query executor type is not set to prometheus")
@@ -502,11 +731,19 @@ func NewStandardReport(commitOrTag string, opts ...StandardReportOption) (*Stand
 		Str("Reference", commitOrTag).
 		Msg("Creating new standard report")
 
-	config := standardReportConfig{}
+	config := standardReportConfig{metricRegistry: DefaultMetricRegistry}
 	for _, opt := range opts {
 		opt(&config)
 	}
 
+	if config.resultsFile != "" {
+		results, loadErr := wasp.LoadResultsFile(config.resultsFile)
+		if loadErr != nil {
+			return nil, errors.Wrapf(loadErr, "failed to load results file %s", config.resultsFile)
+		}
+		config.generators = append(config.generators, results.Generators()...)
+	}
+
 	basicData, basicErr := NewBasicData(commitOrTag, config.generators...)
 	if basicErr != nil {
 		var generatorNames string
@@ -550,6 +787,7 @@ func NewStandardReport(commitOrTag string, opts ...StandardReportOption) (*Stand
 	if config.reportDirectory != "" {
 		sr.LocalStorage.Directory = config.reportDirectory
 	}
+	sr.Storage = config.reportStorage
 
 	L.Info().
 		Str("Reference", commitOrTag).
@@ -565,7 +803,7 @@ func initPrometheusQueryExecutor(config standardReportConfig, basicData *BasicDa
 	if config.prometheusConfig != WithoutPrometheus {
 		// not ideal, but we want to follow the same pattern as with other executors
 		for _, n := range config.prometheusConfig.NameRegexPatterns {
-			prometheusExecutor, prometheusErr := NewStandardPrometheusQueryExecutor(basicData.TestStart, basicData.TestEnd, NewPrometheusConfig(config.prometheusConfig.Url, n))
+			prometheusExecutor, prometheusErr := NewPrometheusQueryExecutorFromRegistry(config.metricRegistry, basicData.TestStart, basicData.TestEnd, NewPrometheusConfig(config.prometheusConfig.Url, n))
 			if prometheusErr != nil {
 				return nil, errors.Wrapf(prometheusErr, "failed to create Prometheus executor for name patterns: %s", strings.Join(config.prometheusConfig.NameRegexPatterns, ", "))
 			}
@@ -585,12 +823,20 @@ func initStandardLoadExecutors(config standardReportConfig, basicData *BasicData
 	if len(config.executorTypes) != 0 {
 		for _, g := range config.generators {
 			for _, exType := range config.executorTypes {
+				// capacity is reported only for generators run with capacity search
+				if exType == StandardQueryExecutor_Capacity && g.Cfg.CapacitySearch == nil {
+					continue
+				}
 				if exType != StandardQueryExecutor_Prometheus {
-					executor, executorErr := initStandardQueryExecutor(exType, basicData, g)
+					executor, executorErr := initStandardQueryExecutor(exType, basicData, g, config.metricRegistry)
 					if executorErr != nil {
 						return nil, errors.Wrapf(executorErr, "failed to create standard %s query executor for generator %s", exType, g.Cfg.GenName)
 					}
 
+					if direct, ok := executor.(*DirectQueryExecutor); ok {
+						direct.IncludeFailedSamples = config.includeFailedSamples
+					}
+
 					validateErr := executor.Validate()
 					if validateErr != nil {
 						return nil, errors.Wrapf(validateErr, "failed to validate queries for generator %s", g.Cfg.GenName)
@@ -605,23 +851,36 @@ func initStandardLoadExecutors(config standardReportConfig, basicData *BasicData
 	return queryExecutors, nil
 }
 
-func initStandardQueryExecutor(kind StandardQueryExecutorType, basicData *BasicData, g *wasp.Generator) (QueryExecutor, error) {
+func initStandardQueryExecutor(kind StandardQueryExecutorType, basicData *BasicData, g *wasp.Generator, registry *MetricRegistry) (QueryExecutor, error) {
 	switch kind {
 	case StandardQueryExecutor_Loki:
 		if !generatorHasLabels(g) {
 			return nil, fmt.Errorf("generator %s is missing branch or commit labels", g.Cfg.GenName)
 		}
-		executor, executorErr := NewStandardMetricsLokiExecutor(g.Cfg.LokiConfig, basicData.TestName, g.Cfg.GenName, g.Cfg.Labels["branch"], g.Cfg.Labels["commit"], basicData.TestStart, basicData.TestEnd)
+		executor, executorErr := NewLokiQueryExecutorFromRegistry(registry, g.Cfg.LokiConfig, MetricQueryParams{
+			TestName:      basicData.TestName,
+			GeneratorName: g.Cfg.GenName,
+			Branch:        g.Cfg.Labels["branch"],
+			Commit:        g.Cfg.Labels["commit"],
+			StartTime:     basicData.TestStart,
+			EndTime:       basicData.TestEnd,
+		})
 		if executorErr != nil {
 			return nil, errors.Wrapf(executorErr, "failed to create standard Loki query executor for generator %s", g.Cfg.GenName)
 		}
 		return executor, nil
 	case StandardQueryExecutor_Direct:
-		executor, executorErr := NewStandardDirectQueryExecutor(g)
+		executor, executorErr := NewDirectQueryExecutorFromRegistry(g, registry)
 		if executorErr != nil {
 			return nil, errors.Wrapf(executorErr, "failed to create standard generator query executor for generator %s", g.Cfg.GenName)
 		}
 		return executor, nil
+	case StandardQueryExecutor_Capacity:
+		executor, executorErr := NewCapacityQueryExecutor(g)
+		if executorErr != nil {
+			return nil, errors.Wrapf(executorErr, "failed to create capacity query executor for generator %s", g.Cfg.GenName)
+		}
+		return executor, nil
 	default:
 		return nil, fmt.Errorf("unknown standard query executor type: %s", kind)
 	}
@@ -653,7 +912,10 @@ func (s *StandardReport) UnmarshalJSON(data []byte) error {
 		return queryErr
 	}
 
+	// storage isn't serialised, keep the one the report was loaded with
+	storage := s.Storage
 	*s = StandardReport(raw.Alias)
+	s.Storage = storage
 	s.QueryExecutors = queryExecutors
 	return nil
 }
@@ -682,6 +944,10 @@ func unmarshallQueryExecutors(raw []json.RawMessage) ([]QueryExecutor, error) {
 			executor = &DirectQueryExecutor{}
 		case "prometheus":
 			executor = &PrometheusQueryExecutor{}
+		case "capacity":
+			executor = &CapacityQueryExecutor{}
+		case ProfileQueryExecutorKind:
+			executor = &ProfileQueryExecutor{}
 		default:
 			return nil, fmt.Errorf("unknown query executor type: %s\nIf you added a new query executor make sure to add a custom JSON unmarshaller to StandardReport.UnmarshalJSON()", typeIndicator.Kind)
 		}
@@ -804,6 +1070,7 @@ func FetchNewStandardReportAndLoadLatestPrevious(ctx context.Context, newCommitO
 
 	previousReport := &StandardReport{
 		LocalStorage: localStorage,
+		Storage:      config.reportStorage,
 	}
 
 	if err = previousReport.LoadLatest(newReport.TestName); err != nil {
@@ -0,0 +1,667 @@
+package benchspy
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	htmlChartWidth   = 720
+	htmlChartHeight  = 220
+	htmlChartPadding = 40
+	// htmlHistogramBins is the number of bins of latency histograms
+	htmlHistogramBins = 30
+	// htmlSeriesClasses is the number of distinct series colours, further series reuse them
+	htmlSeriesClasses = 8
+)
+
+// htmlPercentiles are the latency percentiles compared in the HTML report
+var htmlPercentiles = []float64{50, 90, 95, 99, 100}
+
+// HTML writes the report as a single self-contained HTML page that can be attached as a CI artifact and viewed offline.
+// It contains generator configs, numeric metrics of all query executors, latency distributions of Direct query executors,
+// Loki series and Prometheus resource usage. If previousReport isn't nil, everything is compared against it as the baseline,
+// including the generator config difference found by IsComparable, and functions whose share of profiles changed the most.
+func (b *StandardReport) HTML(w io.Writer, previousReport *StandardReport) error {
+	data := &htmlReportData{
+		Current:   b,
+		Previous:  previousReport,
+		Resources: newHTMLResources(b, previousReport),
+	}
+	for _, name := range htmlGeneratorNames(b, previousReport) {
+		data.Generators = append(data.Generators, newHTMLGenerator(name, b, previousReport))
+	}
+	if previousReport != nil {
+		profiles, err := DiffProfiles(b, previousReport, DefaultProfileTopN)
+		if err != nil {
+			L.Warn().
+				Err(err).
+				Msg("Failed to compare profiles, they won't be included in the HTML report")
+		}
+		data.Profiles = profiles
+	}
+	return htmlReportTemplate.Execute(w, data)
+}
+
+// StoreHTML writes the HTML report, see HTML, to the file and returns its absolute path.
+func (b *StandardReport) StoreHTML(path string, previousReport *StandardReport) (string, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", errors.Wrapf(err, "failed to create directory %s", dir)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create file %s", path)
+	}
+	defer f.Close()
+	if err := b.HTML(f, previousReport); err != nil {
+		return "", errors.Wrapf(err, "failed to render HTML report")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path, nil
+	}
+
+	L.Info().
+		Str("Test name", b.TestName).
+		Str("Reference", b.CommitOrTag).
+		Str("Path", abs).
+		Msg("HTML report stored successfully")
+
+	return abs, nil
+}
+
+type htmlReportData struct {
+	Current, Previous *StandardReport
+	Generators        []*htmlGenerator
+	Resources         *htmlResources
+	Profiles          []*ProfileDiff
+}
+
+type htmlGenerator struct {
+	Name string
+	// ConfigDifference is the difference found by compareGeneratorConfigs, empty if configs are comparable
+	ConfigDifference string
+	CurrentConfig    string
+	PreviousConfig   string
+	Metrics          []*htmlMetricRow
+	Percentiles      []*htmlMetricRow
+	Charts           []*htmlChart
+}
+
+type htmlMetricRow struct {
+	Executor    string
+	Metric      string
+	Current     string
+	Previous    string
+	DiffPercent string
+	// Class is "worse" or "better" if the metric changed
+	Class string
+}
+
+type htmlResources struct {
+	Charts []*htmlChart
+	Values []*htmlMetricRow
+}
+
+// htmlGeneratorNames returns names of generators of both reports, sorted
+func htmlGeneratorNames(current, previous *StandardReport) []string {
+	names := make(map[string]struct{})
+	for _, r := range []*StandardReport{current, previous} {
+		if r == nil {
+			continue
+		}
+		for name := range r.GeneratorConfigs {
+			names[name] = struct{}{}
+		}
+		for _, qe := range r.QueryExecutors {
+			if named, ok := qe.(NamedGenerator); ok {
+				names[named.GeneratorName()] = struct{}{}
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func newHTMLGenerator(name string, current, previous *StandardReport) *htmlGenerator {
+	g := &htmlGenerator{Name: name}
+	currentCfg := current.GeneratorConfigs[name]
+	if currentCfg != nil {
+		g.CurrentConfig = mustMarshallJSON(currentCfg)
+	}
+	if previous != nil {
+		previousCfg := previous.GeneratorConfigs[name]
+		if previousCfg != nil {
+			g.PreviousConfig = mustMarshallJSON(previousCfg)
+		}
+		switch {
+		case currentCfg == nil && previousCfg == nil:
+		case currentCfg == nil:
+			g.ConfigDifference = "generator config is missing from the current report"
+		case previousCfg == nil:
+			g.ConfigDifference = "generator config is missing from the baseline report"
+		default:
+			// baseline is the expected config
+			if err := compareGeneratorConfigs(previousCfg, currentCfg); err != nil {
+				g.ConfigDifference = err.Error()
+			}
+		}
+	}
+
+	currentMetrics := htmlNumericResults(current, name)
+	previousMetrics := htmlNumericResults(previous, name)
+	for _, k := range htmlSortedKeys(currentMetrics, previousMetrics) {
+		c, hasCurrent := currentMetrics[k]
+		p, hasPrevious := previousMetrics[k]
+		g.Metrics = append(g.Metrics, newHTMLMetricRow(k.executor, k.metric, c, hasCurrent, p, hasPrevious && previous != nil))
+	}
+
+	currentSamples := htmlLatencySamples(current, name)
+	previousSamples := htmlLatencySamples(previous, name)
+	if len(currentSamples) > 0 || len(previousSamples) > 0 {
+		for _, pct := range htmlPercentiles {
+			metric := fmt.Sprintf("p%g", pct)
+			if pct == 100 {
+				metric = "max"
+			}
+			c, hasCurrent := htmlPercentile(currentSamples, pct)
+			p, hasPrevious := htmlPercentile(previousSamples, pct)
+			g.Percentiles = append(g.Percentiles, newHTMLMetricRow(string(StandardQueryExecutor_Direct), metric, c, hasCurrent, p, hasPrevious))
+		}
+		g.Charts = append(g.Charts, newLatencyHistogram(current, previous, currentSamples, previousSamples))
+		g.Charts = append(g.Charts, newLatencyCDF(current, previous, currentSamples, previousSamples))
+	}
+
+	for _, query := range htmlLokiQueries(current, previous, name) {
+		var series []*htmlSeries
+		for _, r := range []*StandardReport{current, previous} {
+			if values := htmlLokiValues(r, name, query); len(values) > 0 {
+				s := &htmlSeries{Name: r.CommitOrTag, Baseline: r == previous}
+				for i, v := range values {
+					s.X = append(s.X, float64(i))
+					s.Y = append(s.Y, v)
+				}
+				series = append(series, s)
+			}
+		}
+		if len(series) > 0 {
+			g.Charts = append(g.Charts, newHTMLChart("Loki: "+query, "sample", "", series))
+		}
+	}
+
+	return g
+}
+
+type htmlMetricKey struct{ executor, metric string }
+
+// htmlNumericResults returns results of all query executors of the generator that can be cast to float64
+func htmlNumericResults(r *StandardReport, generator string) map[htmlMetricKey]float64 {
+	results := make(map[htmlMetricKey]float64)
+	if r == nil {
+		return results
+	}
+	for _, qe := range r.QueryExecutors {
+		named, ok := qe.(NamedGenerator)
+		if !ok || named.GeneratorName() != generator {
+			continue
+		}
+		asFloats, err := ResultsAs(0.0, qe)
+		if err != nil {
+			continue
+		}
+		for metric, v := range asFloats {
+			results[htmlMetricKey{qe.Kind(), metric}] = v
+		}
+	}
+	return results
+}
+
+func htmlSortedKeys(maps ...map[htmlMetricKey]float64) []htmlMetricKey {
+	seen := make(map[htmlMetricKey]struct{})
+	var keys []htmlMetricKey
+	for _, m := range maps {
+		for k := range m {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].executor != keys[j].executor {
+			return keys[i].executor < keys[j].executor
+		}
+		return keys[i].metric < keys[j].metric
+	})
+	return keys
+}
+
+func newHTMLMetricRow(executor, metric string, current float64, hasCurrent bool, previous float64, hasPrevious bool) *htmlMetricRow {
+	row := &htmlMetricRow{Executor: executor, Metric: metric, Current: "-", Previous: "-", DiffPercent: "-"}
+	if hasCurrent {
+		row.Current = fmt.Sprintf("%.4f", current)
+	}
+	if hasPrevious {
+		row.Previous = fmt.Sprintf("%.4f", previous)
+	}
+	if hasCurrent && hasPrevious {
+		diff := calculateDiffPercentage(current, previous)
+		row.DiffPercent = fmt.Sprintf("%+.2f", diff)
+		if (&TrendConfig{}).higherIsBetter(metric) {
+			diff = -diff
+		}
+		switch {
+		case diff > 0:
+			row.Class = "worse"
+		case diff < 0:
+			row.Class = "better"
+		}
+	}
+	return row
+}
+
+func htmlLatencySamples(r *StandardReport, generator string) []float64 {
+	if r == nil {
+		return nil
+	}
+	for _, qe := range r.QueryExecutors {
+		if direct, ok := qe.(*DirectQueryExecutor); ok && direct.GeneratorName() == generator && len(direct.Samples) > 0 {
+			return direct.Samples
+		}
+	}
+	return nil
+}
+
+// htmlPercentile returns the nearest rank percentile of sorted samples
+func htmlPercentile(sorted []float64, pct float64) (float64, bool) {
+	if len(sorted) == 0 {
+		return 0, false
+	}
+	rank := int(math.Ceil(pct/100*float64(len(sorted)))) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank], true
+}
+
+func newLatencyHistogram(current, previous *StandardReport, currentSamples, previousSamples []float64) *htmlChart {
+	lo, hi := math.MaxFloat64, -math.MaxFloat64
+	for _, samples := range [][]float64{currentSamples, previousSamples} {
+		if len(samples) > 0 {
+			lo, hi = math.Min(lo, samples[0]), math.Max(hi, samples[len(samples)-1])
+		}
+	}
+	width := (hi - lo) / htmlHistogramBins
+	if width == 0 {
+		width = 1
+	}
+	histogram := func(name string, samples []float64, baseline bool) *htmlSeries {
+		counts := make([]float64, htmlHistogramBins)
+		for _, s := range samples {
+			counts[min(int((s-lo)/width), htmlHistogramBins-1)]++
+		}
+		series := &htmlSeries{Name: name, Baseline: baseline}
+		for i, c := range counts {
+			// a step line, so bins look like bars
+			series.X = append(series.X, lo+float64(i)*width, lo+float64(i+1)*width)
+			series.Y = append(series.Y, 100*c/float64(len(samples)), 100*c/float64(len(samples)))
+		}
+		return series
+	}
+	var series []*htmlSeries
+	if len(currentSamples) > 0 {
+		series = append(series, histogram(current.CommitOrTag, currentSamples, false))
+	}
+	if len(previousSamples) > 0 {
+		series = append(series, histogram(previous.CommitOrTag, previousSamples, true))
+	}
+	return newHTMLChart("Latency distribution", "latency, ms", "% of responses", series)
+}
+
+func newLatencyCDF(current, previous *StandardReport, currentSamples, previousSamples []float64) *htmlChart {
+	cdf := func(name string, samples []float64, baseline bool) *htmlSeries {
+		series := &htmlSeries{Name: name, Baseline: baseline}
+		// at most one point per chart pixel is needed
+		step := max(1, len(samples)/htmlChartWidth)
+		for i := 0; i < len(samples); i += step {
+			series.X = append(series.X, samples[i])
+			series.Y = append(series.Y, 100*float64(i+1)/float64(len(samples)))
+		}
+		series.X = append(series.X, samples[len(samples)-1])
+		series.Y = append(series.Y, 100)
+		return series
+	}
+	var series []*htmlSeries
+	if len(currentSamples) > 0 {
+		series = append(series, cdf(current.CommitOrTag, currentSamples, false))
+	}
+	if len(previousSamples) > 0 {
+		series = append(series, cdf(previous.CommitOrTag, previousSamples, true))
+	}
+	return newHTMLChart("Latency percentiles", "latency, ms", "percentile", series)
+}
+
+func htmlLokiQueries(current, previous *StandardReport, generator string) []string {
+	queries := make(map[string]struct{})
+	for _, r := range []*StandardReport{current, previous} {
+		for _, l := range htmlLokiExecutors(r, generator) {
+			for query := range l.Results() {
+				queries[query] = struct{}{}
+			}
+		}
+	}
+	sorted := make([]string, 0, len(queries))
+	for q := range queries {
+		sorted = append(sorted, q)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func htmlLokiExecutors(r *StandardReport, generator string) []*LokiQueryExecutor {
+	if r == nil {
+		return nil
+	}
+	var executors []*LokiQueryExecutor
+	for _, qe := range r.QueryExecutors {
+		if l, ok := qe.(*LokiQueryExecutor); ok && l.GeneratorName() == generator {
+			executors = append(executors, l)
+		}
+	}
+	return executors
+}
+
+// htmlLokiValues returns numeric values of the Loki query, values that aren't numbers are skipped
+func htmlLokiValues(r *StandardReport, generator, query string) []float64 {
+	var values []float64
+	for _, l := range htmlLokiExecutors(r, generator) {
+		raw, ok := l.Results()[query].([]string)
+		if !ok {
+			continue
+		}
+		for _, s := range raw {
+			if v, err := strconv.ParseFloat(s, 64); err == nil {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// newHTMLResources converts Prometheus results to charts, range queries, and table rows, instant queries
+func newHTMLResources(current, previous *StandardReport) *htmlResources {
+	res := &htmlResources{}
+	currentValues := htmlPrometheusResults(current)
+	previousValues := htmlPrometheusResults(previous)
+	queries := make(map[string]struct{})
+	for q := range currentValues {
+		queries[q] = struct{}{}
+	}
+	for q := range previousValues {
+		queries[q] = struct{}{}
+	}
+	sortedQueries := make([]string, 0, len(queries))
+	for q := range queries {
+		sortedQueries = append(sortedQueries, q)
+	}
+	sort.Strings(sortedQueries)
+
+	for _, query := range sortedQueries {
+		var series []*htmlSeries
+		currentSamples := make(map[string]float64)
+		previousSamples := make(map[string]float64)
+		for _, r := range []*StandardReport{current, previous} {
+			if r == nil {
+				continue
+			}
+			values := currentValues
+			samples := currentSamples
+			if r == previous {
+				values, samples = previousValues, previousSamples
+			}
+			switch v := values[query].(type) {
+			case model.Matrix:
+				for _, stream := range v {
+					s := &htmlSeries{Name: r.CommitOrTag + " " + stream.Metric.String(), Baseline: r == previous}
+					for _, p := range stream.Values {
+						// seconds since the test start, so both reports share the time axis
+						s.X = append(s.X, p.Timestamp.Time().Sub(r.TestStart).Seconds())
+						s.Y = append(s.Y, float64(p.Value))
+					}
+					series = append(series, s)
+				}
+			case model.Vector:
+				for _, sample := range v {
+					samples[sample.Metric.String()] = float64(sample.Value)
+				}
+			case *model.Scalar:
+				samples[""] = float64(v.Value)
+			}
+		}
+		if len(series) > 0 {
+			res.Charts = append(res.Charts, newHTMLChart(query, "seconds since test start", "", series))
+		}
+		labels := make([]string, 0, len(currentSamples))
+		for l := range currentSamples {
+			labels = append(labels, l)
+		}
+		for l := range previousSamples {
+			if _, ok := currentSamples[l]; !ok {
+				labels = append(labels, l)
+			}
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			c, hasCurrent := currentSamples[l]
+			p, hasPrevious := previousSamples[l]
+			res.Values = append(res.Values, newHTMLMetricRow(query, l, c, hasCurrent, p, hasPrevious))
+		}
+	}
+	return res
+}
+
+func htmlPrometheusResults(r *StandardReport) map[string]model.Value {
+	results := make(map[string]model.Value)
+	if r == nil {
+		return results
+	}
+	for _, qe := range r.QueryExecutors {
+		if p, ok := qe.(*PrometheusQueryExecutor); ok {
+			for name, v := range p.MustResultsAsValue() {
+				switch asMatrix := v.(type) {
+				case *model.Matrix:
+					results[name] = *asMatrix
+				case *model.Vector:
+					results[name] = *asMatrix
+				default:
+					results[name] = v
+				}
+			}
+		}
+	}
+	return results
+}
+
+// htmlSeries is a line of a chart, baseline series are dashed
+type htmlSeries struct {
+	Name     string
+	X, Y     []float64
+	Baseline bool
+	Points   string
+	Class    string
+}
+
+type htmlChart struct {
+	Title                  string
+	XLabel, YLabel         string
+	XMin, XMax, YMin, YMax string
+	Series                 []*htmlSeries
+}
+
+// newHTMLChart scales all series to the chart size and sets their polyline points
+func newHTMLChart(title, xLabel, yLabel string, series []*htmlSeries) *htmlChart {
+	xlo, xhi, ylo, yhi := math.MaxFloat64, -math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64
+	for _, s := range series {
+		for i := range s.X {
+			xlo, xhi = math.Min(xlo, s.X[i]), math.Max(xhi, s.X[i])
+			ylo, yhi = math.Min(ylo, s.Y[i]), math.Max(yhi, s.Y[i])
+		}
+	}
+	if ylo > 0 {
+		// values are easier to compare from zero
+		ylo = 0
+	}
+	if xhi <= xlo {
+		xlo, xhi = xlo-1, xhi+1
+	}
+	if yhi <= ylo {
+		yhi = ylo + 1
+	}
+	x := func(v float64) float64 {
+		return htmlChartPadding + (v-xlo)/(xhi-xlo)*float64(htmlChartWidth-2*htmlChartPadding)
+	}
+	y := func(v float64) float64 {
+		return htmlChartPadding/2 + (yhi-v)/(yhi-ylo)*float64(htmlChartHeight-htmlChartPadding)
+	}
+	for i, s := range series {
+		points := make([]string, 0, len(s.X))
+		for j := range s.X {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(s.X[j]), y(s.Y[j])))
+		}
+		s.Points = strings.Join(points, " ")
+		s.Class = fmt.Sprintf("s%d", i%htmlSeriesClasses)
+		if s.Baseline {
+			s.Class += " baseline"
+		}
+	}
+	return &htmlChart{
+		Title:  title,
+		XLabel: xLabel,
+		YLabel: yLabel,
+		XMin:   htmlAxisLabel(xlo),
+		XMax:   htmlAxisLabel(xhi),
+		YMin:   htmlAxisLabel(ylo),
+		YMax:   htmlAxisLabel(yhi),
+		Series: series,
+	}
+}
+
+func htmlAxisLabel(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// htmlReportTemplate draws charts of htmlChartWidth x htmlChartHeight with htmlChartPadding
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>BenchSpy report: {{ .Current.TestName }} {{ .Current.CommitOrTag }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.worse { color: #e02f44; font-weight: bold; }
+td.better { color: #37872d; }
+.difference { color: #e02f44; font-weight: bold; }
+.comparable { color: #37872d; }
+pre { background: #f6f6f6; padding: 8px; font-size: 12px; }
+.configs { display: flex; gap: 1em; }
+.configs div { flex: 1; }
+svg { border: 1px solid #eee; }
+svg text { font-size: 11px; fill: #555; }
+polyline { fill: none; stroke-width: 2; }
+polyline.baseline { stroke-dasharray: 6 4; stroke-width: 1.5; }
+.s0 { stroke: #3274d9; } .s1 { stroke: #ff780a; } .s2 { stroke: #37872d; } .s3 { stroke: #8f3bb8; }
+.s4 { stroke: #e02f44; } .s5 { stroke: #56a64b; } .s6 { stroke: #fade2a; } .s7 { stroke: #6e6e6e; }
+.legend span { margin-right: 1em; font-size: 12px; }
+.legend span::before { content: ""; display: inline-block; width: 16px; height: 0; border-top: 3px solid; margin-right: 4px; vertical-align: middle; }
+.legend span.baseline::before { border-top-style: dashed; }
+.legend .s0 { color: #3274d9; } .legend .s1 { color: #ff780a; } .legend .s2 { color: #37872d; } .legend .s3 { color: #8f3bb8; }
+.legend .s4 { color: #e02f44; } .legend .s5 { color: #56a64b; } .legend .s6 { color: #c8a800; } .legend .s7 { color: #6e6e6e; }
+</style>
+</head>
+<body>
+<h1>BenchSpy report: {{ .Current.TestName }}</h1>
+<table>
+<tr><th></th><th>Current</th>{{ if .Previous }}<th>Baseline</th>{{ end }}</tr>
+<tr><td>Commit or tag</td><td><code>{{ .Current.CommitOrTag }}</code></td>{{ if .Previous }}<td><code>{{ .Previous.CommitOrTag }}</code></td>{{ end }}</tr>
+<tr><td>Test start</td><td>{{ .Current.TestStart }}</td>{{ if .Previous }}<td>{{ .Previous.TestStart }}</td>{{ end }}</tr>
+<tr><td>Test end</td><td>{{ .Current.TestEnd }}</td>{{ if .Previous }}<td>{{ .Previous.TestEnd }}</td>{{ end }}</tr>
+</table>
+{{ range .Generators }}
+<h2>Generator: {{ .Name }}</h2>
+{{ if $.Previous }}{{ if .ConfigDifference }}<p class="difference">Configs differ: {{ .ConfigDifference }}</p>{{ else }}<p class="comparable">Configs are comparable.</p>{{ end }}{{ end }}
+<details><summary>Generator config</summary>
+<div class="configs">
+<div><h4>Current</h4><pre>{{ .CurrentConfig }}</pre></div>
+{{ if $.Previous }}<div><h4>Baseline</h4><pre>{{ .PreviousConfig }}</pre></div>{{ end }}
+</div>
+</details>
+{{ if .Metrics }}
+<h3>Metrics</h3>
+<table>
+<tr><th>Executor</th><th>Metric</th>{{ if $.Previous }}<th>{{ $.Previous.CommitOrTag }}</th>{{ end }}<th>{{ $.Current.CommitOrTag }}</th>{{ if $.Previous }}<th>Diff %</th>{{ end }}</tr>
+{{ range .Metrics }}<tr><td>{{ .Executor }}</td><td>{{ .Metric }}</td>{{ if $.Previous }}<td>{{ .Previous }}</td>{{ end }}<td>{{ .Current }}</td>{{ if $.Previous }}<td class="{{ .Class }}">{{ .DiffPercent }}</td>{{ end }}</tr>
+{{ end }}</table>
+{{ end }}
+{{ if .Percentiles }}
+<h3>Latency percentiles, ms</h3>
+<table>
+<tr><th>Percentile</th>{{ if $.Previous }}<th>{{ $.Previous.CommitOrTag }}</th>{{ end }}<th>{{ $.Current.CommitOrTag }}</th>{{ if $.Previous }}<th>Diff %</th>{{ end }}</tr>
+{{ range .Percentiles }}<tr><td>{{ .Metric }}</td>{{ if $.Previous }}<td>{{ .Previous }}</td>{{ end }}<td>{{ .Current }}</td>{{ if $.Previous }}<td class="{{ .Class }}">{{ .DiffPercent }}</td>{{ end }}</tr>
+{{ end }}</table>
+{{ end }}
+{{ range .Charts }}{{ template "chart" . }}{{ end }}
+{{ end }}
+{{ if or .Resources.Charts .Resources.Values }}
+<h2>Resources</h2>
+{{ if .Resources.Values }}
+<table>
+<tr><th>Query</th><th>Series</th>{{ if $.Previous }}<th>{{ $.Previous.CommitOrTag }}</th>{{ end }}<th>{{ $.Current.CommitOrTag }}</th>{{ if $.Previous }}<th>Diff %</th>{{ end }}</tr>
+{{ range .Resources.Values }}<tr><td>{{ .Executor }}</td><td><code>{{ .Metric }}</code></td>{{ if $.Previous }}<td>{{ .Previous }}</td>{{ end }}<td>{{ .Current }}</td>{{ if $.Previous }}<td class="{{ .Class }}">{{ .DiffPercent }}</td>{{ end }}</tr>
+{{ end }}</table>
+{{ end }}
+{{ range .Resources.Charts }}{{ template "chart" . }}{{ end }}
+{{ end }}
+{{ if .Profiles }}
+<h2>Profiles</h2>
+{{ range .Profiles }}
+<h3>{{ .Name }}: {{ .ProfileType }}</h3>
+<table>
+<tr><th>Function</th><th>Flat % {{ $.Previous.CommitOrTag }}</th><th>Flat % {{ $.Current.CommitOrTag }}</th><th>Flat diff</th><th>Cum % {{ $.Previous.CommitOrTag }}</th><th>Cum % {{ $.Current.CommitOrTag }}</th><th>Cum diff</th></tr>
+{{ range .Functions }}<tr><td><code>{{ .Name }}</code></td><td>{{ printf "%.2f" .PreviousFlat }}</td><td>{{ printf "%.2f" .CurrentFlat }}</td><td class="{{ if gt .FlatDiff 0.0 }}worse{{ else if lt .FlatDiff 0.0 }}better{{ end }}">{{ printf "%+.2f" .FlatDiff }}</td><td>{{ printf "%.2f" .PreviousCum }}</td><td>{{ printf "%.2f" .CurrentCum }}</td><td>{{ printf "%+.2f" .CumDiff }}</td></tr>
+{{ end }}</table>
+{{ end }}
+{{ end }}
+</body>
+</html>
+{{ define "chart" }}
+<h4>{{ .Title }}</h4>
+<svg width="720" height="220" viewBox="0 0 720 220">
+<line x1="40" y1="200" x2="680" y2="200" stroke="#ccc"/>
+<line x1="40" y1="20" x2="40" y2="200" stroke="#ccc"/>
+<text x="40" y="214">{{ .XMin }}</text>
+<text x="680" y="214" text-anchor="end">{{ .XMax }}</text>
+<text x="360" y="214" text-anchor="middle">{{ .XLabel }}</text>
+<text x="36" y="200" text-anchor="end">{{ .YMin }}</text>
+<text x="36" y="24" text-anchor="end">{{ .YMax }}</text>
+{{ if .YLabel }}<text x="44" y="14">{{ .YLabel }}</text>{{ end }}
+{{ range .Series }}<polyline class="{{ .Class }}" points="{{ .Points }}"><title>{{ .Name }}</title></polyline>
+{{ end }}</svg>
+<div class="legend">{{ range .Series }}<span class="{{ .Class }}">{{ .Name }}</span>{{ end }}</div>
+{{ end }}
+`))
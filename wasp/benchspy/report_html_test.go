@@ -0,0 +1,136 @@
+package benchspy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHTMLTestReport(commit string, rps int64, median float64, cpu float64) *StandardReport {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := &wasp.Config{
+		GenName:  "gen",
+		LoadType: wasp.RPS,
+		Schedule: wasp.Plain(rps, time.Minute),
+	}
+	samples := make([]float64, 0, 100)
+	for i := 0; i < 100; i++ {
+		samples = append(samples, median/2+float64(i)*median/100)
+	}
+	return &StandardReport{
+		BasicData: BasicData{
+			TestName:         "html",
+			CommitOrTag:      commit,
+			TestStart:        start,
+			TestEnd:          start.Add(time.Minute),
+			GeneratorConfigs: map[string]*wasp.Config{"gen": cfg},
+		},
+		QueryExecutors: []QueryExecutor{
+			&DirectQueryExecutor{
+				KindName:  string(StandardQueryExecutor_Direct),
+				Generator: &wasp.Generator{Cfg: cfg},
+				QueryResults: map[string]interface{}{
+					string(MedianLatency): median,
+					string(ErrorRate):     0.0,
+				},
+				Samples: samples,
+			},
+			&LokiQueryExecutor{
+				KindName:            string(StandardQueryExecutor_Loki),
+				GeneratorNameString: "gen",
+				QueryResults: map[string]interface{}{
+					string(MedianLatency): []string{"10", "11", "not a number", "12"},
+				},
+			},
+			&PrometheusQueryExecutor{
+				KindName: string(StandardQueryExecutor_Prometheus),
+				QueryResults: map[string]interface{}{
+					"cpu": model.Matrix{
+						&model.SampleStream{
+							Metric: model.Metric{"container": "node"},
+							Values: []model.SamplePair{
+								{Timestamp: model.TimeFromUnixNano(start.UnixNano()), Value: model.SampleValue(cpu)},
+								{Timestamp: model.TimeFromUnixNano(start.Add(30 * time.Second).UnixNano()), Value: model.SampleValue(cpu * 2)},
+							},
+						},
+					},
+					"mem": model.Vector{
+						&model.Sample{Metric: model.Metric{"container": "node"}, Value: 512},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestBenchSpy_StandardReport_HTML(t *testing.T) {
+	previous := newHTMLTestReport("v1", 10, 100, 0.5)
+	current := newHTMLTestReport("v2", 10, 120, 0.4)
+
+	t.Run("with baseline", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, current.HTML(out, previous))
+		html := out.String()
+
+		assert.Contains(t, html, "<title>BenchSpy report: html v2</title>")
+		assert.Contains(t, html, "Configs are comparable.")
+		// direct metrics are compared, higher latency is worse
+		assert.Contains(t, html, `<td>direct</td><td>median_latency</td><td>100.0000</td><td>120.0000</td><td class="worse">&#43;20.00</td>`)
+		// latency distribution charts
+		assert.Contains(t, html, "<h4>Latency distribution</h4>")
+		assert.Contains(t, html, "<h4>Latency percentiles</h4>")
+		assert.Contains(t, html, `<polyline class="s1 baseline"`)
+		assert.Contains(t, html, "<td>p95</td>")
+		// numeric Loki values are charted
+		assert.Contains(t, html, "<h4>Loki: median_latency</h4>")
+		// range queries are charted and instant queries compared
+		assert.Contains(t, html, "<h4>cpu</h4>")
+		assert.Contains(t, html, `<td>mem</td><td><code>{container=&#34;node&#34;}</code></td><td>512.0000</td><td>512.0000</td><td class="">&#43;0.00</td>`)
+		// no external resources are needed
+		assert.NotContains(t, html, "<script")
+		assert.NotContains(t, html, "http://")
+		assert.NotContains(t, html, "https://")
+	})
+
+	t.Run("config difference", func(t *testing.T) {
+		different := newHTMLTestReport("v3", 20, 100, 0.5)
+		out := &bytes.Buffer{}
+		require.NoError(t, different.HTML(out, previous))
+		assert.Contains(t, out.String(), "Configs differ: segments at index 0 are different.")
+	})
+
+	t.Run("without baseline", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		require.NoError(t, current.HTML(out, nil))
+		html := out.String()
+		assert.NotContains(t, html, "Configs are")
+		assert.NotContains(t, html, "Diff %")
+		assert.Contains(t, html, `<td>direct</td><td>median_latency</td><td>120.0000</td>`)
+		assert.Equal(t, 0, strings.Count(html, "baseline\""))
+	})
+
+	t.Run("store loaded reports", func(t *testing.T) {
+		// reports loaded from storage have results decoded from JSON
+		dir := t.TempDir()
+		storage := LocalStorage{Directory: dir}
+		_, err := storage.Store(previous.TestName, previous.CommitOrTag, previous)
+		require.NoError(t, err)
+		loaded := &StandardReport{}
+		require.NoError(t, storage.Load(previous.TestName, previous.CommitOrTag, loaded))
+
+		path, err := current.StoreHTML(filepath.Join(dir, "html", "report.html"), loaded)
+		require.NoError(t, err)
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), `<td class="worse">&#43;20.00</td>`)
+		assert.Contains(t, string(content), "<h4>cpu</h4>")
+	})
+}
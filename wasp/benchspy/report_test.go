@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -50,6 +51,11 @@ func TestBenchSpy_NewStandardReport(t *testing.T) {
 		assert.NotNil(t, report)
 		assert.Equal(t, 1, len(report.QueryExecutors))
 		assert.IsType(t, &DirectQueryExecutor{}, report.QueryExecutors[0])
+		assert.False(t, report.QueryExecutors[0].(*DirectQueryExecutor).IncludeFailedSamples)
+
+		report, err = NewStandardReport("test-commit", WithStandardQueries(StandardQueryExecutor_Direct), WithGenerators(basicGen), WithFailedLatencySamples())
+		require.NoError(t, err)
+		assert.True(t, report.QueryExecutors[0].(*DirectQueryExecutor).IncludeFailedSamples)
 	})
 
 	t.Run("missing branch label", func(t *testing.T) {
@@ -2003,3 +2009,55 @@ func TestBenchSpy_Standard_Direct_Metrics_Two_Generators_E2E(t *testing.T) {
 	hasErrors, errors := CompareDirectWithThresholds(10.0, 10.0, 10.0, 10.0, currentReport, previousReport)
 	require.False(t, hasErrors, fmt.Sprintf("errors found: %v", errors))
 }
+
+func TestBenchSpy_StandardReport_FromResultsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.ndjson.gz")
+	sink, err := wasp.NewFileSink(&wasp.FileSinkConfig{Path: path, Compress: true})
+	require.NoError(t, err)
+
+	gen, err := wasp.NewGenerator(&wasp.Config{
+		T:           t,
+		GenName:     "vu1",
+		CallTimeout: 200 * time.Millisecond,
+		LoadType:    wasp.VU,
+		Schedule:    wasp.Plain(5, 2*time.Second),
+		Sinks:       []wasp.ResultsSink{sink},
+		VU: wasp.NewMockVU(&wasp.MockVirtualUserConfig{
+			CallSleep: 50 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	gen.Run(true)
+
+	liveReport, err := NewStandardReport(
+		"v1",
+		WithStandardQueries(StandardQueryExecutor_Direct),
+		WithGenerators(gen),
+	)
+	require.NoError(t, err)
+	require.NoError(t, liveReport.FetchData(context.Background()))
+
+	fileReport, err := NewStandardReport(
+		"v1",
+		WithStandardQueries(StandardQueryExecutor_Direct),
+		WithResultsFile(path),
+	)
+	require.NoError(t, err)
+	require.NoError(t, fileReport.FetchData(context.Background()))
+
+	require.Equal(t, liveReport.TestName, fileReport.TestName)
+	require.Equal(t, liveReport.TestStart.UnixNano(), fileReport.TestStart.UnixNano())
+	require.Equal(t, liveReport.TestEnd.UnixNano(), fileReport.TestEnd.UnixNano())
+	require.NoError(t, fileReport.IsComparable(liveReport))
+	require.Equal(t, MustAllDirectResults(liveReport), MustAllDirectResults(fileReport))
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := NewStandardReport(
+			"v1",
+			WithStandardQueries(StandardQueryExecutor_Direct),
+			WithResultsFile(filepath.Join(t.TempDir(), "missing.ndjson")),
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to load results file")
+	})
+}
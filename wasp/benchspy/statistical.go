@@ -0,0 +1,506 @@
+package benchspy
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultStatisticalConfidence is the confidence level used by statistical tests if not set
+	DefaultStatisticalConfidence = 0.95
+	// DefaultMinRankBiserial is the smallest rank-biserial correlation Mann-Whitney U test treats as a regression
+	DefaultMinRankBiserial = 0.1
+	// DefaultMinKSDistance is the smallest Kolmogorov-Smirnov distance treated as a regression
+	DefaultMinKSDistance = 0.1
+	// DefaultMinPercentileShift is the smallest relative percentile increase bootstrap test treats as a regression
+	DefaultMinPercentileShift = 0.05
+	// DefaultBootstrapIterations is the number of bootstrap resamples
+	DefaultBootstrapIterations = 2000
+	// DefaultBootstrapPercentile is the latency percentile compared by bootstrap test
+	DefaultBootstrapPercentile = 95.0
+)
+
+var ErrNoLatencySamples = errors.New("no latency samples")
+
+// StatisticalTest detects a latency regression by comparing raw latency samples (in milliseconds) of two runs.
+// All tests are one-sided, only the current run being slower than the previous one is a regression.
+type StatisticalTest interface {
+	// Name returns the name of the test
+	Name() string
+	// Compare tests whether current samples are slower than previous ones
+	Compare(current, previous []float64) (*StatisticalResult, error)
+}
+
+// StatisticalResult is the outcome of a statistical test
+type StatisticalResult struct {
+	// Test is the name of the test
+	Test string `json:"test"`
+	// Statistic is the test statistic, U for Mann-Whitney U, D+ for Kolmogorov-Smirnov and the percentile difference in ms for bootstrap
+	Statistic float64 `json:"statistic"`
+	// PValue is the probability of seeing a slowdown this large if the runs had the same latency distribution
+	PValue float64 `json:"p_value"`
+	// Confidence is the confidence level the test was run with, the slowdown is significant if PValue < 1 - Confidence
+	Confidence float64 `json:"confidence"`
+	// EffectSize measures how large the slowdown is, independent of the number of samples, see EffectSizeName
+	EffectSize float64 `json:"effect_size"`
+	// EffectSizeName describes the effect size measure
+	EffectSizeName string `json:"effect_size_name"`
+	// CILower and CIUpper is the confidence interval of the percentile difference in ms, set only by bootstrap test
+	CILower float64 `json:"ci_lower,omitempty"`
+	CIUpper float64 `json:"ci_upper,omitempty"`
+	// Regression is true if the slowdown is both significant and at least the minimal effect size
+	Regression bool `json:"regression"`
+}
+
+// String returns a short description of the result.
+func (r *StatisticalResult) String() string {
+	s := fmt.Sprintf("%s: p-value %.4f at %.0f%% confidence, %s %.4f", r.Test, r.PValue, r.Confidence*100, r.EffectSizeName, r.EffectSize)
+	if r.CILower != 0 || r.CIUpper != 0 {
+		s += fmt.Sprintf(", difference CI [%.4f, %.4f] ms", r.CILower, r.CIUpper)
+	}
+	return s
+}
+
+// DefaultStatisticalTests returns Mann-Whitney U, Kolmogorov-Smirnov and bootstrap of p95 tests with default settings.
+func DefaultStatisticalTests() []StatisticalTest {
+	return []StatisticalTest{&MannWhitneyU{}, &KolmogorovSmirnov{}, &BootstrapPercentile{}}
+}
+
+// MannWhitneyU tests whether current latencies tend to be larger than previous ones. It's based on ranks,
+// so it's robust to outliers and doesn't assume any distribution, p-value uses normal approximation with tie correction,
+// which is accurate from around 20 samples per run. Effect size is the rank-biserial correlation from -1 to 1.
+type MannWhitneyU struct {
+	// Confidence is the confidence level, DefaultStatisticalConfidence if not set
+	Confidence float64
+	// MinEffectSize is the smallest rank-biserial correlation treated as a regression, DefaultMinRankBiserial if not set
+	MinEffectSize float64
+}
+
+// Name returns the name of the test.
+func (m *MannWhitneyU) Name() string {
+	return "Mann-Whitney U"
+}
+
+// Compare runs the test, see MannWhitneyU.
+func (m *MannWhitneyU) Compare(current, previous []float64) (*StatisticalResult, error) {
+	if err := validateSamples(current, previous); err != nil {
+		return nil, err
+	}
+	confidence, err := confidenceOrDefault(m.Confidence)
+	if err != nil {
+		return nil, err
+	}
+	minEffect := valueOrDefault(m.MinEffectSize, DefaultMinRankBiserial)
+
+	n1, n2 := float64(len(current)), float64(len(previous))
+	type ranked struct {
+		value   float64
+		current bool
+	}
+	all := make([]ranked, 0, len(current)+len(previous))
+	for _, v := range current {
+		all = append(all, ranked{v, true})
+	}
+	for _, v := range previous {
+		all = append(all, ranked{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// average ranks of ties, tie sizes are needed for variance correction
+	var rankSum, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].current {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+
+	p := 1.0
+	if variance > 0 {
+		// continuity correction
+		z := (u - mean - 0.5) / math.Sqrt(variance)
+		p = 0.5 * math.Erfc(z/math.Sqrt2)
+	}
+	effect := 2*u/(n1*n2) - 1
+	return &StatisticalResult{
+		Test:           m.Name(),
+		Statistic:      u,
+		PValue:         p,
+		Confidence:     confidence,
+		EffectSize:     effect,
+		EffectSizeName: "rank-biserial correlation",
+		Regression:     p < 1-confidence && effect >= minEffect,
+	}, nil
+}
+
+// KolmogorovSmirnov tests whether any part of the current latency distribution is slower than the previous one,
+// unlike comparing a single percentile it catches changes of the distribution shape, ex.: only the tail getting slower.
+// The statistic D+ is the largest distance by which the previous CDF is above the current one, it's also the effect size.
+// p-value uses the asymptotic distribution, which is accurate from around 20 samples per run.
+type KolmogorovSmirnov struct {
+	// Confidence is the confidence level, DefaultStatisticalConfidence if not set
+	Confidence float64
+	// MinEffectSize is the smallest D+ treated as a regression, DefaultMinKSDistance if not set
+	MinEffectSize float64
+}
+
+// Name returns the name of the test.
+func (m *KolmogorovSmirnov) Name() string {
+	return "Kolmogorov-Smirnov"
+}
+
+// Compare runs the test, see KolmogorovSmirnov.
+func (m *KolmogorovSmirnov) Compare(current, previous []float64) (*StatisticalResult, error) {
+	if err := validateSamples(current, previous); err != nil {
+		return nil, err
+	}
+	confidence, err := confidenceOrDefault(m.Confidence)
+	if err != nil {
+		return nil, err
+	}
+	minEffect := valueOrDefault(m.MinEffectSize, DefaultMinKSDistance)
+
+	cur := sortedCopy(current)
+	prev := sortedCopy(previous)
+	n1, n2 := float64(len(cur)), float64(len(prev))
+	var d float64
+	i, j := 0, 0
+	for i < len(cur) || j < len(prev) {
+		var x float64
+		switch {
+		case i == len(cur):
+			x = prev[j]
+		case j == len(prev):
+			x = cur[i]
+		default:
+			x = math.Min(cur[i], prev[j])
+		}
+		for i < len(cur) && cur[i] == x {
+			i++
+		}
+		for j < len(prev) && prev[j] == x {
+			j++
+		}
+		d = math.Max(d, float64(j)/n2-float64(i)/n1)
+	}
+	ne := n1 * n2 / (n1 + n2)
+	p := math.Min(1, math.Exp(-2*ne*d*d))
+	return &StatisticalResult{
+		Test:           m.Name(),
+		Statistic:      d,
+		PValue:         p,
+		Confidence:     confidence,
+		EffectSize:     d,
+		EffectSizeName: "D+",
+		Regression:     p < 1-confidence && d >= minEffect,
+	}, nil
+}
+
+// BootstrapPercentile estimates a confidence interval of the difference of a latency percentile between runs
+// by resampling both runs. It's a regression if the whole interval is above zero and the percentile
+// has grown at least by MinEffectSize. Effect size is the relative percentile increase, ex.: 0.1 is 10% slower.
+type BootstrapPercentile struct {
+	// Percentile is the compared percentile from 0 to 100, DefaultBootstrapPercentile if not set
+	Percentile float64
+	// Confidence is the confidence level of the interval, DefaultStatisticalConfidence if not set
+	Confidence float64
+	// MinEffectSize is the smallest relative percentile increase treated as a regression, DefaultMinPercentileShift if not set
+	MinEffectSize float64
+	// Iterations is the number of resamples, DefaultBootstrapIterations if not set
+	Iterations int
+	// Seed makes resampling reproducible, the same samples always give the same result
+	Seed uint64
+}
+
+// Name returns the name of the test.
+func (m *BootstrapPercentile) Name() string {
+	return fmt.Sprintf("Bootstrap p%s", formatPercentile(valueOrDefault(m.Percentile, DefaultBootstrapPercentile)))
+}
+
+// Compare runs the test, see BootstrapPercentile.
+func (m *BootstrapPercentile) Compare(current, previous []float64) (*StatisticalResult, error) {
+	if err := validateSamples(current, previous); err != nil {
+		return nil, err
+	}
+	confidence, err := confidenceOrDefault(m.Confidence)
+	if err != nil {
+		return nil, err
+	}
+	percentile := valueOrDefault(m.Percentile, DefaultBootstrapPercentile)
+	if percentile <= 0 || percentile > 100 {
+		return nil, fmt.Errorf("percentile must be in (0, 100], got %.4f", percentile)
+	}
+	minEffect := valueOrDefault(m.MinEffectSize, DefaultMinPercentileShift)
+	iterations := m.Iterations
+	if iterations <= 0 {
+		iterations = DefaultBootstrapIterations
+	}
+
+	rnd := rand.New(rand.NewPCG(m.Seed, m.Seed))
+	curBuf := make([]float64, len(current))
+	prevBuf := make([]float64, len(previous))
+	diffs := make([]float64, iterations)
+	notSlower := 0
+	for i := range diffs {
+		diffs[i] = resampledPercentile(rnd, current, curBuf, percentile) - resampledPercentile(rnd, previous, prevBuf, percentile)
+		if diffs[i] <= 0 {
+			notSlower++
+		}
+	}
+	sort.Float64s(diffs)
+	alpha := 1 - confidence
+	ciLower := diffs[int(math.Floor(alpha/2*float64(iterations-1)))]
+	ciUpper := diffs[int(math.Ceil((1-alpha/2)*float64(iterations-1)))]
+
+	curP := percentileOf(sortedCopy(current), percentile)
+	prevP := percentileOf(sortedCopy(previous), percentile)
+	diff := curP - prevP
+	var effect float64
+	switch {
+	case prevP != 0:
+		effect = diff / prevP
+	case diff > 0:
+		effect = 1
+	}
+	return &StatisticalResult{
+		Test:           m.Name(),
+		Statistic:      diff,
+		PValue:         float64(notSlower) / float64(iterations),
+		Confidence:     confidence,
+		EffectSize:     effect,
+		EffectSizeName: "relative increase",
+		CILower:        ciLower,
+		CIUpper:        ciUpper,
+		Regression:     ciLower > 0 && effect >= minEffect,
+	}, nil
+}
+
+// resampledPercentile draws len(samples) values with replacement into buf and returns their percentile
+func resampledPercentile(rnd *rand.Rand, samples, buf []float64, percentile float64) float64 {
+	for i := range buf {
+		buf[i] = samples[rnd.IntN(len(samples))]
+	}
+	return selectK(buf, percentileIndex(len(buf), percentile))
+}
+
+// percentileOf returns the nearest-rank percentile of sorted samples
+func percentileOf(sorted []float64, percentile float64) float64 {
+	return sorted[percentileIndex(len(sorted), percentile)]
+}
+
+func percentileIndex(n int, percentile float64) int {
+	idx := int(math.Ceil(percentile/100*float64(n))) - 1
+	return max(0, min(idx, n-1))
+}
+
+// selectK returns k-th smallest value, it reorders values
+func selectK(values []float64, k int) float64 {
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		pivot := values[(lo+hi)/2]
+		i, j := lo, hi
+		for i <= j {
+			for values[i] < pivot {
+				i++
+			}
+			for values[j] > pivot {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return values[k]
+		}
+	}
+	return values[k]
+}
+
+func formatPercentile(p float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", p), "0"), ".")
+}
+
+func sortedCopy(values []float64) []float64 {
+	c := append([]float64{}, values...)
+	sort.Float64s(c)
+	return c
+}
+
+func validateSamples(current, previous []float64) error {
+	if len(current) == 0 {
+		return errors.Wrap(ErrNoLatencySamples, "current run")
+	}
+	if len(previous) == 0 {
+		return errors.Wrap(ErrNoLatencySamples, "previous run")
+	}
+	return nil
+}
+
+func confidenceOrDefault(confidence float64) (float64, error) {
+	confidence = valueOrDefault(confidence, DefaultStatisticalConfidence)
+	if confidence <= 0 || confidence >= 1 {
+		return 0, fmt.Errorf("confidence must be in (0, 1), got %.4f", confidence)
+	}
+	return confidence, nil
+}
+
+func valueOrDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// LatencySampler is a QueryExecutor that keeps raw latency samples, ex.: DirectQueryExecutor
+type LatencySampler interface {
+	NamedGenerator
+	LatencySamples() []float64
+}
+
+// StatisticalResultsByGenerator holds results of all statistical tests for each generator
+type StatisticalResultsByGenerator map[string][]*StatisticalResult
+
+// MustAllDirectSamples returns latency samples of all Direct query executors by generator name.
+func MustAllDirectSamples(sr *StandardReport) map[string][]float64 {
+	samples := make(map[string][]float64)
+
+	for _, queryExecutor := range sr.QueryExecutors {
+		if !strings.EqualFold(queryExecutor.Kind(), string(StandardQueryExecutor_Direct)) {
+			continue
+		}
+		if sampler, ok := queryExecutor.(LatencySampler); ok {
+			samples[sampler.GeneratorName()] = sampler.LatencySamples()
+		}
+	}
+
+	return samples
+}
+
+// CompareDirectWithStatisticalTests compares raw latency samples recorded by Direct query executors of both reports
+// using statistical tests, DefaultStatisticalTests if none are given. Unlike CompareDirectWithThresholds it takes
+// the sample size and the distribution shape into account, so small noisy differences are not reported as regressions.
+// It returns true if any test found a regression, results of all tests and an error describing every regression.
+func CompareDirectWithStatisticalTests(currentReport, previousReport *StandardReport, tests ...StatisticalTest) (bool, StatisticalResultsByGenerator, error) {
+	if currentReport == nil || previousReport == nil {
+		return true, nil, errors.New("one or both reports are nil")
+	}
+	if len(tests) == 0 {
+		tests = DefaultStatisticalTests()
+	}
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Tests", len(tests)).
+		Msg("Comparing Direct latency samples with statistical tests")
+
+	allCurrentSamples := MustAllDirectSamples(currentReport)
+	allPreviousSamples := MustAllDirectSamples(previousReport)
+
+	results := make(StatisticalResultsByGenerator)
+	errors := make(map[string][]error)
+	failed := false
+
+	for _, genCfg := range currentReport.GeneratorConfigs {
+		generatorName := genCfg.GenName
+		current, ok := allCurrentSamples[generatorName]
+		if !ok {
+			errors[generatorName] = append(errors[generatorName], fmt.Errorf("generator %s latency samples were missing from current report", generatorName))
+			failed = true
+			continue
+		}
+		previous, ok := allPreviousSamples[generatorName]
+		if !ok {
+			errors[generatorName] = append(errors[generatorName], fmt.Errorf("generator %s latency samples were missing from previous report", generatorName))
+			failed = true
+			continue
+		}
+
+		for _, test := range tests {
+			result, err := test.Compare(current, previous)
+			if err != nil {
+				errors[generatorName] = append(errors[generatorName], fmt.Errorf("%s test failed: %w", test.Name(), err))
+				failed = true
+				continue
+			}
+			results[generatorName] = append(results[generatorName], result)
+			if result.Regression {
+				errors[generatorName] = append(errors[generatorName], fmt.Errorf("latency regression detected by %s", result))
+				failed = true
+			}
+		}
+	}
+
+	PrintStatisticalResults(currentReport, previousReport, results)
+
+	L.Info().
+		Str("Current report", currentReport.CommitOrTag).
+		Str("Previous report", previousReport.CommitOrTag).
+		Int("Generators with regressions or errors", len(errors)).
+		Msg("Finished comparing Direct latency samples with statistical tests")
+
+	return failed, results, concatenateGeneratorErrors(errors)
+}
+
+// PrintStatisticalResults prints a table with statistical test results of every generator.
+func PrintStatisticalResults(currentReport, previousReport *StandardReport, results StatisticalResultsByGenerator) {
+	generatorNames := make([]string, 0, len(results))
+	for name := range results {
+		generatorNames = append(generatorNames, name)
+	}
+	sort.Strings(generatorNames)
+
+	for _, generatorName := range generatorNames {
+		table := tablewriter.NewWriter(os.Stderr)
+		table.SetHeader([]string{"Test", "Statistic", "P-value", "Confidence", "Effect size", "Regression"})
+
+		for _, r := range results[generatorName] {
+			table.Append([]string{
+				r.Test,
+				fmt.Sprintf("%.4f", r.Statistic),
+				fmt.Sprintf("%.4f", r.PValue),
+				fmt.Sprintf("%.0f%%", r.Confidence*100),
+				fmt.Sprintf("%.4f (%s)", r.EffectSize, r.EffectSizeName),
+				fmt.Sprintf("%t", r.Regression),
+			})
+		}
+
+		table.SetBorder(true)
+		table.SetRowLine(true)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+		title := fmt.Sprintf("Generator: %s (%s vs %s)", generatorName, currentReport.CommitOrTag, previousReport.CommitOrTag)
+		fmt.Println(title)
+		fmt.Println(strings.Repeat("=", len(title)))
+
+		table.Render()
+	}
+}
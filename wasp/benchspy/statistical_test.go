@@ -0,0 +1,263 @@
+package benchspy
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// normalSamples returns n reproducible normally distributed latencies
+func normalSamples(seed uint64, n int, mean, stdDev float64) []float64 {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = mean + rnd.NormFloat64()*stdDev
+	}
+	return samples
+}
+
+// slowTail makes every 10th sample slower, the median stays the same
+func slowTail(samples []float64, by float64) []float64 {
+	c := append([]float64{}, samples...)
+	for i := 0; i < len(c); i += 10 {
+		c[i] += by
+	}
+	return c
+}
+
+func TestBenchSpy_MannWhitneyU(t *testing.T) {
+	t.Run("known values", func(t *testing.T) {
+		r, err := (&MannWhitneyU{}).Compare([]float64{4, 5, 6}, []float64{1, 2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, 9.0, r.Statistic)
+		assert.Equal(t, 1.0, r.EffectSize)
+		assert.InDelta(t, 0.0404, r.PValue, 0.0001)
+		assert.Equal(t, DefaultStatisticalConfidence, r.Confidence)
+		assert.True(t, r.Regression)
+
+		// ties get average ranks
+		r, err = (&MannWhitneyU{}).Compare([]float64{1, 2, 2}, []float64{2, 2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, 2.0, r.Statistic)
+		assert.InDelta(t, -0.5556, r.EffectSize, 0.0001)
+		assert.False(t, r.Regression)
+
+		r, err = (&MannWhitneyU{}).Compare([]float64{1, 1}, []float64{1, 1})
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, r.PValue)
+		assert.Equal(t, 0.0, r.EffectSize)
+	})
+
+	t.Run("same distribution", func(t *testing.T) {
+		r, err := (&MannWhitneyU{}).Compare(normalSamples(1, 1000, 10, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.False(t, r.Regression)
+		assert.Greater(t, r.PValue, 0.05)
+	})
+
+	t.Run("slower", func(t *testing.T) {
+		r, err := (&MannWhitneyU{}).Compare(normalSamples(1, 1000, 11, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.True(t, r.Regression)
+		assert.Less(t, r.PValue, 0.0001)
+		assert.Greater(t, r.EffectSize, 0.4)
+	})
+
+	t.Run("significant but too small effect", func(t *testing.T) {
+		r, err := (&MannWhitneyU{MinEffectSize: 0.5}).Compare(normalSamples(1, 1000, 10.5, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.Less(t, r.PValue, 0.0001)
+		assert.False(t, r.Regression)
+	})
+
+	t.Run("faster is not a regression", func(t *testing.T) {
+		r, err := (&MannWhitneyU{}).Compare(normalSamples(1, 1000, 9, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.False(t, r.Regression)
+		assert.Greater(t, r.PValue, 0.99)
+		assert.Less(t, r.EffectSize, 0.0)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := (&MannWhitneyU{}).Compare(nil, []float64{1})
+		require.ErrorIs(t, err, ErrNoLatencySamples)
+		_, err = (&MannWhitneyU{Confidence: 1.5}).Compare([]float64{1}, []float64{1})
+		require.ErrorContains(t, err, "confidence must be in (0, 1)")
+	})
+}
+
+func TestBenchSpy_KolmogorovSmirnov(t *testing.T) {
+	t.Run("known values", func(t *testing.T) {
+		r, err := (&KolmogorovSmirnov{}).Compare([]float64{4, 5, 6}, []float64{1, 2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, r.Statistic)
+		assert.Equal(t, 1.0, r.EffectSize)
+		assert.InDelta(t, 0.0498, r.PValue, 0.0001)
+		assert.True(t, r.Regression)
+
+		// previous run was slower, its CDF is never above the current one
+		r, err = (&KolmogorovSmirnov{}).Compare([]float64{1, 2, 3}, []float64{4, 5, 6})
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, r.Statistic)
+		assert.Equal(t, 1.0, r.PValue)
+		assert.False(t, r.Regression)
+	})
+
+	t.Run("same distribution", func(t *testing.T) {
+		r, err := (&KolmogorovSmirnov{}).Compare(normalSamples(1, 1000, 10, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.False(t, r.Regression)
+	})
+
+	t.Run("slower tail", func(t *testing.T) {
+		previous := normalSamples(2, 2000, 10, 1)
+		current := slowTail(normalSamples(1, 2000, 10, 1), 20)
+		r, err := (&KolmogorovSmirnov{}).Compare(current, previous)
+		require.NoError(t, err)
+		assert.True(t, r.Regression)
+		assert.InDelta(t, 0.1, r.EffectSize, 0.03)
+	})
+}
+
+func TestBenchSpy_BootstrapPercentile(t *testing.T) {
+	t.Run("same distribution", func(t *testing.T) {
+		r, err := (&BootstrapPercentile{}).Compare(normalSamples(1, 1000, 10, 1), normalSamples(2, 1000, 10, 1))
+		require.NoError(t, err)
+		assert.Equal(t, "Bootstrap p95", r.Test)
+		assert.False(t, r.Regression)
+		assert.Less(t, r.CILower, 0.0)
+		assert.Greater(t, r.CIUpper, 0.0)
+	})
+
+	t.Run("slower tail", func(t *testing.T) {
+		previous := normalSamples(2, 2000, 10, 1)
+		current := slowTail(normalSamples(1, 2000, 10, 1), 20)
+		r, err := (&BootstrapPercentile{}).Compare(current, previous)
+		require.NoError(t, err)
+		assert.True(t, r.Regression)
+		assert.Greater(t, r.CILower, 10.0)
+		assert.GreaterOrEqual(t, r.CIUpper, r.Statistic)
+		assert.LessOrEqual(t, r.CILower, r.Statistic)
+		assert.Greater(t, r.EffectSize, 1.0)
+		assert.Equal(t, 0.0, r.PValue)
+
+		// median is not affected
+		r, err = (&BootstrapPercentile{Percentile: 50}).Compare(current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, "Bootstrap p50", r.Test)
+		assert.False(t, r.Regression)
+	})
+
+	t.Run("reproducible", func(t *testing.T) {
+		current, previous := normalSamples(1, 500, 10.2, 1), normalSamples(2, 500, 10, 1)
+		r1, err := (&BootstrapPercentile{Percentile: 99.9, Iterations: 500, Seed: 42}).Compare(current, previous)
+		require.NoError(t, err)
+		r2, err := (&BootstrapPercentile{Percentile: 99.9, Iterations: 500, Seed: 42}).Compare(current, previous)
+		require.NoError(t, err)
+		assert.Equal(t, r1, r2)
+		assert.Equal(t, "Bootstrap p99.9", r1.Test)
+	})
+
+	t.Run("invalid percentile", func(t *testing.T) {
+		_, err := (&BootstrapPercentile{Percentile: 101}).Compare([]float64{1}, []float64{1})
+		require.ErrorContains(t, err, "percentile must be in (0, 100]")
+	})
+}
+
+func TestBenchSpy_SelectK(t *testing.T) {
+	values := normalSamples(3, 101, 0, 1)
+	sorted := sortedCopy(values)
+	for _, k := range []int{0, 1, 50, 99, 100} {
+		assert.Equal(t, sorted[k], selectK(append([]float64{}, values...), k))
+	}
+	assert.Equal(t, 2.0, selectK([]float64{2, 2, 2, 2}, 2))
+}
+
+func newStatisticalTestReport(commitOrTag string, samples map[string][]float64) *StandardReport {
+	r := &StandardReport{
+		BasicData: BasicData{
+			TestName:         "statistical",
+			CommitOrTag:      commitOrTag,
+			GeneratorConfigs: map[string]*wasp.Config{},
+		},
+	}
+	for name, s := range samples {
+		cfg := &wasp.Config{GenName: name}
+		r.GeneratorConfigs[name] = cfg
+		r.QueryExecutors = append(r.QueryExecutors, &DirectQueryExecutor{
+			KindName:     string(StandardQueryExecutor_Direct),
+			Generator:    &wasp.Generator{Cfg: cfg},
+			QueryResults: map[string]interface{}{},
+			Samples:      s,
+		})
+	}
+	return r
+}
+
+func TestBenchSpy_CompareDirectWithStatisticalTests(t *testing.T) {
+	t.Run("no regression", func(t *testing.T) {
+		previous := newStatisticalTestReport("v1", map[string][]float64{"gen": normalSamples(1, 1000, 10, 1)})
+		current := newStatisticalTestReport("v2", map[string][]float64{"gen": normalSamples(2, 1000, 10, 1)})
+
+		failed, results, err := CompareDirectWithStatisticalTests(current, previous)
+		require.NoError(t, err)
+		assert.False(t, failed)
+		require.Len(t, results["gen"], 3)
+		for _, r := range results["gen"] {
+			assert.False(t, r.Regression, r.String())
+		}
+	})
+
+	t.Run("tail regression in a stored report", func(t *testing.T) {
+		storage := &LocalStorage{Directory: filepath.Join(t.TempDir(), "reports")}
+		previous := newStatisticalTestReport("v1", map[string][]float64{
+			"a": normalSamples(1, 2000, 10, 1),
+			"b": normalSamples(2, 2000, 10, 1),
+		})
+		previous.LocalStorage = *storage
+		_, err := previous.Store()
+		require.NoError(t, err)
+
+		loaded := &StandardReport{LocalStorage: *storage}
+		require.NoError(t, loaded.Load("statistical", "v1"))
+		require.Equal(t, MustAllDirectSamples(previous), MustAllDirectSamples(loaded))
+
+		current := newStatisticalTestReport("v2", map[string][]float64{
+			"a": slowTail(normalSamples(3, 2000, 10, 1), 20),
+			"b": normalSamples(4, 2000, 10, 1),
+		})
+		failed, results, err := CompareDirectWithStatisticalTests(current, loaded, &MannWhitneyU{MinEffectSize: 0.2}, &KolmogorovSmirnov{}, &BootstrapPercentile{Percentile: 99})
+		assert.True(t, failed)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "latency regression detected by Kolmogorov-Smirnov")
+		assert.Contains(t, err.Error(), "latency regression detected by Bootstrap p99")
+		// only a tenth of the calls is slower, so the rank shift is below the required effect size
+		assert.NotContains(t, err.Error(), "Mann-Whitney U")
+		assert.NotContains(t, err.Error(), "generator b")
+		require.Len(t, results["a"], 3)
+		require.Len(t, results["b"], 3)
+
+		d, err := json.Marshal(results)
+		require.NoError(t, err)
+		assert.Contains(t, string(d), `"effect_size_name":"D+"`)
+	})
+
+	t.Run("missing samples", func(t *testing.T) {
+		previous := newStatisticalTestReport("v1", map[string][]float64{"gen": nil})
+		current := newStatisticalTestReport("v2", map[string][]float64{"gen": {1, 2, 3}, "new": {1, 2, 3}})
+
+		failed, _, err := CompareDirectWithStatisticalTests(current, previous, &MannWhitneyU{})
+		assert.True(t, failed)
+		require.ErrorIs(t, err, ErrNoLatencySamples)
+		assert.Contains(t, err.Error(), "generator new latency samples were missing from previous report")
+
+		failed, _, err = CompareDirectWithStatisticalTests(nil, previous)
+		assert.True(t, failed)
+		require.Error(t, err)
+	})
+}
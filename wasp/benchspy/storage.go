@@ -9,6 +9,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -157,31 +159,9 @@ func (l *LocalStorage) findLatestGitRef(refs []string) (string, error) {
 		Msg("Resolving references to commit hashes")
 
 	var ref string
-	// Find git root
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	cmd.Dir = l.Directory
-	out, err := cmd.Output()
+	gitRoot, resolvedRefs, err := l.resolveGitRefs(refs)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to find git root")
-	}
-	gitRoot := strings.TrimSpace(string(out))
-
-	// Resolve all refs to commit hashes
-	resolvedRefs := make(map[string]string)
-	for _, ref := range refs {
-		cmd = exec.Command("git", "rev-parse", ref)
-		cmd.Dir = gitRoot
-		if out, err := cmd.Output(); err == nil {
-			resolvedRefs[ref] = strings.TrimSpace(string(out))
-			L.Trace().
-				Str("Reference", ref).
-				Str("Resolved", resolvedRefs[ref]).
-				Msg("Reference resolved to commit hash")
-		} else {
-			L.Warn().
-				Str("Reference", ref).
-				Msg("Failed to resolve reference to commit hash")
-		}
+		return "", err
 	}
 
 	// Find latest among resolved commits
@@ -195,9 +175,9 @@ func (l *LocalStorage) findLatestGitRef(refs []string) (string, error) {
 		Msg("Finding latest commit among resolved references")
 
 	args := append([]string{"rev-list", "--topo-order", "--date-order", "--max-count=1"}, commitRefs...)
-	cmd = exec.Command("git", args...)
+	cmd := exec.Command("git", args...)
 	cmd.Dir = gitRoot
-	out, err = cmd.Output()
+	out, err := cmd.Output()
 	if err != nil {
 		return "", errors.Wrap(err, "failed to find latest reference")
 	}
@@ -225,6 +205,117 @@ func (l *LocalStorage) findLatestGitRef(refs []string) (string, error) {
 	return ref, nil
 }
 
+// resolveGitRefs returns the git root of the storage directory and commit hashes of all refs that could be resolved
+func (l *LocalStorage) resolveGitRefs(refs []string) (string, map[string]string, error) {
+	// Find git root
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = l.Directory
+	out, err := cmd.Output()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to find git root")
+	}
+	gitRoot := strings.TrimSpace(string(out))
+
+	// Resolve all refs to commit hashes
+	resolvedRefs := make(map[string]string)
+	for _, ref := range refs {
+		cmd = exec.Command("git", "rev-parse", ref+"^{commit}")
+		cmd.Dir = gitRoot
+		if out, err := cmd.Output(); err == nil {
+			resolvedRefs[ref] = strings.TrimSpace(string(out))
+			L.Trace().
+				Str("Reference", ref).
+				Str("Resolved", resolvedRefs[ref]).
+				Msg("Reference resolved to commit hash")
+		} else {
+			L.Warn().
+				Str("Reference", ref).
+				Msg("Failed to resolve reference to commit hash")
+		}
+	}
+
+	return gitRoot, resolvedRefs, nil
+}
+
+// orderGitRefs orders refs by git history from the oldest to the newest, refs that can't be resolved are skipped
+func (l *LocalStorage) orderGitRefs(refs []string) ([]string, error) {
+	gitRoot, resolvedRefs, err := l.resolveGitRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolvedRefs) == 0 {
+		return nil, errors.New("none of the references could be resolved to a commit")
+	}
+
+	// several refs, e.g. a tag and a commit hash, might point to the same commit
+	refsByCommit := make(map[string][]string)
+	for ref, hash := range resolvedRefs {
+		refsByCommit[hash] = append(refsByCommit[hash], ref)
+	}
+	commitRefs := make([]string, 0, len(refsByCommit))
+	for hash := range refsByCommit {
+		commitRefs = append(commitRefs, hash)
+	}
+
+	args := append([]string{"rev-list", "--topo-order", "--date-order"}, commitRefs...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = gitRoot
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to order references")
+	}
+
+	// rev-list returns the newest commit first
+	var ordered []string
+	for _, hash := range strings.Fields(string(out)) {
+		if sameCommit, ok := refsByCommit[hash]; ok {
+			sort.Sort(sort.Reverse(sort.StringSlice(sameCommit)))
+			ordered = append(ordered, sameCommit...)
+		}
+	}
+	slices.Reverse(ordered)
+
+	return ordered, nil
+}
+
+// ListRefs returns references of the test reports stored in local storage ordered by git history
+// from the oldest to the newest, if last is greater than 0 only the last references are returned.
+// References that can't be resolved to a commit are skipped.
+func (l *LocalStorage) ListRefs(testName string, last int) ([]string, error) {
+	l.defaultDirectoryIfEmpty()
+	if testName == "" {
+		return nil, errors.New("test name is empty. Please set it and try again")
+	}
+
+	entries, err := os.ReadDir(l.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read storage directory")
+	}
+
+	refs, err := l.findAllGitlikeReferences(l.cleanTestName(testName), entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no reports found in directory %s", l.Directory)
+	}
+
+	ordered, err := l.orderGitRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	if last > 0 && len(ordered) > last {
+		ordered = ordered[len(ordered)-last:]
+	}
+
+	L.Debug().
+		Str("Test name", testName).
+		Str("References", strings.Join(ordered, ", ")).
+		Msg("Found ordered references in local storage")
+
+	return ordered, nil
+}
+
 func (l *LocalStorage) findRef(cleanTestName string) (string, error) {
 	L.Debug().
 		Str("Test name", cleanTestName).
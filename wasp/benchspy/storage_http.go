@@ -0,0 +1,139 @@
+package benchspy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPStorageConfig is the configuration of a generic HTTP key/value report storage
+type HTTPStorageConfig struct {
+	// URL is the base URL, keys are appended to it, ex.: https://artifacts.example.com/benchspy
+	URL string
+	// Prefix is prepended to all keys
+	Prefix string
+	// Headers are added to all requests, ex.: Authorization
+	Headers map[string]string
+	// Timeout of a single operation, DefaultRemoteStorageTimeout if not set
+	Timeout time.Duration
+	// Client is used for all requests, http.DefaultClient if not set
+	Client *http.Client
+}
+
+// HTTPStorage stores reports in any HTTP key/value store, ex.: a WebDAV server or an artifact store.
+// The server must support:
+//   - GET {URL}/{key} returning 404 if the key doesn't exist and an ETag header otherwise
+//   - PUT {URL}/{key} honouring If-Match and If-None-Match: * headers with 412 if the condition isn't met
+//
+// Reports are content addressed and written with conditional requests, see ReportStorage.
+type HTTPStorage struct {
+	remoteStorage
+}
+
+// NewHTTPStorage creates an HTTP key/value report storage.
+func NewHTTPStorage(cfg *HTTPStorageConfig) (*HTTPStorage, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("HTTP storage URL must be provided")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, errors.Wrapf(err, "invalid HTTP storage URL %s", cfg.URL)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultRemoteStorageTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &HTTPStorage{remoteStorage{
+		kv:      &httpStore{cfg: cfg, baseURL: strings.TrimSuffix(cfg.URL, "/")},
+		prefix:  cfg.Prefix,
+		timeout: cfg.Timeout,
+	}}, nil
+}
+
+// Store saves the report and returns its URL.
+func (h *HTTPStorage) Store(testName, commitOrTag string, report interface{}) (string, error) {
+	return h.store(testName, commitOrTag, report)
+}
+
+// Load loads the report stored for the commit or tag, or the latest stored report if commitOrTag is empty.
+func (h *HTTPStorage) Load(testName, commitOrTag string, report interface{}) error {
+	return h.load(testName, commitOrTag, report)
+}
+
+type httpStore struct {
+	cfg     *HTTPStorageConfig
+	baseURL string
+}
+
+func (h *httpStore) url(key string) string {
+	return h.baseURL + "/" + s3EscapePath(key)
+}
+
+func (h *httpStore) get(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := h.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", errKeyNotFound
+	case resp.StatusCode/100 != 2:
+		return nil, "", httpStorageError(resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
+
+func (h *httpStore) put(ctx context.Context, key string, value []byte, ifMatch string) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	switch ifMatch {
+	case "":
+	case "*":
+		headers["If-None-Match"] = "*"
+	default:
+		headers["If-Match"] = ifMatch
+	}
+	resp, err := h.do(ctx, http.MethodPut, key, value, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return errPreconditionFailed
+	case resp.StatusCode/100 != 2:
+		return httpStorageError(resp)
+	}
+	return nil
+}
+
+func (h *httpStore) do(ctx context.Context, method, key string, body []byte, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.url(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return h.cfg.Client.Do(req)
+}
+
+func httpStorageError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("HTTP storage request %s %s returned %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, msg)
+}
@@ -0,0 +1,248 @@
+package benchspy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRemoteStorageTimeout is the timeout of a single remote storage operation
+	DefaultRemoteStorageTimeout = 30 * time.Second
+	// maxLatestUpdateAttempts is how many times the latest pointer update is retried when another writer updated it concurrently
+	maxLatestUpdateAttempts = 10
+)
+
+var (
+	ErrReportNotFound       = errors.New("report not found")
+	ErrReportDigestMismatch = errors.New("report content doesn't match its digest")
+	errKeyNotFound          = errors.New("key not found")
+	errPreconditionFailed   = errors.New("precondition failed")
+)
+
+// ReportStorage stores and loads reports, loading with an empty commitOrTag loads the latest report of the test.
+// It's implemented by LocalStorage, S3Storage and HTTPStorage, see StandardReport.Storage.
+type ReportStorage interface {
+	Store(testName, commitOrTag string, report interface{}) (string, error)
+	Load(testName, commitOrTag string, report interface{}) error
+}
+
+// kvStore is a remote key/value store with conditional writes that remote report storages are built on
+type kvStore interface {
+	// get returns the value and its version (ETag), errKeyNotFound if the key doesn't exist
+	get(ctx context.Context, key string) ([]byte, string, error)
+	// put writes the value, if ifMatch is set the current version must match it, ifMatch "*" means the key must not exist,
+	// errPreconditionFailed is returned if the condition wasn't met
+	put(ctx context.Context, key string, value []byte, ifMatch string) error
+	// url returns the location of the key
+	url(key string) string
+}
+
+// reportPointer points to the content addressed report stored for a commit or tag
+type reportPointer struct {
+	CommitOrTag string `json:"commit_or_tag"`
+	Digest      string `json:"digest"`
+	// CommitTime is the committer date of the commit or tag, zero if it couldn't be resolved in the local git repository
+	CommitTime time.Time `json:"commit_time,omitempty"`
+	StoredAt   time.Time `json:"stored_at"`
+}
+
+// newerThan reports whether p points to a newer report than other, reports are ordered by commit time like in LocalStorage,
+// reports of the same commit and reports whose commit couldn't be resolved are ordered by the time they were stored
+func (p *reportPointer) newerThan(other *reportPointer) bool {
+	if !p.CommitTime.IsZero() && !other.CommitTime.IsZero() && !p.CommitTime.Equal(other.CommitTime) {
+		return p.CommitTime.After(other.CommitTime)
+	}
+	return p.StoredAt.After(other.StoredAt)
+}
+
+// remoteStorage stores every report once under its SHA-256 digest and points to it from the commit or tag it was stored for
+// and from the latest pointer of the test. Reports are immutable, so readers never see a partially written report,
+// and the latest pointer is updated with compare-and-swap, so concurrent writers can't move it back to an older report.
+//
+// Layout under prefix:
+//   - <test>/reports/<sha256>.json is the report
+//   - <test>/refs/<commit or tag>.json points to the report stored for the commit or tag
+//   - <test>/latest.json points to the report of the newest commit, see reportPointer.newerThan
+type remoteStorage struct {
+	kv      kvStore
+	prefix  string
+	timeout time.Duration
+	// commitTime resolves the commit time of a commit or tag, gitCommitTime if not set
+	commitTime func(commitOrTag string) (time.Time, error)
+}
+
+func (r *remoteStorage) key(parts ...string) string {
+	return path.Join(append([]string{r.prefix}, parts...)...)
+}
+
+func (r *remoteStorage) store(testName, commitOrTag string, report interface{}) (string, error) {
+	if testName == "" || commitOrTag == "" {
+		return "", errors.New("test name and commit or tag must be set")
+	}
+	L.Debug().
+		Str("Test name", testName).
+		Str("Reference", commitOrTag).
+		Msg("Storing report on remote storage")
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	asJson, err := json.MarshalIndent(report, "", " ")
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(asJson)
+	digest := hex.EncodeToString(sum[:])
+	cleanTestName := cleanRemoteName(testName)
+
+	// the same content might already be stored, e.g. by a concurrent writer, it's immutable so that's fine
+	reportKey := r.key(cleanTestName, "reports", digest+".json")
+	if err := r.kv.put(ctx, reportKey, asJson, "*"); err != nil && !errors.Is(err, errPreconditionFailed) {
+		return "", errors.Wrapf(err, "failed to store report %s", reportKey)
+	}
+
+	pointer := &reportPointer{CommitOrTag: commitOrTag, Digest: digest, StoredAt: time.Now().UTC()}
+	commitTime := r.commitTime
+	if commitTime == nil {
+		commitTime = gitCommitTime
+	}
+	if t, err := commitTime(commitOrTag); err == nil {
+		pointer.CommitTime = t.UTC()
+	} else {
+		L.Warn().
+			Err(err).
+			Str("Reference", commitOrTag).
+			Msg("Failed to resolve commit time, the report will be ordered by the time it was stored")
+	}
+	pointerJson, err := json.Marshal(pointer)
+	if err != nil {
+		return "", err
+	}
+	refKey := r.key(cleanTestName, "refs", cleanRemoteName(commitOrTag)+".json")
+	if err := r.kv.put(ctx, refKey, pointerJson, ""); err != nil {
+		return "", errors.Wrapf(err, "failed to store reference %s", refKey)
+	}
+	if err := r.updateLatest(ctx, cleanTestName, pointer, pointerJson); err != nil {
+		return "", err
+	}
+
+	L.Info().
+		Str("Test name", testName).
+		Str("Reference", commitOrTag).
+		Str("Digest", digest).
+		Str("Report URL", r.kv.url(reportKey)).
+		Msg("Report stored successfully")
+
+	return r.kv.url(reportKey), nil
+}
+
+// updateLatest moves the latest pointer to the report unless a report of a newer commit is already there
+func (r *remoteStorage) updateLatest(ctx context.Context, cleanTestName string, pointer *reportPointer, pointerJson []byte) error {
+	latestKey := r.key(cleanTestName, "latest.json")
+	for attempt := 0; attempt < maxLatestUpdateAttempts; attempt++ {
+		ifMatch := "*"
+		current, version, err := r.kv.get(ctx, latestKey)
+		switch {
+		case errors.Is(err, errKeyNotFound):
+		case err != nil:
+			return errors.Wrapf(err, "failed to read latest pointer %s", latestKey)
+		default:
+			latest := &reportPointer{}
+			if err := json.Unmarshal(current, latest); err != nil {
+				return errors.Wrapf(err, "failed to decode latest pointer %s", latestKey)
+			}
+			if latest.newerThan(pointer) {
+				return nil
+			}
+			ifMatch = version
+		}
+		err = r.kv.put(ctx, latestKey, pointerJson, ifMatch)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errPreconditionFailed) {
+			return errors.Wrapf(err, "failed to update latest pointer %s", latestKey)
+		}
+		L.Debug().
+			Str("Key", latestKey).
+			Int("Attempt", attempt+1).
+			Msg("Latest pointer was updated concurrently, retrying")
+	}
+	return fmt.Errorf("failed to update latest pointer %s after %d attempts", latestKey, maxLatestUpdateAttempts)
+}
+
+// gitCommitTime returns the committer date of the commit or tag in the git repository of the working directory
+func gitCommitTime(commitOrTag string) (time.Time, error) {
+	cmd := exec.Command("git", "show", "-s", "--format=%cI", commitOrTag+"^{commit}")
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to resolve %s to a commit", commitOrTag)
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+}
+
+func (r *remoteStorage) load(testName, commitOrTag string, report interface{}) error {
+	if testName == "" {
+		return errors.New("test name is empty. Please set it and try again")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cleanTestName := cleanRemoteName(testName)
+	pointerKey := r.key(cleanTestName, "latest.json")
+	if commitOrTag != "" {
+		pointerKey = r.key(cleanTestName, "refs", cleanRemoteName(commitOrTag)+".json")
+	}
+	L.Info().
+		Str("Test name", testName).
+		Str("Reference", commitOrTag).
+		Str("Key", pointerKey).
+		Msg("Loading report from remote storage")
+
+	pointerJson, _, err := r.kv.get(ctx, pointerKey)
+	if errors.Is(err, errKeyNotFound) {
+		return errors.Wrapf(ErrReportNotFound, "test %s, reference %q", testName, commitOrTag)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", pointerKey)
+	}
+	pointer := &reportPointer{}
+	if err := json.Unmarshal(pointerJson, pointer); err != nil {
+		return errors.Wrapf(err, "failed to decode %s", pointerKey)
+	}
+
+	reportKey := r.key(cleanTestName, "reports", pointer.Digest+".json")
+	asJson, _, err := r.kv.get(ctx, reportKey)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read report %s", reportKey)
+	}
+	sum := sha256.Sum256(asJson)
+	if hex.EncodeToString(sum[:]) != pointer.Digest {
+		return errors.Wrapf(ErrReportDigestMismatch, "report %s", reportKey)
+	}
+	if err := json.Unmarshal(asJson, report); err != nil {
+		return errors.Wrapf(err, "failed to decode report %s", reportKey)
+	}
+
+	L.Info().
+		Str("Test name", testName).
+		Str("Reference", pointer.CommitOrTag).
+		Str("Report URL", r.kv.url(reportKey)).
+		Msg("Report loaded successfully")
+
+	return nil
+}
+
+// cleanRemoteName makes a test name or a reference usable as a single key segment
+func cleanRemoteName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+}
@@ -0,0 +1,236 @@
+package benchspy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/pkg/errors"
+)
+
+const DefaultS3Region = "us-east-1"
+
+// S3StorageConfig is the configuration of an S3-compatible report storage, ex.: AWS S3 or MinIO
+type S3StorageConfig struct {
+	// Endpoint is the S3 API URL, ex.: https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint string
+	// Region is used for request signing, the region of the default AWS config or DefaultS3Region if not set
+	Region string
+	// Bucket must exist
+	Bucket string
+	// Prefix is prepended to all keys, ex.: benchspy/my-service
+	Prefix string
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials, if not set the default AWS credential chain is used:
+	// environment variables, shared config and credentials files with AWS_PROFILE, web identity and EC2 or ECS roles
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// VirtualHostedStyle addresses the bucket as a subdomain of the endpoint instead of the first path segment
+	VirtualHostedStyle bool
+	// Timeout of a single operation, DefaultRemoteStorageTimeout if not set
+	Timeout time.Duration
+	// Client is used for all requests, http.DefaultClient if not set
+	Client *http.Client
+}
+
+// S3Storage stores reports in an S3-compatible object store, so baselines survive ephemeral CI runners.
+// Reports are content addressed and written with conditional requests, see ReportStorage.
+// Like in LocalStorage the latest report is the one of the newest commit, but only the commit time is used, so reports
+// of commits that aren't in the local git repository can still be stored.
+type S3Storage struct {
+	remoteStorage
+}
+
+// NewS3Storage creates an S3 report storage.
+func NewS3Storage(cfg *S3StorageConfig) (*S3Storage, error) {
+	if cfg == nil || cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 storage endpoint and bucket must be provided")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid S3 endpoint %s", cfg.Endpoint)
+	}
+	var creds aws.CredentialsProvider
+	switch {
+	case cfg.AccessKeyID != "" && cfg.SecretAccessKey != "":
+		creds = credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken)
+	case cfg.AccessKeyID != "" || cfg.SecretAccessKey != "":
+		return nil, errors.New("both S3 storage access key ID and secret access key must be provided")
+	default:
+		// credentials are resolved lazily by the provider, so loading the config doesn't make any requests
+		awsCfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load default AWS config")
+		}
+		creds = awsCfg.Credentials
+		if cfg.Region == "" {
+			cfg.Region = awsCfg.Region
+		}
+	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultS3Region
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultRemoteStorageTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &S3Storage{remoteStorage{
+		kv:      newS3Store(cfg, endpoint, creds),
+		prefix:  cfg.Prefix,
+		timeout: cfg.Timeout,
+	}}, nil
+}
+
+// Store saves the report and returns its URL.
+func (s *S3Storage) Store(testName, commitOrTag string, report interface{}) (string, error) {
+	return s.store(testName, commitOrTag, report)
+}
+
+// Load loads the report stored for the commit or tag, or the latest stored report if commitOrTag is empty.
+func (s *S3Storage) Load(testName, commitOrTag string, report interface{}) error {
+	return s.load(testName, commitOrTag, report)
+}
+
+// s3Store is a kvStore using S3 conditional writes, requests are signed with AWS Signature Version 4
+type s3Store struct {
+	cfg      *S3StorageConfig
+	endpoint *url.URL
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+}
+
+func newS3Store(cfg *S3StorageConfig, endpoint *url.URL, creds aws.CredentialsProvider) *s3Store {
+	return &s3Store{
+		cfg:      cfg,
+		endpoint: endpoint,
+		creds:    creds,
+		// object paths are already escaped once, S3 doesn't expect them to be escaped again
+		signer: v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+	}
+}
+
+func (s *s3Store) url(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.cfg.Bucket, key)
+}
+
+func (s *s3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	objectPath := s.cfg.Bucket + "/" + key
+	if s.cfg.VirtualHostedStyle {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		objectPath = key
+	}
+	u.RawPath = s.endpoint.EscapedPath() + "/" + s3EscapePath(objectPath)
+	u.Path = s.endpoint.Path + "/" + objectPath
+	return &u
+}
+
+func (s *s3Store) get(ctx context.Context, key string) ([]byte, string, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, "", errKeyNotFound
+	case resp.StatusCode/100 != 2:
+		return nil, "", s3Error(resp)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, resp.Header.Get("ETag"), nil
+}
+
+func (s *s3Store) put(ctx context.Context, key string, value []byte, ifMatch string) error {
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	switch ifMatch {
+	case "":
+	case "*":
+		headers.Set("If-None-Match", "*")
+	default:
+		headers.Set("If-Match", ifMatch)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, value, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	// 409 is returned when a conditional write conflicts with another in-flight one
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return errPreconditionFailed
+	case resp.StatusCode/100 != 2:
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Store) do(ctx context.Context, method, key string, body []byte, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	if err := s.sign(ctx, req, body, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.cfg.Client.Do(req)
+}
+
+// sign adds AWS Signature Version 4 headers to the request, credentials are retrieved on every call, so expiring ones are refreshed
+func (s *s3Store) sign(ctx context.Context, req *http.Request, body []byte, now time.Time) error {
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve S3 storage credentials")
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return s.signer.SignHTTP(ctx, creds, req, payloadHash, "s3", s.cfg.Region, now)
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 request %s %s returned %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, msg)
+}
+
+// s3EscapePath escapes every segment of the key, slashes are kept
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = s3Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Escape escapes everything except unreserved characters as required by Signature Version 4
+func s3Escape(s string) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,375 @@
+package benchspy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTrendMinChangePercent is the smallest relative change of a metric mean treated as a change point
+	DefaultTrendMinChangePercent = 5.0
+	// DefaultTrendMinScore is the smallest mean shift, in standard errors, treated as a change point
+	DefaultTrendMinScore = 3.0
+	// DefaultTrendMaxDriftPercent is the largest relative change of a metric trend line not treated as a gradual regression
+	DefaultTrendMaxDriftPercent = 10.0
+)
+
+// TrendConfig configures change point and drift detection of a TrendReport
+type TrendConfig struct {
+	// MinChangePercent is the smallest relative change of the mean between segments treated as a change point, DefaultTrendMinChangePercent if not set
+	MinChangePercent float64
+	// MinScore is the smallest mean shift in standard errors treated as a change point, DefaultTrendMinScore if not set
+	MinScore float64
+	// MaxDriftPercent is the largest relative change of the trend line over all reports not treated as a regression, DefaultTrendMaxDriftPercent if not set
+	MaxDriftPercent float64
+	// HigherIsBetter lists metrics that degrade when they decrease, MaxSustainableRate is always included
+	HigherIsBetter []string
+}
+
+func (c *TrendConfig) defaults() {
+	if c.MinChangePercent == 0 {
+		c.MinChangePercent = DefaultTrendMinChangePercent
+	}
+	if c.MinScore == 0 {
+		c.MinScore = DefaultTrendMinScore
+	}
+	if c.MaxDriftPercent == 0 {
+		c.MaxDriftPercent = DefaultTrendMaxDriftPercent
+	}
+}
+
+func (c *TrendConfig) higherIsBetter(metric string) bool {
+	if metric == MaxSustainableRate {
+		return true
+	}
+	if m, ok := DefaultMetricRegistry.Get(metric); ok && m.HigherIsBetter() {
+		return true
+	}
+	for _, m := range c.HigherIsBetter {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// TrendPoint is a value of a metric in a single report
+type TrendPoint struct {
+	CommitOrTag string  `json:"commit_or_tag"`
+	Value       float64 `json:"value"`
+}
+
+// ChangePoint is a report from which the mean of a metric has changed
+type ChangePoint struct {
+	// Index of the first point of the metric trend with the new mean
+	Index       int    `json:"index"`
+	CommitOrTag string `json:"commit_or_tag"`
+	// Before and After are means of the metric in the segments around the change point
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	// ChangePercent is the relative change of the mean
+	ChangePercent float64 `json:"change_percent"`
+	// Score is the mean shift in standard errors, math.MaxFloat64 if the metric has no noise
+	Score float64 `json:"score"`
+	// Degraded is true if the metric got worse
+	Degraded bool `json:"degraded"`
+}
+
+// MetricTrend is a time series of a single metric of a generator over many reports
+type MetricTrend struct {
+	Generator string        `json:"generator"`
+	Metric    string        `json:"metric"`
+	Points    []*TrendPoint `json:"points"`
+	// ChangePoints are ordered from the oldest to the newest
+	ChangePoints []*ChangePoint `json:"change_points"`
+	// DriftPercent is the relative change of the least squares trend line from the first to the last report
+	DriftPercent float64 `json:"drift_percent"`
+	// Degraded is true if the last segment is worse than the first one by at least MinChangePercent
+	// or the trend line got worse by more than MaxDriftPercent
+	Degraded bool `json:"degraded"`
+	// Gradual is true if the metric degraded over many reports rather than in steps, the trend line got worse
+	// by more than MaxDriftPercent and it fits the values better than the segments between change points
+	Gradual bool `json:"gradual"`
+	// FirstDegradedAt is the commit or tag where a degraded metric first got worse, it's the first degrading change point
+	// or, for gradual regressions, the first report where the trend line got worse by MinChangePercent
+	FirstDegradedAt string `json:"first_degraded_at,omitempty"`
+}
+
+// TrendReport is a trend analysis of all numeric metrics over many reports of the same test
+type TrendReport struct {
+	TestName string `json:"test_name"`
+	// CommitsOrTags are references of the analysed reports from the oldest to the newest
+	CommitsOrTags []string       `json:"commits_or_tags"`
+	Trends        []*MetricTrend `json:"trends"`
+	Config        *TrendConfig   `json:"config"`
+}
+
+// Degraded returns trends of all degraded metrics.
+func (t *TrendReport) Degraded() []*MetricTrend {
+	var degraded []*MetricTrend
+	for _, mt := range t.Trends {
+		if mt.Degraded {
+			degraded = append(degraded, mt)
+		}
+	}
+	return degraded
+}
+
+// LoadStandardReports loads the last reports of the test stored in local storage, ordered by git history
+// from the oldest to the newest. If last is 0 all reports are loaded.
+func LoadStandardReports(storage LocalStorage, testName string, last int) ([]*StandardReport, error) {
+	refs, err := storage.ListRefs(testName, last)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*StandardReport, 0, len(refs))
+	for _, ref := range refs {
+		report := &StandardReport{LocalStorage: storage}
+		if err := report.Load(testName, ref); err != nil {
+			return nil, errors.Wrapf(err, "failed to load report %s", ref)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// NewTrendReport builds time series of all numeric metrics, e.g. from Direct and Capacity query executors,
+// of reports ordered from the oldest to the newest and detects change points and gradual regressions in them.
+// Metrics missing from some reports are analysed only over the reports that have them.
+func NewTrendReport(reports []*StandardReport, cfg *TrendConfig) (*TrendReport, error) {
+	if len(reports) < 2 {
+		return nil, fmt.Errorf("at least 2 reports are needed for trend analysis, got %d", len(reports))
+	}
+	if cfg == nil {
+		cfg = &TrendConfig{}
+	}
+	cfg.defaults()
+
+	tr := &TrendReport{
+		TestName:      reports[0].TestName,
+		CommitsOrTags: make([]string, 0, len(reports)),
+		Config:        cfg,
+	}
+
+	type key struct{ generator, metric string }
+	series := make(map[key]*MetricTrend)
+	for _, report := range reports {
+		tr.CommitsOrTags = append(tr.CommitsOrTags, report.CommitOrTag)
+		for _, qe := range report.QueryExecutors {
+			results, err := ResultsAs(0.0, qe)
+			if err != nil {
+				// only numeric metrics have a trend
+				continue
+			}
+			generator := qe.Kind()
+			if named, ok := qe.(NamedGenerator); ok {
+				generator = named.GeneratorName()
+			}
+			for metric, value := range results {
+				k := key{generator, metric}
+				if _, ok := series[k]; !ok {
+					series[k] = &MetricTrend{Generator: generator, Metric: metric}
+				}
+				series[k].Points = append(series[k].Points, &TrendPoint{CommitOrTag: report.CommitOrTag, Value: value})
+			}
+		}
+	}
+
+	for _, mt := range series {
+		mt.analyse(cfg)
+		tr.Trends = append(tr.Trends, mt)
+	}
+	sort.Slice(tr.Trends, func(i, j int) bool {
+		if tr.Trends[i].Generator != tr.Trends[j].Generator {
+			return tr.Trends[i].Generator < tr.Trends[j].Generator
+		}
+		return tr.Trends[i].Metric < tr.Trends[j].Metric
+	})
+
+	L.Info().
+		Str("Test name", tr.TestName).
+		Int("Reports", len(reports)).
+		Int("Metrics", len(tr.Trends)).
+		Int("Degraded metrics", len(tr.Degraded())).
+		Msg("Trend analysis finished")
+
+	return tr, nil
+}
+
+// analyse detects change points, drift and the first degraded report of the metric
+func (mt *MetricTrend) analyse(cfg *TrendConfig) {
+	values := make([]float64, len(mt.Points))
+	for i, p := range mt.Points {
+		values[i] = p.Value
+	}
+	worse := 1.0
+	if cfg.higherIsBetter(mt.Metric) {
+		worse = -1.0
+	}
+
+	sigma := noiseStdDev(values)
+	for _, idx := range binarySegmentation(values, 0, len(values), sigma, cfg) {
+		mt.ChangePoints = append(mt.ChangePoints, &ChangePoint{Index: idx, CommitOrTag: mt.Points[idx].CommitOrTag})
+	}
+	// change points are described by the neighbouring segments only, not the whole series
+	for i, cp := range mt.ChangePoints {
+		before, after := mt.segmentBounds(i), mt.segmentBounds(i+1)
+		left, right := values[before[0]:before[1]], values[after[0]:after[1]]
+		cp.Before, cp.After = mean(left), mean(right)
+		cp.ChangePercent = calculateDiffPercentage(cp.After, cp.Before)
+		cp.Score = meanShiftScore(left, right, sigma)
+		cp.Degraded = worse*(cp.After-cp.Before) > 0
+	}
+
+	slope, intercept := linearFit(values)
+	start, end := intercept, intercept+slope*float64(len(values)-1)
+	mt.DriftPercent = calculateDiffPercentage(end, start)
+	driftDegraded := worse*(end-start) > 0 && math.Abs(mt.DriftPercent) > cfg.MaxDriftPercent
+
+	first, last := mt.segmentBounds(0), mt.segmentBounds(len(mt.ChangePoints))
+	firstMean, lastMean := mean(values[first[0]:first[1]]), mean(values[last[0]:last[1]])
+	segmentsDegraded := worse*(lastMean-firstMean) > 0 && math.Abs(calculateDiffPercentage(lastMean, firstMean)) >= cfg.MinChangePercent
+
+	mt.Degraded = segmentsDegraded || driftDegraded
+	// a gradual regression is explained better by the trend line than by steps between change points
+	var linearError, stepsError float64
+	for i, v := range values {
+		fitted := intercept + slope*float64(i)
+		linearError += (v - fitted) * (v - fitted)
+	}
+	for i := 0; i <= len(mt.ChangePoints); i++ {
+		b := mt.segmentBounds(i)
+		stepsError += squaredError(values[b[0]:b[1]])
+	}
+	mt.Gradual = driftDegraded && linearError < stepsError
+	if !mt.Degraded {
+		return
+	}
+	if !mt.Gradual {
+		for _, cp := range mt.ChangePoints {
+			if cp.Degraded {
+				mt.FirstDegradedAt = cp.CommitOrTag
+				return
+			}
+		}
+	}
+	for i := range values {
+		fitted := intercept + slope*float64(i)
+		if worse*(fitted-start) > 0 && math.Abs(calculateDiffPercentage(fitted, start)) >= cfg.MinChangePercent {
+			mt.FirstDegradedAt = mt.Points[i].CommitOrTag
+			return
+		}
+	}
+}
+
+// segmentBounds returns [start, end) of the i-th segment between change points
+func (mt *MetricTrend) segmentBounds(i int) [2]int {
+	start, end := 0, len(mt.Points)
+	if i > 0 {
+		start = mt.ChangePoints[i-1].Index
+	}
+	if i < len(mt.ChangePoints) {
+		end = mt.ChangePoints[i].Index
+	}
+	return [2]int{start, end}
+}
+
+// binarySegmentation recursively splits values[start:end] where the split reduces the squared error the most,
+// a split is a change point if the mean shift is at least MinChangePercent and MinScore standard errors,
+// returned indexes are sorted
+func binarySegmentation(values []float64, start, end int, sigma float64, cfg *TrendConfig) []int {
+	if end-start < 2 {
+		return nil
+	}
+	segment := values[start:end]
+	total := squaredError(segment)
+	best, bestGain := -1, 0.0
+	for i := 1; i < len(segment); i++ {
+		gain := total - squaredError(segment[:i]) - squaredError(segment[i:])
+		if gain > bestGain {
+			best, bestGain = i, gain
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	left, right := segment[:best], segment[best:]
+	if math.Abs(calculateDiffPercentage(mean(right), mean(left))) < cfg.MinChangePercent || meanShiftScore(left, right, sigma) < cfg.MinScore {
+		return nil
+	}
+	idx := start + best
+	result := binarySegmentation(values, start, idx, sigma, cfg)
+	result = append(result, idx)
+	return append(result, binarySegmentation(values, idx, end, sigma, cfg)...)
+}
+
+// meanShiftScore returns the difference of means in standard errors of the noise sigma,
+// if there is no noise any shift is considered certain
+func meanShiftScore(left, right []float64, sigma float64) float64 {
+	diff := math.Abs(mean(right) - mean(left))
+	if diff == 0 {
+		return 0
+	}
+	se := sigma * math.Sqrt(1/float64(len(left))+1/float64(len(right)))
+	if se == 0 {
+		return math.MaxFloat64
+	}
+	return diff / se
+}
+
+// noiseStdDev estimates the standard deviation of the noise from the median absolute difference of consecutive values,
+// unlike the standard deviation of the whole series it's not inflated by the change points
+func noiseStdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	diffs := make([]float64, 0, len(values)-1)
+	for i := 1; i < len(values); i++ {
+		diffs = append(diffs, math.Abs(values[i]-values[i-1]))
+	}
+	// the difference of two values has sqrt(2) times the noise deviation, 0.6745 scales the median absolute deviation
+	return percentileOf(sortedCopy(diffs), 50) / (0.6745 * math.Sqrt2)
+}
+
+// linearFit returns the slope and intercept of the least squares line of values over their indexes
+func linearFit(values []float64) (float64, float64) {
+	n := float64(len(values))
+	if n < 2 {
+		return 0, mean(values)
+	}
+	meanX := (n - 1) / 2
+	meanY := mean(values)
+	var num, den float64
+	for i, v := range values {
+		dx := float64(i) - meanX
+		num += dx * (v - meanY)
+		den += dx * dx
+	}
+	slope := num / den
+	return slope, meanY - slope*meanX
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func squaredError(values []float64) float64 {
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum
+}
@@ -0,0 +1,200 @@
+package benchspy
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+)
+
+// Markdown writes the trend report as Markdown: a summary of degraded metrics and a table of values of every metric,
+// change points are marked with ▲ when the metric got worse and ▼ when it got better.
+func (t *TrendReport) Markdown(w io.Writer) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Trend report: %s\n\n", t.TestName))
+	sb.WriteString(fmt.Sprintf("%d reports from `%s` to `%s`.\n\n", len(t.CommitsOrTags), t.CommitsOrTags[0], t.CommitsOrTags[len(t.CommitsOrTags)-1]))
+
+	degraded := t.Degraded()
+	if len(degraded) == 0 {
+		sb.WriteString("No degraded metrics.\n\n")
+	} else {
+		sb.WriteString("## Degraded metrics\n\n")
+		sb.WriteString("| Generator | Metric | First degraded at | Drift % | Change points |\n")
+		sb.WriteString("|---|---|---|---|---|\n")
+		for _, mt := range degraded {
+			sb.WriteString(fmt.Sprintf("| %s | %s | `%s` | %.2f | %s |\n", mt.Generator, mt.Metric, mt.FirstDegradedAt, mt.DriftPercent, mt.changePointsSummary()))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("## Metrics\n\n")
+	sb.WriteString("| Generator | Metric |")
+	for _, ref := range t.CommitsOrTags {
+		sb.WriteString(fmt.Sprintf(" `%s` |", ref))
+	}
+	sb.WriteString(" Drift % |\n|---|---|")
+	sb.WriteString(strings.Repeat("---|", len(t.CommitsOrTags)+1))
+	sb.WriteString("\n")
+	for _, mt := range t.Trends {
+		sb.WriteString(fmt.Sprintf("| %s | %s |", mt.Generator, mt.Metric))
+		for _, ref := range t.CommitsOrTags {
+			sb.WriteString(fmt.Sprintf(" %s |", mt.cell(ref)))
+		}
+		sb.WriteString(fmt.Sprintf(" %.2f |\n", mt.DriftPercent))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// HTML writes the trend report as a self-contained HTML page with a chart of every metric, change points
+// and the first degraded report are highlighted.
+func (t *TrendReport) HTML(w io.Writer) error {
+	type chart struct {
+		*MetricTrend
+		Line    string
+		Markers []trendMarker
+	}
+	charts := make([]chart, 0, len(t.Trends))
+	for _, mt := range t.Trends {
+		line, markers := mt.svgPath(t.CommitsOrTags)
+		charts = append(charts, chart{MetricTrend: mt, Line: line, Markers: markers})
+	}
+	return trendHTMLTemplate.Execute(w, map[string]interface{}{
+		"Report":   t,
+		"Degraded": t.Degraded(),
+		"Charts":   charts,
+		"Width":    trendChartWidth,
+		"Height":   trendChartHeight,
+	})
+}
+
+func (mt *MetricTrend) cell(ref string) string {
+	for i, p := range mt.Points {
+		if p.CommitOrTag != ref {
+			continue
+		}
+		for _, cp := range mt.ChangePoints {
+			if cp.Index == i {
+				if cp.Degraded {
+					return fmt.Sprintf("**%.4f ▲**", p.Value)
+				}
+				return fmt.Sprintf("%.4f ▼", p.Value)
+			}
+		}
+		return fmt.Sprintf("%.4f", p.Value)
+	}
+	return "-"
+}
+
+func (mt *MetricTrend) changePointsSummary() string {
+	parts := make([]string, 0, len(mt.ChangePoints)+1)
+	if mt.Gradual {
+		parts = append(parts, "gradual")
+	}
+	for _, cp := range mt.ChangePoints {
+		parts = append(parts, fmt.Sprintf("`%s` %+.2f%%", cp.CommitOrTag, cp.ChangePercent))
+	}
+	return strings.Join(parts, ", ")
+}
+
+const (
+	trendChartWidth   = 640
+	trendChartHeight  = 160
+	trendChartPadding = 10
+)
+
+type trendMarker struct {
+	X, Y        float64
+	CommitOrTag string
+	Value       float64
+	Class       string
+}
+
+// svgPath returns the polyline points of the metric and markers of all its points scaled to the chart size
+func (mt *MetricTrend) svgPath(refs []string) (string, []trendMarker) {
+	lo, hi := math.MaxFloat64, -math.MaxFloat64
+	for _, p := range mt.Points {
+		lo, hi = math.Min(lo, p.Value), math.Max(hi, p.Value)
+	}
+	if hi == lo {
+		lo, hi = lo-1, hi+1
+	}
+	x := func(ref string) float64 {
+		if len(refs) < 2 {
+			return trendChartPadding
+		}
+		for i, r := range refs {
+			if r == ref {
+				return trendChartPadding + float64(i)*float64(trendChartWidth-2*trendChartPadding)/float64(len(refs)-1)
+			}
+		}
+		return trendChartPadding
+	}
+	y := func(v float64) float64 {
+		return trendChartPadding + (hi-v)/(hi-lo)*float64(trendChartHeight-2*trendChartPadding)
+	}
+
+	points := make([]string, 0, len(mt.Points))
+	markers := make([]trendMarker, 0, len(mt.Points))
+	for i, p := range mt.Points {
+		m := trendMarker{X: x(p.CommitOrTag), Y: y(p.Value), CommitOrTag: p.CommitOrTag, Value: p.Value, Class: "point"}
+		for _, cp := range mt.ChangePoints {
+			if cp.Index == i {
+				m.Class = "improved"
+				if cp.Degraded {
+					m.Class = "degraded"
+				}
+			}
+		}
+		if mt.Degraded && p.CommitOrTag == mt.FirstDegradedAt {
+			m.Class += " first-degraded"
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", m.X, m.Y))
+		markers = append(markers, m)
+	}
+	return strings.Join(points, " "), markers
+}
+
+var trendHTMLTemplate = template.Must(template.New("trend").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Trend report: {{ .Report.TestName }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+svg { border: 1px solid #eee; }
+polyline { fill: none; stroke: #3274d9; stroke-width: 2; }
+circle.point { fill: #3274d9; }
+circle.degraded { fill: #e02f44; }
+circle.improved { fill: #37872d; }
+circle.first-degraded { stroke: #000; stroke-width: 2; }
+.degraded-metric { color: #e02f44; }
+</style>
+</head>
+<body>
+<h1>Trend report: {{ .Report.TestName }}</h1>
+<p>{{ len .Report.CommitsOrTags }} reports: {{ range $i, $r := .Report.CommitsOrTags }}{{ if $i }}, {{ end }}<code>{{ $r }}</code>{{ end }}</p>
+{{ if .Degraded }}
+<h2>Degraded metrics</h2>
+<table>
+<tr><th>Generator</th><th>Metric</th><th>First degraded at</th><th>Drift %</th><th>Change points</th></tr>
+{{ range .Degraded }}<tr><td>{{ .Generator }}</td><td>{{ .Metric }}</td><td><code>{{ .FirstDegradedAt }}</code></td><td>{{ printf "%.2f" .DriftPercent }}</td><td>{{ if .Gradual }}gradual{{ if .ChangePoints }}, {{ end }}{{ end }}{{ range $i, $cp := .ChangePoints }}{{ if $i }}, {{ end }}<code>{{ $cp.CommitOrTag }}</code> {{ printf "%+.2f" $cp.ChangePercent }}%{{ end }}</td></tr>
+{{ end }}</table>
+{{ else }}
+<p>No degraded metrics.</p>
+{{ end }}
+<h2>Metrics</h2>
+{{ range .Charts }}
+<h3{{ if .Degraded }} class="degraded-metric"{{ end }}>{{ .Generator }}: {{ .Metric }} (drift {{ printf "%.2f" .DriftPercent }}%)</h3>
+<svg width="{{ $.Width }}" height="{{ $.Height }}" viewBox="0 0 {{ $.Width }} {{ $.Height }}">
+<polyline points="{{ .Line }}"/>
+{{ range .Markers }}<circle class="{{ .Class }}" cx="{{ printf "%.1f" .X }}" cy="{{ printf "%.1f" .Y }}" r="4"><title>{{ .CommitOrTag }}: {{ printf "%.4f" .Value }}</title></circle>
+{{ end }}</svg>
+{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,260 @@
+package benchspy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTrendTestReports creates a report of every value with Direct median latency and error rate,
+// and a Capacity max sustainable rate
+func newTrendTestReports(medians, errorRates, rates []float64) []*StandardReport {
+	reports := make([]*StandardReport, 0, len(medians))
+	for i := range medians {
+		cfg := &wasp.Config{GenName: "gen"}
+		reports = append(reports, &StandardReport{
+			BasicData: BasicData{
+				TestName:         "trend",
+				CommitOrTag:      fmt.Sprintf("v%d", i+1),
+				GeneratorConfigs: map[string]*wasp.Config{"gen": cfg},
+			},
+			QueryExecutors: []QueryExecutor{
+				&DirectQueryExecutor{
+					KindName:  string(StandardQueryExecutor_Direct),
+					Generator: &wasp.Generator{Cfg: cfg},
+					QueryResults: map[string]interface{}{
+						string(MedianLatency): medians[i],
+						string(ErrorRate):     errorRates[i],
+					},
+				},
+				&CapacityQueryExecutor{
+					KindName:     string(StandardQueryExecutor_Capacity),
+					Generator:    &wasp.Generator{Cfg: cfg},
+					QueryResults: map[string]interface{}{MaxSustainableRate: rates[i]},
+				},
+				// non-numeric results have no trend
+				&MockQueryExecutor{
+					KindFn:    func() string { return "loki" },
+					ResultsFn: func() map[string]interface{} { return map[string]interface{}{"logs": []string{"1"}} },
+				},
+			},
+		})
+	}
+	return reports
+}
+
+func findTrend(t *testing.T, tr *TrendReport, metric string) *MetricTrend {
+	for _, mt := range tr.Trends {
+		if mt.Metric == metric {
+			return mt
+		}
+	}
+	require.FailNow(t, "metric trend not found", metric)
+	return nil
+}
+
+func TestBenchSpy_NewTrendReport(t *testing.T) {
+	t.Run("step regression", func(t *testing.T) {
+		tr, err := NewTrendReport(newTrendTestReports(
+			[]float64{10, 10.1, 9.9, 10, 12, 12.1, 11.9, 12},
+			[]float64{0, 0, 0, 0, 0, 0, 0, 0},
+			[]float64{100, 101, 99, 100, 100, 99, 101, 100},
+		), nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v1", "v2", "v3", "v4", "v5", "v6", "v7", "v8"}, tr.CommitsOrTags)
+		require.Len(t, tr.Trends, 3)
+
+		median := findTrend(t, tr, string(MedianLatency))
+		require.Len(t, median.ChangePoints, 1)
+		cp := median.ChangePoints[0]
+		assert.Equal(t, 4, cp.Index)
+		assert.Equal(t, "v5", cp.CommitOrTag)
+		assert.InDelta(t, 10, cp.Before, 0.001)
+		assert.InDelta(t, 12, cp.After, 0.001)
+		assert.InDelta(t, 20, cp.ChangePercent, 0.01)
+		assert.Greater(t, cp.Score, 3.0)
+		assert.True(t, cp.Degraded)
+		assert.True(t, median.Degraded)
+		assert.False(t, median.Gradual)
+		assert.Equal(t, "v5", median.FirstDegradedAt)
+
+		assert.False(t, findTrend(t, tr, string(ErrorRate)).Degraded)
+		assert.False(t, findTrend(t, tr, MaxSustainableRate).Degraded)
+		assert.Equal(t, []*MetricTrend{median}, tr.Degraded())
+	})
+
+	t.Run("gradual regression", func(t *testing.T) {
+		// every commit is only 2% slower, but 14% in total
+		medians := []float64{10, 10.2, 10.4, 10.6, 10.8, 11, 11.2, 11.4}
+		tr, err := NewTrendReport(newTrendTestReports(medians, make([]float64, 8), make([]float64, 8)), nil)
+		require.NoError(t, err)
+
+		median := findTrend(t, tr, string(MedianLatency))
+		assert.True(t, median.Degraded)
+		assert.True(t, median.Gradual)
+		assert.InDelta(t, 14, median.DriftPercent, 0.01)
+		// the first commit where the trend line is 5% above the start
+		assert.Equal(t, "v4", median.FirstDegradedAt)
+
+		// within the allowed drift
+		tr, err = NewTrendReport(newTrendTestReports(medians, make([]float64, 8), make([]float64, 8)), &TrendConfig{MaxDriftPercent: 20, MinChangePercent: 50})
+		require.NoError(t, err)
+		assert.False(t, findTrend(t, tr, string(MedianLatency)).Degraded)
+	})
+
+	t.Run("improvement and higher is better", func(t *testing.T) {
+		tr, err := NewTrendReport(newTrendTestReports(
+			[]float64{12, 12, 12, 12, 10, 10, 10, 10},
+			[]float64{0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1},
+			[]float64{100, 100, 100, 100, 100, 80, 80, 80},
+		), nil)
+		require.NoError(t, err)
+
+		median := findTrend(t, tr, string(MedianLatency))
+		require.Len(t, median.ChangePoints, 1)
+		assert.False(t, median.ChangePoints[0].Degraded)
+		assert.False(t, median.Degraded)
+
+		rate := findTrend(t, tr, MaxSustainableRate)
+		require.Len(t, rate.ChangePoints, 1)
+		assert.True(t, rate.Degraded)
+		assert.Equal(t, "v6", rate.FirstDegradedAt)
+
+		// error rate is better when lower unless configured otherwise
+		tr, err = NewTrendReport(newTrendTestReports(
+			[]float64{10, 10, 10, 10},
+			[]float64{0.1, 0.1, 0.05, 0.05},
+			[]float64{100, 100, 100, 100},
+		), &TrendConfig{HigherIsBetter: []string{string(ErrorRate)}})
+		require.NoError(t, err)
+		assert.True(t, findTrend(t, tr, string(ErrorRate)).Degraded)
+	})
+
+	t.Run("regression fixed later", func(t *testing.T) {
+		tr, err := NewTrendReport(newTrendTestReports(
+			[]float64{10, 10, 10, 15, 15, 15, 10, 10, 10},
+			make([]float64, 9),
+			make([]float64, 9),
+		), nil)
+		require.NoError(t, err)
+		median := findTrend(t, tr, string(MedianLatency))
+		require.Len(t, median.ChangePoints, 2)
+		assert.Equal(t, "v4", median.ChangePoints[0].CommitOrTag)
+		assert.True(t, median.ChangePoints[0].Degraded)
+		assert.Equal(t, "v7", median.ChangePoints[1].CommitOrTag)
+		assert.False(t, median.ChangePoints[1].Degraded)
+		assert.False(t, median.Degraded)
+	})
+
+	t.Run("noise is not a change point", func(t *testing.T) {
+		tr, err := NewTrendReport(newTrendTestReports(
+			[]float64{10, 11, 9, 10.5, 9.5, 11, 9, 10.2},
+			make([]float64, 8),
+			make([]float64, 8),
+		), nil)
+		require.NoError(t, err)
+		median := findTrend(t, tr, string(MedianLatency))
+		assert.Empty(t, median.ChangePoints)
+		assert.False(t, median.Degraded)
+	})
+
+	t.Run("not enough reports", func(t *testing.T) {
+		_, err := NewTrendReport(newTrendTestReports([]float64{1}, []float64{1}, []float64{1}), nil)
+		require.ErrorContains(t, err, "at least 2 reports are needed")
+	})
+}
+
+func TestBenchSpy_TrendReport_Output(t *testing.T) {
+	tr, err := NewTrendReport(newTrendTestReports(
+		[]float64{10, 10, 10, 12, 12, 12},
+		make([]float64, 6),
+		make([]float64, 6),
+	), nil)
+	require.NoError(t, err)
+
+	md := &bytes.Buffer{}
+	require.NoError(t, tr.Markdown(md))
+	assert.Contains(t, md.String(), "# Trend report: trend")
+	assert.Contains(t, md.String(), "| gen | median_latency | `v4` | ")
+	assert.Contains(t, md.String(), "`v4` +20.00%")
+	assert.Contains(t, md.String(), "**12.0000 ▲**")
+
+	html := &bytes.Buffer{}
+	require.NoError(t, tr.HTML(html))
+	assert.Contains(t, html.String(), "<title>Trend report: trend</title>")
+	assert.Contains(t, html.String(), `<circle class="degraded first-degraded"`)
+	assert.Contains(t, html.String(), "<polyline points=")
+
+	d, err := json.Marshal(tr)
+	require.NoError(t, err)
+	assert.Contains(t, string(d), `"first_degraded_at":"v4"`)
+}
+
+func TestBenchSpy_LoadStandardReports(t *testing.T) {
+	gitDir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = gitDir
+		out, err := cmd.Output()
+		require.NoError(t, err, args)
+		return string(bytes.TrimSpace(out))
+	}
+	git("init")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test User")
+	git("config", "--local", "commit.gpgsign", "false")
+
+	storage := LocalStorage{Directory: gitDir}
+	reports := newTrendTestReports([]float64{10, 10, 10, 12, 12}, make([]float64, 5), make([]float64, 5))
+	var refs []string
+	for i, r := range reports {
+		// stored in a different order than committed, tags and commit hashes are mixed
+		ref := r.CommitOrTag
+		if i%2 == 1 {
+			git("commit", "--allow-empty", "-m", ref)
+			ref = git("rev-parse", "HEAD")
+		} else {
+			git("commit", "--allow-empty", "-m", ref)
+			git("tag", "-a", ref, "-m", ref)
+		}
+		r.CommitOrTag = ref
+		refs = append(refs, ref)
+	}
+	for _, i := range []int{3, 0, 4, 2, 1} {
+		// mock executors can't be stored
+		reports[i].QueryExecutors = reports[i].QueryExecutors[:2]
+		reports[i].LocalStorage = storage
+		_, err := reports[i].Store()
+		require.NoError(t, err)
+	}
+
+	ordered, err := storage.ListRefs("trend", 0)
+	require.NoError(t, err)
+	require.Equal(t, refs, ordered)
+
+	ordered, err = storage.ListRefs("trend", 3)
+	require.NoError(t, err)
+	require.Equal(t, refs[2:], ordered)
+
+	loaded, err := LoadStandardReports(storage, "trend", 4)
+	require.NoError(t, err)
+	require.Len(t, loaded, 4)
+	for i, r := range loaded {
+		assert.Equal(t, refs[i+1], r.CommitOrTag)
+	}
+
+	tr, err := NewTrendReport(loaded, nil)
+	require.NoError(t, err)
+	median := findTrend(t, tr, string(MedianLatency))
+	assert.True(t, median.Degraded)
+	assert.Equal(t, refs[3], median.FirstDegradedAt)
+
+	_, err = storage.ListRefs("other", 0)
+	require.ErrorContains(t, err, "no reports found")
+}
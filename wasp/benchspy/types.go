@@ -56,6 +56,7 @@ const (
 	StandardQueryExecutor_Loki       StandardQueryExecutorType = "loki"
 	StandardQueryExecutor_Direct     StandardQueryExecutorType = "direct"
 	StandardQueryExecutor_Prometheus StandardQueryExecutorType = "prometheus"
+	StandardQueryExecutor_Capacity   StandardQueryExecutorType = "capacity"
 )
 
 type StandardLoadMetric string
@@ -0,0 +1,252 @@
+package wasp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultCapacitySearchPrecision = 1
+)
+
+var (
+	ErrInvalidCapacitySearch  = errors.New("invalid capacity search config")
+	ErrCapacitySearchSchedule = errors.New("capacity search generates its own schedule, schedule segments must not be provided")
+)
+
+// CapacitySearchConfig finds the highest RPS or amount of VUs that still meets the SLO.
+// Rate is increased by Step until some SLO condition is breached, then the range between
+// the highest passing and the lowest failing rate is bisected until it's not wider than Precision.
+type CapacitySearchConfig struct {
+	// From is the first probed rate
+	From int64 `json:"from"`
+	// Step is the rate increase between probes until the SLO is breached
+	Step int64 `json:"step"`
+	// Max is the highest probed rate
+	Max int64 `json:"max"`
+	// StepDuration is how long every probed rate is kept
+	StepDuration time.Duration `json:"step_duration"`
+	// WarmUp is the beginning of every step excluded from the SLO checks, so the system under test can settle on the new rate
+	WarmUp time.Duration `json:"warm_up"`
+	// Precision stops the search when the lowest failing rate is not more than Precision above the highest passing rate, default is 1
+	Precision int64 `json:"precision"`
+	// SLO are the conditions every probed rate must meet, they are evaluated once per step, Window and ConsecutiveWindows are ignored.
+	// A step with less than MinCalls calls doesn't meet the SLO.
+	SLO []*AbortCondition `json:"slo"`
+}
+
+// Validate checks the search bounds and SLO conditions and sets the default precision.
+func (m *CapacitySearchConfig) Validate() error {
+	if m.From <= 0 {
+		return errors.Wrap(ErrInvalidCapacitySearch, "from must be > 0")
+	}
+	if m.Step <= 0 {
+		return errors.Wrap(ErrInvalidCapacitySearch, "step must be > 0")
+	}
+	if m.Max < m.From {
+		return errors.Wrap(ErrInvalidCapacitySearch, "max must be >= from")
+	}
+	if m.StepDuration <= 0 {
+		return errors.Wrap(ErrInvalidCapacitySearch, "step duration must be > 0")
+	}
+	if m.WarmUp < 0 || m.WarmUp >= m.StepDuration {
+		return errors.Wrap(ErrInvalidCapacitySearch, "warm up must be >= 0 and shorter than step duration")
+	}
+	if m.Precision < 0 {
+		return errors.Wrap(ErrInvalidCapacitySearch, "precision must be >= 0")
+	}
+	if m.Precision == 0 {
+		m.Precision = DefaultCapacitySearchPrecision
+	}
+	if len(m.SLO) == 0 {
+		return errors.Wrap(ErrInvalidCapacitySearch, "at least one SLO condition is required")
+	}
+	for _, c := range m.SLO {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CapacityStep is a single probed rate of the capacity search
+type CapacityStep struct {
+	Rate      int64     `json:"rate"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Success, Failed, Timeouts and Latency are computed from calls finished after the warm up
+	Success   int64              `json:"success"`
+	Failed    int64              `json:"failed"`
+	Timeouts  int64              `json:"timeouts"`
+	ErrorRate float64            `json:"error_rate"`
+	Latency   LatencyPercentiles `json:"latency"`
+	Passed    bool               `json:"passed"`
+	// Breached describes the SLO conditions that were not met
+	Breached []string `json:"breached,omitempty"`
+}
+
+// CapacityResult is the outcome of the capacity search, steps form the explored load curve
+type CapacityResult struct {
+	LoadType ScheduleType `json:"load_type"`
+	// MaxRate is the highest rate that met the SLO, 0 if none did
+	MaxRate int64 `json:"max_rate"`
+	// Completed is false if the search was stopped before it converged
+	Completed bool            `json:"completed"`
+	Steps     []*CapacityStep `json:"steps"`
+}
+
+// capacitySearch keeps the search range, lo is the highest passing rate and hi is the lowest failing rate, 0 if none failed yet
+type capacitySearch struct {
+	cfg    *CapacitySearchConfig
+	lo     int64
+	hi     int64
+	probed bool
+}
+
+// next returns the next rate to probe and false when the search has converged
+func (s *capacitySearch) next() (int64, bool) {
+	if !s.probed {
+		return s.cfg.From, true
+	}
+	if s.hi == 0 {
+		if s.lo >= s.cfg.Max {
+			return 0, false
+		}
+		return min(s.lo+s.cfg.Step, s.cfg.Max), true
+	}
+	if s.hi-s.lo <= s.cfg.Precision {
+		return 0, false
+	}
+	return s.lo + (s.hi-s.lo)/2, true
+}
+
+func (s *capacitySearch) record(rate int64, passed bool) {
+	s.probed = true
+	if passed {
+		s.lo = rate
+	} else {
+		s.hi = rate
+	}
+}
+
+// runCapacitySearch starts the capacity search, every probed rate is appended to the schedule as a plain segment
+// and applied with processSegment, the run ends when the search converges.
+func (g *Generator) runCapacitySearch() {
+	cfg := g.Cfg.CapacitySearch
+	g.ResponsesWaitGroup.Add(1)
+	go func() {
+		defer g.ResponsesWaitGroup.Done()
+		defer g.responsesCancel()
+		res := &CapacityResult{LoadType: g.Cfg.LoadType}
+		search := &capacitySearch{cfg: cfg}
+		defer func() {
+			res.MaxRate = search.lo
+			g.currentSegmentMu.Lock()
+			for _, s := range g.scheduleSegments {
+				g.Cfg.duration += s.Duration
+			}
+			g.currentSegmentMu.Unlock()
+			g.capacityResult.Store(res)
+			g.Log.Info().
+				Int64("MaxRate", res.MaxRate).
+				Int("Steps", len(res.Steps)).
+				Bool("Completed", res.Completed).
+				Msg("Capacity search finished")
+		}()
+		for {
+			rate, ok := search.next()
+			if !ok {
+				res.Completed = true
+				return
+			}
+			step, ok := g.probeCapacity(rate)
+			if !ok {
+				return
+			}
+			res.Steps = append(res.Steps, step)
+			search.record(rate, step.Passed)
+		}
+	}()
+}
+
+// probeCapacity keeps the rate for a single step and checks the SLO, it returns false if the run was stopped during the step
+func (g *Generator) probeCapacity(rate int64) (*CapacityStep, bool) {
+	cfg := g.Cfg.CapacitySearch
+	seg := &Segment{From: rate, Duration: cfg.StepDuration, Type: SegmentType_Plain}
+	// the schedule is read by processSegment and the stats, a new slice is swapped in under the segment lock
+	g.currentSegmentMu.Lock()
+	schedule := make([]*Segment, 0, len(g.scheduleSegments)+1)
+	schedule = append(schedule, g.scheduleSegments...)
+	schedule = append(schedule, seg)
+	g.Cfg.Schedule = schedule
+	g.scheduleSegments = schedule
+	g.currentSegmentMu.Unlock()
+	g.stats.LastSegment.Store(int64(len(schedule)))
+	g.processSegment()
+	if !g.sleepUntilStopped(cfg.WarmUp) {
+		seg.EndTime = time.Now()
+		return nil, false
+	}
+	start := g.statsWindow(true, "")
+	sloStart := make([]*statsWindow, len(cfg.SLO))
+	for i, c := range cfg.SLO {
+		sloStart[i] = g.abortWindowState(c)
+	}
+	stopped := !g.sleepUntilStopped(cfg.StepDuration - cfg.WarmUp)
+	seg.EndTime = time.Now()
+	if stopped {
+		return nil, false
+	}
+	end := g.statsWindow(true, "")
+	step := &CapacityStep{
+		Rate:      rate,
+		StartTime: seg.StartTime,
+		EndTime:   seg.EndTime,
+		Success:   end.success - start.success,
+		Failed:    end.failed - start.failed,
+		Timeouts:  end.timeouts - start.timeouts,
+		Latency:   percentilesFromHistogram(start.latencies(end)),
+		Passed:    true,
+	}
+	if total := step.Success + step.Failed; total > 0 {
+		step.ErrorRate = float64(step.Failed) / float64(total)
+	}
+	for i, c := range cfg.SLO {
+		value, ok := sloStart[i].evaluate(c, g.abortWindowState(c))
+		switch {
+		case !ok:
+			step.Breached = append(step.Breached, fmt.Sprintf("%s: not enough calls", c))
+		case c.breached(value):
+			step.Breached = append(step.Breached, fmt.Sprintf("%s: observed %s", c, c.formatValue(value)))
+		}
+	}
+	step.Passed = len(step.Breached) == 0
+	g.Log.Info().
+		Int64("Rate", rate).
+		Bool("Passed", step.Passed).
+		Strs("Breached", step.Breached).
+		Msg("Capacity search step")
+	return step, true
+}
+
+// sleepUntilStopped waits for d and returns false if the run was stopped earlier
+func (g *Generator) sleepUntilStopped(d time.Duration) bool {
+	if d <= 0 {
+		return g.ResponsesCtx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-g.ResponsesCtx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// CapacityResult returns the result of the capacity search, or nil if the search is not finished or CapacitySearch is not set.
+func (g *Generator) CapacityResult() *CapacityResult {
+	return g.capacityResult.Load()
+}
@@ -0,0 +1,212 @@
+package wasp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// saturatingGun fails every call when the generator rate is higher than the limit
+type saturatingGun struct {
+	limit int64
+}
+
+func (m *saturatingGun) Call(l *Generator) *Response {
+	time.Sleep(5 * time.Millisecond)
+	if l.Stats().CurrentRPS.Load() > m.limit {
+		return &Response{Failed: true, Error: "saturated"}
+	}
+	return &Response{Data: "ok"}
+}
+
+// saturatingVU fails every call when the generator has more VUs than the limit
+type saturatingVU struct {
+	*MockVirtualUser
+	limit int64
+}
+
+func (m *saturatingVU) Clone(l *Generator) VirtualUser {
+	return &saturatingVU{MockVirtualUser: m.MockVirtualUser.Clone(l).(*MockVirtualUser), limit: m.limit}
+}
+
+func (m *saturatingVU) Call(l *Generator) {
+	startedAt := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if l.Stats().CurrentVUs.Load() > m.limit {
+		l.ResponsesChan <- &Response{StartedAt: &startedAt, Failed: true, Error: "saturated"}
+		return
+	}
+	l.ResponsesChan <- &Response{StartedAt: &startedAt, Data: "ok"}
+}
+
+func TestSmokeCapacitySearchRPS(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Gun:      &saturatingGun{limit: 37},
+		CapacitySearch: &CapacitySearchConfig{
+			From:         10,
+			Step:         10,
+			Max:          100,
+			StepDuration: 1 * time.Second,
+			WarmUp:       200 * time.Millisecond,
+			Precision:    2,
+			SLO:          []*AbortCondition{ErrorRateAbove(0.1, 0)},
+		},
+	})
+	require.NoError(t, err)
+	_, _ = gen.Run(true)
+
+	res := gen.CapacityResult()
+	require.NotNil(t, res)
+	require.True(t, res.Completed)
+	require.Equal(t, int64(37), res.MaxRate)
+	rates := make([]int64, 0)
+	for _, s := range res.Steps {
+		rates = append(rates, s.Rate)
+		require.Equal(t, s.Rate <= 37, s.Passed, "rate %d", s.Rate)
+		require.Equal(t, s.Passed, len(s.Breached) == 0)
+		require.NotZero(t, s.Latency.Count)
+	}
+	// ramp up until the first failure, then bisect
+	require.Equal(t, []int64{10, 20, 30, 40, 35, 37, 38}, rates)
+	require.Len(t, gen.Cfg.Schedule, len(res.Steps))
+	for _, s := range gen.Cfg.Schedule {
+		require.False(t, s.StartTime.IsZero())
+		require.False(t, s.EndTime.IsZero())
+	}
+	require.Equal(t, (7 * time.Second).Nanoseconds(), gen.Stats().Duration)
+}
+
+func TestSmokeCapacitySearchVU(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: VU,
+		VU:       &saturatingVU{MockVirtualUser: NewMockVU(&MockVirtualUserConfig{}), limit: 4},
+		CapacitySearch: &CapacitySearchConfig{
+			From:         1,
+			Step:         2,
+			Max:          9,
+			StepDuration: 1 * time.Second,
+			WarmUp:       200 * time.Millisecond,
+			SLO: []*AbortCondition{
+				ErrorRateAbove(0.05, 0),
+				LatencyAbove(99, 1*time.Second, 0, 1),
+			},
+		},
+	})
+	require.NoError(t, err)
+	_, _ = gen.Run(true)
+
+	res := gen.CapacityResult()
+	require.NotNil(t, res)
+	require.Equal(t, VU, res.LoadType)
+	require.Equal(t, int64(4), res.MaxRate)
+	rates := make([]int64, 0)
+	for _, s := range res.Steps {
+		rates = append(rates, s.Rate)
+	}
+	require.Equal(t, []int64{1, 3, 5, 4}, rates)
+}
+
+func TestSmokeCapacitySearchMaxRate(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Gun:      &saturatingGun{limit: 1000},
+		CapacitySearch: &CapacitySearchConfig{
+			From:         5,
+			Step:         10,
+			Max:          20,
+			StepDuration: 500 * time.Millisecond,
+			SLO:          []*AbortCondition{ErrorRateAbove(0.1, 0)},
+		},
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	res := gen.CapacityResult()
+	require.True(t, res.Completed)
+	require.Equal(t, int64(20), res.MaxRate)
+	require.Len(t, res.Steps, 3)
+}
+
+func TestSmokeCapacitySearchValidate(t *testing.T) {
+	t.Parallel()
+	valid := func() *CapacitySearchConfig {
+		return &CapacitySearchConfig{
+			From:         1,
+			Step:         1,
+			Max:          10,
+			StepDuration: time.Second,
+			SLO:          []*AbortCondition{ErrorRateAbove(0.1, 0)},
+		}
+	}
+	c := valid()
+	require.NoError(t, c.Validate())
+	require.Equal(t, int64(DefaultCapacitySearchPrecision), c.Precision)
+
+	tests := []struct {
+		name   string
+		modify func(c *CapacitySearchConfig)
+	}{
+		{name: "from", modify: func(c *CapacitySearchConfig) { c.From = 0 }},
+		{name: "step", modify: func(c *CapacitySearchConfig) { c.Step = 0 }},
+		{name: "max", modify: func(c *CapacitySearchConfig) { c.Max = 0 }},
+		{name: "step duration", modify: func(c *CapacitySearchConfig) { c.StepDuration = 0 }},
+		{name: "warm up", modify: func(c *CapacitySearchConfig) { c.WarmUp = time.Second }},
+		{name: "no slo", modify: func(c *CapacitySearchConfig) { c.SLO = nil }},
+	}
+	for _, tc := range tests {
+		c := valid()
+		tc.modify(c)
+		require.ErrorIs(t, c.Validate(), ErrInvalidCapacitySearch, tc.name)
+	}
+
+	_, err := NewGenerator(&Config{
+		LoadType:       RPS,
+		Gun:            NewMockGun(&MockGunConfig{}),
+		Schedule:       Plain(1, time.Second),
+		CapacitySearch: valid(),
+	})
+	require.ErrorIs(t, err, ErrCapacitySearchSchedule)
+}
+
+func TestSmokeCapacitySearchScheduleReadDuringRun(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Gun:      &saturatingGun{limit: 15},
+		CapacitySearch: &CapacitySearchConfig{
+			From:         10,
+			Step:         10,
+			Max:          30,
+			StepDuration: 300 * time.Millisecond,
+			WarmUp:       50 * time.Millisecond,
+			Precision:    10,
+			SLO:          []*AbortCondition{ErrorRateAbove(0.1, 0)},
+		},
+	})
+	require.NoError(t, err)
+	gen.Run(false)
+
+	// the schedule is read the same way the scheduler does while the search keeps appending probed rates, run with -race
+	var seen int
+	for gen.CapacityResult() == nil {
+		gen.currentSegmentMu.Lock()
+		for _, s := range gen.scheduleSegments {
+			require.NotZero(t, s.From)
+		}
+		seen = max(seen, len(gen.scheduleSegments))
+		gen.currentSegmentMu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _ = gen.Wait()
+	require.Equal(t, 2, seen)
+	require.Len(t, gen.Cfg.Schedule, 2)
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp/benchspy"
+)
+
+func newBenchSpyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "benchspy",
+		Short: "Analyse stored BenchSpy reports",
+	}
+	cmd.AddCommand(newTrendCmd())
+	return cmd
+}
+
+func newTrendCmd() *cobra.Command {
+	var dir, format, out string
+	var last int
+	var failOnDegradation bool
+	cfg := &benchspy.TrendConfig{}
+	cmd := &cobra.Command{
+		Use:   "trend [test name]",
+		Short: "Analyse the trend of the last reports of a test ordered by git history and detect change points",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			reports, err := benchspy.LoadStandardReports(benchspy.LocalStorage{Directory: dir}, args[0], last)
+			if err != nil {
+				return err
+			}
+			tr, err := benchspy.NewTrendReport(reports, cfg)
+			if err != nil {
+				return err
+			}
+			w := cmd.OutOrStdout()
+			if out != "" {
+				f, err := os.Create(out)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			if err := writeTrendReport(w, tr, format); err != nil {
+				return err
+			}
+			degraded := tr.Degraded()
+			for _, mt := range degraded {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s %s degraded since %s\n", mt.Generator, mt.Metric, mt.FirstDegradedAt)
+			}
+			if failOnDegradation && len(degraded) > 0 {
+				return fmt.Errorf("%d metric(s) degraded", len(degraded))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", benchspy.DEFAULT_DIRECTORY, "directory with stored reports, must be inside a git repository")
+	cmd.Flags().IntVar(&last, "last", 20, "number of the latest reports to analyse, 0 for all")
+	cmd.Flags().StringVar(&format, "format", "markdown", "output format: markdown, html or json")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "output file, stdout if not set")
+	cmd.Flags().BoolVar(&failOnDegradation, "fail-on-degradation", false, "exit with an error if any metric degraded")
+	cmd.Flags().Float64Var(&cfg.MinChangePercent, "min-change", benchspy.DefaultTrendMinChangePercent, "smallest relative change of the mean in percent treated as a change point")
+	cmd.Flags().Float64Var(&cfg.MinScore, "min-score", benchspy.DefaultTrendMinScore, "smallest mean shift in standard errors treated as a change point")
+	cmd.Flags().Float64Var(&cfg.MaxDriftPercent, "max-drift", benchspy.DefaultTrendMaxDriftPercent, "largest relative change of the trend line in percent not treated as a regression")
+	cmd.Flags().StringSliceVar(&cfg.HigherIsBetter, "higher-is-better", nil, "comma separated metrics that degrade when they decrease")
+	return cmd
+}
+
+func writeTrendReport(w io.Writer, tr *benchspy.TrendReport, format string) error {
+	switch strings.ToLower(format) {
+	case "markdown", "md":
+		return tr.Markdown(w)
+	case "html":
+		return tr.HTML(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tr)
+	default:
+		return fmt.Errorf("unsupported format %s, use markdown, html or json", format)
+	}
+}
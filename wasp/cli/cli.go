@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
+)
+
+// NewRootCmd creates the wasp CLI, Guns and VUs referenced in profiles must be registered
+// with wasp.RegisterGun and wasp.RegisterVU before the command is executed
+func NewRootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "wasp",
+		Short:        "wasp load testing CLI",
+		SilenceUsage: true,
+	}
+	root.AddCommand(newRunCmd(), newListCmd(), newAgentCmd(), newCoordinateCmd(), newBenchSpyCmd())
+	return root
+}
+
+// Execute runs the wasp CLI with os.Args.
+// To run profiles with your own Guns and VUs, register them and call Execute from your own main package.
+func Execute() error {
+	return NewRootCmd().Execute()
+}
+
+func newRunCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "run [profile.toml|profile.yaml]",
+		Short: "Run a declarative load profile and print a summary",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := wasp.LoadProfileConfig(args[0])
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				// sinks and the control API are not created, so a dry run doesn't touch the results file or listen on any port
+				gcs, err := cfg.GeneratorConfigs(nil)
+				if err != nil {
+					return err
+				}
+				for _, gc := range gcs {
+					if cs := gc.CapacitySearch; cs != nil {
+						fmt.Fprintf(cmd.OutOrStdout(), "%s: %s, capacity search from %d to %d by %d, %s per step\n", gc.GenName, gc.LoadType, cs.From, cs.Max, cs.Step, cs.StepDuration)
+						continue
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "%s: %s, %d segment(s)\n", gc.GenName, gc.LoadType, len(gc.Schedule))
+				}
+				return nil
+			}
+			p, err := cfg.NewProfile(nil)
+			if err != nil {
+				return err
+			}
+			_, err = p.Run(true)
+			p.PrintSummary(cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+			var failed []string
+			for _, g := range p.Generators {
+				if g.Stats().RunFailed.Load() {
+					failed = append(failed, g.Cfg.GenName)
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("generators failed: %s", strings.Join(failed, ", "))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate the profile and create generator configs without running them or opening any sinks")
+	return cmd
+}
+
+func newListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List registered Gun and VU implementations",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			fmt.Fprintf(cmd.OutOrStdout(), "Guns: %s\n", strings.Join(wasp.RegisteredGuns(), ", "))
+			fmt.Fprintf(cmd.OutOrStdout(), "VUs: %s\n", strings.Join(wasp.RegisteredVUs(), ", "))
+		},
+	}
+}
+
+func newAgentCmd() *cobra.Command {
+	var listen, id string
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Run an agent executing the parts of distributed profiles sent by a coordinator",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			a, err := wasp.NewAgent(&wasp.AgentConfig{ListenAddr: listen, ID: id})
+			if err != nil {
+				return err
+			}
+			a.Run()
+			fmt.Fprintf(cmd.OutOrStdout(), "Agent %s listening on %s\n", a.ID(), a.Addr())
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			return a.Shutdown(shutdownCtx)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":7777", "address of the agent API")
+	cmd.Flags().StringVar(&id, "id", "", "agent ID, random if not set")
+	return cmd
+}
+
+func newCoordinateCmd() *cobra.Command {
+	var agents []string
+	var startDelay, pollInterval time.Duration
+	cmd := &cobra.Command{
+		Use:   "coordinate [profile.toml|profile.yaml]",
+		Short: "Split a declarative load profile between agents, run it and print a summary",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := wasp.LoadProfileConfig(args[0])
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			c, err := wasp.NewCoordinator(&wasp.CoordinatorConfig{
+				Agents:       agents,
+				Profile:      cfg,
+				StartDelay:   startDelay,
+				PollInterval: pollInterval,
+				OnStats: func(s *wasp.DistributedStats) {
+					for _, g := range s.Generators {
+						fmt.Fprintf(out, "%s: rps %d, vus %d, success %d, failed %d, timeouts %d\n", g.Name, g.CurrentRPS, g.CurrentVUs, g.Success, g.Failed, g.CallTimeout)
+					}
+				},
+			})
+			if err != nil {
+				return err
+			}
+			// interrupting the coordinator stops all the agents
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			stats, err := c.Run(ctx)
+			stats.PrintSummary(out)
+			if err != nil {
+				return err
+			}
+			if stats.Failed() {
+				return fmt.Errorf("distributed run %s failed", c.RunID())
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&agents, "agents", nil, "comma separated agent URLs, ex.: http://10.0.0.1:7777,http://10.0.0.2:7777")
+	cmd.Flags().DurationVar(&startDelay, "start-delay", wasp.DefaultCoordinatorStartDelay, "delay between preparing the agents and the synchronized start")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", wasp.DefaultCoordinatorPollInterval, "how often the agents stats are collected")
+	//nolint
+	_ = cmd.MarkFlagRequired("agents")
+	return cmd
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+
+	"github.com/smartcontractkit/chainlink-testing-framework/wasp/cli"
+)
+
+// main runs the wasp CLI with built-in mock Gun and VU only,
+// to use your own implementations register them and call cli.Execute from your own main package
+func main() {
+	if err := cli.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
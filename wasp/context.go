@@ -0,0 +1,161 @@
+package wasp
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ContextGun is a Gun which calls can be cancelled.
+// ctx is cancelled after Config.CallTimeout or when the generator is stopped, CallContext should return as soon as it's done.
+// If ctx is done the returned response is replaced: a deadline is recorded as a call timeout and calls cancelled by Generator.Stop are not recorded at all.
+// With Config.Tracing ctx carries the trace of the call, see TraceFromContext, the generator records it on the response.
+type ContextGun interface {
+	CallContext(ctx context.Context, l *Generator) *Response
+}
+
+// ContextVirtualUser is a VirtualUser which calls can be cancelled.
+// ctx is cancelled after Config.CallTimeout, when the VU is removed by the schedule or when the generator is stopped.
+// CallContext should return as soon as ctx is done and must not send a response for the cancelled request,
+// the generator records a call timeout itself.
+// With Config.Tracing ctx carries the trace of the call, see TraceFromContext and Response.SetTrace.
+type ContextVirtualUser interface {
+	VirtualUser
+	CallContext(ctx context.Context, l *Generator)
+}
+
+// legacyGun runs a Gun without context support, the call can't be cancelled so it's abandoned when ctx is done
+type legacyGun struct {
+	gun Gun
+}
+
+// ContextGunAdapter wraps a Gun without context support.
+// When ctx is done the call is abandoned and keeps running in the background until Call returns.
+func ContextGunAdapter(g Gun) ContextGun {
+	if cg, ok := g.(ContextGun); ok {
+		return cg
+	}
+	return &legacyGun{gun: g}
+}
+
+// CallContext calls the wrapped Gun and returns a timeout response if ctx is done first.
+func (m *legacyGun) CallContext(ctx context.Context, l *Generator) *Response {
+	// buffered, so the call goroutine can exit even if nobody reads the result
+	result := make(chan *Response, 1)
+	go func() {
+		result <- m.gun.Call(l)
+	}()
+	select {
+	case <-ctx.Done():
+		return &Response{Timeout: true, Error: ErrCallTimeout.Error()}
+	case res := <-result:
+		return res
+	}
+}
+
+// contextGun runs a ContextGun as a plain Gun
+type contextGun struct {
+	ContextGun
+}
+
+// GunFromContext turns a ContextGun into a Gun which can be used as Config.Gun.
+// The generator calls CallContext, Call creates a context with Config.CallTimeout.
+func GunFromContext(cg ContextGun) Gun {
+	return &contextGun{ContextGun: cg}
+}
+
+// Call calls the wrapped ContextGun with a Config.CallTimeout deadline.
+func (m *contextGun) Call(l *Generator) *Response {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.CallTimeout)
+	defer cancel()
+	return m.CallContext(ctx, l)
+}
+
+// legacyVU runs a VirtualUser without context support
+type legacyVU struct {
+	VirtualUser
+}
+
+// ContextVUAdapter wraps a VirtualUser without context support.
+// When ctx is done CallContext returns and the call keeps running in the background until Call returns.
+func ContextVUAdapter(vu VirtualUser) ContextVirtualUser {
+	if cvu, ok := vu.(ContextVirtualUser); ok {
+		return cvu
+	}
+	return &legacyVU{VirtualUser: vu}
+}
+
+// Clone clones the wrapped VirtualUser.
+func (m *legacyVU) Clone(l *Generator) VirtualUser {
+	return &legacyVU{VirtualUser: m.VirtualUser.Clone(l)}
+}
+
+// CallContext calls the wrapped VirtualUser and returns when it's done or ctx is done, whatever happens first.
+func (m *legacyVU) CallContext(ctx context.Context, l *Generator) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Call(l)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
+
+// runContextVU is runVU for virtual users supporting cancellation, every call gets a context derived from ResponsesCtx with Config.CallTimeout
+// and a new trace with Config.Tracing, VUs should record it on their responses with Response.SetTrace
+func (g *Generator) runContextVU(vu ContextVirtualUser) {
+	g.ResponsesWaitGroup.Add(1)
+	go func() {
+		defer g.ResponsesWaitGroup.Done()
+		if !g.runSetupWithTimeout(vu) {
+			return
+		}
+		for {
+			if g.stats.RunPaused.Load() {
+				continue
+			}
+			select {
+			case <-g.ResponsesCtx.Done():
+				return
+			case <-vu.StopChan():
+				g.runTeardownWithTimeout(vu)
+				return
+			default:
+			}
+			startedAt := time.Now()
+			ctx, cancel := context.WithTimeout(g.ResponsesCtx, g.Cfg.CallTimeout)
+			var tc *TraceContext
+			if g.Cfg.Tracing {
+				tc = NewTraceContext()
+				ctx = ContextWithTrace(ctx, tc)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				vu.CallContext(ctx, g)
+			}()
+			stopped := false
+			select {
+			case <-done:
+			case <-vu.StopChan():
+				stopped = true
+				cancel()
+				<-done
+			}
+			cancel()
+			// ResponsesCtx is cancelled at the end of the schedule, the calls in-flight at that moment are not timeouts
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && g.ResponsesCtx.Err() == nil {
+				res := &Response{StartedAt: &startedAt, Error: ErrCallTimeout.Error(), Timeout: true}
+				res.SetTrace(tc)
+				g.ResponsesChan <- res
+			}
+			if stopped {
+				g.runTeardownWithTimeout(vu)
+				return
+			}
+		}
+	}()
+}
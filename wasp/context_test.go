@@ -0,0 +1,175 @@
+package wasp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingContextGun blocks every call until ctx is done and counts the calls in flight
+type blockingContextGun struct {
+	inFlight atomic.Int64
+	calls    atomic.Int64
+}
+
+func (m *blockingContextGun) CallContext(ctx context.Context, _ *Generator) *Response {
+	m.calls.Add(1)
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	<-ctx.Done()
+	return &Response{Failed: true, Error: ctx.Err().Error()}
+}
+
+// blockingContextVU blocks every call until ctx is done and counts the calls in flight
+type blockingContextVU struct {
+	*VUControl
+	inFlight *atomic.Int64
+}
+
+func (m *blockingContextVU) Clone(_ *Generator) VirtualUser {
+	return &blockingContextVU{VUControl: NewVUControl(), inFlight: m.inFlight}
+}
+
+func (m *blockingContextVU) Setup(_ *Generator) error    { return nil }
+func (m *blockingContextVU) Teardown(_ *Generator) error { return nil }
+func (m *blockingContextVU) Call(l *Generator)           { m.CallContext(context.Background(), l) }
+
+func (m *blockingContextVU) CallContext(ctx context.Context, _ *Generator) {
+	m.inFlight.Add(1)
+	defer m.inFlight.Add(-1)
+	<-ctx.Done()
+}
+
+func TestSmokeContextGunTimeout(t *testing.T) {
+	t.Parallel()
+	gun := &blockingContextGun{}
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: time.Second,
+		CallTimeout:       50 * time.Millisecond,
+		Schedule:          Plain(20, time.Second),
+		Gun:               GunFromContext(gun),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.True(t, failed)
+	require.Zero(t, gun.inFlight.Load())
+	// every call is recorded as a call timeout, not as a failure reported by the gun
+	require.Equal(t, gun.calls.Load(), gen.Stats().CallTimeout.Load())
+	require.Equal(t, ErrCallTimeout.Error(), gen.Errors()[0])
+}
+
+func TestSmokeContextGunStop(t *testing.T) {
+	t.Parallel()
+	gun := &blockingContextGun{}
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: time.Second,
+		CallTimeout:       time.Minute,
+		Schedule:          Plain(20, time.Minute),
+		Gun:               GunFromContext(gun),
+	})
+	require.NoError(t, err)
+	gen.Run(false)
+	time.Sleep(500 * time.Millisecond)
+	require.Greater(t, gun.inFlight.Load(), int64(0))
+	start := time.Now()
+	gen.Stop()
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Zero(t, gun.inFlight.Load())
+	// cancelled calls are not recorded
+	require.Zero(t, gen.Stats().CallTimeout.Load())
+	require.Zero(t, gen.Stats().Failed.Load())
+}
+
+func TestSmokeContextHTTPGunCancelsRequests(t *testing.T) {
+	t.Parallel()
+	var inFlight atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer srv.Close()
+
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: time.Second,
+		CallTimeout:       100 * time.Millisecond,
+		Schedule:          Plain(10, time.Second),
+		Gun:               NewHTTPMockGun(&MockHTTPGunConfig{TargetURL: srv.URL}),
+	})
+	require.NoError(t, err)
+	gen.Run(true)
+	require.Greater(t, gen.Stats().CallTimeout.Load(), int64(5))
+	// the server sees the requests cancelled instead of waiting for a minute
+	require.Eventually(t, func() bool {
+		return inFlight.Load() == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSmokeContextVUTimeoutAndStop(t *testing.T) {
+	t.Parallel()
+	vu := &blockingContextVU{VUControl: NewVUControl(), inFlight: &atomic.Int64{}}
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          VU,
+		StatsPollInterval: time.Second,
+		CallTimeout:       100 * time.Millisecond,
+		Schedule: Combine(
+			Plain(3, time.Second),
+			Plain(1, time.Minute),
+		),
+		VU: vu,
+	})
+	require.NoError(t, err)
+	gen.Run(false)
+	time.Sleep(1500 * time.Millisecond)
+	// the VUs removed by the schedule are cancelled
+	require.LessOrEqual(t, vu.inFlight.Load(), int64(1))
+	start := time.Now()
+	gen.Stop()
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Zero(t, vu.inFlight.Load())
+	require.Greater(t, gen.Stats().CallTimeout.Load(), int64(10))
+	require.Equal(t, gen.Stats().CallTimeout.Load(), gen.Stats().Failed.Load())
+}
+
+func TestSmokeContextAdapters(t *testing.T) {
+	t.Parallel()
+	gen := &Generator{Cfg: &Config{CallTimeout: 50 * time.Millisecond}, ResponsesChan: make(chan *Response, 10)}
+
+	// legacy gun is abandoned when ctx is done
+	legacy := ContextGunAdapter(NewMockGun(&MockGunConfig{CallSleep: time.Second}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res := legacy.CallContext(ctx, gen)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.True(t, res.Timeout)
+
+	// context guns are not wrapped twice
+	cg := &blockingContextGun{}
+	require.Equal(t, ContextGun(cg), ContextGunAdapter(GunFromContext(cg)).(*contextGun).ContextGun)
+	res = GunFromContext(cg).Call(gen)
+	require.True(t, res.Failed)
+	require.Equal(t, context.DeadlineExceeded.Error(), res.Error)
+
+	vu := ContextVUAdapter(NewMockVU(&MockVirtualUserConfig{CallSleep: time.Second}))
+	_, ok := vu.Clone(gen).(ContextVirtualUser)
+	require.True(t, ok)
+	start = time.Now()
+	vu.CallContext(ctx, gen)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
@@ -0,0 +1,104 @@
+package wasp
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrControlCapacitySearch = errors.New("capacity search generates its own schedule, it can't be changed")
+	ErrControlNotRunning     = errors.New("generator schedule is not running")
+	ErrControlNoSegments     = errors.New("no segments to inject")
+)
+
+// scheduleCommand is applied by the schedule loop, next ends the current segment right away
+type scheduleCommand struct {
+	apply func() (next bool, err error)
+	done  chan error
+}
+
+// SetRate changes the load of a running generator, it's kept until the next schedule segment starts.
+// rate is the number of requests per Config.RateLimitUnitDuration for RPS load or the number of virtual users for VU load.
+func (g *Generator) SetRate(rate int64) error {
+	if rate <= 0 {
+		return ErrStartFrom
+	}
+	return g.control(func() (bool, error) {
+		g.applyLoad(rate, g.currentSegment.Type)
+		g.Log.Warn().Int64("Rate", rate).Msg("Generator rate was changed")
+		return false, nil
+	})
+}
+
+// InjectSegments runs the segments right away, ex.: Plain(500, 10*time.Minute) holds 500 RPS for 10 minutes.
+// The rest of the current segment and the remaining schedule are run after them, so the run is extended by the duration of the injected segments.
+func (g *Generator) InjectSegments(segs ...*Segment) error {
+	if len(segs) == 0 {
+		return ErrControlNoSegments
+	}
+	injected := make([]*Segment, 0, len(segs))
+	var added time.Duration
+	for _, s := range segs {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if s.Type == SegmentType_Poisson && g.Cfg.LoadType != RPS {
+			return ErrPoissonSegmentVU
+		}
+		sc := *s
+		injected = append(injected, &sc)
+		added += s.Duration
+	}
+	return g.control(func() (bool, error) {
+		if !g.deadline.Stop() {
+			return false, ErrControlNotRunning
+		}
+		g.deadlineAt = g.deadlineAt.Add(added)
+		g.deadline.Reset(time.Until(g.deadlineAt))
+
+		cur := g.currentSegment
+		rest := &Segment{From: cur.From, Type: cur.Type, Duration: cur.Duration - time.Since(cur.StartTime)}
+		pos := int(g.stats.CurrentSegment.Load())
+		schedule := make([]*Segment, 0, len(g.scheduleSegments)+len(injected)+1)
+		schedule = append(schedule, g.scheduleSegments[:pos]...)
+		schedule = append(schedule, injected...)
+		if rest.Duration > 0 {
+			schedule = append(schedule, rest)
+		}
+		schedule = append(schedule, g.scheduleSegments[pos:]...)
+
+		g.currentSegmentMu.Lock()
+		g.scheduleSegments = schedule
+		g.Cfg.duration += added
+		g.currentSegmentMu.Unlock()
+		g.stats.LastSegment.Store(int64(len(schedule)))
+		g.Log.Warn().Int("Segments", len(injected)).Dur("Duration", added).Msg("Schedule segments were injected")
+		return true, nil
+	})
+}
+
+// control sends a command to the schedule loop and waits until it's applied
+func (g *Generator) control(apply func() (bool, error)) error {
+	if g.Cfg.CapacitySearch != nil {
+		return ErrControlCapacitySearch
+	}
+	if g.stats.CurrentSegment.Load() == 0 {
+		return ErrControlNotRunning
+	}
+	cmd := &scheduleCommand{
+		apply: func() (bool, error) {
+			if g.ResponsesCtx.Err() != nil {
+				return false, ErrControlNotRunning
+			}
+			return apply()
+		},
+		done: make(chan error, 1),
+	}
+	select {
+	case g.controlChan <- cmd:
+		return <-cmd.done
+	case <-g.scheduleDone:
+		return ErrControlNotRunning
+	}
+}
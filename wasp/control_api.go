@@ -0,0 +1,234 @@
+package wasp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/smartcontractkit/chainlink-testing-framework/lib/grafana"
+)
+
+// controlAPIShutdownTimeout is how long Wait waits for the in-flight control requests
+const controlAPIShutdownTimeout = 10 * time.Second
+
+// ControlGeneratorStats are the live stats of a generator returned by the control API
+type ControlGeneratorStats struct {
+	Name   string                 `json:"name"`
+	Paused bool                   `json:"paused"`
+	Stats  map[string]interface{} `json:"stats"`
+}
+
+// ControlRateRequest changes the load of a generator, see Generator.SetRate
+type ControlRateRequest struct {
+	Rate int64 `json:"rate"`
+}
+
+// ControlSegmentsRequest injects segments into the schedule of a generator, see Generator.InjectSegments
+type ControlSegmentsRequest struct {
+	Segments []*SegmentConfig `json:"segments"`
+}
+
+// WithControlAPI serves a live control API of the profile on listenAddr, use "127.0.0.1:0" for a random local port:
+//   - GET /v1/generators returns live stats of all generators, GET /v1/generators/{name} of a single one
+//   - POST /v1/generators/{name}/pause, /resume and /stop control a single generator
+//   - POST /v1/generators/{name}/rate changes the load, ex.: {"rate": 500}, see Generator.SetRate
+//   - POST /v1/generators/{name}/segments injects segments, ex.: {"segments": [{"type": "plain", "from": 500, "duration": "10m"}]}, see Generator.InjectSegments
+//   - POST /v1/pause, /v1/resume and /v1/stop control all generators
+//
+// Every action is annotated on the dashboard set in GrafanaOpts.AnnotateDashboardUID, see WithGrafana.
+// The API is served from Run until the profile has finished.
+func (m *Profile) WithControlAPI(listenAddr string) *Profile {
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		m.bootstrapErr = errors.Wrap(err, "failed to start control API")
+		return m
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/generators", m.handleControlStats)
+	mux.HandleFunc("GET /v1/generators/{name}", m.handleGenerator(func(_ *http.Request, _ *Generator) (string, error) {
+		return "", nil
+	}))
+	mux.HandleFunc("POST /v1/generators/{name}/pause", m.handleGenerator(func(_ *http.Request, g *Generator) (string, error) {
+		g.Pause()
+		return "paused", nil
+	}))
+	mux.HandleFunc("POST /v1/generators/{name}/resume", m.handleGenerator(func(_ *http.Request, g *Generator) (string, error) {
+		g.Resume()
+		return "resumed", nil
+	}))
+	mux.HandleFunc("POST /v1/generators/{name}/stop", m.handleGenerator(func(_ *http.Request, g *Generator) (string, error) {
+		// annotated before stopping, Stop waits for the generator to finish
+		m.annotateControlOnGrafana(fmt.Sprintf("generator %s stopped", g.Cfg.GenName))
+		g.Stop()
+		return "", nil
+	}))
+	mux.HandleFunc("POST /v1/generators/{name}/rate", m.handleGenerator(m.controlRate))
+	mux.HandleFunc("POST /v1/generators/{name}/segments", m.handleGenerator(m.controlSegments))
+	mux.HandleFunc("POST /v1/pause", m.handleProfile("paused", m.Pause))
+	mux.HandleFunc("POST /v1/resume", m.handleProfile("resumed", m.Resume))
+	mux.HandleFunc("POST /v1/stop", m.handleProfile("stopped", m.Stop))
+	m.controlLis = lis
+	m.controlSrv = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return m
+}
+
+// ControlAPIAddr returns the address of the control API or an empty string if it's not enabled.
+func (m *Profile) ControlAPIAddr() string {
+	if m.controlLis == nil {
+		return ""
+	}
+	return m.controlLis.Addr().String()
+}
+
+// serveControlAPI starts serving the control API if it's enabled
+func (m *Profile) serveControlAPI() {
+	if m.controlSrv == nil {
+		return
+	}
+	m.controlOnce.Do(func() {
+		go func() {
+			if err := m.controlSrv.Serve(m.controlLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Err(err).Str("Addr", m.ControlAPIAddr()).Msg("Control API failed")
+			}
+		}()
+		log.Info().Str("Addr", m.ControlAPIAddr()).Msg("Control API started")
+	})
+}
+
+// shutdownControlAPI stops the control API, in-flight requests are waited for
+func (m *Profile) shutdownControlAPI() {
+	if m.controlSrv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controlAPIShutdownTimeout)
+	defer cancel()
+	if err := m.controlSrv.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to shutdown control API")
+	}
+}
+
+func (m *Profile) controlRate(r *http.Request, g *Generator) (string, error) {
+	req := &ControlRateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return "", err
+	}
+	if err := g.SetRate(req.Rate); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rate changed to %d", req.Rate), nil
+}
+
+func (m *Profile) controlSegments(r *http.Request, g *Generator) (string, error) {
+	req := &ControlSegmentsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return "", err
+	}
+	segs := make([]*Segment, 0)
+	desc := make([]string, 0, len(req.Segments))
+	for i, sc := range req.Segments {
+		s, err := sc.Segments()
+		if err != nil {
+			return "", fmt.Errorf("segment %d: %w", i, err)
+		}
+		segs = append(segs, s...)
+		desc = append(desc, fmt.Sprintf("%s from %d for %s", sc.Type, sc.From, sc.Duration))
+	}
+	if err := g.InjectSegments(segs...); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("segments injected: %s", strings.Join(desc, ", ")), nil
+}
+
+// handleGenerator runs a control action on the generator from the path and returns its stats,
+// a non-empty action description is annotated on Grafana
+func (m *Profile) handleGenerator(action func(r *http.Request, g *Generator) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		g := m.generator(name)
+		if g == nil {
+			writeJSONError(w, http.StatusNotFound, fmt.Errorf("generator %s not found", name))
+			return
+		}
+		desc, err := action(r, g)
+		if err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, ErrControlNotRunning) || errors.Is(err, ErrControlCapacitySearch) {
+				code = http.StatusConflict
+			}
+			writeJSONError(w, code, err)
+			return
+		}
+		if desc != "" {
+			m.annotateControlOnGrafana(fmt.Sprintf("generator %s %s", name, desc))
+		}
+		writeJSON(w, newControlGeneratorStats(g))
+	}
+}
+
+// handleProfile runs a control action on all generators and returns their stats
+func (m *Profile) handleProfile(desc string, action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.annotateControlOnGrafana(fmt.Sprintf("profile %s", desc))
+		action()
+		m.handleControlStats(w, r)
+	}
+}
+
+func (m *Profile) handleControlStats(w http.ResponseWriter, _ *http.Request) {
+	stats := make([]*ControlGeneratorStats, 0, len(m.Generators))
+	for _, g := range m.Generators {
+		stats = append(stats, newControlGeneratorStats(g))
+	}
+	writeJSON(w, stats)
+}
+
+// generator returns the first generator with the name
+func (m *Profile) generator(name string) *Generator {
+	for _, g := range m.Generators {
+		if g.Cfg.GenName == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func newControlGeneratorStats(g *Generator) *ControlGeneratorStats {
+	return &ControlGeneratorStats{
+		Name:   g.Cfg.GenName,
+		Paused: g.stats.RunPaused.Load(),
+		Stats:  g.StatsJSON(),
+	}
+}
+
+// annotateControlOnGrafana posts a control action annotation to the Grafana dashboard, if it's configured
+func (m *Profile) annotateControlOnGrafana(action string) {
+	log.Info().Str("ProfileID", m.ProfileID).Str("Action", action).Msg("Control API action")
+	if m.grafanaAPI == nil || m.grafanaOpts.AnnotateDashboardUID == "" {
+		return
+	}
+	now := time.Now()
+	var sb strings.Builder
+	sb.WriteString("<body>")
+	sb.WriteString("<h4>Control API</h4>")
+	sb.WriteString(fmt.Sprintf("<div>WASP profileId: %s</div>", m.ProfileID))
+	sb.WriteString(fmt.Sprintf("<div>Action: %s</div>", html.EscapeString(action)))
+	sb.WriteString(fmt.Sprintf("<div>Time: %s</div>", now.Format(time.RFC3339)))
+	sb.WriteString("</body>")
+
+	a := grafana.PostAnnotation{
+		DashboardUID: m.grafanaOpts.AnnotateDashboardUID,
+		Time:         &now,
+		Text:         sb.String(),
+	}
+	_, _, err := m.grafanaAPI.PostAnnotation(a)
+	if err != nil {
+		log.Warn().Msgf("could not annotate on Grafana: %s", err)
+	}
+}
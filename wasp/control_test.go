@@ -0,0 +1,253 @@
+package wasp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func controlRequest(t *testing.T, method, url string, body interface{}, result interface{}) int {
+	var d []byte
+	if body != nil {
+		var err error
+		d, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(d))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+// grafanaAnnotationsMock records texts of the posted annotations
+func grafanaAnnotationsMock(t *testing.T) (*httptest.Server, func() []string) {
+	mu := &sync.Mutex{}
+	texts := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/annotations" {
+			a := map[string]interface{}{}
+			//nolint
+			_ = json.NewDecoder(r.Body).Decode(&a)
+			mu.Lock()
+			texts = append(texts, fmt.Sprint(a["text"]))
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		//nolint
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, texts...)
+	}
+}
+
+func TestSmokeControlSetRate(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Combine(
+			Plain(5, 2*time.Second),
+			Plain(10, time.Second),
+		),
+		Gun: NewMockGun(&MockGunConfig{CallSleep: 10 * time.Millisecond}),
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, gen.SetRate(50), ErrControlNotRunning)
+	gen.Run(false)
+	require.Eventually(t, func() bool {
+		return gen.SetRate(50) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(50), gen.Stats().CurrentRPS.Load())
+	require.ErrorIs(t, gen.SetRate(0), ErrStartFrom)
+	_, failed := gen.Wait()
+	require.False(t, failed)
+	stats := gen.Stats()
+	// the rate is kept until the next segment
+	require.Equal(t, int64(10), stats.CurrentRPS.Load())
+	require.Greater(t, stats.Success.Load(), int64(80))
+	require.Equal(t, (3 * time.Second).Nanoseconds(), stats.Duration)
+	require.ErrorIs(t, gen.SetRate(50), ErrControlNotRunning)
+}
+
+func TestSmokeControlInjectSegments(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Combine(
+			Plain(5, 2*time.Second),
+			Plain(10, time.Second),
+		),
+		Gun: NewMockGun(&MockGunConfig{CallSleep: 10 * time.Millisecond}),
+	})
+	require.NoError(t, err)
+	start := time.Now()
+	gen.Run(false)
+	time.Sleep(500 * time.Millisecond)
+	require.NoError(t, gen.InjectSegments(Plain(30, time.Second)...))
+	require.Eventually(t, func() bool {
+		return gen.Stats().CurrentRPS.Load() == 30
+	}, time.Second, 10*time.Millisecond)
+	// the rest of the first segment is run after the injected one
+	require.Eventually(t, func() bool {
+		return gen.Stats().CurrentRPS.Load() == 5
+	}, 2*time.Second, 10*time.Millisecond)
+	_, failed := gen.Wait()
+	elapsed := time.Since(start)
+	require.False(t, failed)
+	stats := gen.Stats()
+	require.Equal(t, int64(10), stats.CurrentRPS.Load())
+	require.Equal(t, int64(4), stats.LastSegment.Load())
+	require.Equal(t, (4 * time.Second).Nanoseconds(), stats.Duration)
+	require.GreaterOrEqual(t, elapsed, 4*time.Second)
+	// the stats loop may take another poll interval to exit
+	require.Less(t, elapsed, 6*time.Second)
+	require.Greater(t, stats.Success.Load(), int64(50))
+
+	require.ErrorIs(t, gen.InjectSegments(Plain(30, time.Second)...), ErrControlNotRunning)
+	require.ErrorIs(t, gen.InjectSegments(), ErrControlNoSegments)
+	require.ErrorIs(t, gen.InjectSegments(&Segment{From: 1, Type: SegmentType_Plain}), ErrInvalidSegmentDuration)
+}
+
+func TestSmokeControlInjectSegmentsVU(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: VU,
+		Schedule: Plain(1, 2*time.Second),
+		VU:       NewMockVU(&MockVirtualUserConfig{CallSleep: 50 * time.Millisecond}),
+	})
+	require.NoError(t, err)
+	gen.Run(false)
+	require.Eventually(t, func() bool {
+		return gen.Stats().CurrentSegment.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, gen.InjectSegments(Poisson(1, time.Second)...), ErrPoissonSegmentVU)
+	require.NoError(t, gen.InjectSegments(Plain(3, time.Second)...))
+	require.Eventually(t, func() bool {
+		return gen.Stats().CurrentVUs.Load() == 3
+	}, time.Second, 10*time.Millisecond)
+	_, failed := gen.Wait()
+	require.False(t, failed)
+	require.Equal(t, int64(1), gen.Stats().CurrentVUs.Load())
+	require.Equal(t, (3 * time.Second).Nanoseconds(), gen.Stats().Duration)
+}
+
+func TestSmokeControlAPI(t *testing.T) {
+	t.Parallel()
+	grafanaSrv, annotations := grafanaAnnotationsMock(t)
+	newGen := func(name string) (*Generator, error) {
+		return NewGenerator(&Config{
+			T:        t,
+			GenName:  name,
+			LoadType: RPS,
+			Schedule: Plain(5, time.Minute),
+			Gun:      NewMockGun(&MockGunConfig{CallSleep: 10 * time.Millisecond}),
+		})
+	}
+	p := NewProfile().
+		Add(newGen("a")).
+		Add(newGen("b")).
+		WithGrafana(&GrafanaOpts{GrafanaURL: grafanaSrv.URL, AnnotateDashboardUID: "dashboard"}).
+		WithControlAPI("127.0.0.1:0")
+	require.NotEmpty(t, p.ControlAPIAddr())
+	_, err := p.Run(false)
+	require.NoError(t, err)
+	api := "http://" + p.ControlAPIAddr() + "/v1"
+	require.Eventually(t, func() bool {
+		return p.Generators[0].Stats().CurrentRPS.Load() > 0 && p.Generators[1].Stats().CurrentRPS.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var stats []*ControlGeneratorStats
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodGet, api+"/generators", nil, &stats))
+	require.Len(t, stats, 2)
+	require.Equal(t, "a", stats[0].Name)
+	require.Equal(t, float64(5), stats[0].Stats["current_rps"])
+
+	st := &ControlGeneratorStats{}
+	require.Equal(t, http.StatusNotFound, controlRequest(t, http.MethodGet, api+"/generators/c", nil, nil))
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/generators/a/rate", &ControlRateRequest{Rate: 20}, st))
+	require.Equal(t, float64(20), st.Stats["current_rps"])
+	require.Equal(t, http.StatusBadRequest, controlRequest(t, http.MethodPost, api+"/generators/a/rate", &ControlRateRequest{Rate: -1}, nil))
+
+	segs := &ControlSegmentsRequest{Segments: []*SegmentConfig{{Type: "plain", From: 30, Duration: "10m"}}}
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/generators/b/segments", segs, st))
+	require.Equal(t, float64(30), st.Stats["current_rps"])
+	segs.Segments[0].Duration = "forever"
+	require.Equal(t, http.StatusBadRequest, controlRequest(t, http.MethodPost, api+"/generators/b/segments", segs, nil))
+
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/generators/a/pause", nil, st))
+	require.True(t, st.Paused)
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/pause", nil, &stats))
+	require.True(t, stats[0].Paused && stats[1].Paused)
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/resume", nil, &stats))
+	require.False(t, stats[0].Paused || stats[1].Paused)
+
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/generators/a/stop", nil, st))
+	require.Equal(t, true, st.Stats["run_stopped"])
+	require.Equal(t, http.StatusConflict, controlRequest(t, http.MethodPost, api+"/generators/a/rate", &ControlRateRequest{Rate: 20}, nil))
+	require.Equal(t, http.StatusOK, controlRequest(t, http.MethodPost, api+"/stop", nil, &stats))
+	require.Equal(t, true, stats[1].Stats["run_stopped"])
+	p.Wait()
+
+	texts := strings.Join(annotations(), "\n")
+	for _, action := range []string{
+		"generator a rate changed to 20",
+		"generator b segments injected: plain from 30 for 10m",
+		"generator a paused",
+		"profile paused",
+		"profile resumed",
+		"generator a stopped",
+		"profile stopped",
+	} {
+		require.Contains(t, texts, action)
+	}
+	require.NotContains(t, texts, "rate changed to -1")
+	// the API is stopped with the profile
+	_, err = http.Get(api + "/generators")
+	require.Error(t, err)
+}
+
+func TestSmokeControlAPIErrors(t *testing.T) {
+	t.Parallel()
+	p := NewProfile().WithControlAPI("127.0.0.1:0")
+	p2 := NewProfile().WithControlAPI(p.ControlAPIAddr())
+	require.ErrorContains(t, p2.bootstrapErr, "failed to start control API")
+	require.Empty(t, p2.ControlAPIAddr())
+	require.Empty(t, NewProfile().ControlAPIAddr())
+	//nolint
+	_ = p.controlLis.Close()
+
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		CapacitySearch: &CapacitySearchConfig{
+			From:         1,
+			Step:         1,
+			Max:          2,
+			StepDuration: time.Second,
+			SLO:          []*AbortCondition{ErrorRateAbove(0.5, 0)},
+		},
+		Gun: NewMockGun(&MockGunConfig{}),
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, gen.SetRate(1), ErrControlCapacitySearch)
+	require.ErrorIs(t, gen.InjectSegments(Plain(1, time.Second)...), ErrControlCapacitySearch)
+}
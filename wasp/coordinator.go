@@ -0,0 +1,331 @@
+package wasp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultCoordinatorStartDelay   = 2 * time.Second
+	DefaultCoordinatorPollInterval = time.Second
+	// coordinatorMaxPollErrors is the number of failed stats requests in a row after which an agent is considered lost
+	coordinatorMaxPollErrors = 5
+)
+
+// CoordinatorConfig configures a Coordinator
+type CoordinatorConfig struct {
+	// Agents are the base URLs of the agents, ex.: http://10.0.0.1:7777
+	Agents []string
+	// Profile is split between the agents, see SplitProfileConfig
+	Profile *ProfileConfig
+	// StartDelay is the time between preparing the agents and the synchronized start, DefaultCoordinatorStartDelay if not set
+	StartDelay time.Duration
+	// PollInterval is how often the agents stats are collected, DefaultCoordinatorPollInterval if not set
+	PollInterval time.Duration
+	// Client is used for all agent requests, http.DefaultClient if not set
+	Client *http.Client
+	// OnStats is called with aggregated stats after every poll
+	OnStats func(s *DistributedStats)
+}
+
+// Validate checks the agents and splits the profile between them.
+func (m *CoordinatorConfig) Validate() error {
+	if len(m.Agents) == 0 {
+		return ErrNoAgents
+	}
+	if m.Profile == nil {
+		return fmt.Errorf("profile is empty")
+	}
+	if m.StartDelay == 0 {
+		m.StartDelay = DefaultCoordinatorStartDelay
+	}
+	if m.PollInterval == 0 {
+		m.PollInterval = DefaultCoordinatorPollInterval
+	}
+	if m.Client == nil {
+		m.Client = http.DefaultClient
+	}
+	for i, a := range m.Agents {
+		m.Agents[i] = strings.TrimSuffix(a, "/")
+	}
+	return nil
+}
+
+// Coordinator runs a ProfileConfig on several agents, it doesn't need Kubernetes, only HTTP access to the agents.
+// The load of every generator is split between the agents, all agents start at the same instant
+// and their stats are aggregated live, see Stats and CoordinatorConfig.OnStats.
+// Pause, Resume and Stop are propagated to all the agents.
+type Coordinator struct {
+	cfg   *CoordinatorConfig
+	parts []*ProfileConfig
+	// abortConditions are checked against the aggregated stats, see RunAbortConditions
+	abortConditions map[string][]*AbortCondition
+	runID           string
+	mu              *sync.Mutex
+	stats           *DistributedStats
+}
+
+// NewCoordinator validates the config and splits the profile between the agents.
+func NewCoordinator(cfg *CoordinatorConfig) (*Coordinator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	parts, err := SplitProfileConfig(cfg.Profile, len(cfg.Agents))
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := RunAbortConditions(cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return &Coordinator{
+		cfg:             cfg,
+		parts:           parts,
+		abortConditions: conditions,
+		runID:           uuid.NewString()[0:5],
+		mu:              &sync.Mutex{},
+		stats:           newDistributedStats(make([]*AgentStatus, len(cfg.Agents))),
+	}, nil
+}
+
+// RunID returns the ID of the run shared by all the agents.
+func (c *Coordinator) RunID() string {
+	return c.runID
+}
+
+// Stats returns the last aggregated stats of all agents.
+func (c *Coordinator) Stats() *DistributedStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Run prepares the agents, starts them at the same instant and polls their stats until all of them have finished.
+// If ctx is cancelled the agents are stopped, when an agent reports an error or is aborted the other agents are stopped right away.
+// It returns the final aggregated stats, an error is returned if any agent can't be prepared or started,
+// is lost during the run or reports an error, or an *AbortError if a run abort condition was breached.
+func (c *Coordinator) Run(ctx context.Context) (*DistributedStats, error) {
+	offsets, err := c.prepare(ctx)
+	if err != nil {
+		c.stopAgents()
+		return c.Stats(), err
+	}
+	// agent clocks may differ, so the start time is sent in the clock of every agent
+	startAt := time.Now().Add(c.cfg.StartDelay)
+	err = c.forEachAgent(ctx, func(ctx context.Context, i int, agent string) error {
+		return c.post(ctx, agent, "/v1/start", &AgentStartRequest{RunID: c.runID, StartAt: startAt.Add(offsets[i])}, nil)
+	})
+	if err != nil {
+		c.stopAgents()
+		return c.Stats(), err
+	}
+	log.Info().Str("RunID", c.runID).Int("Agents", len(c.cfg.Agents)).Time("StartAt", startAt).Msg("Distributed run started")
+	return c.poll(ctx)
+}
+
+// prepare sends profile parts to the agents and returns the offsets of their clocks
+func (c *Coordinator) prepare(ctx context.Context) ([]time.Duration, error) {
+	offsets := make([]time.Duration, len(c.cfg.Agents))
+	err := c.forEachAgent(ctx, func(ctx context.Context, i int, agent string) error {
+		sent := time.Now()
+		res := &AgentPrepareResponse{}
+		if err := c.post(ctx, agent, "/v1/prepare", &AgentPrepareRequest{RunID: c.runID, Profile: c.parts[i]}, res); err != nil {
+			return err
+		}
+		// the agent read its clock somewhere in the middle of the round trip
+		received := time.Now()
+		offsets[i] = res.Time.Sub(sent.Add(received.Sub(sent) / 2))
+		log.Debug().Str("Agent", agent).Str("ID", res.ID).Dur("ClockOffset", offsets[i]).Msg("Agent prepared")
+		return nil
+	})
+	return offsets, err
+}
+
+func (c *Coordinator) poll(ctx context.Context) (*DistributedStats, error) {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	pollErrors := make([]int, len(c.cfg.Agents))
+	stopping := false
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn().Str("RunID", c.runID).Msg("Distributed run cancelled, stopping agents")
+			c.stopAgents()
+			return c.Stats(), ctx.Err()
+		case <-ticker.C:
+		}
+		stats, err := c.collect(ctx, pollErrors)
+		if err != nil {
+			c.stopAgents()
+			return c.Stats(), err
+		}
+		if c.cfg.OnStats != nil {
+			c.cfg.OnStats(stats)
+		}
+		if abortErr := stats.checkRunAbortConditions(c.abortConditions); abortErr != nil {
+			log.Error().Err(abortErr).Str("RunID", c.runID).Msg("Distributed run was aborted, stopping agents")
+			c.stopAgents()
+			return c.Stats(), abortErr
+		}
+		if a := stats.failedAgent(); a != nil && !stopping && !stats.Finished() {
+			// the other agents would keep running at full load until the end of their schedule
+			log.Warn().Str("RunID", c.runID).Str("Agent", a.Addr).Str("Error", a.Error).Msg("Agent failed, stopping the other agents")
+			stopping = true
+			c.stopAgents()
+			continue
+		}
+		if stats.Finished() {
+			for _, a := range stats.Agents {
+				if a.Error != "" {
+					return stats, fmt.Errorf("agent %s: %s", a.Addr, a.Error)
+				}
+			}
+			return stats, nil
+		}
+	}
+}
+
+// collect gets stats of all agents, the previous status of an agent is kept if it doesn't respond
+func (c *Coordinator) collect(ctx context.Context, pollErrors []int) (*DistributedStats, error) {
+	prev := c.Stats()
+	agents := make([]*AgentStatus, len(c.cfg.Agents))
+	mu := &sync.Mutex{}
+	var lost error
+	//nolint
+	_ = c.forEachAgent(ctx, func(ctx context.Context, i int, agent string) error {
+		st, err := c.agentStatus(ctx, agent)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			pollErrors[i]++
+			agents[i] = prev.Agents[i]
+			log.Warn().Err(err).Str("Agent", agent).Int("Errors", pollErrors[i]).Msg("Failed to get agent stats")
+			if pollErrors[i] >= coordinatorMaxPollErrors {
+				lost = errors.Wrapf(ErrAgentUnreachable, "%s: %s", agent, err)
+			}
+			return nil
+		}
+		pollErrors[i] = 0
+		agents[i] = st
+		return nil
+	})
+	stats := newDistributedStats(agents)
+	c.mu.Lock()
+	c.stats = stats
+	c.mu.Unlock()
+	return stats, lost
+}
+
+func (c *Coordinator) agentStatus(ctx context.Context, agent string) (*AgentStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, agent+"/v1/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	st := &AgentStatus{}
+	if err := c.do(req, st); err != nil {
+		return nil, err
+	}
+	if st.RunID != c.runID {
+		return nil, errors.Wrapf(ErrAgentState, "agent runs %s instead of %s", st.RunID, c.runID)
+	}
+	st.Addr = agent
+	return st, nil
+}
+
+// Pause pauses the generators on all the agents.
+func (c *Coordinator) Pause(ctx context.Context) error {
+	return c.control(ctx, "/v1/pause")
+}
+
+// Resume resumes the generators on all the agents.
+func (c *Coordinator) Resume(ctx context.Context) error {
+	return c.control(ctx, "/v1/resume")
+}
+
+// Stop stops the generators on all the agents, Run returns when they have finished.
+func (c *Coordinator) Stop(ctx context.Context) error {
+	return c.control(ctx, "/v1/stop")
+}
+
+func (c *Coordinator) control(ctx context.Context, path string) error {
+	return c.forEachAgent(ctx, func(ctx context.Context, _ int, agent string) error {
+		return c.post(ctx, agent, path, nil, nil)
+	})
+}
+
+// stopAgents stops all the agents when the run fails, errors are only logged because some agents may be already gone
+func (c *Coordinator) stopAgents() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := c.Stop(ctx); err != nil {
+		log.Warn().Err(err).Str("RunID", c.runID).Msg("Failed to stop some agents")
+	}
+}
+
+// forEachAgent calls fn for all agents concurrently and returns the first error
+func (c *Coordinator) forEachAgent(ctx context.Context, fn func(ctx context.Context, i int, agent string) error) error {
+	wg := &sync.WaitGroup{}
+	errs := make([]error, len(c.cfg.Agents))
+	for i, agent := range c.cfg.Agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx, i, agent); err != nil {
+				errs[i] = fmt.Errorf("agent %s: %w", agent, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) post(ctx context.Context, agent, path string, body, result interface{}) error {
+	var r io.Reader
+	if body != nil {
+		d, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(d)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, result)
+}
+
+func (c *Coordinator) do(req *http.Request, result interface{}) error {
+	resp, err := c.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e := map[string]string{}
+		//nolint
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s %s returned %d: %s", req.Method, req.URL.Path, resp.StatusCode, e["error"])
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -29,6 +29,11 @@ const (
 	DefaultRequirementLabelKey = "requirement_name"
 )
 
+const (
+	DataSourceTypeLoki       = "loki"
+	DataSourceTypePrometheus = "prometheus"
+)
+
 const (
 	AlertTypeQuantile99 = "quantile_99"
 	AlertTypeErrors     = "errors"
@@ -49,6 +54,8 @@ type WaspAlert struct {
 type Dashboard struct {
 	Name           string
 	DataSourceName string
+	// DataSourceType is either DataSourceTypeLoki (default) or DataSourceTypePrometheus for wasp.PrometheusSink metrics
+	DataSourceType string
 	Folder         string
 	GrafanaURL     string
 	GrafanaToken   string
@@ -66,6 +73,13 @@ func NewDashboard(reqs []WaspAlert, opts []dashboard.Option) (*Dashboard, error)
 	if dsn == "" {
 		return nil, fmt.Errorf("DATA_SOURCE_NAME must be provided")
 	}
+	dst := os.Getenv("DATA_SOURCE_TYPE")
+	if dst == "" {
+		dst = DataSourceTypeLoki
+	}
+	if dst != DataSourceTypeLoki && dst != DataSourceTypePrometheus {
+		return nil, fmt.Errorf("DATA_SOURCE_TYPE must be either %s or %s", DataSourceTypeLoki, DataSourceTypePrometheus)
+	}
 	dbf := os.Getenv("DASHBOARD_FOLDER")
 	if dbf == "" {
 		return nil, fmt.Errorf("DASHBOARD_FOLDER must be provided")
@@ -81,6 +95,7 @@ func NewDashboard(reqs []WaspAlert, opts []dashboard.Option) (*Dashboard, error)
 	dash := &Dashboard{
 		Name:           name,
 		DataSourceName: dsn,
+		DataSourceType: dst,
 		Folder:         dbf,
 		GrafanaURL:     grafanaURL,
 		GrafanaToken:   grafanaToken,
@@ -122,12 +137,30 @@ func defaultStatWidget(name, datasourceName, target, legend string) row.Option {
 	)
 }
 
+// inlineAlertParams generates an alert query for the given data source type.
+func inlineAlertParams(dataSourceType, queryType, testName, genName string) string {
+	if dataSourceType == DataSourceTypePrometheus {
+		return InlinePrometheusAlertParams(queryType, testName, genName)
+	}
+	return InlineLokiAlertParams(queryType, testName, genName)
+}
+
 // defaultLastValueAlertWidget generates a timeseries.Option for alerting using a WaspAlert.
 // It returns the custom alert if provided, otherwise configures a default last-value alert for consistent monitoring in dashboards.
-func defaultLastValueAlertWidget(a WaspAlert) timeseries.Option {
+func defaultLastValueAlertWidget(dataSourceType string, a WaspAlert) timeseries.Option {
 	if a.CustomAlert != nil {
 		return a.CustomAlert
 	}
+	query := alert.WithLokiQuery(
+		a.Name,
+		InlineLokiAlertParams(a.AlertType, a.TestName, a.GenName),
+	)
+	if dataSourceType == DataSourceTypePrometheus {
+		query = alert.WithPrometheusQuery(
+			a.Name,
+			InlinePrometheusAlertParams(a.AlertType, a.TestName, a.GenName),
+		)
+	}
 	return timeseries.Alert(
 		a.Name,
 		alert.For(DefaultAlertFor),
@@ -137,10 +170,7 @@ func defaultLastValueAlertWidget(a WaspAlert) timeseries.Option {
 			"service":                  "wasp",
 			DefaultRequirementLabelKey: a.RequirementGroupName,
 		}),
-		alert.WithLokiQuery(
-			a.Name,
-			InlineLokiAlertParams(a.AlertType, a.TestName, a.GenName),
-		),
+		query,
 		alert.If(alert.Last, a.Name, a.AlertIf),
 		alert.EvaluateEvery(DefaultAlertEvaluateEvery),
 	)
@@ -162,7 +192,7 @@ func defaultLabelValuesVar(name, datasourceName string) dashboard.Option {
 
 // timeSeriesWithAlerts creates dashboard options for each WaspAlert, configuring time series panels with alert settings.
 // Use it to add alert-specific rows to a dashboard based on provided alert definitions.
-func timeSeriesWithAlerts(datasourceName string, alertDefs []WaspAlert) []dashboard.Option {
+func timeSeriesWithAlerts(datasourceName, dataSourceType string, alertDefs []WaspAlert) []dashboard.Option {
 	dashboardOpts := make([]dashboard.Option, 0)
 	for _, a := range alertDefs {
 		// for wasp metrics we also create additional row per alert
@@ -173,13 +203,13 @@ func timeSeriesWithAlerts(datasourceName string, alertDefs []WaspAlert) []dashbo
 			timeseries.DataSource(datasourceName),
 			timeseries.Legend(timeseries.Bottom),
 		}
-		tsOpts = append(tsOpts, defaultLastValueAlertWidget(a))
+		tsOpts = append(tsOpts, defaultLastValueAlertWidget(dataSourceType, a))
 
 		var rowTitle string
 		// for wasp metrics we also create additional row per alert
 		if a.CustomAlert == nil {
 			rowTitle = fmt.Sprintf("Alert: %s, Requirement: %s", a.Name, a.RequirementGroupName)
-			tsOpts = append(tsOpts, timeseries.WithPrometheusTarget(InlineLokiAlertParams(a.AlertType, a.TestName, a.GenName)))
+			tsOpts = append(tsOpts, timeseries.WithPrometheusTarget(inlineAlertParams(dataSourceType, a.AlertType, a.TestName, a.GenName)))
 		} else {
 			rowTitle = fmt.Sprintf("External alert: %s, Requirement: %s", a.Name, a.RequirementGroupName)
 		}
@@ -224,9 +254,14 @@ func (m *Dashboard) dashboard(datasourceName string, requirements []WaspAlert) [
 		dashboard.Tags([]string{"generated", "load-test"}),
 	}
 	defaultOpts = append(defaultOpts, AddVariables(datasourceName)...)
-	defaultOpts = append(defaultOpts, WASPLoadStatsRow(datasourceName, panelQuery))
-	defaultOpts = append(defaultOpts, WASPDebugDataRow(datasourceName, panelQuery, false))
-	defaultOpts = append(defaultOpts, timeSeriesWithAlerts(datasourceName, requirements)...)
+	if m.DataSourceType == DataSourceTypePrometheus {
+		// logs panels are not available for Prometheus, sampling stats are part of the load stats row
+		defaultOpts = append(defaultOpts, WASPPrometheusLoadStatsRow(datasourceName, panelQuery))
+	} else {
+		defaultOpts = append(defaultOpts, WASPLoadStatsRow(datasourceName, panelQuery))
+		defaultOpts = append(defaultOpts, WASPDebugDataRow(datasourceName, panelQuery, false))
+	}
+	defaultOpts = append(defaultOpts, timeSeriesWithAlerts(datasourceName, m.DataSourceType, requirements)...)
 	defaultOpts = append(defaultOpts, m.extendedOpts...)
 	return defaultOpts
 }
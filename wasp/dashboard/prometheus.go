@@ -0,0 +1,181 @@
+package dashboard
+
+import (
+	"fmt"
+
+	"github.com/K-Phoen/grabana/dashboard"
+	"github.com/K-Phoen/grabana/row"
+	"github.com/K-Phoen/grabana/target/prometheus"
+	"github.com/K-Phoen/grabana/timeseries"
+	"github.com/K-Phoen/grabana/timeseries/axis"
+)
+
+// InlinePrometheusAlertParams generates a PromQL query based on the alert type, test name, and generator name.
+// It is the Prometheus counterpart of InlineLokiAlertParams, metrics are exported by wasp.PrometheusSink.
+func InlinePrometheusAlertParams(queryType, testName, genName string) string {
+	switch queryType {
+	case AlertTypeQuantile99:
+		return fmt.Sprintf(`
+histogram_quantile(0.99, sum(rate(wasp_call_duration_seconds_bucket{go_test_name="%s", gen_name="%s"}[10s])) by (le)) * 1e3`, testName, genName)
+	case AlertTypeErrors:
+		return fmt.Sprintf(`
+max(wasp_calls_failed_total{go_test_name="%s", gen_name="%s"}) by (go_test_name, gen_name)`, testName, genName)
+	case AlertTypeTimeouts:
+		return fmt.Sprintf(`
+max(wasp_calls_timeout_total{go_test_name="%s", gen_name="%s"}) by (go_test_name, gen_name)`, testName, genName)
+	default:
+		return ""
+	}
+}
+
+// WASPPrometheusLoadStatsRow creates a "WASP Load Stats" dashboard row for a Prometheus data source.
+// It shows the same widgets as WASPLoadStatsRow, metrics are exported by wasp.PrometheusSink.
+func WASPPrometheusLoadStatsRow(dataSource string, query map[string]string) dashboard.Option {
+	queryString := ""
+	for key, value := range query {
+		queryString += key + value + ", "
+	}
+	selector := `{` + queryString + `go_test_name=~"${go_test_name:pipe}", gen_name=~"${gen_name:pipe}"}`
+	groupSelector := `{` + queryString + `go_test_name=~"${go_test_name:pipe}", gen_name=~"${gen_name:pipe}", call_group=~"${call_group:pipe}"}`
+
+	return dashboard.Row(
+		"WASP Load Stats",
+		defaultStatWidget(
+			"RPS (Now)",
+			dataSource,
+			`sum(wasp_current_rps`+selector+`) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} RPS`,
+		),
+		defaultStatWidget(
+			"VUs (Now)",
+			dataSource,
+			`sum(wasp_current_vus`+selector+`) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} VUs`,
+		),
+		defaultStatWidget(
+			"Responses/sec (Now)",
+			dataSource,
+			`sum(rate(wasp_call_duration_seconds_count`+selector+`[$__rate_interval])) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} Responses/sec`,
+		),
+		defaultStatWidget(
+			"Successful requests (Total)",
+			dataSource,
+			`sum(max_over_time(wasp_calls_success_total`+selector+`[$__range])) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} Successful requests`,
+		),
+		defaultStatWidget(
+			"Errored requests (Total)",
+			dataSource,
+			`sum(max_over_time(wasp_calls_failed_total`+selector+`[$__range])) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} Errored requests`,
+		),
+		defaultStatWidget(
+			"Timed out requests (Total)",
+			dataSource,
+			`sum(max_over_time(wasp_calls_timeout_total`+selector+`[$__range])) by (go_test_name, gen_name)`,
+			`{{go_test_name}} {{gen_name}} Timed out requests`,
+		),
+		row.WithTimeSeries(
+			"RPS/VUs per schedule segments",
+			timeseries.Transparent(),
+			timeseries.Span(6),
+			timeseries.Height("300px"),
+			timeseries.DataSource(dataSource),
+			timeseries.WithPrometheusTarget(
+				`max(wasp_current_rps`+selector+`) by (go_test_name, gen_name)`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} RPS"),
+			),
+			timeseries.WithPrometheusTarget(
+				`sum(wasp_current_rps`+selector+`) by (go_test_name)`,
+				prometheus.Legend("{{go_test_name}} Total RPS"),
+			),
+			timeseries.WithPrometheusTarget(
+				`max(wasp_current_vus`+selector+`) by (go_test_name, gen_name)`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} VUs"),
+			),
+			timeseries.WithPrometheusTarget(
+				`sum(wasp_current_vus`+selector+`) by (go_test_name)`,
+				prometheus.Legend("{{go_test_name}} Total VUs"),
+			),
+		),
+		row.WithTimeSeries(
+			"Responses/sec (Generator, CallGroup)",
+			timeseries.Transparent(),
+			timeseries.Span(6),
+			timeseries.Height("300px"),
+			timeseries.DataSource(dataSource),
+			timeseries.Axis(
+				axis.Unit("Responses"),
+				axis.Label("Responses"),
+			),
+			timeseries.Legend(timeseries.Bottom),
+			timeseries.WithPrometheusTarget(
+				`sum(rate(wasp_call_duration_seconds_count`+groupSelector+`[$__rate_interval])) by (go_test_name, gen_name, call_group)`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} {{call_group}} responses/sec"),
+			),
+			timeseries.WithPrometheusTarget(
+				`sum(rate(wasp_call_duration_seconds_count`+selector+`[$__rate_interval])) by (go_test_name, gen_name)`,
+				prometheus.Legend("{{go_test_name}} Total responses/sec"),
+			),
+		),
+		row.WithTimeSeries(
+			"Latency quantiles over groups (99, 95, 50)",
+			timeseries.Transparent(),
+			timeseries.Span(6),
+			timeseries.Height("300px"),
+			timeseries.DataSource(dataSource),
+			timeseries.Legend(timeseries.Bottom),
+			timeseries.Axis(
+				axis.Unit("ms"),
+				axis.Label("ms"),
+			),
+			timeseries.WithPrometheusTarget(
+				`histogram_quantile(0.99, sum(rate(wasp_call_duration_seconds_bucket`+selector+`[$__rate_interval])) by (le, go_test_name, gen_name)) * 1e3`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} Q 99"),
+			),
+			timeseries.WithPrometheusTarget(
+				`histogram_quantile(0.95, sum(rate(wasp_call_duration_seconds_bucket`+selector+`[$__rate_interval])) by (le, go_test_name, gen_name)) * 1e3`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} Q 95"),
+			),
+			timeseries.WithPrometheusTarget(
+				`histogram_quantile(0.50, sum(rate(wasp_call_duration_seconds_bucket`+selector+`[$__rate_interval])) by (le, go_test_name, gen_name)) * 1e3`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} Q 50"),
+			),
+		),
+		row.WithTimeSeries(
+			"Latency quantiles by types over time (Generator, CallGroup)",
+			timeseries.Transparent(),
+			timeseries.Span(6),
+			timeseries.Height("300px"),
+			timeseries.DataSource(dataSource),
+			timeseries.Legend(timeseries.Bottom),
+			timeseries.Axis(
+				axis.Unit("ms"),
+				axis.Label("ms"),
+			),
+			timeseries.WithPrometheusTarget(
+				`histogram_quantile(0.99, sum(rate(wasp_call_duration_seconds_bucket`+groupSelector+`[$__rate_interval])) by (le, go_test_name, gen_name, call_group)) * 1e3`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} {{call_group}} Q 99"),
+			),
+		),
+		row.WithTimeSeries(
+			"CallResult sampling (successful results)",
+			timeseries.Transparent(),
+			timeseries.Span(12),
+			timeseries.Height("200px"),
+			timeseries.DataSource(dataSource),
+			timeseries.Axis(
+				axis.Label("CallResults"),
+			),
+			timeseries.WithPrometheusTarget(
+				`sum(wasp_samples_recorded_total`+selector+`) by (go_test_name, gen_name)`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} recorded"),
+			),
+			timeseries.WithPrometheusTarget(
+				`sum(wasp_samples_skipped_total`+selector+`) by (go_test_name, gen_name)`,
+				prometheus.Legend("{{go_test_name}} {{gen_name}} skipped"),
+			),
+		),
+	)
+}
@@ -0,0 +1,364 @@
+package wasp
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoAgents                  = errors.New("no agents to run the profile on")
+	ErrDistributedCapacitySearch = errors.New("capacity search can't be distributed, run it on a single node")
+	ErrAgentBusy                 = errors.New("agent is already running a profile")
+	ErrAgentState                = errors.New("agent is not in the right state for this command")
+	ErrAgentUnreachable          = errors.New("agent is unreachable")
+)
+
+// AgentState is the state of the profile run on an agent
+type AgentState string
+
+const (
+	AgentStateIdle     AgentState = "idle"
+	AgentStatePrepared AgentState = "prepared"
+	AgentStateRunning  AgentState = "running"
+	AgentStateFinished AgentState = "finished"
+)
+
+// AgentLabel is added to the labels of every generator run on an agent, its value is the index of the agent
+const AgentLabel = "agent_id"
+
+// AgentPrepareRequest sends the part of the profile an agent should run
+type AgentPrepareRequest struct {
+	RunID   string         `json:"run_id"`
+	Profile *ProfileConfig `json:"profile"`
+}
+
+// AgentPrepareResponse returns the agent clock, so the coordinator can compute the start time in the agent's time
+type AgentPrepareResponse struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+}
+
+// AgentStartRequest starts the prepared profile at StartAt, in the agent clock
+type AgentStartRequest struct {
+	RunID   string    `json:"run_id"`
+	StartAt time.Time `json:"start_at"`
+}
+
+// GeneratorStatus is a serializable snapshot of generator Stats
+type GeneratorStatus struct {
+	Name        string           `json:"name"`
+	LoadType    ScheduleType     `json:"load_type"`
+	Success     int64            `json:"success"`
+	Failed      int64            `json:"failed"`
+	CallTimeout int64            `json:"call_timeout"`
+	CurrentRPS  int64            `json:"current_rps"`
+	CurrentVUs  int64            `json:"current_vus"`
+	RunPaused   bool             `json:"run_paused"`
+	RunStopped  bool             `json:"run_stopped"`
+	RunFailed   bool             `json:"run_failed"`
+	Latencies   *LatencySnapshot `json:"latencies,omitempty"`
+}
+
+// NewGeneratorStatus takes a snapshot of the generator stats.
+func NewGeneratorStatus(g *Generator) *GeneratorStatus {
+	st := g.Stats()
+	s := &GeneratorStatus{
+		Name:        g.Cfg.GenName,
+		LoadType:    g.Cfg.LoadType,
+		Success:     st.Success.Load(),
+		Failed:      st.Failed.Load(),
+		CallTimeout: st.CallTimeout.Load(),
+		CurrentRPS:  st.CurrentRPS.Load(),
+		CurrentVUs:  st.CurrentVUs.Load(),
+		RunPaused:   st.RunPaused.Load(),
+		RunStopped:  st.RunStopped.Load(),
+		RunFailed:   st.RunFailed.Load(),
+	}
+	if st.Latencies != nil {
+		s.Latencies = st.Latencies.Snapshot()
+	}
+	return s
+}
+
+// merge adds stats of the same generator run on another agent, counters and the current load are summed
+func (m *GeneratorStatus) merge(other *GeneratorStatus) {
+	m.Success += other.Success
+	m.Failed += other.Failed
+	m.CallTimeout += other.CallTimeout
+	m.CurrentRPS += other.CurrentRPS
+	m.CurrentVUs += other.CurrentVUs
+	m.RunPaused = m.RunPaused || other.RunPaused
+	m.RunStopped = m.RunStopped || other.RunStopped
+	m.RunFailed = m.RunFailed || other.RunFailed
+	if other.Latencies == nil {
+		return
+	}
+	if m.Latencies == nil {
+		m.Latencies = &LatencySnapshot{}
+	}
+	m.Latencies.Merge(other.Latencies)
+}
+
+// AgentStatus is the state and the generator stats of an agent
+type AgentStatus struct {
+	ID         string             `json:"id"`
+	Addr       string             `json:"addr,omitempty"`
+	RunID      string             `json:"run_id"`
+	State      AgentState         `json:"state"`
+	Generators []*GeneratorStatus `json:"generators"`
+	// Error is set when the profile failed to run or was aborted
+	Error string `json:"error,omitempty"`
+}
+
+// DistributedStats are the stats of all agents, Generators are aggregated by name across the agents
+type DistributedStats struct {
+	Agents     []*AgentStatus     `json:"agents"`
+	Generators []*GeneratorStatus `json:"generators"`
+}
+
+// newDistributedStats aggregates the agent stats, generators are kept in the order of the first agent reporting them
+func newDistributedStats(agents []*AgentStatus) *DistributedStats {
+	s := &DistributedStats{Agents: agents, Generators: make([]*GeneratorStatus, 0)}
+	byName := make(map[string]*GeneratorStatus)
+	for _, a := range agents {
+		if a == nil {
+			continue
+		}
+		for _, g := range a.Generators {
+			agg, ok := byName[g.Name]
+			if !ok {
+				agg = &GeneratorStatus{Name: g.Name, LoadType: g.LoadType}
+				byName[g.Name] = agg
+				s.Generators = append(s.Generators, agg)
+			}
+			agg.merge(g)
+		}
+	}
+	return s
+}
+
+// Finished checks if all the agents have finished their runs.
+func (m *DistributedStats) Finished() bool {
+	for _, a := range m.Agents {
+		if a == nil || a.State != AgentStateFinished {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed checks if any generator failed or any agent reported an error.
+func (m *DistributedStats) Failed() bool {
+	for _, a := range m.Agents {
+		if a != nil && a.Error != "" {
+			return true
+		}
+	}
+	for _, g := range m.Generators {
+		if g.RunFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitProfileConfig splits the load of every generator between n agents.
+// Rates and VUs of every segment are divided evenly, agents with lower indexes get the remainder,
+// so the total load of all agents is the same as the load of the original profile.
+// Every segment must start with at least n RPS or VUs so that every agent gets some load,
+// non-zero To, Increase and Amplitude must be at least n as well, so that no agent gets a no-op segment.
+// Agents may share a host, so every agent writes its own results file and the Prometheus port is offset by the agent index.
+// Abort conditions on the amount of failures or timeouts of the whole run are left to the coordinator, see RunAbortConditions,
+// windowed amounts and MinCalls are divided between the agents.
+func SplitProfileConfig(cfg *ProfileConfig, n int) ([]*ProfileConfig, error) {
+	if n <= 0 {
+		return nil, ErrNoAgents
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.PrometheusListenAddr != "" {
+		if _, err := agentListenAddr(cfg.PrometheusListenAddr, 0); err != nil {
+			return nil, fmt.Errorf("invalid prometheus listen address: %w", err)
+		}
+	}
+	for _, g := range cfg.Generators {
+		if g.CapacitySearch != nil {
+			return nil, fmt.Errorf("generator %s: %w", g.Name, ErrDistributedCapacitySearch)
+		}
+		for i, s := range g.Schedule {
+			if s.From < int64(n) {
+				return nil, fmt.Errorf("generator %s: schedule segment %d starts from %d, it can't be split between %d agents", g.Name, i, s.From, n)
+			}
+			// a share of a non-zero field rounded down to 0 would turn the segment into a no-op for some agents
+			for _, f := range []struct {
+				name string
+				v    int64
+			}{{"to", s.To}, {"increase", s.Increase}, {"amplitude", s.Amplitude}} {
+				if f.v != 0 && f.v > -int64(n) && f.v < int64(n) {
+					return nil, fmt.Errorf("generator %s: schedule segment %d has %s %d, it can't be split between %d agents", g.Name, i, f.name, f.v, n)
+				}
+			}
+		}
+	}
+	parts := make([]*ProfileConfig, 0, n)
+	for i := 0; i < n; i++ {
+		p := *cfg
+		// agents are controlled by the coordinator
+		p.ControlListenAddr = ""
+		if cfg.ResultsFile != "" {
+			p.ResultsFile = agentResultsFile(cfg.ResultsFile, i)
+		}
+		if cfg.PrometheusListenAddr != "" {
+			//nolint
+			p.PrometheusListenAddr, _ = agentListenAddr(cfg.PrometheusListenAddr, i)
+		}
+		p.AbortConditions = splitAbortConditions(cfg.AbortConditions, n)
+		p.Generators = make([]*GeneratorConfig, 0, len(cfg.Generators))
+		for _, g := range cfg.Generators {
+			gc := *g
+			gc.AbortConditions = splitAbortConditions(g.AbortConditions, n)
+			gc.Labels = make(map[string]string, len(g.Labels)+1)
+			for k, v := range g.Labels {
+				gc.Labels[k] = v
+			}
+			gc.Labels[AgentLabel] = strconv.Itoa(i)
+			gc.Schedule = make([]*SegmentConfig, 0, len(g.Schedule))
+			for _, s := range g.Schedule {
+				sc := *s
+				sc.From = splitShare(s.From, n, i)
+				sc.To = splitShare(s.To, n, i)
+				sc.Increase = splitShare(s.Increase, n, i)
+				sc.Amplitude = splitShare(s.Amplitude, n, i)
+				gc.Schedule = append(gc.Schedule, &sc)
+			}
+			p.Generators = append(p.Generators, &gc)
+		}
+		parts = append(parts, &p)
+	}
+	return parts, nil
+}
+
+// agentResultsFile is the results file of the agent i, the agent index is added before the extensions, ex.: results.agent-1.ndjson.gz
+func agentResultsFile(path string, i int) string {
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	if idx := strings.Index(base, "."); idx > 0 {
+		name, ext = base[:idx], base[idx:]
+	}
+	return fmt.Sprintf("%s%s.agent-%d%s", dir, name, i, ext)
+}
+
+// agentListenAddr offsets the port of addr by the agent index i, a random port (0) is kept as is
+func agentListenAddr(addr string, i int) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+	if p == 0 {
+		return addr, nil
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+i)), nil
+}
+
+// isRunTotalCondition checks if the condition is on the amount of failures or timeouts of the whole run
+func isRunTotalCondition(c *AbortCondition) bool {
+	return (c.Metric == AbortMetricFailures || c.Metric == AbortMetricTimeouts) && c.Window == 0
+}
+
+// splitAbortConditions returns the abort conditions an agent checks on its part of the load,
+// conditions on run totals are dropped, amounts of calls are divided between n agents.
+// Conditions must be already validated.
+func splitAbortConditions(cfgs []*AbortConditionConfig, n int) []*AbortConditionConfig {
+	res := make([]*AbortConditionConfig, 0, len(cfgs))
+	for _, ac := range cfgs {
+		//nolint
+		c, _ := ac.AbortCondition()
+		if isRunTotalCondition(c) {
+			continue
+		}
+		sc := *ac
+		if c.Metric == AbortMetricFailures || c.Metric == AbortMetricTimeouts {
+			sc.Threshold = ac.Threshold / float64(n)
+		}
+		sc.MinCalls = (ac.MinCalls + int64(n) - 1) / int64(n)
+		res = append(res, &sc)
+	}
+	return res
+}
+
+// RunAbortConditions returns the abort conditions on the amount of failures or timeouts of the whole run for every generator.
+// When a profile is split between agents, every agent only sees its part of the calls,
+// so these conditions are checked by the coordinator against the stats aggregated across the agents.
+func RunAbortConditions(cfg *ProfileConfig) (map[string][]*AbortCondition, error) {
+	profileConditions, err := abortConditions(cfg.AbortConditions)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]*AbortCondition)
+	for _, g := range cfg.Generators {
+		genConditions, err := abortConditions(g.AbortConditions)
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: %w", g.Name, err)
+		}
+		for _, c := range append(profileConditions, genConditions...) {
+			if isRunTotalCondition(c) {
+				res[g.Name] = append(res[g.Name], c)
+			}
+		}
+	}
+	return res, nil
+}
+
+// checkRunAbortConditions checks the run abort conditions against the aggregated generator stats
+func (m *DistributedStats) checkRunAbortConditions(conditions map[string][]*AbortCondition) *AbortError {
+	for _, g := range m.Generators {
+		for _, c := range conditions[g.Name] {
+			value := float64(g.Failed)
+			if c.Metric == AbortMetricTimeouts {
+				value = float64(g.CallTimeout)
+			}
+			if c.breached(value) {
+				return &AbortError{GenName: g.Name, Condition: c, Value: value, Time: time.Now()}
+			}
+		}
+	}
+	return nil
+}
+
+// failedAgent returns the first agent that reported an error, or nil
+func (m *DistributedStats) failedAgent() *AgentStatus {
+	for _, a := range m.Agents {
+		if a != nil && a.Error != "" {
+			return a
+		}
+	}
+	return nil
+}
+
+// splitShare is the part of v for the agent i of n, the remainder goes to the first agents
+func splitShare(v int64, n, i int) int64 {
+	share := v / int64(n)
+	rem := v % int64(n)
+	if rem < 0 {
+		rem = -rem
+		if int64(i) < rem {
+			share--
+		}
+		return share
+	}
+	if int64(i) < rem {
+		share++
+	}
+	return share
+}
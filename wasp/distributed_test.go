@@ -0,0 +1,392 @@
+package wasp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func distributedTestProfile(rps int64, duration string) *ProfileConfig {
+	return &ProfileConfig{
+		Name: "distributed",
+		Generators: []*GeneratorConfig{
+			{
+				Name:     "rps_gen",
+				LoadType: "rps",
+				Gun:      "mock",
+				Params:   map[string]interface{}{"call_sleep": "10ms"},
+				Schedule: []*SegmentConfig{{Type: "plain", From: rps, Duration: duration}},
+			},
+			{
+				Name:     "vu_gen",
+				LoadType: "vu",
+				VU:       "mock",
+				Params:   map[string]interface{}{"call_sleep": "50ms"},
+				Schedule: []*SegmentConfig{{Type: "plain", From: 2, Duration: duration}},
+			},
+		},
+	}
+}
+
+func runTestAgents(t *testing.T, n int) []string {
+	urls := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		a, err := NewAgent(&AgentConfig{ListenAddr: "127.0.0.1:0", ID: fmt.Sprintf("agent-%d", i)})
+		require.NoError(t, err)
+		a.Run()
+		t.Cleanup(func() {
+			//nolint
+			_ = a.Shutdown(context.Background())
+		})
+		urls = append(urls, "http://"+a.Addr())
+	}
+	return urls
+}
+
+// TestAgentHelperProcess is not a real test, it runs an agent in a separate process for TestSmokeDistributedRunProcesses
+func TestAgentHelperProcess(t *testing.T) {
+	if os.Getenv("WASP_TEST_AGENT_PROCESS") != "1" {
+		return
+	}
+	a, err := NewAgent(&AgentConfig{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	a.Run()
+	fmt.Printf("AGENT_ADDR=%s\n", a.Addr())
+	// the parent test kills the process
+	select {}
+}
+
+func startAgentProcess(t *testing.T) string {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAgentHelperProcess$")
+	cmd.Env = append(os.Environ(), "WASP_TEST_AGENT_PROCESS=1")
+	out, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		//nolint
+		_ = cmd.Process.Kill()
+		//nolint
+		_ = cmd.Wait()
+	})
+	addr := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(out)
+		for sc.Scan() {
+			if a, ok := strings.CutPrefix(sc.Text(), "AGENT_ADDR="); ok {
+				addr <- a
+			}
+		}
+	}()
+	select {
+	case a := <-addr:
+		return "http://" + a
+	case <-time.After(30 * time.Second):
+		t.Fatal("agent process didn't start")
+		return ""
+	}
+}
+
+func TestSmokeSplitProfileConfig(t *testing.T) {
+	t.Parallel()
+	cfg := distributedTestProfile(10, "1s")
+	cfg.Generators[1].Schedule[0].From = 3
+	cfg.Generators[0].Schedule = append(cfg.Generators[0].Schedule,
+		&SegmentConfig{Type: "ramp", From: 5, To: 11, Steps: 2, Duration: "1s"},
+		&SegmentConfig{Type: "steps", From: 4, Increase: -4, Steps: 1, Duration: "1s"},
+	)
+	parts, err := SplitProfileConfig(cfg, 3)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+	var from, to, increase int64
+	for i, p := range parts {
+		require.Equal(t, "distributed", p.Name)
+		require.Equal(t, fmt.Sprint(i), p.Generators[0].Labels[AgentLabel])
+		from += p.Generators[0].Schedule[0].From
+		to += p.Generators[0].Schedule[1].To
+		increase += p.Generators[0].Schedule[2].Increase
+		require.Equal(t, "10ms", p.Generators[0].Params["call_sleep"])
+	}
+	require.Equal(t, int64(10), from)
+	require.Equal(t, int64(11), to)
+	require.Equal(t, int64(-4), increase)
+	require.Equal(t, []int64{4, 3, 3}, []int64{parts[0].Generators[0].Schedule[0].From, parts[1].Generators[0].Schedule[0].From, parts[2].Generators[0].Schedule[0].From})
+	// the original config is not modified
+	require.Equal(t, int64(10), cfg.Generators[0].Schedule[0].From)
+	require.Empty(t, cfg.Generators[0].Labels)
+
+	_, err = SplitProfileConfig(cfg, 0)
+	require.ErrorIs(t, err, ErrNoAgents)
+	_, err = SplitProfileConfig(cfg, 3)
+	require.NoError(t, err)
+	// vu_gen has only 3 VUs
+	_, err = SplitProfileConfig(cfg, 4)
+	require.ErrorContains(t, err, "can't be split between 4 agents")
+	// a ramp to 11 isn't divisible by 4 agents, shares are 3, 3, 3, 2
+	cfg.Generators[1].Schedule[0].From = 4
+	parts, err = SplitProfileConfig(cfg, 4)
+	require.NoError(t, err)
+	to = 0
+	for _, p := range parts {
+		require.Positive(t, p.Generators[0].Schedule[1].To)
+		to += p.Generators[0].Schedule[1].To
+	}
+	require.Equal(t, int64(11), to)
+	// a step increase of -3 rounds down to 0 for some of 5 agents
+	cfg.Generators[0].Schedule[2].Increase = -3
+	cfg.Generators[0].Schedule[2].From = 8
+	_, err = SplitProfileConfig(cfg, 5)
+	require.ErrorContains(t, err, "has increase -3, it can't be split between 5 agents")
+
+	cfg.Generators[0].Schedule = nil
+	cfg.Generators[0].CapacitySearch = &CapacitySearchProfileConfig{From: 1, Step: 1, Max: 10, StepDuration: "1s", SLO: []*AbortConditionConfig{{Metric: "error_rate", Threshold: 0.1}}}
+	_, err = SplitProfileConfig(cfg, 2)
+	require.ErrorIs(t, err, ErrDistributedCapacitySearch)
+}
+
+func TestSmokeSplitProfileConfigSinksAndAbortConditions(t *testing.T) {
+	t.Parallel()
+	cfg := distributedTestProfile(10, "1s")
+	cfg.Generators[1].Schedule[0].From = 4
+	cfg.ResultsFile = "out/results.ndjson.gz"
+	cfg.PrometheusListenAddr = ":2112"
+	cfg.AbortConditions = []*AbortConditionConfig{
+		{Metric: "failures", Threshold: 10},
+		{Metric: "timeouts", Threshold: 8, Window: "10s"},
+		{Metric: "error_rate", Threshold: 0.1, Window: "10s", MinCalls: 10},
+	}
+	cfg.Generators[0].AbortConditions = []*AbortConditionConfig{{Metric: "timeouts", Threshold: 5}}
+	parts, err := SplitProfileConfig(cfg, 4)
+	require.NoError(t, err)
+	for i, p := range parts {
+		require.Equal(t, fmt.Sprintf("out/results.agent-%d.ndjson.gz", i), p.ResultsFile)
+		require.Equal(t, fmt.Sprintf(":%d", 2112+i), p.PrometheusListenAddr)
+		// run totals are checked by the coordinator, windowed amounts are divided
+		require.Len(t, p.AbortConditions, 2)
+		require.Equal(t, 2.0, p.AbortConditions[0].Threshold)
+		require.Equal(t, 0.1, p.AbortConditions[1].Threshold)
+		require.Equal(t, int64(3), p.AbortConditions[1].MinCalls)
+		require.Empty(t, p.Generators[0].AbortConditions)
+	}
+	// the original config is not modified
+	require.Len(t, cfg.AbortConditions, 3)
+	require.Equal(t, 8.0, cfg.AbortConditions[1].Threshold)
+
+	conditions, err := RunAbortConditions(cfg)
+	require.NoError(t, err)
+	require.Len(t, conditions["rps_gen"], 2)
+	require.Equal(t, FailuresAbove(10).String(), conditions["rps_gen"][0].String())
+	require.Equal(t, TimeoutsAbove(5).String(), conditions["rps_gen"][1].String())
+	require.Len(t, conditions["vu_gen"], 1)
+	stats := newDistributedStats([]*AgentStatus{
+		{Generators: []*GeneratorStatus{{Name: "rps_gen", Failed: 6, CallTimeout: 3}}},
+		{Generators: []*GeneratorStatus{{Name: "rps_gen", Failed: 5, CallTimeout: 2}}},
+	})
+	abortErr := stats.checkRunAbortConditions(conditions)
+	require.NotNil(t, abortErr)
+	require.Equal(t, "rps_gen", abortErr.GenName)
+	require.Equal(t, 11.0, abortErr.Value)
+
+	cfg.PrometheusListenAddr = "2112"
+	_, err = SplitProfileConfig(cfg, 4)
+	require.ErrorContains(t, err, "invalid prometheus listen address")
+}
+
+func TestSmokeAgentReleasesPreparedProfile(t *testing.T) {
+	t.Parallel()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	promAddr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+	a, err := NewAgent(&AgentConfig{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	cfg := distributedTestProfile(10, "1m")
+	cfg.ResultsFile = filepath.Join(t.TempDir(), "results.ndjson")
+	cfg.PrometheusListenAddr = promAddr
+	for i := 0; i < 2; i++ {
+		require.NoError(t, a.prepare(&AgentPrepareRequest{RunID: fmt.Sprint(i), Profile: cfg}))
+		require.FileExists(t, cfg.ResultsFile)
+		require.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", promAddr)
+			if err != nil {
+				return false
+			}
+			//nolint
+			_ = conn.Close()
+			return true
+		}, 5*time.Second, 20*time.Millisecond)
+		// stopping a profile that was never started frees the port for the next one
+		a.stop()
+		require.Equal(t, AgentStateFinished, a.Status().State)
+		require.Eventually(t, func() bool {
+			l, err := net.Listen("tcp", promAddr)
+			if err != nil {
+				return false
+			}
+			//nolint
+			_ = l.Close()
+			return true
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+}
+
+func TestSmokeDistributedRunProcesses(t *testing.T) {
+	t.Parallel()
+	agents := []string{startAgentProcess(t), startAgentProcess(t)}
+	var polls atomic.Int64
+	c, err := NewCoordinator(&CoordinatorConfig{
+		Agents:       agents,
+		Profile:      distributedTestProfile(10, "3s"),
+		StartDelay:   500 * time.Millisecond,
+		PollInterval: 200 * time.Millisecond,
+		OnStats: func(_ *DistributedStats) {
+			polls.Add(1)
+		},
+	})
+	require.NoError(t, err)
+	stats, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.True(t, stats.Finished())
+	require.False(t, stats.Failed())
+	require.Greater(t, polls.Load(), int64(5))
+
+	require.Len(t, stats.Agents, 2)
+	for _, a := range stats.Agents {
+		require.Equal(t, c.RunID(), a.RunID)
+		require.Len(t, a.Generators, 2)
+		// every agent runs a half of the load
+		require.Equal(t, int64(5), a.Generators[0].CurrentRPS)
+		require.Equal(t, int64(1), a.Generators[1].CurrentVUs)
+	}
+	require.Len(t, stats.Generators, 2)
+	rps := stats.Generators[0]
+	require.Equal(t, "rps_gen", rps.Name)
+	require.Equal(t, int64(10), rps.CurrentRPS)
+	require.InDelta(t, 30, rps.Success, 3)
+	require.Equal(t, rps.Success, rps.Latencies.Percentiles().Count)
+	require.Equal(t, int64(2), stats.Generators[1].CurrentVUs)
+	require.Greater(t, stats.Generators[1].Success, int64(80))
+}
+
+func TestSmokeDistributedControl(t *testing.T) {
+	t.Parallel()
+	agents := runTestAgents(t, 2)
+	c, err := NewCoordinator(&CoordinatorConfig{
+		Agents:       agents,
+		Profile:      distributedTestProfile(10, "1m"),
+		StartDelay:   200 * time.Millisecond,
+		PollInterval: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	type result struct {
+		stats *DistributedStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		s, err := c.Run(context.Background())
+		done <- result{s, err}
+	}()
+	require.Eventually(t, func() bool {
+		s := c.Stats()
+		return len(s.Generators) == 2 && s.Generators[0].Success > 0
+	}, 10*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, c.Pause(context.Background()))
+	require.Eventually(t, func() bool {
+		return c.Stats().Generators[0].RunPaused
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NoError(t, c.Resume(context.Background()))
+	require.Eventually(t, func() bool {
+		return !c.Stats().Generators[0].RunPaused
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, c.Stop(context.Background()))
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("distributed run didn't stop")
+	}
+	require.NoError(t, res.err)
+	require.True(t, res.stats.Finished())
+	require.True(t, res.stats.Generators[0].RunStopped)
+	require.True(t, res.stats.Failed())
+
+	// agents can run the next profile when the previous one has finished
+	c, err = NewCoordinator(&CoordinatorConfig{
+		Agents:       agents,
+		Profile:      distributedTestProfile(2, "500ms"),
+		StartDelay:   100 * time.Millisecond,
+		PollInterval: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats, err := c.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, stats)
+}
+
+func TestSmokeDistributedErrors(t *testing.T) {
+	t.Parallel()
+	agents := runTestAgents(t, 2)
+
+	_, err := NewCoordinator(&CoordinatorConfig{Profile: distributedTestProfile(10, "1s")})
+	require.ErrorIs(t, err, ErrNoAgents)
+
+	cfg := distributedTestProfile(10, "1s")
+	cfg.Generators[0].Gun = "not_registered"
+	c, err := NewCoordinator(&CoordinatorConfig{Agents: agents, Profile: cfg})
+	require.NoError(t, err)
+	_, err = c.Run(context.Background())
+	require.ErrorContains(t, err, "not registered")
+
+	// an agent can't be prepared twice
+	c, err = NewCoordinator(&CoordinatorConfig{Agents: agents[:1], Profile: distributedTestProfile(2, "1m")})
+	require.NoError(t, err)
+	_, err = c.prepare(context.Background())
+	require.NoError(t, err)
+	_, err = c.prepare(context.Background())
+	require.ErrorContains(t, err, ErrAgentBusy.Error())
+	require.NoError(t, c.Stop(context.Background()))
+
+	// an aborted agent stops the others right away
+	cfg = distributedTestProfile(10, "1m")
+	for _, g := range cfg.Generators {
+		// generators wait for the stats loop to stop
+		g.StatsPollInterval = "100ms"
+	}
+	c, err = NewCoordinator(&CoordinatorConfig{
+		Agents:       agents,
+		Profile:      cfg,
+		StartDelay:   100 * time.Millisecond,
+		PollInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	c.parts[0].AbortConditions = []*AbortConditionConfig{{Metric: "latency", Percentile: 50, Latency: "1ms", Window: "200ms"}}
+	started := time.Now()
+	stats, err := c.Run(context.Background())
+	require.ErrorContains(t, err, "aborted")
+	require.Less(t, time.Since(started), 5*time.Second)
+	require.True(t, stats.Finished())
+	require.True(t, stats.Agents[1].Generators[0].RunStopped)
+
+	c, err = NewCoordinator(&CoordinatorConfig{
+		Agents:       []string{agents[0], "http://127.0.0.1:1"},
+		Profile:      distributedTestProfile(10, "1s"),
+		PollInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	_, err = c.Run(context.Background())
+	require.ErrorContains(t, err, "127.0.0.1:1")
+}
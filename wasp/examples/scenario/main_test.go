@@ -12,7 +12,10 @@ func TestScenario(t *testing.T) {
 	srv := wasp.NewHTTPMockServer(nil)
 	srv.Run()
 
-	_, err := wasp.NewProfile().
+	vu, err := NewExampleScenario(srv.URL())
+	require.NoError(t, err)
+
+	_, err = wasp.NewProfile().
 		Add(wasp.NewGenerator(&wasp.Config{
 			T: t,
 			Labels: map[string]string{
@@ -20,7 +23,7 @@ func TestScenario(t *testing.T) {
 				"commit": "generator_healthcheck",
 			},
 			LoadType: wasp.VU,
-			VU:       NewExampleScenario(srv.URL()),
+			VU:       vu,
 			Schedule: wasp.Combine(
 				wasp.Plain(1, 30*time.Second),
 				wasp.Plain(2, 30*time.Second),
@@ -1,83 +1,84 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/go-resty/resty/v2"
 	"github.com/smartcontractkit/chainlink-testing-framework/wasp"
-	"go.uber.org/ratelimit"
 )
 
 const (
-	GroupAuth = "auth"
-	GroupUser = "user"
+	GroupAuth     = "auth"
+	GroupBalance  = "balance"
+	GroupTransfer = "transfer"
 )
 
-type VirtualUser struct {
-	*wasp.VUControl
-	target    string
-	Data      []string
-	rateLimit int
-	rl        ratelimit.Limiter
-	client    *resty.Client
+// NewExampleScenario logs the user in and then checks the balance 3 times more often than it makes a transfer
+func NewExampleScenario(target string) (*wasp.ScenarioVU, error) {
+	client := resty.New()
+	return wasp.NewScenario().
+		Step(&wasp.ScenarioStep{
+			Name:      GroupAuth,
+			Fn:        login(client, target),
+			Timeout:   2 * time.Second,
+			ThinkTime: wasp.UniformThinkTime(50*time.Millisecond, 150*time.Millisecond),
+		}).
+		OneOf(
+			&wasp.ScenarioStep{
+				Name:      GroupBalance,
+				Fn:        authenticatedAction(client, target),
+				Weight:    3,
+				ThinkTime: wasp.NormalThinkTime(100*time.Millisecond, 20*time.Millisecond),
+			},
+			&wasp.ScenarioStep{
+				Name:      GroupTransfer,
+				Fn:        authenticatedAction(client, target),
+				Weight:    1,
+				ThinkTime: wasp.ExponentialThinkTime(200 * time.Millisecond),
+			},
+		).
+		VU()
 }
 
-func NewExampleScenario(target string) *VirtualUser {
-	rateLimit := 10
-	return &VirtualUser{
-		VUControl: wasp.NewVUControl(),
-		target:    target,
-		rateLimit: rateLimit,
-		rl:        ratelimit.New(rateLimit, ratelimit.WithoutSlack),
-		client:    resty.New().SetBaseURL(target),
-		Data:      make([]string, 0),
+// login represents user login, the token is passed to the next steps
+func login(client *resty.Client, target string) wasp.StepFunc {
+	return func(ctx context.Context, sc *wasp.ScenarioContext) (interface{}, error) {
+		var result map[string]interface{}
+		r, err := client.R().
+			SetContext(ctx).
+			SetResult(&result).
+			Get(target)
+		if err != nil {
+			return nil, err
+		}
+		if r.IsError() {
+			return nil, fmt.Errorf("login failed: %s", r.Status())
+		}
+		sc.Vars["token"] = result["message"]
+		return r.Body(), nil
 	}
 }
 
-func (m *VirtualUser) Clone(_ *wasp.Generator) wasp.VirtualUser {
-	return &VirtualUser{
-		VUControl: wasp.NewVUControl(),
-		target:    m.target,
-		rl:        ratelimit.New(m.rateLimit, ratelimit.WithoutSlack),
-		client:    resty.New().SetBaseURL(m.target),
-		Data:      make([]string, 0),
+// authenticatedAction represents an action that requires the token from the login step
+func authenticatedAction(client *resty.Client, target string) wasp.StepFunc {
+	return func(ctx context.Context, sc *wasp.ScenarioContext) (interface{}, error) {
+		token, ok := sc.Vars["token"].(string)
+		if !ok {
+			return nil, errors.New("user is not logged in")
+		}
+		r, err := client.R().
+			SetContext(ctx).
+			SetAuthToken(token).
+			Get(target)
+		if err != nil {
+			return nil, err
+		}
+		if r.IsError() {
+			return nil, fmt.Errorf("action failed: %s", r.Status())
+		}
+		return r.Body(), nil
 	}
 }
-
-func (m *VirtualUser) Setup(_ *wasp.Generator) error {
-	return nil
-}
-
-func (m *VirtualUser) Teardown(_ *wasp.Generator) error {
-	return nil
-}
-
-// represents user login
-func (m *VirtualUser) requestOne(l *wasp.Generator) {
-	var result map[string]interface{}
-	r, err := m.client.R().
-		SetResult(&result).
-		Get(m.target)
-	if err != nil {
-		l.Responses.Err(r, GroupAuth, err)
-		return
-	}
-	l.Responses.OK(r, GroupAuth)
-}
-
-// represents authenticated user action
-func (m *VirtualUser) requestTwo(l *wasp.Generator) {
-	var result map[string]interface{}
-	r, err := m.client.R().
-		SetResult(&result).
-		Get(m.target)
-	if err != nil {
-		l.Responses.Err(r, GroupUser, err)
-		return
-	}
-	l.Responses.OK(r, GroupUser)
-}
-
-func (m *VirtualUser) Call(l *wasp.Generator) {
-	m.rl.Take()
-	m.requestOne(l)
-	m.requestTwo(l)
-}
@@ -0,0 +1,380 @@
+package wasp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	DefaultGRPCPoolSize          = 1
+	DefaultGRPCReflectionTimeout = 10 * time.Second
+)
+
+var (
+	ErrGRPCNoTarget       = errors.New("grpc target is empty")
+	ErrGRPCNoMethod       = errors.New("grpc method is empty")
+	ErrGRPCMethodNotFound = errors.New("grpc method not found")
+	ErrGRPCInvalidRequest = errors.New("invalid grpc request")
+)
+
+// GRPCConfig configures GRPCGun and GRPCVU
+type GRPCConfig struct {
+	// Target is the server address, e.g. localhost:50051
+	Target string `json:"target"`
+	// Method is the full method name, e.g. grpc.testing.TestService/UnaryCall
+	Method string `json:"method"`
+	// Request is the request message in protojson format, an empty message is sent if it's not set
+	Request string `json:"request"`
+	// Requests are the messages sent by client and bidi streaming methods in protojson format, Request is sent if it's empty
+	Requests []string `json:"requests"`
+	// Metadata is sent with every call
+	Metadata map[string]string `json:"metadata"`
+	// Files are the proto descriptors the method is resolved from, server reflection is used if it's nil
+	Files *protoregistry.Files `json:"-"`
+	// PoolSize is the number of connections the calls are balanced over, default is 1
+	PoolSize int `json:"pool_size"`
+	// DialOptions are passed to every connection, insecure credentials are used if it's empty
+	DialOptions []grpc.DialOption `json:"-"`
+}
+
+// Validate checks the target and the method and sets the default pool size.
+func (m *GRPCConfig) Validate() error {
+	if m.Target == "" {
+		return ErrGRPCNoTarget
+	}
+	if m.Method == "" {
+		return ErrGRPCNoMethod
+	}
+	if m.PoolSize < 0 {
+		return errors.New("grpc pool size must be >= 0")
+	}
+	if m.PoolSize == 0 {
+		m.PoolSize = DefaultGRPCPoolSize
+	}
+	return nil
+}
+
+// GRPCConnPool is a fixed set of connections to the same target, calls are balanced over them in round robin order
+type GRPCConnPool struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+// NewGRPCConnPool creates size connections to the target, connections are established lazily on the first call.
+func NewGRPCConnPool(target string, size int, opts ...grpc.DialOption) (*GRPCConnPool, error) {
+	if size <= 0 {
+		size = DefaultGRPCPoolSize
+	}
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	p := &GRPCConnPool{conns: make([]*grpc.ClientConn, 0, size)}
+	for i := 0; i < size; i++ {
+		conn, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+// Conn returns the next connection of the pool.
+func (p *GRPCConnPool) Conn() *grpc.ClientConn {
+	return p.conns[(p.next.Add(1)-1)%uint64(len(p.conns))]
+}
+
+// Close closes all the connections of the pool.
+func (p *GRPCConnPool) Close() error {
+	var errs []string
+	for _, c := range p.conns {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// LoadProtoDescriptorSet loads proto descriptors from a file created with protoc --descriptor_set_out --include_imports
+func LoadProtoDescriptorSet(path string) (*protoregistry.Files, error) {
+	d, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(d, &set); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode descriptor set %s", path)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+// splitGRPCMethod splits pkg.Service/Method, /pkg.Service/Method or pkg.Service.Method into service and method names
+func splitGRPCMethod(method string) (string, string, error) {
+	m := strings.TrimPrefix(method, "/")
+	idx := strings.LastIndex(m, "/")
+	if idx < 0 {
+		idx = strings.LastIndex(m, ".")
+	}
+	if idx <= 0 || idx == len(m)-1 {
+		return "", "", errors.Wrapf(ErrGRPCMethodNotFound, "method name %q must be pkg.Service/Method", method)
+	}
+	return m[:idx], m[idx+1:], nil
+}
+
+// findGRPCMethod finds the method descriptor of pkg.Service/Method in the proto descriptors
+func findGRPCMethod(files *protoregistry.Files, method string) (protoreflect.MethodDescriptor, error) {
+	svcName, methodName, err := splitGRPCMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(svcName))
+	if err != nil {
+		return nil, errors.Wrapf(ErrGRPCMethodNotFound, "service %s: %s", svcName, err)
+	}
+	svc, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.Wrapf(ErrGRPCMethodNotFound, "%s is not a service", svcName)
+	}
+	md := svc.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, errors.Wrapf(ErrGRPCMethodNotFound, "service %s has no method %s", svcName, methodName)
+	}
+	return md, nil
+}
+
+// grpcReflectionFiles fetches the proto descriptors defining the symbol, and all their dependencies, with server reflection
+func grpcReflectionFiles(ctx context.Context, conn grpc.ClientConnInterface, symbol string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start server reflection")
+	}
+	//nolint
+	defer stream.CloseSend()
+
+	fdps := make(map[string]*descriptorpb.FileDescriptorProto)
+	fetch := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return fmt.Errorf("server reflection error: %s", e.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return err
+			}
+			fdps[fd.GetName()] = fd
+		}
+		return nil
+	}
+	if err := fetch(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol},
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve %s", symbol)
+	}
+	// servers usually send all the dependencies at once, but they don't have to
+	for missing := missingProtoDependency(fdps); missing != ""; missing = missingProtoDependency(fdps) {
+		if err := fetch(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: missing},
+		}); err != nil {
+			return nil, errors.Wrapf(err, "failed to resolve %s", missing)
+		}
+		if _, ok := fdps[missing]; !ok {
+			return nil, fmt.Errorf("server reflection didn't return %s", missing)
+		}
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range fdps {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+func missingProtoDependency(fdps map[string]*descriptorpb.FileDescriptorProto) string {
+	for _, fd := range fdps {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := fdps[dep]; !ok {
+				return dep
+			}
+		}
+	}
+	return ""
+}
+
+// grpcClient calls a single method resolved from proto descriptors, it's shared by GRPCGun and GRPCVU
+type grpcClient struct {
+	cfg        *GRPCConfig
+	pool       *GRPCConnPool
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+	requests   []proto.Message
+	md         metadata.MD
+}
+
+func newGRPCClient(cfg *GRPCConfig) (*grpcClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	pool, err := NewGRPCConnPool(cfg.Target, cfg.PoolSize, cfg.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newGRPCClientWithPool(cfg, pool)
+	if err != nil {
+		_ = pool.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newGRPCClientWithPool(cfg *GRPCConfig, pool *GRPCConnPool) (*grpcClient, error) {
+	files := cfg.Files
+	if files == nil {
+		svcName, _, err := splitGRPCMethod(cfg.Method)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultGRPCReflectionTimeout)
+		defer cancel()
+		files, err = grpcReflectionFiles(ctx, pool.Conn(), svcName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	method, err := findGRPCMethod(files, cfg.Method)
+	if err != nil {
+		return nil, err
+	}
+	c := &grpcClient{
+		cfg:        cfg,
+		pool:       pool,
+		method:     method,
+		fullMethod: fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name()),
+		md:         metadata.New(cfg.Metadata),
+	}
+	raw := cfg.Requests
+	if len(raw) == 0 || !method.IsStreamingClient() {
+		raw = []string{cfg.Request}
+	}
+	for i, r := range raw {
+		msg := dynamicpb.NewMessage(method.Input())
+		if r != "" {
+			if err := protojson.Unmarshal([]byte(r), msg); err != nil {
+				return nil, errors.Wrapf(ErrGRPCInvalidRequest, "request %d of %s: %s", i, c.fullMethod, err)
+			}
+		}
+		c.requests = append(c.requests, msg)
+	}
+	return c, nil
+}
+
+func (c *grpcClient) streamDesc() *grpc.StreamDesc {
+	return &grpc.StreamDesc{
+		StreamName:    string(c.method.Name()),
+		ServerStreams: c.method.IsStreamingServer(),
+		ClientStreams: c.method.IsStreamingClient(),
+	}
+}
+
+func (c *grpcClient) outgoingContext(ctx context.Context) context.Context {
+	if len(c.md) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, c.md)
+	}
+	if tc := TraceFromContext(ctx); tc != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, TraceparentHeader, tc.Traceparent())
+	}
+	return ctx
+}
+
+// invoke makes a single call, streaming calls send all the requests and receive all the responses
+func (c *grpcClient) invoke(ctx context.Context) (interface{}, error) {
+	ctx = c.outgoingContext(ctx)
+	conn := c.pool.Conn()
+	if !c.method.IsStreamingClient() && !c.method.IsStreamingServer() {
+		out := dynamicpb.NewMessage(c.method.Output())
+		if err := conn.Invoke(ctx, c.fullMethod, c.requests[0], out); err != nil {
+			return nil, err
+		}
+		return marshalGRPCMessage(out), nil
+	}
+	stream, err := conn.NewStream(ctx, c.streamDesc(), c.fullMethod)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range c.requests {
+		if err := stream.SendMsg(req); err != nil {
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	responses := make([]string, 0)
+	for {
+		out := dynamicpb.NewMessage(c.method.Output())
+		if err := stream.RecvMsg(out); err != nil {
+			if errors.Is(err, io.EOF) {
+				return responses, nil
+			}
+			return responses, err
+		}
+		responses = append(responses, marshalGRPCMessage(out))
+	}
+}
+
+// response maps the call result to a Response, non OK status codes are failures and DeadlineExceeded is a timeout
+func (c *grpcClient) response(data interface{}, err error) *Response {
+	code := status.Code(err)
+	res := &Response{
+		Path:       c.fullMethod,
+		StatusCode: code.String(),
+		Data:       data,
+	}
+	switch code {
+	case codes.OK:
+	case codes.DeadlineExceeded:
+		res.Timeout = true
+		res.Error = err.Error()
+	default:
+		res.Failed = true
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func marshalGRPCMessage(m proto.Message) string {
+	d, err := protojson.Marshal(m)
+	if err != nil {
+		return err.Error()
+	}
+	return string(d)
+}
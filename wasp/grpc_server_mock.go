@@ -0,0 +1,151 @@
+package wasp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+/* This is a gRPC mock server implementing grpc.testing.TestService with server reflection, to test gRPC guns and VUs */
+
+// MockGRPCServerConfig configures MockGRPCServer
+type MockGRPCServerConfig struct {
+	// Latency is added to every unary call and every streamed response
+	Latency time.Duration
+}
+
+// MockGRPCServer serves grpc.testing.TestService on a random local port.
+// Requests with response_status set fail with that status code, response_size and response_parameters set the payload sizes.
+type MockGRPCServer struct {
+	testpb.UnimplementedTestServiceServer
+	cfg *MockGRPCServerConfig
+	srv *grpc.Server
+	lis net.Listener
+}
+
+// NewMockGRPCServer listens on a random local port, use Run to start serving.
+func NewMockGRPCServer(cfg *MockGRPCServerConfig) (*MockGRPCServer, error) {
+	if cfg == nil {
+		cfg = &MockGRPCServerConfig{}
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &MockGRPCServer{cfg: cfg, srv: grpc.NewServer(), lis: lis}
+	testpb.RegisterTestServiceServer(s.srv, s)
+	reflection.Register(s.srv)
+	return s, nil
+}
+
+// Run starts serving in a separate goroutine.
+func (s *MockGRPCServer) Run() {
+	go func() {
+		//nolint
+		_ = s.srv.Serve(s.lis)
+	}()
+}
+
+// Addr returns the address to use as GRPCConfig.Target
+func (s *MockGRPCServer) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Stop stops the server and closes all the open streams.
+func (s *MockGRPCServer) Stop() {
+	s.srv.Stop()
+}
+
+func mockGRPCStatus(st *testpb.EchoStatus) error {
+	if st == nil || codes.Code(st.GetCode()) == codes.OK {
+		return nil
+	}
+	return status.Error(codes.Code(st.GetCode()), st.GetMessage())
+}
+
+func mockGRPCPayload(size int32) *testpb.Payload {
+	return &testpb.Payload{Type: testpb.PayloadType_COMPRESSABLE, Body: make([]byte, size)}
+}
+
+// EmptyCall returns an empty message.
+func (s *MockGRPCServer) EmptyCall(_ context.Context, _ *testpb.Empty) (*testpb.Empty, error) {
+	time.Sleep(s.cfg.Latency)
+	return &testpb.Empty{}, nil
+}
+
+// UnaryCall returns a payload of response_size bytes, or the response_status error.
+func (s *MockGRPCServer) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case <-time.After(s.cfg.Latency):
+	}
+	if err := mockGRPCStatus(req.GetResponseStatus()); err != nil {
+		return nil, err
+	}
+	return &testpb.SimpleResponse{Payload: mockGRPCPayload(req.GetResponseSize())}, nil
+}
+
+// StreamingOutputCall streams a response for every response_parameters entry.
+func (s *MockGRPCServer) StreamingOutputCall(req *testpb.StreamingOutputCallRequest, stream grpc.ServerStreamingServer[testpb.StreamingOutputCallResponse]) error {
+	if err := mockGRPCStatus(req.GetResponseStatus()); err != nil {
+		return err
+	}
+	for _, p := range req.GetResponseParameters() {
+		time.Sleep(s.cfg.Latency + time.Duration(p.GetIntervalUs())*time.Microsecond)
+		if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: mockGRPCPayload(p.GetSize())}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamingInputCall returns the aggregated size of all the received payloads.
+func (s *MockGRPCServer) StreamingInputCall(stream grpc.ClientStreamingServer[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse]) error {
+	var size int32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			time.Sleep(s.cfg.Latency)
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(req.GetPayload().GetBody()))
+	}
+}
+
+// FullDuplexCall responds to every received message, with a response for every response_parameters entry, or a single empty one.
+func (s *MockGRPCServer) FullDuplexCall(stream grpc.BidiStreamingServer[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse]) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := mockGRPCStatus(req.GetResponseStatus()); err != nil {
+			return err
+		}
+		params := req.GetResponseParameters()
+		if len(params) == 0 {
+			params = []*testpb.ResponseParameters{{}}
+		}
+		for _, p := range params {
+			time.Sleep(s.cfg.Latency + time.Duration(p.GetIntervalUs())*time.Microsecond)
+			if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: mockGRPCPayload(p.GetSize())}); err != nil {
+				return err
+			}
+		}
+	}
+}
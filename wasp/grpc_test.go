@@ -0,0 +1,176 @@
+package wasp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func runMockGRPCServer(t *testing.T, cfg *MockGRPCServerConfig) *MockGRPCServer {
+	srv, err := NewMockGRPCServer(cfg)
+	require.NoError(t, err)
+	srv.Run()
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+func TestSmokeGRPCGunUnary(t *testing.T) {
+	t.Parallel()
+	srv := runMockGRPCServer(t, &MockGRPCServerConfig{Latency: 5 * time.Millisecond})
+	gun, err := NewGRPCGun(&GRPCConfig{
+		Target:   srv.Addr(),
+		Method:   "grpc.testing.TestService/UnaryCall",
+		Request:  `{"response_size": 4}`,
+		PoolSize: 3,
+	})
+	require.NoError(t, err)
+	defer gun.Close()
+
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: time.Second,
+		Schedule:          Plain(20, 2*time.Second),
+		Gun:               gun,
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	require.GreaterOrEqual(t, gen.Stats().Success.Load(), int64(35))
+
+	res := gen.GetData().OKResponses.Data[0]
+	require.Equal(t, codes.OK.String(), res.StatusCode)
+	require.Equal(t, "/grpc.testing.TestService/UnaryCall", res.Path)
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(res.Data.(string)), &payload))
+	require.Contains(t, payload, "payload")
+}
+
+func TestSmokeGRPCGunStatusCodes(t *testing.T) {
+	t.Parallel()
+	srv := runMockGRPCServer(t, &MockGRPCServerConfig{Latency: 100 * time.Millisecond})
+	gen := &Generator{Cfg: &Config{CallTimeout: time.Second}}
+
+	gun, err := NewGRPCGun(&GRPCConfig{
+		Target:  srv.Addr(),
+		Method:  "/grpc.testing.TestService/UnaryCall",
+		Request: `{"response_status": {"code": 14, "message": "down"}}`,
+	})
+	require.NoError(t, err)
+	defer gun.Close()
+	res := gun.Call(gen)
+	require.True(t, res.Failed)
+	require.False(t, res.Timeout)
+	require.Equal(t, codes.Unavailable.String(), res.StatusCode)
+	require.Contains(t, res.Error, "down")
+
+	// the deadline is derived from the call timeout
+	gen.Cfg.CallTimeout = 20 * time.Millisecond
+	gun, err = NewGRPCGun(&GRPCConfig{
+		Target: srv.Addr(),
+		Method: "grpc.testing.TestService.UnaryCall",
+	})
+	require.NoError(t, err)
+	defer gun.Close()
+	res = gun.Call(gen)
+	require.True(t, res.Timeout)
+	require.False(t, res.Failed)
+	require.Equal(t, codes.DeadlineExceeded.String(), res.StatusCode)
+}
+
+func TestSmokeGRPCGunStreaming(t *testing.T) {
+	t.Parallel()
+	srv := runMockGRPCServer(t, nil)
+	gen := &Generator{Cfg: &Config{CallTimeout: time.Second}}
+
+	t.Run("server streaming", func(t *testing.T) {
+		gun, err := NewGRPCGun(&GRPCConfig{
+			Target:  srv.Addr(),
+			Method:  "grpc.testing.TestService/StreamingOutputCall",
+			Request: `{"response_parameters": [{"size": 1}, {"size": 2}, {"size": 3}]}`,
+		})
+		require.NoError(t, err)
+		defer gun.Close()
+		res := gun.Call(gen)
+		require.False(t, res.Failed, res.Error)
+		require.Len(t, res.Data, 3)
+	})
+
+	t.Run("client streaming", func(t *testing.T) {
+		gun, err := NewGRPCGun(&GRPCConfig{
+			Target: srv.Addr(),
+			Method: "grpc.testing.TestService/StreamingInputCall",
+			Requests: []string{
+				`{"payload": {"body": "AAAA"}}`,
+				`{"payload": {"body": "AAAAAAAA"}}`,
+			},
+		})
+		require.NoError(t, err)
+		defer gun.Close()
+		res := gun.Call(gen)
+		require.False(t, res.Failed, res.Error)
+		require.Equal(t, []string{`{"aggregatedPayloadSize":9}`}, res.Data)
+	})
+}
+
+func TestSmokeGRPCVUBidiStreaming(t *testing.T) {
+	t.Parallel()
+	srv := runMockGRPCServer(t, &MockGRPCServerConfig{Latency: 10 * time.Millisecond})
+	vu, err := NewGRPCVU(&GRPCConfig{
+		Target:   srv.Addr(),
+		Method:   "grpc.testing.TestService/FullDuplexCall",
+		Requests: []string{`{"response_parameters": [{"size": 1}]}`, `{}`},
+		Metadata: map[string]string{"x-test": "wasp"},
+		PoolSize: 2,
+	})
+	require.NoError(t, err)
+	defer vu.Close()
+
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          VU,
+		StatsPollInterval: time.Second,
+		Schedule:          Plain(3, 2*time.Second),
+		VU:                vu,
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	require.Zero(t, gen.Stats().Failed.Load())
+	// every VU keeps a single stream, so there are way more calls than streams
+	require.Greater(t, gen.Stats().Success.Load(), int64(100))
+}
+
+func TestSmokeGRPCMethodResolution(t *testing.T) {
+	t.Parallel()
+	srv := runMockGRPCServer(t, nil)
+
+	// proto descriptors instead of server reflection
+	gun, err := NewGRPCGun(&GRPCConfig{
+		Target: srv.Addr(),
+		Method: "grpc.testing.TestService/EmptyCall",
+		Files:  protoregistry.GlobalFiles,
+	})
+	require.NoError(t, err)
+	defer gun.Close()
+	res := gun.Call(&Generator{Cfg: &Config{CallTimeout: time.Second}})
+	require.False(t, res.Failed, res.Error)
+
+	_, err = NewGRPCGun(&GRPCConfig{Target: srv.Addr(), Method: "grpc.testing.TestService/NoSuchCall"})
+	require.ErrorIs(t, err, ErrGRPCMethodNotFound)
+	_, err = NewGRPCGun(&GRPCConfig{Target: srv.Addr(), Method: "grpc.testing.TestService/UnaryCall", Request: `{"no_such_field": 1}`})
+	require.ErrorIs(t, err, ErrGRPCInvalidRequest)
+	_, err = NewGRPCGun(&GRPCConfig{Method: "grpc.testing.TestService/UnaryCall"})
+	require.ErrorIs(t, err, ErrGRPCNoTarget)
+
+	_, err = newRegisteredGun("grpc", map[string]interface{}{
+		"target":    srv.Addr(),
+		"method":    "grpc.testing.TestService/UnaryCall",
+		"pool_size": 2,
+	})
+	require.NoError(t, err)
+}
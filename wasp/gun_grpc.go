@@ -0,0 +1,37 @@
+package wasp
+
+import "context"
+
+// GRPCGun makes a unary or streaming gRPC call for every request of the RPS schedule.
+// Streaming calls send all the Requests and receive all the responses, so one call is one stream.
+type GRPCGun struct {
+	client *grpcClient
+}
+
+// NewGRPCGun connects to the target and resolves the method, from GRPCConfig.Files or with server reflection.
+// Call Close when the generator is finished to close the connections.
+func NewGRPCGun(cfg *GRPCConfig) (*GRPCGun, error) {
+	c, err := newGRPCClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCGun{client: c}, nil
+}
+
+// Call makes a single gRPC call with a deadline of Config.CallTimeout and maps its status code to the Response.
+func (m *GRPCGun) Call(l *Generator) *Response {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.CallTimeout)
+	defer cancel()
+	return m.CallContext(ctx, l)
+}
+
+// CallContext makes a single gRPC call which is cancelled with ctx.
+func (m *GRPCGun) CallContext(ctx context.Context, _ *Generator) *Response {
+	data, err := m.client.invoke(ctx)
+	return m.client.response(data, err)
+}
+
+// Close closes all the pooled connections.
+func (m *GRPCGun) Close() error {
+	return m.client.pool.Close()
+}
@@ -1,6 +1,10 @@
 package wasp
 
-import "github.com/go-resty/resty/v2"
+import (
+	"context"
+
+	"github.com/go-resty/resty/v2"
+)
 
 // MockHTTPGunConfig configures a mock HTTP gun
 type MockHTTPGunConfig struct {
@@ -27,10 +31,17 @@ func NewHTTPMockGun(cfg *MockHTTPGunConfig) *MockHTTPGun {
 // Call sends an HTTP GET request to the configured target URL and returns the response data.
 // It is used to simulate HTTP calls for testing or load generation purposes.
 func (m *MockHTTPGun) Call(l *Generator) *Response {
+	return m.CallContext(context.Background(), l)
+}
+
+// CallContext sends the HTTP GET request with the traceparent header of the call, the request is cancelled when ctx is done.
+func (m *MockHTTPGun) CallContext(ctx context.Context, _ *Generator) *Response {
 	var result map[string]interface{}
-	r, err := m.client.R().
-		SetResult(&result).
-		Get(m.cfg.TargetURL)
+	req := m.client.R().
+		SetContext(ctx).
+		SetResult(&result)
+	InjectTraceparent(ctx, req.Header)
+	r, err := req.Get(m.cfg.TargetURL)
 	if err != nil {
 		return &Response{Data: result, Error: err.Error()}
 	}
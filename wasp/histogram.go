@@ -0,0 +1,221 @@
+package wasp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// DefaultHistogramMinLatency is the lowest latency that can be discerned by the histogram
+	DefaultHistogramMinLatency = 1 * time.Microsecond
+	// DefaultHistogramMaxLatency is the highest latency tracked by the histogram, longer calls are clamped to it
+	DefaultHistogramMaxLatency = 1 * time.Hour
+	// DefaultHistogramSignificantFigures is the amount of significant value digits kept by the histogram
+	DefaultHistogramSignificantFigures = 3
+)
+
+// LatencyPercentiles are the latency percentiles exported from a histogram
+type LatencyPercentiles struct {
+	// Count is the amount of recorded samples, see Stats.Latencies for how it relates to the amount of calls
+	Count int64         `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	P999  time.Duration `json:"p999"`
+	Max   time.Duration `json:"max"`
+}
+
+// LatencyHistogram keeps high dynamic range latency histograms for all calls and per Response.Group
+// unlike responses it is never sampled, so the percentiles are accurate whatever the sampling ratio
+type LatencyHistogram struct {
+	mu     *sync.Mutex
+	total  *hdrhistogram.Histogram
+	groups map[string]*hdrhistogram.Histogram
+}
+
+// NewLatencyHistogram creates an empty LatencyHistogram with the default precision and range.
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		mu:     &sync.Mutex{},
+		total:  newHDRHistogram(),
+		groups: make(map[string]*hdrhistogram.Histogram),
+	}
+}
+
+// NewLatencyHistogramFromSnapshot creates a LatencyHistogram with all the values recorded in the snapshot.
+func NewLatencyHistogramFromSnapshot(s *LatencySnapshot) *LatencyHistogram {
+	h := NewLatencyHistogram()
+	if s.Total != nil {
+		h.total.Merge(hdrhistogram.Import(s.Total))
+	}
+	for name, g := range s.Groups {
+		if g == nil {
+			continue
+		}
+		h.groups[name] = newHDRHistogram()
+		h.groups[name].Merge(hdrhistogram.Import(g))
+	}
+	return h
+}
+
+func newHDRHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(
+		DefaultHistogramMinLatency.Microseconds(),
+		DefaultHistogramMaxLatency.Microseconds(),
+		DefaultHistogramSignificantFigures,
+	)
+}
+
+// Record adds a call latency to the total histogram and to the histogram of the given group.
+// Latencies outside the trackable range are clamped to its bounds.
+func (m *LatencyHistogram) Record(group string, d time.Duration) {
+	v := d.Microseconds()
+	if v < DefaultHistogramMinLatency.Microseconds() {
+		v = DefaultHistogramMinLatency.Microseconds()
+	}
+	if v > DefaultHistogramMaxLatency.Microseconds() {
+		v = DefaultHistogramMaxLatency.Microseconds()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[group]; !ok {
+		m.groups[group] = newHDRHistogram()
+	}
+	//nolint
+	_ = m.total.RecordValue(v)
+	//nolint
+	_ = m.groups[group].RecordValue(v)
+}
+
+// Snapshot returns a point-in-time copy of all histograms that can be serialized, merged or queried for percentiles.
+func (m *LatencyHistogram) Snapshot() *LatencySnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &LatencySnapshot{
+		Total:  m.total.Export(),
+		Groups: make(map[string]*hdrhistogram.Snapshot, len(m.groups)),
+	}
+	for name, h := range m.groups {
+		s.Groups[name] = h.Export()
+	}
+	return s
+}
+
+// histogramSnapshot returns a copy of the histogram of a single Response.Group, or of all calls if group is empty.
+func (m *LatencyHistogram) histogramSnapshot(group string) *hdrhistogram.Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if group == "" {
+		return m.total.Export()
+	}
+	if h, ok := m.groups[group]; ok {
+		return h.Export()
+	}
+	return nil
+}
+
+// Percentiles returns the percentiles of all recorded calls.
+func (m *LatencyHistogram) Percentiles() LatencyPercentiles {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return percentilesFromHistogram(m.total)
+}
+
+// GroupPercentiles returns the percentiles of every Response.Group recorded so far.
+func (m *LatencyHistogram) GroupPercentiles() map[string]LatencyPercentiles {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string]LatencyPercentiles, len(m.groups))
+	for name, h := range m.groups {
+		res[name] = percentilesFromHistogram(h)
+	}
+	return res
+}
+
+// LatencySnapshot is a serializable copy of LatencyHistogram, snapshots from different generators or nodes can be merged
+type LatencySnapshot struct {
+	Total  *hdrhistogram.Snapshot            `json:"total"`
+	Groups map[string]*hdrhistogram.Snapshot `json:"groups"`
+}
+
+// Merge adds all values recorded in other snapshot to this one.
+// Use it to aggregate latencies of several generators or cluster nodes.
+func (s *LatencySnapshot) Merge(other *LatencySnapshot) {
+	if other == nil {
+		return
+	}
+	s.Total = mergeHDRSnapshots(s.Total, other.Total)
+	if s.Groups == nil {
+		s.Groups = make(map[string]*hdrhistogram.Snapshot)
+	}
+	for name, g := range other.Groups {
+		s.Groups[name] = mergeHDRSnapshots(s.Groups[name], g)
+	}
+}
+
+// Percentiles returns the percentiles of all calls in the snapshot.
+func (s *LatencySnapshot) Percentiles() LatencyPercentiles {
+	if s.Total == nil {
+		return LatencyPercentiles{}
+	}
+	return percentilesFromHistogram(hdrhistogram.Import(s.Total))
+}
+
+// GroupPercentiles returns the percentiles of a single Response.Group and false if the group is not present.
+func (s *LatencySnapshot) GroupPercentiles(group string) (LatencyPercentiles, bool) {
+	g, ok := s.Groups[group]
+	if !ok || g == nil {
+		return LatencyPercentiles{}, false
+	}
+	return percentilesFromHistogram(hdrhistogram.Import(g)), true
+}
+
+func mergeHDRSnapshots(a, b *hdrhistogram.Snapshot) *hdrhistogram.Snapshot {
+	if b == nil {
+		return a
+	}
+	if a == nil {
+		return hdrhistogram.Import(b).Export()
+	}
+	h := hdrhistogram.Import(a)
+	h.Merge(hdrhistogram.Import(b))
+	return h.Export()
+}
+
+// subtractHDRSnapshots returns the values recorded in a but not in b, b must be an earlier snapshot of the same histogram
+func subtractHDRSnapshots(a, b *hdrhistogram.Snapshot) *hdrhistogram.Snapshot {
+	if a == nil {
+		return newHDRHistogram().Export()
+	}
+	if b == nil {
+		return a
+	}
+	res := &hdrhistogram.Snapshot{
+		LowestTrackableValue:  a.LowestTrackableValue,
+		HighestTrackableValue: a.HighestTrackableValue,
+		SignificantFigures:    a.SignificantFigures,
+		Counts:                make([]int64, len(a.Counts)),
+	}
+	for i, c := range a.Counts {
+		if i < len(b.Counts) {
+			c -= b.Counts[i]
+		}
+		res.Counts[i] = c
+	}
+	return res
+}
+
+func percentilesFromHistogram(h *hdrhistogram.Histogram) LatencyPercentiles {
+	return LatencyPercentiles{
+		Count: h.TotalCount(),
+		P50:   time.Duration(h.ValueAtQuantile(50)) * time.Microsecond,
+		P90:   time.Duration(h.ValueAtQuantile(90)) * time.Microsecond,
+		P95:   time.Duration(h.ValueAtQuantile(95)) * time.Microsecond,
+		P99:   time.Duration(h.ValueAtQuantile(99)) * time.Microsecond,
+		P999:  time.Duration(h.ValueAtQuantile(99.9)) * time.Microsecond,
+		Max:   time.Duration(h.Max()) * time.Microsecond,
+	}
+}
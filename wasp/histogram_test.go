@@ -0,0 +1,74 @@
+package wasp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmokeLatencyHistogram(t *testing.T) {
+	t.Parallel()
+	h := NewLatencyHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record("a", time.Duration(i)*time.Millisecond)
+	}
+	h.Record("b", 2*time.Hour)
+
+	p := h.Percentiles()
+	require.Equal(t, int64(1001), p.Count)
+	require.InDelta(t, float64(501*time.Millisecond), float64(p.P50), float64(time.Millisecond))
+	require.InDelta(t, float64(991*time.Millisecond), float64(p.P99), float64(time.Millisecond))
+	require.InDelta(t, float64(DefaultHistogramMaxLatency), float64(p.Max), float64(time.Second))
+
+	groups := h.GroupPercentiles()
+	require.Len(t, groups, 2)
+	require.Equal(t, int64(1000), groups["a"].Count)
+	require.Equal(t, int64(1), groups["b"].Count)
+}
+
+func TestSmokeLatencySnapshotMerge(t *testing.T) {
+	t.Parallel()
+	h1 := NewLatencyHistogram()
+	h2 := NewLatencyHistogram()
+	for i := 0; i < 100; i++ {
+		h1.Record("a", 10*time.Millisecond)
+		h2.Record("b", 100*time.Millisecond)
+	}
+	s := h1.Snapshot()
+	s.Merge(h2.Snapshot())
+
+	p := s.Percentiles()
+	require.Equal(t, int64(200), p.Count)
+	require.InDelta(t, float64(10*time.Millisecond), float64(p.P50), float64(100*time.Microsecond))
+	require.InDelta(t, float64(100*time.Millisecond), float64(p.P99), float64(100*time.Microsecond))
+
+	gp, ok := s.GroupPercentiles("b")
+	require.True(t, ok)
+	require.Equal(t, int64(100), gp.Count)
+	_, ok = s.GroupPercentiles("c")
+	require.False(t, ok)
+}
+
+func TestSmokeLatencyHistogramIgnoresSampling(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: 1 * time.Second,
+		Schedule:          Plain(10, 1*time.Second),
+		SamplerConfig:     &SamplerConfig{SuccessfulCallResultRecordRatio: 0},
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 20 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.Equal(t, false, failed)
+	_, okResponses, _ := convertResponsesData(gen)
+	require.Empty(t, okResponses)
+	p := gen.Stats().Latencies.Percentiles()
+	require.Equal(t, gen.Stats().SamplesSkipped.Load(), p.Count)
+	require.GreaterOrEqual(t, p.P50, 20*time.Millisecond)
+	require.Contains(t, gen.StatsJSON(), "latency_p99")
+}
@@ -3,10 +3,13 @@ package wasp
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,11 +27,18 @@ type Profile struct {
 	grafanaOpts  GrafanaOpts
 	startTime    time.Time
 	endTime      time.Time
+	// abortConditions are checked for every generator, see WithAbortConditions
+	abortConditions []*AbortCondition
+	abortErr        atomic.Pointer[AbortError]
+	// controlSrv serves the live control API, see WithControlAPI
+	controlLis  net.Listener
+	controlSrv  *http.Server
+	controlOnce sync.Once
 }
 
 // Run executes the profile's generators, manages Grafana annotations, and handles alert checks.
 // If wait is true, it waits for all generators to complete before proceeding.
-// It returns the updated Profile and any encountered error.
+// It returns the updated Profile and any encountered error, *AbortError if any abort condition was breached.
 func (m *Profile) Run(wait bool) (*Profile, error) {
 	if m.bootstrapErr != nil {
 		return m, m.bootstrapErr
@@ -40,9 +50,11 @@ func (m *Profile) Run(wait bool) (*Profile, error) {
 	if len(m.grafanaOpts.AnnotateDashboardUID) > 0 {
 		m.annotateRunStartOnGrafana()
 	}
+	m.attachAbortConditions()
 	for _, g := range m.Generators {
 		g.Run(false)
 	}
+	m.serveControlAPI()
 	if wait {
 		m.Wait()
 	}
@@ -65,9 +77,23 @@ func (m *Profile) Run(wait bool) (*Profile, error) {
 			return m, err
 		}
 	}
+	if wait {
+		if err := m.Aborted(); err != nil {
+			return m, err
+		}
+	}
 	return m, nil
 }
 
+// attachAbortConditions sets the generator's own abort conditions plus the profile's ones,
+// conditions are rebuilt from the generator config so running the profile again doesn't duplicate them
+func (m *Profile) attachAbortConditions() {
+	for _, g := range m.Generators {
+		g.abortConditions = append(append([]*AbortCondition{}, g.Cfg.AbortConditions...), m.abortConditions...)
+		g.onAbort = m.abort
+	}
+}
+
 func (m *Profile) printProfileId() {
 	log.Info().Msgf("Profile ID: %s", m.ProfileID)
 }
@@ -177,6 +203,19 @@ func (m *Profile) Resume() {
 	}
 }
 
+// Stop stops all generators of the profile concurrently and waits for them to finish.
+func (m *Profile) Stop() {
+	wg := &sync.WaitGroup{}
+	for _, g := range m.Generators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
 // Wait blocks until all generators associated with the Profile have finished executing,
 // ensuring all operations are complete before proceeding.
 func (m *Profile) Wait() {
@@ -189,6 +228,7 @@ func (m *Profile) Wait() {
 		}()
 	}
 	m.testEndedWg.Wait()
+	m.shutdownControlAPI()
 }
 
 // NewProfile creates and returns a new Profile instance.
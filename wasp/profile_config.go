@@ -0,0 +1,465 @@
+package wasp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileConfig is a declarative description of a Profile that can be loaded from a TOML or YAML file.
+// Guns and VUs are referenced by the names they were registered with, see RegisterGun and RegisterVU.
+// All durations are strings parsed with time.ParseDuration, ex.: "10s", "1m30s".
+type ProfileConfig struct {
+	// Name is used as go_test_name label when the profile is not run from a Go test
+	Name string `toml:"name" yaml:"name"`
+	// Loki enables streaming results to Loki configured with LOKI_* environment variables
+	Loki bool `toml:"loki" yaml:"loki"`
+	// ResultsFile writes results of all generators to a local file, see FileSink
+	ResultsFile string `toml:"results_file" yaml:"results_file"`
+	// CompressResultsFile writes the results file with gzip compression
+	CompressResultsFile bool `toml:"compress_results_file" yaml:"compress_results_file"`
+	// PrometheusListenAddr exposes metrics of all generators on this address, see PrometheusSink
+	PrometheusListenAddr string `toml:"prometheus_listen_addr" yaml:"prometheus_listen_addr"`
+	// ControlListenAddr serves the live control API of the profile on this address, see Profile.WithControlAPI
+	ControlListenAddr string `toml:"control_listen_addr" yaml:"control_listen_addr"`
+	// Tracing gives every call of all generators a W3C trace context, see Config.Tracing
+	Tracing bool `toml:"tracing" yaml:"tracing"`
+	// OTLPEndpoint exports traced calls as client spans to this OTLP/HTTP traces endpoint, it enables Tracing, see OTLPSink
+	OTLPEndpoint string `toml:"otlp_endpoint" yaml:"otlp_endpoint"`
+	// AbortConditions are checked for every generator, a breach stops the whole profile
+	AbortConditions []*AbortConditionConfig `toml:"abort_conditions" yaml:"abort_conditions"`
+	Generators      []*GeneratorConfig      `toml:"generators" yaml:"generators"`
+}
+
+// GeneratorConfig is a declarative description of a single Generator
+type GeneratorConfig struct {
+	Name string `toml:"name" yaml:"name"`
+	// LoadType is either "rps" or "vu"
+	LoadType string `toml:"load_type" yaml:"load_type"`
+	// Gun is the name of a registered Gun, required for "rps" load type
+	Gun string `toml:"gun" yaml:"gun"`
+	// VU is the name of a registered VirtualUser, required for "vu" load type
+	VU string `toml:"vu" yaml:"vu"`
+	// Params are passed to the Gun or VU factory
+	Params                     map[string]interface{} `toml:"params" yaml:"params"`
+	Schedule                   []*SegmentConfig       `toml:"schedule" yaml:"schedule"`
+	Labels                     map[string]string      `toml:"labels" yaml:"labels"`
+	CallTimeout                string                 `toml:"call_timeout" yaml:"call_timeout"`
+	SetupTimeout               string                 `toml:"setup_timeout" yaml:"setup_timeout"`
+	TeardownTimeout            string                 `toml:"teardown_timeout" yaml:"teardown_timeout"`
+	StatsPollInterval          string                 `toml:"stats_poll_interval" yaml:"stats_poll_interval"`
+	RateLimitUnitDuration      string                 `toml:"rate_limit_unit_duration" yaml:"rate_limit_unit_duration"`
+	CallResultBufLen           int                    `toml:"call_result_buf_len" yaml:"call_result_buf_len"`
+	FailOnErr                  bool                   `toml:"fail_on_err" yaml:"fail_on_err"`
+	CorrectCoordinatedOmission bool                   `toml:"correct_coordinated_omission" yaml:"correct_coordinated_omission"`
+	// SamplerSuccessfulRatio is the percentage of successful responses to record, 0-100, all are recorded if not set
+	SamplerSuccessfulRatio *int `toml:"sampler_successful_ratio" yaml:"sampler_successful_ratio"`
+	// AbortConditions are checked only for this generator
+	AbortConditions []*AbortConditionConfig `toml:"abort_conditions" yaml:"abort_conditions"`
+	// CapacitySearch replaces the schedule with a search for the highest rate that meets the SLO
+	CapacitySearch *CapacitySearchProfileConfig `toml:"capacity_search" yaml:"capacity_search"`
+}
+
+// SegmentConfig is a declarative schedule segment, fields used depend on the type:
+// plain: from, duration
+// steps: from, increase, steps, duration
+// ramp: from, to, steps, duration
+// sine: from (base), amplitude, period, steps (per period), duration
+// poisson: from (rate), duration
+type SegmentConfig struct {
+	Type      string `toml:"type" yaml:"type"`
+	From      int64  `toml:"from" yaml:"from"`
+	To        int64  `toml:"to" yaml:"to"`
+	Increase  int64  `toml:"increase" yaml:"increase"`
+	Amplitude int64  `toml:"amplitude" yaml:"amplitude"`
+	Steps     int    `toml:"steps" yaml:"steps"`
+	Period    string `toml:"period" yaml:"period"`
+	Duration  string `toml:"duration" yaml:"duration"`
+}
+
+// AbortConditionConfig is a declarative AbortCondition, latency and window are duration strings
+type AbortConditionConfig struct {
+	Metric             string  `toml:"metric" yaml:"metric"`
+	Threshold          float64 `toml:"threshold" yaml:"threshold"`
+	Percentile         float64 `toml:"percentile" yaml:"percentile"`
+	Latency            string  `toml:"latency" yaml:"latency"`
+	Group              string  `toml:"group" yaml:"group"`
+	Window             string  `toml:"window" yaml:"window"`
+	ConsecutiveWindows int     `toml:"consecutive_windows" yaml:"consecutive_windows"`
+	MinCalls           int64   `toml:"min_calls" yaml:"min_calls"`
+}
+
+// AbortCondition converts a declarative abort condition and validates it.
+func (m *AbortConditionConfig) AbortCondition() (*AbortCondition, error) {
+	if m == nil {
+		return nil, fmt.Errorf("abort condition is empty")
+	}
+	latency, err := parseOptionalDuration("latency", m.Latency)
+	if err != nil {
+		return nil, err
+	}
+	window, err := parseOptionalDuration("window", m.Window)
+	if err != nil {
+		return nil, err
+	}
+	c := &AbortCondition{
+		Metric:             AbortMetric(strings.ToLower(m.Metric)),
+		Threshold:          m.Threshold,
+		Percentile:         m.Percentile,
+		Latency:            latency,
+		Group:              m.Group,
+		Window:             window,
+		ConsecutiveWindows: m.ConsecutiveWindows,
+		MinCalls:           m.MinCalls,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func abortConditions(cfgs []*AbortConditionConfig) ([]*AbortCondition, error) {
+	conditions := make([]*AbortCondition, 0, len(cfgs))
+	for i, ac := range cfgs {
+		c, err := ac.AbortCondition()
+		if err != nil {
+			return nil, fmt.Errorf("abort condition %d: %w", i, err)
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+// CapacitySearchProfileConfig is a declarative CapacitySearchConfig, durations are strings
+type CapacitySearchProfileConfig struct {
+	From         int64                   `toml:"from" yaml:"from"`
+	Step         int64                   `toml:"step" yaml:"step"`
+	Max          int64                   `toml:"max" yaml:"max"`
+	StepDuration string                  `toml:"step_duration" yaml:"step_duration"`
+	WarmUp       string                  `toml:"warm_up" yaml:"warm_up"`
+	Precision    int64                   `toml:"precision" yaml:"precision"`
+	SLO          []*AbortConditionConfig `toml:"slo" yaml:"slo"`
+}
+
+// CapacitySearchConfig converts a declarative capacity search and validates it.
+func (m *CapacitySearchProfileConfig) CapacitySearchConfig() (*CapacitySearchConfig, error) {
+	stepDuration, err := parseOptionalDuration("step_duration", m.StepDuration)
+	if err != nil {
+		return nil, err
+	}
+	warmUp, err := parseOptionalDuration("warm_up", m.WarmUp)
+	if err != nil {
+		return nil, err
+	}
+	slo, err := abortConditions(m.SLO)
+	if err != nil {
+		return nil, fmt.Errorf("slo: %w", err)
+	}
+	c := &CapacitySearchConfig{
+		From:         m.From,
+		Step:         m.Step,
+		Max:          m.Max,
+		StepDuration: stepDuration,
+		WarmUp:       warmUp,
+		Precision:    m.Precision,
+		SLO:          slo,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadProfileConfig reads a declarative profile from a file, format is chosen by extension: .toml, .yaml or .yml
+func LoadProfileConfig(path string) (*ProfileConfig, error) {
+	d, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseProfileConfig(d, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseProfileConfig parses a declarative profile, format is "toml", "yaml" or "yml", with or without a leading dot.
+func ParseProfileConfig(data []byte, format string) (*ProfileConfig, error) {
+	cfg := &ProfileConfig{}
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "toml":
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported profile format %q, use toml or yaml", format)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the profile has generators with unique names and a Gun or VU for their load type.
+func (m *ProfileConfig) Validate() error {
+	if len(m.Generators) == 0 {
+		return fmt.Errorf("profile has no generators")
+	}
+	if _, err := abortConditions(m.AbortConditions); err != nil {
+		return err
+	}
+	names := make(map[string]struct{})
+	for i, g := range m.Generators {
+		if g == nil {
+			return fmt.Errorf("generator %d is empty", i)
+		}
+		if g.Name == "" {
+			return fmt.Errorf("generator %d has no name", i)
+		}
+		if _, ok := names[g.Name]; ok {
+			return fmt.Errorf("generator name %s is not unique", g.Name)
+		}
+		names[g.Name] = struct{}{}
+		if _, err := g.scheduleType(); err != nil {
+			return fmt.Errorf("generator %s: %w", g.Name, err)
+		}
+		if g.CapacitySearch != nil {
+			if len(g.Schedule) > 0 {
+				return fmt.Errorf("generator %s: %w", g.Name, ErrCapacitySearchSchedule)
+			}
+			if _, err := g.CapacitySearch.CapacitySearchConfig(); err != nil {
+				return fmt.Errorf("generator %s: capacity search: %w", g.Name, err)
+			}
+		} else if len(g.Schedule) == 0 {
+			return fmt.Errorf("generator %s: %w", g.Name, ErrNoSchedule)
+		}
+		if _, err := abortConditions(g.AbortConditions); err != nil {
+			return fmt.Errorf("generator %s: %w", g.Name, err)
+		}
+	}
+	return nil
+}
+
+func (m *GeneratorConfig) scheduleType() (ScheduleType, error) {
+	switch strings.ToLower(m.LoadType) {
+	case "rps", string(RPS):
+		if m.Gun == "" {
+			return "", ErrNoGun
+		}
+		return RPS, nil
+	case "vu", string(VU):
+		if m.VU == "" {
+			return "", ErrNoVU
+		}
+		return VU, nil
+	default:
+		return "", fmt.Errorf("%w: %q, use rps or vu", ErrInvalidScheduleType, m.LoadType)
+	}
+}
+
+// Segments converts declarative segments into a schedule.
+func (m *GeneratorConfig) Segments() ([]*Segment, error) {
+	schedule := make([]*Segment, 0)
+	for i, s := range m.Schedule {
+		segs, err := s.Segments()
+		if err != nil {
+			return nil, fmt.Errorf("schedule segment %d: %w", i, err)
+		}
+		schedule = append(schedule, segs...)
+	}
+	return schedule, nil
+}
+
+// Segments converts a declarative segment into schedule segments using Plain, Steps, Ramp, Sine or Poisson.
+func (m *SegmentConfig) Segments() ([]*Segment, error) {
+	duration, err := time.ParseDuration(m.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration: %w", err)
+	}
+	switch SegmentType(strings.ToLower(m.Type)) {
+	case SegmentType_Plain:
+		return Plain(m.From, duration), nil
+	case SegmentType_Steps:
+		if m.Steps <= 0 {
+			return nil, fmt.Errorf("steps segment must have steps > 0")
+		}
+		return Steps(m.From, m.Increase, m.Steps, duration), nil
+	case SegmentType_Ramp:
+		if err := validateScheduleSteps(m.Steps, duration); err != nil {
+			return nil, fmt.Errorf("ramp segment: %w", err)
+		}
+		return Ramp(m.From, m.To, m.Steps, duration), nil
+	case SegmentType_Sine:
+		period, err := time.ParseDuration(m.Period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period: %w", err)
+		}
+		if err := validateSineSchedule(period, m.Steps, duration); err != nil {
+			return nil, fmt.Errorf("sine segment: %w", err)
+		}
+		return Sine(m.From, m.Amplitude, period, m.Steps, duration), nil
+	case SegmentType_Poisson:
+		return Poisson(m.From, duration), nil
+	default:
+		return nil, fmt.Errorf("unknown segment type %q, use plain, steps, ramp, sine or poisson", m.Type)
+	}
+}
+
+// Config converts a declarative generator into a Config, Gun or VU is created with the registered factory.
+func (m *GeneratorConfig) Config() (*Config, error) {
+	loadType, err := m.scheduleType()
+	if err != nil {
+		return nil, err
+	}
+	var schedule []*Segment
+	var capacitySearch *CapacitySearchConfig
+	if m.CapacitySearch != nil {
+		if capacitySearch, err = m.CapacitySearch.CapacitySearchConfig(); err != nil {
+			return nil, fmt.Errorf("capacity search: %w", err)
+		}
+	} else if schedule, err = m.Segments(); err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		GenName:                    m.Name,
+		LoadType:                   loadType,
+		Labels:                     make(map[string]string),
+		Schedule:                   schedule,
+		CallResultBufLen:           m.CallResultBufLen,
+		FailOnErr:                  m.FailOnErr,
+		CorrectCoordinatedOmission: m.CorrectCoordinatedOmission,
+		CapacitySearch:             capacitySearch,
+	}
+	for k, v := range m.Labels {
+		cfg.Labels[k] = v
+	}
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"call_timeout", m.CallTimeout, &cfg.CallTimeout},
+		{"setup_timeout", m.SetupTimeout, &cfg.SetupTimeout},
+		{"teardown_timeout", m.TeardownTimeout, &cfg.TeardownTimeout},
+		{"stats_poll_interval", m.StatsPollInterval, &cfg.StatsPollInterval},
+		{"rate_limit_unit_duration", m.RateLimitUnitDuration, &cfg.RateLimitUnitDuration},
+	}
+	for _, d := range durations {
+		if *d.field, err = parseOptionalDuration(d.name, d.value); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AbortConditions, err = abortConditions(m.AbortConditions); err != nil {
+		return nil, err
+	}
+	if m.SamplerSuccessfulRatio != nil {
+		cfg.SamplerConfig = &SamplerConfig{SuccessfulCallResultRecordRatio: *m.SamplerSuccessfulRatio}
+	}
+	switch loadType {
+	case RPS:
+		if cfg.Gun, err = newRegisteredGun(m.Gun, m.Params); err != nil {
+			return nil, err
+		}
+	case VU:
+		if cfg.VU, err = newRegisteredVU(m.VU, m.Params); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// GeneratorConfigs validates the profile and creates the configs of all its generators without creating any sinks,
+// so unlike NewProfile it has no side effects, t can be nil when the profile is not run from a Go test.
+func (m *ProfileConfig) GeneratorConfigs(t *testing.T) ([]*Config, error) {
+	if _, err := abortConditions(m.AbortConditions); err != nil {
+		return nil, err
+	}
+	cfgs := make([]*Config, 0, len(m.Generators))
+	for _, gc := range m.Generators {
+		cfg, err := gc.Config()
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: %w", gc.Name, err)
+		}
+		cfg.T = t
+		if t == nil && m.Name != "" {
+			if _, ok := cfg.Labels["go_test_name"]; !ok {
+				cfg.Labels["go_test_name"] = m.Name
+			}
+		}
+		cfg.Tracing = m.Tracing || m.OTLPEndpoint != ""
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("generator %s: %w", gc.Name, err)
+		}
+		for _, s := range cfg.Schedule {
+			if err := s.Validate(); err != nil {
+				return nil, fmt.Errorf("generator %s: %w", gc.Name, err)
+			}
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+// NewProfile creates a Profile with all the generators, t can be nil when the profile is not run from a Go test.
+// Sinks are registered when the generators are created, so the results file and the Prometheus listener are opened here.
+func (m *ProfileConfig) NewProfile(t *testing.T) (*Profile, error) {
+	conditions, err := abortConditions(m.AbortConditions)
+	if err != nil {
+		return nil, err
+	}
+	cfgs, err := m.GeneratorConfigs(t)
+	if err != nil {
+		return nil, err
+	}
+	var sinks []ResultsSink
+	if m.ResultsFile != "" {
+		fs, err := NewFileSink(&FileSinkConfig{Path: m.ResultsFile, Compress: m.CompressResultsFile})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, fs)
+	}
+	if m.PrometheusListenAddr != "" {
+		sinks = append(sinks, NewPrometheusSink(&PrometheusSinkConfig{ListenAddr: m.PrometheusListenAddr}))
+	}
+	if m.OTLPEndpoint != "" {
+		otlp, err := NewOTLPSink(&OTLPSinkConfig{Endpoint: m.OTLPEndpoint, ServiceName: m.Name})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, otlp)
+	}
+	p := NewProfile().WithAbortConditions(conditions...)
+	for i, cfg := range cfgs {
+		if m.Loki {
+			cfg.LokiConfig = NewEnvLokiConfig()
+		}
+		cfg.Sinks = sinks
+		p.Add(NewGenerator(cfg))
+		if p.bootstrapErr != nil {
+			return nil, fmt.Errorf("generator %s: %w", m.Generators[i].Name, p.bootstrapErr)
+		}
+	}
+	if m.ControlListenAddr != "" {
+		p.WithControlAPI(m.ControlListenAddr)
+		if p.bootstrapErr != nil {
+			return nil, p.bootstrapErr
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,292 @@
+package wasp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testProfileTOML = `
+name = "declarative"
+
+[[abort_conditions]]
+metric = "error_rate"
+threshold = 0.5
+window = "1s"
+min_calls = 10
+
+[[generators]]
+name = "rps_gen"
+load_type = "rps"
+gun = "mock"
+call_timeout = "1s"
+sampler_successful_ratio = 50
+labels = { branch = "main" }
+params = { call_sleep = "10ms" }
+
+[[generators.schedule]]
+type = "ramp"
+from = 1
+to = 5
+steps = 2
+duration = "1s"
+
+[[generators.schedule]]
+type = "plain"
+from = 5
+duration = "1s"
+
+[[generators.abort_conditions]]
+metric = "latency"
+percentile = 99
+latency = "1s"
+window = "1s"
+consecutive_windows = 2
+
+[[generators]]
+name = "vu_gen"
+load_type = "vu"
+vu = "mock"
+params = { call_sleep = "50ms" }
+
+[[generators.schedule]]
+type = "plain"
+from = 2
+duration = "2s"
+`
+
+const testProfileYAML = `
+name: declarative
+abort_conditions:
+  - metric: error_rate
+    threshold: 0.5
+    window: 1s
+    min_calls: 10
+generators:
+  - name: rps_gen
+    load_type: rps
+    gun: mock
+    call_timeout: 1s
+    sampler_successful_ratio: 50
+    labels:
+      branch: main
+    params:
+      call_sleep: 10ms
+    schedule:
+      - type: ramp
+        from: 1
+        to: 5
+        steps: 2
+        duration: 1s
+      - type: plain
+        from: 5
+        duration: 1s
+    abort_conditions:
+      - metric: latency
+        percentile: 99
+        latency: 1s
+        window: 1s
+        consecutive_windows: 2
+  - name: vu_gen
+    load_type: vu
+    vu: mock
+    params:
+      call_sleep: 50ms
+    schedule:
+      - type: plain
+        from: 2
+        duration: 2s
+`
+
+func TestSmokeProfileConfigFormats(t *testing.T) {
+	t.Parallel()
+	fromTOML, err := ParseProfileConfig([]byte(testProfileTOML), "toml")
+	require.NoError(t, err)
+	fromYAML, err := ParseProfileConfig([]byte(testProfileYAML), ".yaml")
+	require.NoError(t, err)
+
+	for _, cfg := range []*ProfileConfig{fromTOML, fromYAML} {
+		require.Equal(t, "declarative", cfg.Name)
+		require.Len(t, cfg.Generators, 2)
+
+		rpsCfg, err := cfg.Generators[0].Config()
+		require.NoError(t, err)
+		require.Equal(t, "rps_gen", rpsCfg.GenName)
+		require.Equal(t, RPS, rpsCfg.LoadType)
+		require.Equal(t, 1*time.Second, rpsCfg.CallTimeout)
+		require.Equal(t, 50, rpsCfg.SamplerConfig.SuccessfulCallResultRecordRatio)
+		require.Equal(t, "main", rpsCfg.Labels["branch"])
+		require.Equal(t, Combine(Ramp(1, 5, 2, 1*time.Second), Plain(5, 1*time.Second)), rpsCfg.Schedule)
+		require.IsType(t, &MockGun{}, rpsCfg.Gun)
+		require.Equal(t, 10*time.Millisecond, rpsCfg.Gun.(*MockGun).cfg.CallSleep)
+		require.Equal(t, []*AbortCondition{LatencyAbove(99, 1*time.Second, 1*time.Second, 2)}, rpsCfg.AbortConditions)
+
+		p, err := cfg.NewProfile(nil)
+		require.NoError(t, err)
+		expected := ErrorRateAbove(0.5, 1*time.Second)
+		expected.MinCalls = 10
+		expected.ConsecutiveWindows = 1
+		require.Equal(t, []*AbortCondition{expected}, p.abortConditions)
+
+		vuCfg, err := cfg.Generators[1].Config()
+		require.NoError(t, err)
+		require.Equal(t, VU, vuCfg.LoadType)
+		require.IsType(t, &MockVirtualUser{}, vuCfg.VU)
+	}
+}
+
+func TestSmokeProfileConfigRun(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "profile.toml")
+	require.NoError(t, os.WriteFile(path, []byte(testProfileTOML), 0600))
+	cfg, err := LoadProfileConfig(path)
+	require.NoError(t, err)
+	// profile is not run from a test, name is used as go_test_name
+	p, err := cfg.NewProfile(nil)
+	require.NoError(t, err)
+	require.Equal(t, "declarative", p.Generators[0].Cfg.Labels["go_test_name"])
+	_, err = p.Run(true)
+	require.NoError(t, err)
+	for _, g := range p.Generators {
+		require.False(t, g.Stats().RunFailed.Load())
+		require.Greater(t, g.Stats().Success.Load(), int64(0))
+	}
+}
+
+func TestSmokeProfileConfigErrors(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		name   string
+		format string
+		input  string
+		errMsg string
+	}
+	tests := []test{
+		{
+			name:   "unknown format",
+			format: "json",
+			input:  `{}`,
+			errMsg: "unsupported profile format",
+		},
+		{
+			name:   "no generators",
+			format: "toml",
+			input:  `name = "empty"`,
+			errMsg: "profile has no generators",
+		},
+		{
+			name:   "unknown field",
+			format: "yaml",
+			input:  "generators:\n  - name: a\n    load_type: rps\n    gun: mock\n    rps: 10\n",
+			errMsg: "field rps not found",
+		},
+		{
+			name:   "duplicate names",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: "generator name a is not unique",
+		},
+		{
+			name:   "rps without gun",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rps, vu: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: ErrNoGun.Error(),
+		},
+		{
+			name:   "invalid load type",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rpm, gun: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: ErrInvalidScheduleType.Error(),
+		},
+		{
+			name:   "invalid abort condition",
+			format: "yaml",
+			input:  "abort_conditions: [{metric: error_rate, threshold: 5}]\ngenerators:\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: "error rate threshold must be in [0, 1)",
+		},
+		{
+			name:   "invalid generator abort condition",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rps, gun: mock, abort_conditions: [{metric: latency, percentile: 99, latency: 2x}], schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: "generator a: abort condition 0: invalid latency",
+		},
+		{
+			name:   "capacity search with schedule",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rps, gun: mock, capacity_search: {from: 1, step: 1, max: 5, step_duration: 1s, slo: [{metric: failures}]}, schedule: [{type: plain, from: 1, duration: 1s}]}\n",
+			errMsg: ErrCapacitySearchSchedule.Error(),
+		},
+		{
+			name:   "capacity search without slo",
+			format: "yaml",
+			input:  "generators:\n  - {name: a, load_type: rps, gun: mock, capacity_search: {from: 1, step: 1, max: 5, step_duration: 1s}}\n",
+			errMsg: "generator a: capacity search: at least one SLO condition is required",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseProfileConfig([]byte(tc.input), tc.format)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.errMsg)
+		})
+	}
+
+	t.Run("unregistered gun", func(t *testing.T) {
+		cfg, err := ParseProfileConfig([]byte("generators:\n  - {name: a, load_type: rps, gun: nope, schedule: [{type: plain, from: 1, duration: 1s}]}\n"), "yaml")
+		require.NoError(t, err)
+		_, err = cfg.NewProfile(nil)
+		require.ErrorContains(t, err, `gun "nope" is not registered`)
+	})
+
+	t.Run("invalid segment", func(t *testing.T) {
+		cfg, err := ParseProfileConfig([]byte("generators:\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: steps, from: 1, duration: 1s}]}\n"), "yaml")
+		require.NoError(t, err)
+		_, err = cfg.NewProfile(nil)
+		require.ErrorContains(t, err, "steps segment must have steps > 0")
+	})
+
+	t.Run("generator configs have no side effects", func(t *testing.T) {
+		dir := t.TempDir()
+		results := filepath.Join(dir, "results.ndjson")
+		cfg, err := ParseProfileConfig([]byte("results_file: "+results+"\nprometheus_listen_addr: 127.0.0.1:0\ngenerators:\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: plain, from: 1, duration: 1s}]}\n"), "yaml")
+		require.NoError(t, err)
+		cfgs, err := cfg.GeneratorConfigs(nil)
+		require.NoError(t, err)
+		require.Len(t, cfgs, 1)
+		require.Empty(t, cfgs[0].Sinks)
+		require.NoFileExists(t, results)
+	})
+
+	t.Run("sine segment shorter than one step", func(t *testing.T) {
+		cfg, err := ParseProfileConfig([]byte("generators:\n  - {name: a, load_type: rps, gun: mock, schedule: [{type: sine, from: 10, amplitude: 5, period: 1m, steps: 6, duration: 5s}]}\n"), "yaml")
+		require.NoError(t, err)
+		_, err = cfg.NewProfile(nil)
+		require.ErrorIs(t, err, ErrScheduleTooShort)
+		cfg.Generators[0].Schedule[0].Period = "0s"
+		_, err = cfg.NewProfile(nil)
+		require.ErrorIs(t, err, ErrInvalidSchedulePeriod)
+	})
+
+	t.Run("capacity search", func(t *testing.T) {
+		cfg, err := ParseProfileConfig([]byte("generators:\n  - {name: a, load_type: rps, gun: mock, capacity_search: {from: 10, step: 10, max: 100, step_duration: 30s, warm_up: 5s, slo: [{metric: error_rate, threshold: 0.01}]}}\n"), "yaml")
+		require.NoError(t, err)
+		p, err := cfg.NewProfile(nil)
+		require.NoError(t, err)
+		cs := p.Generators[0].Cfg.CapacitySearch
+		require.NotNil(t, cs)
+		require.Equal(t, 30*time.Second, cs.StepDuration)
+		require.Equal(t, 5*time.Second, cs.WarmUp)
+		require.Equal(t, int64(DefaultCapacitySearchPrecision), cs.Precision)
+		require.Equal(t, AbortMetricErrorRate, cs.SLO[0].Metric)
+	})
+
+	t.Run("invalid duration", func(t *testing.T) {
+		cfg, err := ParseProfileConfig([]byte("generators:\n  - {name: a, load_type: rps, gun: mock, call_timeout: 1x, schedule: [{type: plain, from: 1, duration: 1s}]}\n"), "yaml")
+		require.NoError(t, err)
+		_, err = cfg.NewProfile(nil)
+		require.ErrorContains(t, err, "invalid call_timeout")
+	})
+}
@@ -0,0 +1,199 @@
+package wasp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GunFactory creates a new Gun from the params of a declarative generator config
+type GunFactory func(params map[string]interface{}) (Gun, error)
+
+// VUFactory creates a new VirtualUser from the params of a declarative generator config
+type VUFactory func(params map[string]interface{}) (VirtualUser, error)
+
+var (
+	registryMu  = &sync.RWMutex{}
+	gunRegistry = make(map[string]GunFactory)
+	vuRegistry  = make(map[string]VUFactory)
+)
+
+func init() {
+	RegisterGun("mock", newMockGunFromParams)
+	RegisterVU("mock", newMockVUFromParams)
+	RegisterGun("grpc", newGRPCGunFromParams)
+	RegisterVU("grpc", newGRPCVUFromParams)
+}
+
+// RegisterGun registers a Gun implementation by name, so it can be referenced from declarative profiles.
+// Registering the same name twice overrides the previous factory.
+func RegisterGun(name string, f GunFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	gunRegistry[name] = f
+}
+
+// RegisterVU registers a VirtualUser implementation by name, so it can be referenced from declarative profiles.
+// Registering the same name twice overrides the previous factory.
+func RegisterVU(name string, f VUFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	vuRegistry[name] = f
+}
+
+// RegisteredGuns returns the sorted names of all registered Gun implementations.
+func RegisteredGuns() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(gunRegistry)
+}
+
+// RegisteredVUs returns the sorted names of all registered VirtualUser implementations.
+func RegisteredVUs() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(vuRegistry)
+}
+
+func newRegisteredGun(name string, params map[string]interface{}) (Gun, error) {
+	registryMu.RLock()
+	f, ok := gunRegistry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("gun %q is not registered, registered guns: %v", name, RegisteredGuns())
+	}
+	return f(params)
+}
+
+func newRegisteredVU(name string, params map[string]interface{}) (VirtualUser, error) {
+	registryMu.RLock()
+	f, ok := vuRegistry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("vu %q is not registered, registered vus: %v", name, RegisteredVUs())
+	}
+	return f(params)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DecodeParams decodes declarative generator params into a struct using its json tags.
+// Use it in your GunFactory or VUFactory to get typed params.
+func DecodeParams(params map[string]interface{}, out interface{}) error {
+	d, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(d, out)
+}
+
+type mockParams struct {
+	FailRatio       int    `json:"fail_ratio"`
+	TimeoutRatio    int    `json:"timeout_ratio"`
+	CallSleep       string `json:"call_sleep"`
+	SetupSleep      string `json:"setup_sleep"`
+	TeardownSleep   string `json:"teardown_sleep"`
+	SetupFailure    bool   `json:"setup_failure"`
+	TeardownFailure bool   `json:"teardown_failure"`
+}
+
+func parseOptionalDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+func newMockGunFromParams(params map[string]interface{}) (Gun, error) {
+	var p mockParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	callSleep, err := parseOptionalDuration("call_sleep", p.CallSleep)
+	if err != nil {
+		return nil, err
+	}
+	return NewMockGun(&MockGunConfig{
+		FailRatio:    p.FailRatio,
+		TimeoutRatio: p.TimeoutRatio,
+		CallSleep:    callSleep,
+	}), nil
+}
+
+func newMockVUFromParams(params map[string]interface{}) (VirtualUser, error) {
+	var p mockParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	callSleep, err := parseOptionalDuration("call_sleep", p.CallSleep)
+	if err != nil {
+		return nil, err
+	}
+	setupSleep, err := parseOptionalDuration("setup_sleep", p.SetupSleep)
+	if err != nil {
+		return nil, err
+	}
+	teardownSleep, err := parseOptionalDuration("teardown_sleep", p.TeardownSleep)
+	if err != nil {
+		return nil, err
+	}
+	return NewMockVU(&MockVirtualUserConfig{
+		FailRatio:       p.FailRatio,
+		TimeoutRatio:    p.TimeoutRatio,
+		CallSleep:       callSleep,
+		SetupSleep:      setupSleep,
+		SetupFailure:    p.SetupFailure,
+		TeardownSleep:   teardownSleep,
+		TeardownFailure: p.TeardownFailure,
+	}), nil
+}
+
+type grpcParams struct {
+	GRPCConfig
+	// DescriptorSet is a path to protoc --descriptor_set_out file, server reflection is used if it's empty
+	DescriptorSet string `json:"descriptor_set"`
+}
+
+func grpcConfigFromParams(params map[string]interface{}) (*GRPCConfig, error) {
+	var p grpcParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.DescriptorSet != "" {
+		files, err := LoadProtoDescriptorSet(p.DescriptorSet)
+		if err != nil {
+			return nil, err
+		}
+		p.Files = files
+	}
+	return &p.GRPCConfig, nil
+}
+
+func newGRPCGunFromParams(params map[string]interface{}) (Gun, error) {
+	cfg, err := grpcConfigFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return NewGRPCGun(cfg)
+}
+
+func newGRPCVUFromParams(params map[string]interface{}) (VirtualUser, error) {
+	cfg, err := grpcConfigFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return NewGRPCVU(cfg)
+}
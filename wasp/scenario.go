@@ -0,0 +1,329 @@
+package wasp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidScenario = errors.New("invalid scenario")
+	ErrStepTimeout     = errors.New("scenario step timeout")
+)
+
+// StepFunc is a single scenario step, the returned data is stored as Response.Data and a non nil error fails the step.
+// Steps should respect ctx, it's cancelled after the step timeout. With Config.Tracing ctx carries the trace of the step, see InjectTraceparent.
+type StepFunc func(ctx context.Context, sc *ScenarioContext) (interface{}, error)
+
+// ThinkTime returns how long a virtual user waits after a step, see ConstantThinkTime, UniformThinkTime, NormalThinkTime and ExponentialThinkTime
+type ThinkTime func(rnd *rand.Rand) time.Duration
+
+// ConstantThinkTime always waits for d
+func ConstantThinkTime(d time.Duration) ThinkTime {
+	return func(_ *rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// UniformThinkTime waits for a random duration between minimum and maximum
+func UniformThinkTime(minimum, maximum time.Duration) ThinkTime {
+	return func(rnd *rand.Rand) time.Duration {
+		if maximum <= minimum {
+			return minimum
+		}
+		return minimum + time.Duration(rnd.Int63n(int64(maximum-minimum)))
+	}
+}
+
+// NormalThinkTime waits for a normally distributed duration, negative values are clamped to 0
+func NormalThinkTime(mean, stdDev time.Duration) ThinkTime {
+	return func(rnd *rand.Rand) time.Duration {
+		return time.Duration(math.Max(0, rnd.NormFloat64()*float64(stdDev)+float64(mean)))
+	}
+}
+
+// ExponentialThinkTime waits for an exponentially distributed duration, users acting independently of each other arrive like this
+func ExponentialThinkTime(mean time.Duration) ThinkTime {
+	return func(rnd *rand.Rand) time.Duration {
+		return time.Duration(rnd.ExpFloat64() * float64(mean))
+	}
+}
+
+// ScenarioStep is a named step of a Scenario, its results are stored with the step name as Response.Group
+type ScenarioStep struct {
+	Name string
+	Fn   StepFunc
+	// Weight is the relative probability of the step being picked from a OneOf group, it's ignored for sequential steps
+	Weight int
+	// Timeout of a single step, Config.CallTimeout is used if it's not set
+	Timeout time.Duration
+	// ThinkTime is the pause after the step
+	ThinkTime ThinkTime
+	// ContinueOnError runs the next steps even if this one failed, by default the rest of the iteration is skipped
+	ContinueOnError bool
+}
+
+// ScenarioContext is the state of a single virtual user passed to every step
+type ScenarioContext struct {
+	Gen *Generator
+	// Vars are kept between the steps and the iterations of the virtual user, use them to pass data from step to step
+	Vars map[string]interface{}
+	// Iteration is the number of the current Call of the virtual user, starting at 0
+	Iteration int64
+	// Rand is the random source of the virtual user, it's not safe to share it with other goroutines
+	Rand *rand.Rand
+}
+
+// scenarioStage is a single step or a weighted choice of steps
+type scenarioStage struct {
+	steps       []*ScenarioStep
+	totalWeight int
+}
+
+func (s *scenarioStage) pick(rnd *rand.Rand) *ScenarioStep {
+	if len(s.steps) == 1 {
+		return s.steps[0]
+	}
+	n := rnd.Intn(s.totalWeight)
+	for _, st := range s.steps {
+		if n < st.Weight {
+			return st
+		}
+		n -= st.Weight
+	}
+	return s.steps[len(s.steps)-1]
+}
+
+// Scenario composes steps into a user journey, build it with NewScenario and create the VirtualUser with VU.
+// Every Call runs the stages in order, a stage is a single step added with Step, or one step picked by weight from a OneOf group.
+type Scenario struct {
+	stages   []*scenarioStage
+	setup    func(sc *ScenarioContext) error
+	teardown func(sc *ScenarioContext) error
+	names    map[string]struct{}
+	err      error
+}
+
+// NewScenario creates an empty scenario.
+func NewScenario() *Scenario {
+	return &Scenario{names: make(map[string]struct{})}
+}
+
+func (m *Scenario) addStep(st *ScenarioStep) error {
+	if st == nil || st.Name == "" {
+		return errors.Wrap(ErrInvalidScenario, "step name is empty")
+	}
+	if st.Fn == nil {
+		return errors.Wrapf(ErrInvalidScenario, "step %s has no function", st.Name)
+	}
+	if _, ok := m.names[st.Name]; ok {
+		return errors.Wrapf(ErrInvalidScenario, "step name %s is not unique", st.Name)
+	}
+	if st.Timeout < 0 {
+		return errors.Wrapf(ErrInvalidScenario, "step %s timeout must be >= 0", st.Name)
+	}
+	m.names[st.Name] = struct{}{}
+	return nil
+}
+
+// Step adds a step run on every iteration.
+func (m *Scenario) Step(st *ScenarioStep) *Scenario {
+	if m.err != nil {
+		return m
+	}
+	if err := m.addStep(st); err != nil {
+		m.err = err
+		return m
+	}
+	m.stages = append(m.stages, &scenarioStage{steps: []*ScenarioStep{st}})
+	return m
+}
+
+// OneOf adds a group of steps, on every iteration one of them is picked with probability proportional to its Weight.
+func (m *Scenario) OneOf(steps ...*ScenarioStep) *Scenario {
+	if m.err != nil {
+		return m
+	}
+	if len(steps) == 0 {
+		m.err = errors.Wrap(ErrInvalidScenario, "OneOf must have at least one step")
+		return m
+	}
+	stage := &scenarioStage{}
+	for _, st := range steps {
+		if err := m.addStep(st); err != nil {
+			m.err = err
+			return m
+		}
+		if st.Weight <= 0 {
+			m.err = errors.Wrapf(ErrInvalidScenario, "step %s weight must be > 0", st.Name)
+			return m
+		}
+		stage.steps = append(stage.steps, st)
+		stage.totalWeight += st.Weight
+	}
+	m.stages = append(m.stages, stage)
+	return m
+}
+
+// OnSetup is called once per virtual user before the first iteration, e.g. to log in and keep the token in Vars.
+func (m *Scenario) OnSetup(fn func(sc *ScenarioContext) error) *Scenario {
+	m.setup = fn
+	return m
+}
+
+// OnTeardown is called once per virtual user after the last iteration.
+func (m *Scenario) OnTeardown(fn func(sc *ScenarioContext) error) *Scenario {
+	m.teardown = fn
+	return m
+}
+
+// VU validates the scenario and creates a VirtualUser running it.
+func (m *Scenario) VU() (*ScenarioVU, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(m.stages) == 0 {
+		return nil, errors.Wrap(ErrInvalidScenario, "scenario has no steps")
+	}
+	return newScenarioVU(m), nil
+}
+
+// ScenarioVU is a VirtualUser running a Scenario, every step result is sent as a separate Response with the step name as Group.
+// Config.CallTimeout limits the whole iteration, including the think time, so set it accordingly.
+type ScenarioVU struct {
+	*VUControl
+	scenario *Scenario
+	sc       *ScenarioContext
+	// mu keeps the iterations sequential, the generator starts a new Call when the previous one timed out
+	mu *sync.Mutex
+}
+
+func newScenarioVU(s *Scenario) *ScenarioVU {
+	return &ScenarioVU{
+		VUControl: NewVUControl(),
+		scenario:  s,
+		mu:        &sync.Mutex{},
+		sc: &ScenarioContext{
+			Vars: make(map[string]interface{}),
+			//nolint
+			Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		},
+	}
+}
+
+// Clone creates a new virtual user with its own Vars running the same scenario.
+func (m *ScenarioVU) Clone(_ *Generator) VirtualUser {
+	return newScenarioVU(m.scenario)
+}
+
+// Setup runs the OnSetup function of the scenario.
+func (m *ScenarioVU) Setup(l *Generator) error {
+	m.sc.Gen = l
+	if m.scenario.setup == nil {
+		return nil
+	}
+	return m.scenario.setup(m.sc)
+}
+
+// Teardown runs the OnTeardown function of the scenario.
+func (m *ScenarioVU) Teardown(l *Generator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sc.Gen = l
+	if m.scenario.teardown == nil {
+		return nil
+	}
+	return m.scenario.teardown(m.sc)
+}
+
+// Call runs a single iteration of the scenario.
+func (m *ScenarioVU) Call(l *Generator) {
+	m.CallContext(context.Background(), l)
+}
+
+// CallContext runs a single iteration of the scenario, the steps contexts are derived from ctx.
+// When ctx is done the iteration stops and the interrupted step is not reported, the generator records the timeout.
+func (m *ScenarioVU) CallContext(ctx context.Context, l *Generator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sc.Gen = l
+	defer func() {
+		m.sc.Iteration++
+	}()
+	for _, stage := range m.scenario.stages {
+		st := stage.pick(m.sc.Rand)
+		res := m.runStep(ctx, l, st)
+		if ctx.Err() != nil {
+			return
+		}
+		l.ResponsesChan <- res
+		if (res.Failed || res.Timeout) && !st.ContinueOnError {
+			return
+		}
+		if st.ThinkTime != nil {
+			if !m.think(ctx, l, st.ThinkTime(m.sc.Rand)) {
+				return
+			}
+		}
+	}
+}
+
+func (m *ScenarioVU) runStep(parent context.Context, l *Generator, st *ScenarioStep) *Response {
+	timeout := st.Timeout
+	if timeout == 0 {
+		timeout = l.Cfg.CallTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	// all steps of the iteration belong to the same trace, every step is a separate span
+	var tc *TraceContext
+	if it := TraceFromContext(parent); it != nil {
+		tc = it.NewSpan()
+		ctx = ContextWithTrace(ctx, tc)
+	}
+	startedAt := time.Now()
+	data, err := m.callStep(ctx, st)
+	res := &Response{StartedAt: &startedAt, Group: st.Name, Data: data}
+	res.SetTrace(tc)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.Timeout = true
+		res.Error = fmt.Sprintf("%s: %s", ErrStepTimeout, st.Name)
+	case err != nil:
+		res.Failed = true
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// callStep runs the step function, a panic fails the step instead of the whole generator
+func (m *ScenarioVU) callStep(ctx context.Context, st *ScenarioStep) (data interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("step %s panicked: %v", st.Name, r)
+		}
+	}()
+	return st.Fn(ctx, m.sc)
+}
+
+// think waits for d and returns false if the generator was stopped or ctx is done in the meantime
+func (m *ScenarioVU) think(ctx context.Context, l *Generator, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-l.ResponsesCtx.Done():
+		return false
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
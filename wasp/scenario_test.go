@@ -0,0 +1,159 @@
+package wasp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scenarioTestGenerator() *Generator {
+	return &Generator{
+		Cfg:           &Config{CallTimeout: time.Second},
+		ResponsesChan: make(chan *Response, 100),
+		ResponsesCtx:  context.Background(),
+	}
+}
+
+func drainResponses(ch chan *Response) []*Response {
+	res := make([]*Response, 0)
+	for {
+		select {
+		case r := <-ch:
+			res = append(res, r)
+		default:
+			return res
+		}
+	}
+}
+
+func TestSmokeScenarioWeightedSteps(t *testing.T) {
+	t.Parallel()
+	login := func(_ context.Context, sc *ScenarioContext) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		sc.Vars["token"] = "secret"
+		return "logged in", nil
+	}
+	authenticated := func(_ context.Context, sc *ScenarioContext) (interface{}, error) {
+		time.Sleep(5 * time.Millisecond)
+		if sc.Vars["token"] != "secret" {
+			return nil, errors.New("not authenticated")
+		}
+		return nil, nil
+	}
+	vu, err := NewScenario().
+		Step(&ScenarioStep{Name: "login", Fn: login, ThinkTime: UniformThinkTime(time.Millisecond, 5*time.Millisecond)}).
+		OneOf(
+			&ScenarioStep{Name: "balance", Fn: authenticated, Weight: 3},
+			&ScenarioStep{Name: "transfer", Fn: authenticated, Weight: 1},
+		).
+		VU()
+	require.NoError(t, err)
+
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          VU,
+		StatsPollInterval: time.Second,
+		Schedule:          Plain(3, 2*time.Second),
+		VU:                vu,
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+
+	groups := make(map[string]int)
+	for _, r := range gen.GetData().OKResponses.Data {
+		groups[r.Group]++
+	}
+	require.Greater(t, groups["login"], 100)
+	// the last iteration of every VU can be stopped during the think time after login
+	require.InDelta(t, groups["login"], groups["balance"]+groups["transfer"], 3)
+	require.Greater(t, groups["balance"], groups["transfer"])
+	require.Greater(t, groups["transfer"], 0)
+	require.Equal(t, "logged in", gen.GetData().OKResponses.Data[0].Data)
+	// every step has its own latency histogram
+	require.NotZero(t, gen.Stats().Latencies.GroupPercentiles()["login"].Count)
+}
+
+func TestSmokeScenarioStepErrors(t *testing.T) {
+	t.Parallel()
+	var calls []string
+	step := func(name string, err error) StepFunc {
+		return func(_ context.Context, _ *ScenarioContext) (interface{}, error) {
+			calls = append(calls, name)
+			return nil, err
+		}
+	}
+	slow := func(ctx context.Context, _ *ScenarioContext) (interface{}, error) {
+		calls = append(calls, "slow")
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	vu, err := NewScenario().
+		Step(&ScenarioStep{Name: "optional", Fn: step("optional", errors.New("optional failed")), ContinueOnError: true}).
+		Step(&ScenarioStep{Name: "slow", Fn: slow, Timeout: 20 * time.Millisecond}).
+		Step(&ScenarioStep{Name: "skipped", Fn: step("skipped", nil)}).
+		VU()
+	require.NoError(t, err)
+
+	gen := scenarioTestGenerator()
+	vu.Call(gen)
+	require.Equal(t, []string{"optional", "slow"}, calls)
+	res := drainResponses(gen.ResponsesChan)
+	require.Len(t, res, 2)
+	require.True(t, res[0].Failed)
+	require.Equal(t, "optional failed", res[0].Error)
+	require.Equal(t, "optional", res[0].Group)
+	require.True(t, res[1].Timeout)
+	require.False(t, res[1].Failed)
+	require.Equal(t, "slow", res[1].Group)
+
+	panicking, err := NewScenario().
+		Step(&ScenarioStep{Name: "panic", Fn: func(_ context.Context, _ *ScenarioContext) (interface{}, error) {
+			panic("boom")
+		}}).
+		VU()
+	require.NoError(t, err)
+	panicking.Call(gen)
+	res = drainResponses(gen.ResponsesChan)
+	require.Len(t, res, 1)
+	require.True(t, res[0].Failed)
+	require.Contains(t, res[0].Error, "boom")
+}
+
+func TestSmokeScenarioValidate(t *testing.T) {
+	t.Parallel()
+	fn := func(_ context.Context, _ *ScenarioContext) (interface{}, error) { return nil, nil }
+	tests := []struct {
+		name     string
+		scenario *Scenario
+	}{
+		{name: "empty", scenario: NewScenario()},
+		{name: "no name", scenario: NewScenario().Step(&ScenarioStep{Fn: fn})},
+		{name: "no function", scenario: NewScenario().Step(&ScenarioStep{Name: "a"})},
+		{name: "duplicate name", scenario: NewScenario().Step(&ScenarioStep{Name: "a", Fn: fn}).OneOf(&ScenarioStep{Name: "a", Fn: fn, Weight: 1})},
+		{name: "no weight", scenario: NewScenario().OneOf(&ScenarioStep{Name: "a", Fn: fn}, &ScenarioStep{Name: "b", Fn: fn, Weight: 1})},
+		{name: "empty group", scenario: NewScenario().OneOf()},
+	}
+	for _, tc := range tests {
+		_, err := tc.scenario.VU()
+		require.ErrorIs(t, err, ErrInvalidScenario, tc.name)
+	}
+}
+
+func TestSmokeScenarioThinkTime(t *testing.T) {
+	t.Parallel()
+	//nolint
+	rnd := rand.New(rand.NewSource(1))
+	require.Equal(t, time.Second, ConstantThinkTime(time.Second)(rnd))
+	for i := 0; i < 1000; i++ {
+		d := UniformThinkTime(10*time.Millisecond, 20*time.Millisecond)(rnd)
+		require.GreaterOrEqual(t, d, 10*time.Millisecond)
+		require.Less(t, d, 20*time.Millisecond)
+		require.GreaterOrEqual(t, NormalThinkTime(time.Millisecond, 10*time.Millisecond)(rnd), time.Duration(0))
+		require.GreaterOrEqual(t, ExponentialThinkTime(time.Second)(rnd), time.Duration(0))
+	}
+}
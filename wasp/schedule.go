@@ -1,6 +1,7 @@
 package wasp
 
 import (
+	"math"
 	"time"
 )
 
@@ -40,6 +41,94 @@ func Steps(from, increase int64, steps int, duration time.Duration) []*Segment {
 	return segments
 }
 
+// Ramp generates a slice of Segment pointers that linearly change the load from 'from' to 'to' in 'steps' steps.
+// The first segment starts at 'from', the last one ends at 'to', each lasting duration divided by the number of steps.
+// Use it to reproduce gradual traffic ramps, for example a warm-up before a plain segment.
+// Panics with ErrInvalidScheduleSteps if steps <= 0 and with ErrScheduleTooShort if duration is shorter than steps nanoseconds.
+func Ramp(from, to int64, steps int, duration time.Duration) []*Segment {
+	if err := validateScheduleSteps(steps, duration); err != nil {
+		panic(err)
+	}
+	segments := make([]*Segment, 0)
+	perStepDuration := duration / time.Duration(steps)
+	for i := 0; i < steps; i++ {
+		newFrom := from
+		if steps > 1 {
+			newFrom = from + int64(math.Round(float64(to-from)*float64(i)/float64(steps-1)))
+		}
+		segments = append(segments, &Segment{
+			From:     newFrom,
+			Duration: perStepDuration,
+			Type:     SegmentType_Ramp,
+		})
+	}
+	return segments
+}
+
+// Sine generates a slice of Segment pointers following a sinusoidal curve around 'base' with the given 'amplitude' and 'period'.
+// Each period is split into 'stepsPerPeriod' segments, the curve is sampled at the start of every segment and never goes below 1.
+// Use it to reproduce diurnal or otherwise periodic traffic patterns.
+// Panics with ErrInvalidSchedulePeriod, ErrInvalidScheduleSteps or ErrScheduleTooShort if the curve can't produce a single segment.
+func Sine(base, amplitude int64, period time.Duration, stepsPerPeriod int, duration time.Duration) []*Segment {
+	if err := validateSineSchedule(period, stepsPerPeriod, duration); err != nil {
+		panic(err)
+	}
+	segments := make([]*Segment, 0)
+	perStepDuration := period / time.Duration(stepsPerPeriod)
+	steps := int(duration / perStepDuration)
+	for i := 0; i < steps; i++ {
+		elapsed := time.Duration(i) * perStepDuration
+		newFrom := base + int64(math.Round(float64(amplitude)*math.Sin(2*math.Pi*float64(elapsed)/float64(period))))
+		if newFrom < 1 {
+			newFrom = 1
+		}
+		segments = append(segments, &Segment{
+			From:     newFrom,
+			Duration: perStepDuration,
+			Type:     SegmentType_Sine,
+		})
+	}
+	return segments
+}
+
+// validateScheduleSteps checks that duration can be split into the given number of non-empty steps
+func validateScheduleSteps(steps int, duration time.Duration) error {
+	if steps <= 0 {
+		return ErrInvalidScheduleSteps
+	}
+	if duration < time.Duration(steps) {
+		return ErrScheduleTooShort
+	}
+	return nil
+}
+
+// validateSineSchedule checks that a sine curve has a period, steps and lasts for at least one step
+func validateSineSchedule(period time.Duration, stepsPerPeriod int, duration time.Duration) error {
+	if period <= 0 {
+		return ErrInvalidSchedulePeriod
+	}
+	if err := validateScheduleSteps(stepsPerPeriod, period); err != nil {
+		return err
+	}
+	if duration < period/time.Duration(stepsPerPeriod) {
+		return ErrScheduleTooShort
+	}
+	return nil
+}
+
+// Poisson creates a slice containing a single Segment with Poisson-distributed inter-arrival times.
+// On average 'rate' requests are sent per RateLimitUnitDuration, but intervals between requests are exponentially distributed.
+// It can only be used with RPS load type.
+func Poisson(rate int64, duration time.Duration) []*Segment {
+	return []*Segment{
+		{
+			From:     rate,
+			Duration: duration,
+			Type:     SegmentType_Poisson,
+		},
+	}
+}
+
 // Combine merges multiple slices of Segment pointers into a single slice.
 // It is useful for aggregating segment data from various sources.
 func Combine(segs ...[]*Segment) []*Segment {
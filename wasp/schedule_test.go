@@ -57,6 +57,89 @@ func TestSmokeSchedules(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "ramp",
+			input: Ramp(10, 40, 4, 40*time.Second),
+			output: []*Segment{
+				{
+					From:     10,
+					Duration: 10 * time.Second,
+					Type:     SegmentType_Ramp,
+				},
+				{
+					From:     20,
+					Duration: 10 * time.Second,
+					Type:     SegmentType_Ramp,
+				},
+				{
+					From:     30,
+					Duration: 10 * time.Second,
+					Type:     SegmentType_Ramp,
+				},
+				{
+					From:     40,
+					Duration: 10 * time.Second,
+					Type:     SegmentType_Ramp,
+				},
+			},
+		},
+		{
+			name:  "sine",
+			input: Sine(10, 10, 4*time.Second, 4, 8*time.Second),
+			output: []*Segment{
+				{
+					From:     10,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     20,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     10,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     1,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     10,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     20,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     10,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+				{
+					From:     1,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Sine,
+				},
+			},
+		},
+		{
+			name:  "poisson",
+			input: Poisson(5, 1*time.Second),
+			output: []*Segment{
+				{
+					From:     5,
+					Duration: 1 * time.Second,
+					Type:     SegmentType_Poisson,
+				},
+			},
+		},
 		{
 			name:  "plain",
 			input: Plain(1, 1*time.Second),
@@ -125,3 +208,55 @@ func TestSmokeSchedules(t *testing.T) {
 		})
 	}
 }
+
+func TestSmokePoissonLimiterRate(t *testing.T) {
+	t.Parallel()
+	rl := newPoissonLimiter(200, 1*time.Second)
+	start := time.Now()
+	var last time.Time
+	for i := 0; i < 200; i++ {
+		last = rl.Take()
+	}
+	// exponential intervals are noisy, we only check the mean rate is in a sane range
+	elapsed := last.Sub(start)
+	require.Greater(t, elapsed, 500*time.Millisecond)
+	require.Less(t, elapsed, 2*time.Second)
+}
+
+func TestSmokeInvalidSchedules(t *testing.T) {
+	t.Parallel()
+	require.PanicsWithValue(t, ErrScheduleTooShort, func() { Sine(10, 5, time.Minute, 6, 5*time.Second) })
+	require.PanicsWithValue(t, ErrInvalidSchedulePeriod, func() { Sine(10, 5, 0, 6, time.Minute) })
+	require.PanicsWithValue(t, ErrInvalidScheduleSteps, func() { Sine(10, 5, time.Minute, 0, time.Minute) })
+	require.PanicsWithValue(t, ErrInvalidScheduleSteps, func() { Ramp(1, 10, 0, time.Minute) })
+	require.PanicsWithValue(t, ErrScheduleTooShort, func() { Ramp(1, 10, 10, 5*time.Nanosecond) })
+}
+
+func TestSmokeUniformLimiterCatchesUp(t *testing.T) {
+	t.Parallel()
+	rl := newUniformLimiter(10, 1*time.Second)
+	first := rl.Take()
+	// caller is a bit late, limiter should return intended times on the original timeline
+	time.Sleep(150 * time.Millisecond)
+	require.Equal(t, first.Add(100*time.Millisecond), rl.Take())
+	require.Equal(t, first.Add(200*time.Millisecond), rl.Take())
+}
+
+func TestSmokeUniformLimiterCapsCatchUpAfterStall(t *testing.T) {
+	t.Parallel()
+	rl := newUniformLimiter(10, 1*time.Second)
+	first := rl.Take()
+	// caller stalls for 10 intervals, the late call keeps its intended time,
+	// but only one more call is owed instead of a burst of 10
+	time.Sleep(time.Second)
+	resumed := time.Now()
+	next, skipped := rl.(*scheduledLimiter).take()
+	require.Equal(t, first.Add(100*time.Millisecond), next)
+	// arrivals dropped by the cap are reported on the original timeline
+	require.InDelta(t, 8, len(skipped), 1)
+	require.Equal(t, first.Add(200*time.Millisecond), skipped[0])
+	rl.Take()
+	require.Less(t, time.Since(resumed), 50*time.Millisecond, "one owed call should be let through right away")
+	rl.Take()
+	require.GreaterOrEqual(t, time.Since(resumed), 90*time.Millisecond, "calls after the owed one should follow the rate")
+}
@@ -0,0 +1,96 @@
+package wasp
+
+import "time"
+
+// ResultsSink is a pluggable destination for generator results, in addition to Loki
+// it can be used to export call results and stats to other storages, ex.: Prometheus, local files
+type ResultsSink interface {
+	// Register is called once when the generator is created, it can be used to set up the sink for this generator
+	Register(g *Generator) error
+	// HandleResponse is called for every call result recorded by the Sampler
+	HandleResponse(g *Generator, r *Response) error
+	// HandleStats is called every StatsPollInterval with current generator stats
+	HandleStats(g *Generator, stats map[string]interface{}) error
+	// Stop is called once when the generator has finished, sink should flush all the data it has
+	Stop(g *Generator) error
+}
+
+// registerSinks registers the generator in all configured sinks.
+func (g *Generator) registerSinks() error {
+	for _, s := range g.Cfg.Sinks {
+		if err := s.Register(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendResponsesToSinks starts a background goroutine that passes recorded responses to all configured sinks.
+func (g *Generator) sendResponsesToSinks() {
+	g.dataWaitGroup.Add(1)
+	go func() {
+		defer g.dataWaitGroup.Done()
+		for {
+			select {
+			case <-g.dataCtx.Done():
+				g.Log.Info().Msg("Sink responses exited")
+				return
+			case r := <-g.sinkResponsesChan:
+				g.handleSinksResponse(r)
+			}
+		}
+	}()
+}
+
+// sendStatsToSinks starts a background goroutine that periodically passes generator stats to all configured sinks.
+func (g *Generator) sendStatsToSinks() {
+	g.dataWaitGroup.Add(1)
+	go func() {
+		defer g.dataWaitGroup.Done()
+		for {
+			select {
+			case <-g.dataCtx.Done():
+				g.Log.Info().Msg("Sink stats exited")
+				return
+			default:
+				time.Sleep(g.Cfg.StatsPollInterval)
+				g.handleSinksStats()
+			}
+		}
+	}()
+}
+
+func (g *Generator) handleSinksResponse(r *Response) {
+	for _, s := range g.Cfg.Sinks {
+		if err := s.HandleResponse(g, r); err != nil {
+			g.Log.Err(err).Msg("failed to send response to sink")
+		}
+	}
+}
+
+func (g *Generator) handleSinksStats() {
+	stats := g.StatsJSON()
+	for _, s := range g.Cfg.Sinks {
+		if err := s.HandleStats(g, stats); err != nil {
+			g.Log.Err(err).Msg("failed to send stats to sink")
+		}
+	}
+}
+
+// stopSinks drains the remaining responses, sends final stats and stops all configured sinks.
+func (g *Generator) stopSinks() {
+	for drained := false; !drained; {
+		select {
+		case r := <-g.sinkResponsesChan:
+			g.handleSinksResponse(r)
+		default:
+			drained = true
+		}
+	}
+	g.handleSinksStats()
+	for _, s := range g.Cfg.Sinks {
+		if err := s.Stop(g); err != nil {
+			g.Log.Err(err).Msg("failed to stop sink")
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package wasp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	FileRecordResponse  = "response"
+	FileRecordStats     = "stats"
+	FileRecordGenerator = "generator"
+)
+
+// FileSinkConfig is the configuration of the local file sink
+type FileSinkConfig struct {
+	// Path is the results file path, it is truncated if it exists
+	Path string
+	// Compress writes the file with gzip compression
+	Compress bool
+}
+
+// FileRecord is a single NDJSON line of the results file
+type FileRecord struct {
+	Type      string                 `json:"type"`
+	GenName   string                 `json:"gen_name"`
+	Timestamp time.Time              `json:"ts"`
+	Response  *Response              `json:"response,omitempty"`
+	Stats     map[string]interface{} `json:"stats,omitempty"`
+	// generator record is written once, when the generator finishes, so the schedule has start and end times
+	Config    *Config           `json:"config,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Latencies *LatencySnapshot  `json:"latencies,omitempty"`
+	Capacity  *CapacityResult   `json:"capacity,omitempty"`
+}
+
+// FileSink is a ResultsSink that streams every sampled Response and periodic Stats to a local NDJSON file.
+// The file can be loaded back with LoadResultsFile for offline analysis, no Loki is required.
+type FileSink struct {
+	cfg      *FileSinkConfig
+	mu       *sync.Mutex
+	openOnce *sync.Once
+	openErr  error
+	file     *os.File
+	gz       *gzip.Writer
+	w        *bufio.Writer
+	enc      *json.Encoder
+	active   int
+}
+
+// NewFileSink creates a file sink, it can be shared between several generators or a Profile.
+func NewFileSink(cfg *FileSinkConfig) (*FileSink, error) {
+	if cfg == nil || cfg.Path == "" {
+		return nil, fmt.Errorf("file sink path must be provided")
+	}
+	return &FileSink{
+		cfg:      cfg,
+		mu:       &sync.Mutex{},
+		openOnce: &sync.Once{},
+	}, nil
+}
+
+func (m *FileSink) open() error {
+	m.openOnce.Do(func() {
+		f, err := os.Create(m.cfg.Path)
+		if err != nil {
+			m.openErr = err
+			return
+		}
+		m.file = f
+		var w io.Writer = f
+		if m.cfg.Compress {
+			m.gz = gzip.NewWriter(f)
+			w = m.gz
+		}
+		m.w = bufio.NewWriter(w)
+		m.enc = json.NewEncoder(m.w)
+	})
+	return m.openErr
+}
+
+func (m *FileSink) write(r *FileRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enc == nil {
+		return fmt.Errorf("file sink %s is closed", m.cfg.Path)
+	}
+	return m.enc.Encode(r)
+}
+
+// Register opens the results file on the first call.
+func (m *FileSink) Register(_ *Generator) error {
+	if err := m.open(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.active++
+	m.mu.Unlock()
+	return nil
+}
+
+// HandleResponse writes a response record.
+func (m *FileSink) HandleResponse(g *Generator, r *Response) error {
+	ts := time.Now()
+	if r.FinishedAt != nil {
+		ts = *r.FinishedAt
+	}
+	return m.write(&FileRecord{
+		Type:      FileRecordResponse,
+		GenName:   g.Cfg.GenName,
+		Timestamp: ts,
+		Response:  r,
+	})
+}
+
+// HandleStats writes a stats snapshot record.
+func (m *FileSink) HandleStats(g *Generator, stats map[string]interface{}) error {
+	return m.write(&FileRecord{
+		Type:      FileRecordStats,
+		GenName:   g.Cfg.GenName,
+		Timestamp: time.Now(),
+		Stats:     stats,
+	})
+}
+
+// Stop writes the generator record with the final config, stats and latency histograms,
+// the file is flushed and closed when the last registered generator stops.
+func (m *FileSink) Stop(g *Generator) error {
+	labels := make(map[string]string, len(g.labels))
+	for k, v := range g.labels {
+		labels[string(k)] = string(v)
+	}
+	if err := m.write(&FileRecord{
+		Type:      FileRecordGenerator,
+		GenName:   g.Cfg.GenName,
+		Timestamp: time.Now(),
+		Stats:     g.StatsJSON(),
+		Config:    g.Cfg,
+		Labels:    labels,
+		Latencies: g.stats.Latencies.Snapshot(),
+		Capacity:  g.CapacityResult(),
+	}); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active--
+	if m.active > 0 {
+		return nil
+	}
+	return m.close()
+}
+
+// Close flushes and closes the file, use it if some registered generators were never run.
+func (m *FileSink) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.close()
+}
+
+func (m *FileSink) close() error {
+	if m.enc == nil {
+		return nil
+	}
+	m.enc = nil
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	if m.gz != nil {
+		if err := m.gz.Close(); err != nil {
+			return err
+		}
+	}
+	return m.file.Close()
+}
+
+// FileResults are the results of all generators loaded from a results file
+type FileResults struct {
+	// TestName is the go_test_name label of the generators, if they were run in a test
+	TestName string
+	Results  map[string]*GeneratorResults
+}
+
+// GeneratorResults are the results of a single generator loaded from a results file
+type GeneratorResults struct {
+	Config *Config
+	Labels map[string]string
+	// Data contains all the responses written to the file, buffers are sized to fit them
+	Data *ResponseData
+	// Stats are the periodic stats snapshots, the last one is the final stats
+	Stats     []map[string]interface{}
+	Latencies *LatencySnapshot
+	// Capacity is the result of the capacity search, if the generator was run with CapacitySearch
+	Capacity *CapacityResult
+}
+
+// LoadResultsFile reads a results file written by FileSink, compressed or not, and rebuilds results of all generators.
+func LoadResultsFile(path string) (*FileResults, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	// gzip magic bytes
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	res := &FileResults{Results: make(map[string]*GeneratorResults)}
+	ok := make(map[string][]*Response)
+	failed := make(map[string][]*Response)
+	getGen := func(name string) *GeneratorResults {
+		if _, exists := res.Results[name]; !exists {
+			res.Results[name] = &GeneratorResults{}
+		}
+		return res.Results[name]
+	}
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var rec FileRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode results file %s record %d: %w", path, line, err)
+		}
+		gr := getGen(rec.GenName)
+		switch rec.Type {
+		case FileRecordResponse:
+			if rec.Response == nil {
+				continue
+			}
+			if rec.Response.Failed || rec.Response.Timeout {
+				failed[rec.GenName] = append(failed[rec.GenName], rec.Response)
+			} else {
+				ok[rec.GenName] = append(ok[rec.GenName], rec.Response)
+			}
+		case FileRecordStats:
+			gr.Stats = append(gr.Stats, rec.Stats)
+		case FileRecordGenerator:
+			gr.Config = rec.Config
+			gr.Labels = rec.Labels
+			gr.Latencies = rec.Latencies
+			gr.Capacity = rec.Capacity
+			gr.Stats = append(gr.Stats, rec.Stats)
+			if res.TestName == "" {
+				res.TestName = rec.Labels["go_test_name"]
+			}
+		default:
+			return nil, fmt.Errorf("unknown record type %q in results file %s, record %d", rec.Type, path, line)
+		}
+	}
+
+	for name, gr := range res.Results {
+		if gr.Config == nil {
+			return nil, fmt.Errorf("results file %s has no final record for generator %s, was it stopped?", path, name)
+		}
+		gr.Data = newResponseDataFromResponses(ok[name], failed[name])
+	}
+	return res, nil
+}
+
+func newResponseDataFromResponses(ok, failed []*Response) *ResponseData {
+	// SliceBuffer overwrites the oldest items when capacity is reached, capacity 0 would keep only the last item
+	rd := &ResponseData{
+		okDataMu:        &sync.Mutex{},
+		OKData:          NewSliceBuffer[any](max(len(ok), 1)),
+		okResponsesMu:   &sync.Mutex{},
+		OKResponses:     NewSliceBuffer[*Response](max(len(ok), 1)),
+		failResponsesMu: &sync.Mutex{},
+		FailResponses:   NewSliceBuffer[*Response](max(len(failed), 1)),
+	}
+	for _, r := range ok {
+		rd.OKData.Append(r.Data)
+		rd.OKResponses.Append(r)
+	}
+	for _, r := range failed {
+		rd.FailResponses.Append(r)
+	}
+	return rd
+}
+
+// Generator returns a generator rebuilt from the results, it can't be run,
+// but GetData, Stats and Cfg can be used for analysis the same way as after a real run.
+func (m *GeneratorResults) Generator() *Generator {
+	cfg := *m.Config
+	cfg.Labels = m.Labels
+	stats := &Stats{Latencies: NewLatencyHistogram()}
+	if m.Latencies != nil {
+		stats.Latencies = NewLatencyHistogramFromSnapshot(m.Latencies)
+	}
+	if len(m.Stats) > 0 {
+		final := m.Stats[len(m.Stats)-1]
+		num := func(key string) int64 {
+			if v, ok := final[key].(float64); ok {
+				return int64(v)
+			}
+			return 0
+		}
+		flag := func(key string) bool {
+			v, _ := final[key].(bool)
+			return v
+		}
+		stats.CurrentRPS.Store(num("current_rps"))
+		stats.CurrentVUs.Store(num("current_instances"))
+		stats.SamplesRecorded.Store(num("samples_recorded"))
+		stats.SamplesSkipped.Store(num("samples_skipped"))
+		stats.RunStopped.Store(flag("run_stopped"))
+		stats.RunFailed.Store(flag("run_failed"))
+		stats.Success.Store(num("success"))
+		stats.Failed.Store(num("failed"))
+		stats.CallTimeout.Store(num("callTimeout"))
+		stats.ArrivalsSkipped.Store(num("arrivals_skipped"))
+		stats.Duration = num("load_duration")
+		stats.CurrentTimeUnit = num("current_time_unit")
+	}
+	labels := LabelsMapToModel(m.Labels)
+	g := &Generator{
+		Cfg:           &cfg,
+		Log:           GetLogger(nil, cfg.GenName),
+		labels:        labels,
+		responsesData: m.Data,
+		stats:         stats,
+		errsMu:        &sync.Mutex{},
+		errs:          NewSliceBuffer[string](1),
+	}
+	g.capacityResult.Store(m.Capacity)
+	return g
+}
+
+// Generators returns read-only generators rebuilt from all the results in the file, sorted by name.
+func (m *FileResults) Generators() []*Generator {
+	names := make([]string, 0, len(m.Results))
+	for name := range m.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gens := make([]*Generator, 0, len(names))
+	for _, name := range names {
+		gens = append(gens, m.Results[name].Generator())
+	}
+	return gens
+}
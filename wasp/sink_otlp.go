@@ -0,0 +1,253 @@
+package wasp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOTLPServiceName   = "wasp"
+	DefaultOTLPBatchSize     = 512
+	DefaultOTLPFlushInterval = 5 * time.Second
+	DefaultOTLPTimeout       = 10 * time.Second
+)
+
+// OTLP span kind and status codes
+const (
+	otlpSpanKindClient  = 3
+	otlpStatusCodeOK    = 1
+	otlpStatusCodeError = 2
+)
+
+// OTLPSinkConfig is the configuration of the OTLP traces sink
+type OTLPSinkConfig struct {
+	// Endpoint is the OTLP/HTTP traces endpoint, ex.: http://localhost:4318/v1/traces
+	Endpoint string
+	// ServiceName is the service.name resource attribute, DefaultOTLPServiceName if not set
+	ServiceName string
+	// Headers are added to every export request, ex.: authorization
+	Headers map[string]string
+	// BatchSize is the number of spans exported at once, DefaultOTLPBatchSize if not set
+	BatchSize int
+	// FlushInterval is the longest time spans are buffered, DefaultOTLPFlushInterval if not set
+	FlushInterval time.Duration
+	// Client is used for export requests, a client with DefaultOTLPTimeout if not set
+	Client *http.Client
+}
+
+// OTLPSink is a ResultsSink that exports every sampled traced Response as a client span in OTLP/HTTP JSON format,
+// so a slow call can be opened in a tracing backend together with the server side spans, see Config.Tracing.
+// Responses without a trace ID are ignored.
+type OTLPSink struct {
+	cfg       *OTLPSinkConfig
+	mu        *sync.Mutex
+	spans     []*otlpSpan
+	lastFlush time.Time
+}
+
+// NewOTLPSink creates an OTLP traces sink, it can be shared between several generators or a Profile.
+func NewOTLPSink(cfg *OTLPSinkConfig) (*OTLPSink, error) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return nil, fmt.Errorf("OTLP sink endpoint must be provided")
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultOTLPServiceName
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultOTLPBatchSize
+	}
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = DefaultOTLPFlushInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultOTLPTimeout}
+	}
+	return &OTLPSink{
+		cfg:       cfg,
+		mu:        &sync.Mutex{},
+		spans:     make([]*otlpSpan, 0, cfg.BatchSize),
+		lastFlush: time.Now(),
+	}, nil
+}
+
+// Register does nothing, spans are exported with the generator name attribute.
+func (m *OTLPSink) Register(_ *Generator) error {
+	return nil
+}
+
+// HandleResponse buffers a client span of the call and exports the batch when it's full.
+func (m *OTLPSink) HandleResponse(g *Generator, r *Response) error {
+	if r.TraceID == "" || r.SpanID == "" {
+		return nil
+	}
+	m.mu.Lock()
+	m.spans = append(m.spans, newOTLPSpan(g, r))
+	full := len(m.spans) >= m.cfg.BatchSize
+	m.mu.Unlock()
+	if full {
+		return m.Flush()
+	}
+	return nil
+}
+
+// HandleStats exports the buffered spans if FlushInterval has passed since the last export.
+func (m *OTLPSink) HandleStats(_ *Generator, _ map[string]interface{}) error {
+	m.mu.Lock()
+	due := time.Since(m.lastFlush) >= m.cfg.FlushInterval
+	m.mu.Unlock()
+	if due {
+		return m.Flush()
+	}
+	return nil
+}
+
+// Stop exports the buffered spans.
+func (m *OTLPSink) Stop(_ *Generator) error {
+	return m.Flush()
+}
+
+// Flush exports all the buffered spans.
+func (m *OTLPSink) Flush() error {
+	m.mu.Lock()
+	spans := m.spans
+	m.spans = make([]*otlpSpan, 0, m.cfg.BatchSize)
+	m.lastFlush = time.Now()
+	m.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	return m.export(spans)
+}
+
+func (m *OTLPSink) export(spans []*otlpSpan) error {
+	body, err := json.Marshal(&otlpTracesRequest{
+		ResourceSpans: []*otlpResourceSpans{{
+			Resource: &otlpResource{Attributes: []*otlpAttribute{otlpString("service.name", m.cfg.ServiceName)}},
+			ScopeSpans: []*otlpScopeSpans{{
+				Scope: &otlpScope{Name: "wasp"},
+				Spans: spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to export %d spans, OTLP endpoint returned %d: %s", len(spans), resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// newOTLPSpan creates a client span of the call, it ends when the response was recorded
+func newOTLPSpan(g *Generator, r *Response) *otlpSpan {
+	end := time.Now()
+	if r.FinishedAt != nil {
+		end = *r.FinishedAt
+	}
+	start := end.Add(-r.Duration)
+	name := r.Group
+	if name == "" {
+		name = g.Cfg.GenName
+	}
+	attrs := []*otlpAttribute{otlpString("wasp.gen_name", g.Cfg.GenName)}
+	if r.Group != "" {
+		attrs = append(attrs, otlpString("wasp.call_group", r.Group))
+	}
+	if r.Path != "" {
+		attrs = append(attrs, otlpString("wasp.path", r.Path))
+	}
+	if r.StatusCode != "" {
+		attrs = append(attrs, otlpString("wasp.status_code", r.StatusCode))
+	}
+	if r.Timeout {
+		attrs = append(attrs, &otlpAttribute{Key: "wasp.timeout", Value: &otlpValue{BoolValue: &r.Timeout}})
+	}
+	status := &otlpStatus{Code: otlpStatusCodeOK}
+	if r.Failed || r.Timeout {
+		status = &otlpStatus{Code: otlpStatusCodeError, Message: r.Error}
+	}
+	return &otlpSpan{
+		TraceID:           r.TraceID,
+		SpanID:            r.SpanID,
+		Name:              name,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        attrs,
+		Status:            status,
+	}
+}
+
+func otlpString(k, v string) *otlpAttribute {
+	return &otlpAttribute{Key: k, Value: &otlpValue{StringValue: &v}}
+}
+
+// OTLP/HTTP JSON encoding of ExportTraceServiceRequest, IDs are hex encoded and 64 bit integers are strings
+
+type otlpTracesRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   *otlpResource     `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope *otlpScope  `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes"`
+	Status            *otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string     `json:"key"`
+	Value *otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
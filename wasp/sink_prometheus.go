@@ -0,0 +1,228 @@
+package wasp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultPrometheusSinkPath = "/metrics"
+)
+
+// DefaultPrometheusLatencyBuckets are the upper bounds in seconds of the exported call latency histogram, 1ms to ~32s
+var DefaultPrometheusLatencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 16)
+
+// PrometheusSinkConfig is the configuration of the Prometheus /metrics exporter
+type PrometheusSinkConfig struct {
+	// ListenAddr is the address to serve metrics on, ex.: ":2112", if empty no server is started, use Handler() instead
+	ListenAddr string
+	// Path is the HTTP path metrics are served on, DefaultPrometheusSinkPath if empty
+	Path string
+	// LatencyBuckets are the latency histogram buckets in seconds, DefaultPrometheusLatencyBuckets if empty
+	LatencyBuckets []float64
+}
+
+// PrometheusSink is a ResultsSink that exposes generators stats and latency histograms on a Prometheus /metrics endpoint.
+// Metrics are computed from live Stats on every scrape, so they are never sampled and cost nothing between scrapes.
+type PrometheusSink struct {
+	cfg        *PrometheusSinkConfig
+	mu         *sync.Mutex
+	generators []*Generator
+	registry   *prometheus.Registry
+	handler    http.Handler
+	server     *http.Server
+	serverOnce *sync.Once
+}
+
+// NewPrometheusSink creates a Prometheus sink, it can be shared between several generators or a Profile.
+func NewPrometheusSink(cfg *PrometheusSinkConfig) *PrometheusSink {
+	if cfg == nil {
+		cfg = &PrometheusSinkConfig{}
+	}
+	if cfg.Path == "" {
+		cfg.Path = DefaultPrometheusSinkPath
+	}
+	if len(cfg.LatencyBuckets) == 0 {
+		cfg.LatencyBuckets = DefaultPrometheusLatencyBuckets
+	}
+	s := &PrometheusSink{
+		cfg:        cfg,
+		mu:         &sync.Mutex{},
+		registry:   prometheus.NewRegistry(),
+		serverOnce: &sync.Once{},
+	}
+	s.registry.MustRegister(s)
+	s.handler = promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+	return s
+}
+
+// Handler returns an http.Handler serving metrics of all registered generators.
+// Use it to mount metrics on your own server.
+func (m *PrometheusSink) Handler() http.Handler {
+	return m.handler
+}
+
+// Register adds the generator to the exporter and starts the metrics server if ListenAddr is set.
+func (m *PrometheusSink) Register(g *Generator) error {
+	m.mu.Lock()
+	m.generators = append(m.generators, g)
+	m.mu.Unlock()
+	if m.cfg.ListenAddr == "" {
+		return nil
+	}
+	m.serverOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.Handle(m.cfg.Path, m.handler)
+		m.server = &http.Server{
+			Addr:              m.cfg.ListenAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Err(err).Str("Addr", m.cfg.ListenAddr).Msg("Prometheus sink server failed")
+			}
+		}()
+	})
+	return nil
+}
+
+// HandleResponse does nothing, latencies are exported from the generator's LatencyHistogram which is never sampled.
+func (m *PrometheusSink) HandleResponse(_ *Generator, _ *Response) error {
+	return nil
+}
+
+// HandleStats does nothing, stats are read from the generator on every scrape.
+func (m *PrometheusSink) HandleStats(_ *Generator, _ map[string]interface{}) error {
+	return nil
+}
+
+// Stop does nothing, the server keeps serving final values so the last scrape is not lost, use Shutdown to stop it.
+func (m *PrometheusSink) Stop(_ *Generator) error {
+	return nil
+}
+
+// Shutdown gracefully stops the metrics server if it was started.
+func (m *PrometheusSink) Shutdown(ctx context.Context) error {
+	if m.server == nil {
+		return nil
+	}
+	return m.server.Shutdown(ctx)
+}
+
+// Describe implements prometheus.Collector, label sets depend on generators, so the collector is unchecked.
+func (m *PrometheusSink) Describe(_ chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (m *PrometheusSink) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	gens := make([]*Generator, len(m.generators))
+	copy(gens, m.generators)
+	m.mu.Unlock()
+
+	// every metric family must have the same label names, so we use a union of all generators labels
+	labelNames := prometheusLabelNames(gens)
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, labelNames, nil)
+	}
+	var (
+		rpsDesc      = desc("wasp_current_rps", "Current RPS of the generator")
+		vusDesc      = desc("wasp_current_vus", "Current amount of VUs of the generator")
+		pausedDesc   = desc("wasp_run_paused", "1 if the generator is paused")
+		failedDesc   = desc("wasp_run_failed", "1 if the generator run has failed")
+		successDesc  = desc("wasp_calls_success_total", "Total amount of successful calls")
+		errorsDesc   = desc("wasp_calls_failed_total", "Total amount of failed calls")
+		timeoutsDesc = desc("wasp_calls_timeout_total", "Total amount of timed out calls")
+		recordedDesc = desc("wasp_samples_recorded_total", "Total amount of recorded call results")
+		skippedDesc  = desc("wasp_samples_skipped_total", "Total amount of call results skipped by the sampler")
+		latencyDesc  = prometheus.NewDesc(
+			"wasp_call_duration_seconds",
+			"Call latency histogram by call group",
+			append(append([]string{}, labelNames...), CallGroupLabel),
+			nil,
+		)
+	)
+	for _, g := range gens {
+		lv := prometheusLabelValues(g, labelNames)
+		st := g.Stats()
+		ch <- prometheus.MustNewConstMetric(rpsDesc, prometheus.GaugeValue, float64(st.CurrentRPS.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(vusDesc, prometheus.GaugeValue, float64(st.CurrentVUs.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(pausedDesc, prometheus.GaugeValue, boolToFloat(st.RunPaused.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(failedDesc, prometheus.GaugeValue, boolToFloat(st.RunFailed.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(successDesc, prometheus.CounterValue, float64(st.Success.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(st.Failed.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(timeoutsDesc, prometheus.CounterValue, float64(st.CallTimeout.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(recordedDesc, prometheus.CounterValue, float64(st.SamplesRecorded.Load()), lv...)
+		ch <- prometheus.MustNewConstMetric(skippedDesc, prometheus.CounterValue, float64(st.SamplesSkipped.Load()), lv...)
+		if st.Latencies == nil {
+			continue
+		}
+		for group, snap := range st.Latencies.Snapshot().Groups {
+			count, sum, buckets := prometheusBuckets(hdrhistogram.Import(snap), m.cfg.LatencyBuckets)
+			ch <- prometheus.MustNewConstHistogram(latencyDesc, count, sum, buckets, append(lv, group)...)
+		}
+	}
+}
+
+// prometheusBuckets converts an HDR histogram recorded in microseconds into cumulative Prometheus buckets in seconds.
+func prometheusBuckets(h *hdrhistogram.Histogram, bounds []float64) (uint64, float64, map[float64]uint64) {
+	buckets := make(map[float64]uint64, len(bounds))
+	for _, b := range bounds {
+		buckets[b] = 0
+	}
+	for _, bar := range h.Distribution() {
+		if bar.Count == 0 {
+			continue
+		}
+		v := float64(bar.To) / 1e6
+		for _, b := range bounds {
+			if v <= b {
+				buckets[b] += uint64(bar.Count)
+			}
+		}
+	}
+	count := uint64(h.TotalCount())
+	sum := h.Mean() * float64(count) / 1e6
+	return count, sum, buckets
+}
+
+func prometheusLabelNames(gens []*Generator) []string {
+	uniq := make(map[string]struct{})
+	for _, g := range gens {
+		for k := range g.labels {
+			uniq[string(k)] = struct{}{}
+		}
+	}
+	delete(uniq, CallGroupLabel)
+	names := make([]string, 0, len(uniq))
+	for k := range uniq {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func prometheusLabelValues(g *Generator, names []string) []string {
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = string(g.labels[model.LabelName(n)])
+	}
+	return values
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
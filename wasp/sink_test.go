@@ -0,0 +1,154 @@
+package wasp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu         *sync.Mutex
+	registered int
+	responses  []*Response
+	stats      []map[string]interface{}
+	stopped    int
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{mu: &sync.Mutex{}}
+}
+
+func (m *recordingSink) Register(_ *Generator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.registered++
+	return nil
+}
+
+func (m *recordingSink) HandleResponse(_ *Generator, r *Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = append(m.responses, r)
+	return nil
+}
+
+func (m *recordingSink) HandleStats(_ *Generator, stats map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = append(m.stats, stats)
+	return nil
+}
+
+func (m *recordingSink) Stop(_ *Generator) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped++
+	return nil
+}
+
+func TestSmokeResultsSink(t *testing.T) {
+	t.Parallel()
+	sink := newRecordingSink()
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: 200 * time.Millisecond,
+		Schedule:          Plain(5, 1*time.Second),
+		Sinks:             []ResultsSink{sink},
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.Equal(t, false, failed)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	require.Equal(t, 1, sink.registered)
+	require.Equal(t, 1, sink.stopped)
+	require.Equal(t, int(gen.Stats().SamplesRecorded.Load()), len(sink.responses))
+	require.Equal(t, "successCallData", sink.responses[0].Data)
+	require.NotEmpty(t, sink.stats)
+	// final stats are sent after all the responses are processed
+	require.Equal(t, gen.Stats().Success.Load(), sink.stats[len(sink.stats)-1]["success"])
+}
+
+func TestSmokePrometheusSink(t *testing.T) {
+	t.Parallel()
+	sink := NewPrometheusSink(nil)
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		GenName:           "prom_gen",
+		LoadType:          RPS,
+		StatsPollInterval: 1 * time.Second,
+		Schedule:          Plain(5, 1*time.Second),
+		Sinks:             []ResultsSink{sink},
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.Equal(t, false, failed)
+
+	srv := httptest.NewServer(sink.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	metrics := string(body)
+
+	require.Contains(t, metrics, `wasp_current_rps{gen_name="prom_gen",go_test_name="TestSmokePrometheusSink"} 5`)
+	require.Contains(t, metrics, `wasp_calls_failed_total{gen_name="prom_gen",go_test_name="TestSmokePrometheusSink"} 0`)
+	require.Contains(t, metrics, `wasp_calls_success_total{gen_name="prom_gen",go_test_name="TestSmokePrometheusSink"}`)
+	require.Contains(t, metrics, `wasp_call_duration_seconds_bucket{call_group="",gen_name="prom_gen",go_test_name="TestSmokePrometheusSink",le="0.016"}`)
+	require.Contains(t, metrics, `wasp_call_duration_seconds_count{call_group="",gen_name="prom_gen",go_test_name="TestSmokePrometheusSink"}`)
+}
+
+func TestSmokeFileSink(t *testing.T) {
+	t.Parallel()
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "results.ndjson")
+		sink, err := NewFileSink(&FileSinkConfig{Path: path, Compress: compress})
+		require.NoError(t, err)
+		gen, err := NewGenerator(&Config{
+			T:                 t,
+			GenName:           "file_gen",
+			LoadType:          RPS,
+			StatsPollInterval: 200 * time.Millisecond,
+			Schedule:          Plain(10, 1*time.Second),
+			Sinks:             []ResultsSink{sink},
+			Gun: NewMockGun(&MockGunConfig{
+				FailRatio: 20,
+				CallSleep: 10 * time.Millisecond,
+			}),
+		})
+		require.NoError(t, err)
+		_, _ = gen.Run(true)
+
+		results, err := LoadResultsFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "TestSmokeFileSink", results.TestName)
+		require.Len(t, results.Results, 1)
+		gr := results.Results["file_gen"]
+		require.NotEmpty(t, gr.Stats)
+		require.Equal(t, len(gen.GetData().OKResponses.Data), len(gr.Data.OKResponses.Data))
+		require.Equal(t, len(gen.GetData().FailResponses.Data), len(gr.Data.FailResponses.Data))
+		require.Equal(t, gen.GetData().OKData.Data[0], gr.Data.OKData.Data[0])
+		require.Equal(t, gen.Cfg.Schedule[0].StartTime.UnixNano(), gr.Config.Schedule[0].StartTime.UnixNano())
+
+		replayed := results.Generators()[0]
+		require.Equal(t, gen.Stats().Success.Load(), replayed.Stats().Success.Load())
+		require.Equal(t, gen.Stats().Failed.Load(), replayed.Stats().Failed.Load())
+		require.Equal(t, gen.Stats().Latencies.Percentiles(), replayed.Stats().Latencies.Percentiles())
+	}
+}
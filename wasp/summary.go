@@ -0,0 +1,87 @@
+package wasp
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// PrintSummary writes a table with call counts and latency percentiles of every generator in the profile.
+// Use it after the run to get a quick overview without dashboards.
+func (m *Profile) PrintSummary(w io.Writer) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Generator", "Load type", "Success", "Failed", "Timeouts", "P50", "P95", "P99", "Max", "Run failed"})
+	for _, g := range m.Generators {
+		st := g.Stats()
+		var p LatencyPercentiles
+		if st.Latencies != nil {
+			p = st.Latencies.Percentiles()
+		}
+		table.Append([]string{
+			g.Cfg.GenName,
+			string(g.Cfg.LoadType),
+			fmt.Sprint(st.Success.Load()),
+			fmt.Sprint(st.Failed.Load()),
+			fmt.Sprint(st.CallTimeout.Load()),
+			p.P50.String(),
+			p.P95.String(),
+			p.P99.String(),
+			p.Max.String(),
+			fmt.Sprint(st.RunFailed.Load()),
+		})
+	}
+	table.SetBorder(true)
+	table.SetRowLine(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+	for _, g := range m.Generators {
+		if res := g.CapacityResult(); res != nil {
+			fmt.Fprintf(w, "Capacity of %s: max rate %d, %d step(s), completed: %t\n", g.Cfg.GenName, res.MaxRate, len(res.Steps), res.Completed)
+		}
+	}
+	if err := m.Aborted(); err != nil {
+		fmt.Fprintf(w, "Aborted: %s\n", err)
+	}
+}
+
+// PrintSummary writes a table with call counts and latency percentiles of every generator aggregated across the agents,
+// and a table with the state of every agent.
+func (m *DistributedStats) PrintSummary(w io.Writer) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Generator", "Load type", "Success", "Failed", "Timeouts", "P50", "P95", "P99", "Max", "Run failed"})
+	for _, g := range m.Generators {
+		var p LatencyPercentiles
+		if g.Latencies != nil {
+			p = g.Latencies.Percentiles()
+		}
+		table.Append([]string{
+			g.Name,
+			string(g.LoadType),
+			fmt.Sprint(g.Success),
+			fmt.Sprint(g.Failed),
+			fmt.Sprint(g.CallTimeout),
+			p.P50.String(),
+			p.P95.String(),
+			p.P99.String(),
+			p.Max.String(),
+			fmt.Sprint(g.RunFailed),
+		})
+	}
+	table.SetBorder(true)
+	table.SetRowLine(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+
+	agents := tablewriter.NewWriter(w)
+	agents.SetHeader([]string{"Agent", "ID", "State", "Error"})
+	for _, a := range m.Agents {
+		if a == nil {
+			continue
+		}
+		agents.Append([]string{a.Addr, a.ID, string(a.State), a.Error})
+	}
+	agents.SetBorder(true)
+	agents.SetAlignment(tablewriter.ALIGN_LEFT)
+	agents.Render()
+}
@@ -0,0 +1,113 @@
+package wasp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TraceparentHeader is the W3C trace context header, it's also used as gRPC metadata key
+const TraceparentHeader = "traceparent"
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceContext is a W3C trace context of a single call, see https://www.w3.org/TR/trace-context/
+// With Config.Tracing every call gets a new trace, use TraceFromContext in CallContext to propagate it to the system under test.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// NewTraceContext creates a sampled trace with random trace and span IDs.
+func NewTraceContext() *TraceContext {
+	return &TraceContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+}
+
+// NewSpan creates another span of the same trace, ex.: every step of a scenario iteration.
+func (m *TraceContext) NewSpan() *TraceContext {
+	return &TraceContext{TraceID: m.TraceID, SpanID: randomHex(8), Sampled: m.Sampled}
+}
+
+// Traceparent returns the traceparent header value.
+func (m *TraceContext) Traceparent() string {
+	flags := "00"
+	if m.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", m.TraceID, m.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value, only version 00 is supported.
+func ParseTraceparent(s string) (*TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return nil, errors.Wrap(ErrInvalidTraceparent, s)
+	}
+	if !validTraceID(parts[1], 16) || !validTraceID(parts[2], 8) || !validTraceID(parts[3], 1) {
+		return nil, errors.Wrap(ErrInvalidTraceparent, s)
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return &TraceContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}, nil
+}
+
+// validTraceID checks that s is n lowercase hex encoded bytes, IDs must not be all zeros, flags can be
+func validTraceID(s string, n int) bool {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return false
+	}
+	if n == 1 {
+		return true
+	}
+	for _, v := range b {
+		if v != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context.
+func ContextWithTrace(ctx context.Context, tc *TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace context of the call or nil if tracing is disabled, see Config.Tracing.
+func TraceFromContext(ctx context.Context) *TraceContext {
+	tc, _ := ctx.Value(traceContextKey{}).(*TraceContext)
+	return tc
+}
+
+// InjectTraceparent sets the traceparent header of an outgoing request if ctx carries a trace context.
+func InjectTraceparent(ctx context.Context, h http.Header) {
+	if tc := TraceFromContext(ctx); tc != nil {
+		h.Set(TraceparentHeader, tc.Traceparent())
+	}
+}
+
+// SetTrace records the trace and span IDs on the response, nothing is set if tc is nil.
+func (m *Response) SetTrace(tc *TraceContext) {
+	if tc == nil {
+		return
+	}
+	m.TraceID = tc.TraceID
+	m.SpanID = tc.SpanID
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	//nolint
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,250 @@
+package wasp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// otlpCollectorMock is a stand-in for an OTLP/HTTP collector, it records all the exported spans
+func otlpCollectorMock(t *testing.T) (*httptest.Server, func() []*otlpSpan) {
+	mu := &sync.Mutex{}
+	spans := make([]*otlpSpan, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req := &otlpTracesRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		//nolint
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []*otlpSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*otlpSpan{}, spans...)
+	}
+}
+
+func TestSmokeTraceparent(t *testing.T) {
+	t.Parallel()
+	tc := NewTraceContext()
+	require.Len(t, tc.TraceID, 32)
+	require.Len(t, tc.SpanID, 16)
+	require.True(t, tc.Sampled)
+	require.NotEqual(t, tc.TraceID, NewTraceContext().TraceID)
+
+	parsed, err := ParseTraceparent(tc.Traceparent())
+	require.NoError(t, err)
+	require.Equal(t, tc, parsed)
+
+	span := tc.NewSpan()
+	require.Equal(t, tc.TraceID, span.TraceID)
+	require.NotEqual(t, tc.SpanID, span.SpanID)
+
+	parsed, err = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.NoError(t, err)
+	require.Equal(t, &TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, parsed)
+
+	for _, invalid := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		require.ErrorIs(t, err, ErrInvalidTraceparent, invalid)
+	}
+
+	require.Nil(t, TraceFromContext(context.Background()))
+	h := http.Header{}
+	InjectTraceparent(context.Background(), h)
+	require.Empty(t, h.Get(TraceparentHeader))
+	InjectTraceparent(ContextWithTrace(context.Background(), tc), h)
+	require.Equal(t, tc.Traceparent(), h.Get(TraceparentHeader))
+}
+
+func TestSmokeTracingHTTPGunOTLP(t *testing.T) {
+	t.Parallel()
+	mu := &sync.Mutex{}
+	received := make(map[string]*TraceContext)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, err := ParseTraceparent(r.Header.Get(TraceparentHeader))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[tc.TraceID] = tc
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		//nolint
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(target.Close)
+	collector, spans := otlpCollectorMock(t)
+	sink, err := NewOTLPSink(&OTLPSinkConfig{Endpoint: collector.URL + "/v1/traces", ServiceName: "checkout", BatchSize: 7})
+	require.NoError(t, err)
+
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		GenName:  "traced",
+		LoadType: RPS,
+		Schedule: Plain(20, time.Second),
+		Gun:      NewHTTPMockGun(&MockHTTPGunConfig{TargetURL: target.URL}),
+		Tracing:  true,
+		Sinks:    []ResultsSink{sink},
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+
+	responses := gen.GetData().OKResponses.Data
+	require.GreaterOrEqual(t, len(responses), 18)
+	exported := make(map[string]*otlpSpan)
+	for _, s := range spans() {
+		exported[s.TraceID] = s
+	}
+	require.Len(t, exported, len(responses))
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range responses {
+		// the system under test got the same trace and span as recorded
+		tc, ok := received[r.TraceID]
+		require.True(t, ok, r.TraceID)
+		require.Equal(t, tc.SpanID, r.SpanID)
+		s := exported[r.TraceID]
+		require.Equal(t, r.SpanID, s.SpanID)
+		require.Equal(t, "traced", s.Name)
+		require.Equal(t, otlpSpanKindClient, s.Kind)
+		require.Equal(t, otlpStatusCodeOK, s.Status.Code)
+		require.Less(t, s.StartTimeUnixNano, s.EndTimeUnixNano)
+	}
+
+	// a failing collector is reported by the sink
+	broken, err := NewOTLPSink(&OTLPSinkConfig{Endpoint: collector.URL + "/wrong"})
+	require.NoError(t, err)
+	require.NoError(t, broken.HandleResponse(gen, responses[0]))
+	require.ErrorContains(t, broken.Flush(), "returned 400")
+	_, err = NewOTLPSink(&OTLPSinkConfig{})
+	require.Error(t, err)
+}
+
+func TestSmokeTracingDisabled(t *testing.T) {
+	t.Parallel()
+	traced := make(chan bool, 100)
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Plain(10, time.Second),
+		Gun: GunFromContext(contextGunFunc(func(ctx context.Context, _ *Generator) *Response {
+			select {
+			case traced <- TraceFromContext(ctx) != nil:
+			default:
+			}
+			return &Response{}
+		})),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	require.False(t, <-traced)
+	for _, r := range gen.GetData().OKResponses.Data {
+		require.Empty(t, r.TraceID)
+	}
+}
+
+// contextGunFunc is a ContextGun made of a function
+type contextGunFunc func(ctx context.Context, l *Generator) *Response
+
+func (f contextGunFunc) CallContext(ctx context.Context, l *Generator) *Response {
+	return f(ctx, l)
+}
+
+func TestSmokeTracingScenario(t *testing.T) {
+	t.Parallel()
+	step := func(ctx context.Context, _ *ScenarioContext) (interface{}, error) {
+		tc := TraceFromContext(ctx)
+		if tc == nil {
+			return nil, errNoTrace
+		}
+		return tc.SpanID, nil
+	}
+	vu, err := NewScenario().
+		Step(&ScenarioStep{Name: "login", Fn: step}).
+		Step(&ScenarioStep{Name: "buy", Fn: step}).
+		VU()
+	require.NoError(t, err)
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: VU,
+		Schedule: Plain(2, time.Second),
+		VU:       vu,
+		Tracing:  true,
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+
+	traces := make(map[string][]*Response)
+	for _, r := range gen.GetData().OKResponses.Data {
+		require.Equal(t, r.SpanID, r.Data)
+		traces[r.TraceID] = append(traces[r.TraceID], r)
+	}
+	require.Greater(t, len(traces), 10)
+	for _, steps := range traces {
+		// the last iteration of a VU may be interrupted after the first step
+		require.LessOrEqual(t, len(steps), 2)
+		if len(steps) == 2 {
+			require.ElementsMatch(t, []string{"login", "buy"}, []string{steps[0].Group, steps[1].Group})
+			require.NotEqual(t, steps[0].SpanID, steps[1].SpanID)
+		}
+	}
+}
+
+var errNoTrace = errors.New("no trace")
+
+func TestSmokeTracingProfileConfig(t *testing.T) {
+	t.Parallel()
+	collector, _ := otlpCollectorMock(t)
+	cfg := &ProfileConfig{
+		Name:         "traced",
+		OTLPEndpoint: collector.URL + "/v1/traces",
+		Generators: []*GeneratorConfig{{
+			Name:     "rps_gen",
+			LoadType: "rps",
+			Gun:      "mock",
+			Schedule: []*SegmentConfig{{Type: "plain", From: 1, Duration: "1s"}},
+		}},
+	}
+	p, err := cfg.NewProfile(t)
+	require.NoError(t, err)
+	require.True(t, p.Generators[0].Cfg.Tracing)
+	require.Len(t, p.Generators[0].Cfg.Sinks, 1)
+	sink, ok := p.Generators[0].Cfg.Sinks[0].(*OTLPSink)
+	require.True(t, ok)
+	require.Equal(t, "traced", sink.cfg.ServiceName)
+}
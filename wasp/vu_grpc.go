@@ -0,0 +1,159 @@
+package wasp
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GRPCVU is a virtual user making gRPC calls. For bidi streaming methods every VU keeps its own stream open,
+// and every Call sends the next message of Requests and waits for a single response.
+// Other methods make a new call on every iteration, like GRPCGun.
+// All the clones share the same connection pool.
+type GRPCVU struct {
+	*VUControl
+	client       *grpcClient
+	stream       grpc.ClientStream
+	streamCancel context.CancelFunc
+	sent         int
+}
+
+// NewGRPCVU connects to the target and resolves the method, from GRPCConfig.Files or with server reflection.
+// Call Close when the generator is finished to close the connections.
+func NewGRPCVU(cfg *GRPCConfig) (*GRPCVU, error) {
+	c, err := newGRPCClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCVU{
+		VUControl: NewVUControl(),
+		client:    c,
+	}, nil
+}
+
+// Clone creates a new virtual user sharing the connection pool.
+func (m *GRPCVU) Clone(_ *Generator) VirtualUser {
+	return &GRPCVU{
+		VUControl: NewVUControl(),
+		client:    m.client,
+	}
+}
+
+func (m *GRPCVU) bidi() bool {
+	return m.client.method.IsStreamingClient() && m.client.method.IsStreamingServer()
+}
+
+// Setup opens the stream for bidi streaming methods.
+func (m *GRPCVU) Setup(l *Generator) error {
+	if !m.bidi() {
+		return nil
+	}
+	if err := m.openStream(); err != nil {
+		l.Log.Error().Err(err).Str("Method", m.client.fullMethod).Msg("failed to open grpc stream from virtual user")
+		return err
+	}
+	return nil
+}
+
+func (m *GRPCVU) openStream() error {
+	ctx, cancel := context.WithCancel(m.client.outgoingContext(context.Background()))
+	stream, err := m.client.pool.Conn().NewStream(ctx, m.client.streamDesc(), m.client.fullMethod)
+	if err != nil {
+		cancel()
+		return err
+	}
+	m.stream = stream
+	m.streamCancel = cancel
+	return nil
+}
+
+func (m *GRPCVU) closeStream() error {
+	if m.stream == nil {
+		return nil
+	}
+	err := m.stream.CloseSend()
+	m.streamCancel()
+	m.stream = nil
+	return err
+}
+
+// Teardown closes the stream of bidi streaming methods.
+func (m *GRPCVU) Teardown(_ *Generator) error {
+	return m.closeStream()
+}
+
+// Call makes a single gRPC call, or a single request and response on the open stream, with a deadline of Config.CallTimeout.
+func (m *GRPCVU) Call(l *Generator) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.CallTimeout)
+	defer cancel()
+	l.ResponsesChan <- m.call(ctx)
+}
+
+// CallContext is Call cancelled with ctx, nothing is sent if ctx is done because the generator records the timeout.
+func (m *GRPCVU) CallContext(ctx context.Context, l *Generator) {
+	res := m.call(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	l.ResponsesChan <- res
+}
+
+func (m *GRPCVU) call(ctx context.Context) *Response {
+	startedAt := time.Now()
+	var res *Response
+	if m.bidi() {
+		res = m.streamCall(ctx)
+	} else {
+		data, err := m.client.invoke(ctx)
+		res = m.client.response(data, err)
+	}
+	res.StartedAt = &startedAt
+	res.SetTrace(TraceFromContext(ctx))
+	return res
+}
+
+// streamCall sends the next request on the stream and receives a response, the stream is reopened on the next call if it fails
+func (m *GRPCVU) streamCall(ctx context.Context) *Response {
+	if m.stream == nil {
+		if err := m.openStream(); err != nil {
+			return m.client.response(nil, err)
+		}
+	}
+	// the stream lives as long as the VU, so it's cancelled when ctx of a single message is done
+	stop := context.AfterFunc(ctx, m.streamCancel)
+	defer stop()
+	req := m.client.requests[m.sent%len(m.client.requests)]
+	m.sent++
+	if err := m.stream.SendMsg(req); err != nil {
+		// the real status is returned by RecvMsg
+		out := dynamicpb.NewMessage(m.client.method.Output())
+		err = m.stream.RecvMsg(out)
+		_ = m.closeStream()
+		return m.streamErrResponse(err, stop)
+	}
+	out := dynamicpb.NewMessage(m.client.method.Output())
+	if err := m.stream.RecvMsg(out); err != nil {
+		_ = m.closeStream()
+		return m.streamErrResponse(err, stop)
+	}
+	return m.client.response(marshalGRPCMessage(out), nil)
+}
+
+func (m *GRPCVU) streamErrResponse(err error, stop func() bool) *Response {
+	res := m.client.response(nil, err)
+	// cancelled by ctx
+	if !stop() {
+		res.Failed = false
+		res.Timeout = true
+		res.StatusCode = codes.DeadlineExceeded.String()
+	}
+	return res
+}
+
+// Close closes all the pooled connections.
+func (m *GRPCVU) Close() error {
+	return m.client.pool.Close()
+}
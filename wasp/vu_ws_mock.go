@@ -59,15 +59,39 @@ func (m *WSMockVU) Setup(l *Generator) error {
 // Teardown gracefully closes the WebSocket connection for the VirtualUser.
 // It should be called when the user simulation is complete to release resources.
 func (m *WSMockVU) Teardown(_ *Generator) error {
+	if m.conn == nil {
+		return nil
+	}
 	return m.conn.Close(websocket.StatusInternalError, "")
 }
 
 // Call reads a WebSocket message from the connection and sends the response with a timestamp to the generator's ResponsesChan.
 // It is used by a virtual user to handle incoming WebSocket data during execution.
 func (m *WSMockVU) Call(l *Generator) {
+	m.CallContext(context.Background(), l)
+}
+
+// CallContext reads a WebSocket message, the read is cancelled when ctx is done and nothing is sent to the generator.
+// The connection is closed on cancellation, so it's dialed again on the next call.
+func (m *WSMockVU) CallContext(ctx context.Context, l *Generator) {
 	startedAt := time.Now()
+	if m.conn == nil {
+		var err error
+		m.conn, _, err = websocket.Dial(ctx, m.cfg.TargetURl, &websocket.DialOptions{})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			l.ResponsesChan <- &Response{StartedAt: &startedAt, Failed: true, Error: err.Error()}
+			return
+		}
+	}
 	v := map[string]string{}
-	err := wsjson.Read(context.Background(), m.conn, &v)
+	err := wsjson.Read(ctx, m.conn, &v)
+	if ctx.Err() != nil {
+		m.conn = nil
+		return
+	}
 	if err != nil {
 		l.Log.Error().Err(err).Msg("failed read ws msg from vu")
 	}
@@ -42,10 +42,16 @@ var (
 	ErrNoGun                  = errors.New("rps load scheduleSegments selected but gun implementation is nil")
 	ErrNoVU                   = errors.New("vu load scheduleSegments selected but vu implementation is nil")
 	ErrInvalidLabels          = errors.New("invalid Loki labels, labels should be [a-z][A-Z][0-9] and _")
+	ErrPoissonSegmentVU       = errors.New("poisson schedule segments can only be used with wasp.RPS load type")
+	ErrCoordinatedOmissionVU  = errors.New("coordinated omission correction can only be used with wasp.RPS load type")
+	ErrInvalidScheduleSteps   = errors.New("schedule steps must be > 0")
+	ErrInvalidSchedulePeriod  = errors.New("schedule period must be > 0")
+	ErrScheduleTooShort       = errors.New("schedule duration must be at least one step long")
 )
 
 // Gun is basic interface for some synthetic load test implementation
 // Call performs one request according to some RPS schedule
+// Implement ContextGun as well to get the calls cancelled on timeout and on Stop
 type Gun interface {
 	Call(l *Generator) *Response
 }
@@ -54,6 +60,7 @@ type Gun interface {
 // you should use it if:
 // - your protocol is stateful, ex.: ws, grpc
 // - you'd like to have some VirtualUser modelling, perform sequential requests
+// Implement ContextVirtualUser as well to get the calls cancelled on timeout and on Stop
 type VirtualUser interface {
 	Call(l *Generator)
 	Clone(l *Generator) VirtualUser
@@ -96,6 +103,13 @@ type Response struct {
 	Group      string        `json:"group"`
 	Data       interface{}   `json:"data,omitempty"`
 	Error      string        `json:"error,omitempty"`
+	// IntendedStartedAt is the time the call was scheduled at by the RPS schedule, only set for Gun calls
+	IntendedStartedAt *time.Time `json:"intended_started_at,omitempty"`
+	// ServiceDuration is the time the call took without queueing delay, only set when CorrectCoordinatedOmission is on
+	ServiceDuration time.Duration `json:"service_duration,omitempty"`
+	// TraceID and SpanID link the call to the traces of the system under test, only set with Config.Tracing
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
 }
 
 type ScheduleType string
@@ -108,8 +122,11 @@ const (
 type SegmentType string
 
 const (
-	SegmentType_Plain SegmentType = "plain"
-	SegmentType_Steps SegmentType = "steps"
+	SegmentType_Plain   SegmentType = "plain"
+	SegmentType_Steps   SegmentType = "steps"
+	SegmentType_Ramp    SegmentType = "ramp"
+	SegmentType_Sine    SegmentType = "sine"
+	SegmentType_Poisson SegmentType = "poisson"
 )
 
 // Segment load test schedule segment
@@ -158,6 +175,17 @@ type Config struct {
 	Logger                zerolog.Logger    `json:"-"`
 	SharedData            interface{}       `json:"-"`
 	SamplerConfig         *SamplerConfig    `json:"-"`
+	Sinks                 []ResultsSink     `json:"-"`
+	// CorrectCoordinatedOmission reports Gun call latency from the intended start time instead of the actual one,
+	// so queueing delay caused by the saturated system under test is not hidden
+	CorrectCoordinatedOmission bool `json:"correct_coordinated_omission"`
+	// AbortConditions are checked against live Stats, the generator is stopped when any of them is breached
+	AbortConditions []*AbortCondition `json:"abort_conditions,omitempty"`
+	// CapacitySearch replaces the Schedule with a search for the highest rate that meets the SLO, see CapacitySearchConfig
+	CapacitySearch *CapacitySearchConfig `json:"capacity_search,omitempty"`
+	// Tracing gives every call a W3C trace context, guns and VUs can propagate it with TraceFromContext,
+	// trace IDs are recorded on responses and can be exported as client spans with OTLPSink
+	Tracing bool `json:"tracing"`
 	// calculated fields
 	duration time.Duration
 	// only available in cluster mode
@@ -189,7 +217,14 @@ func (lgc *Config) Validate() error {
 	if lgc.Gun == nil && lgc.VU == nil {
 		return ErrNoImpl
 	}
-	if lgc.Schedule == nil {
+	if lgc.CapacitySearch != nil {
+		if len(lgc.Schedule) > 0 {
+			return ErrCapacitySearchSchedule
+		}
+		if err := lgc.CapacitySearch.Validate(); err != nil {
+			return err
+		}
+	} else if len(lgc.Schedule) == 0 {
 		return ErrNoSchedule
 	}
 	if lgc.LoadType != RPS && lgc.LoadType != VU {
@@ -201,6 +236,21 @@ func (lgc *Config) Validate() error {
 	if lgc.LoadType == VU && lgc.VU == nil {
 		return ErrNoVU
 	}
+	if lgc.LoadType == VU && lgc.CorrectCoordinatedOmission {
+		return ErrCoordinatedOmissionVU
+	}
+	if lgc.LoadType == VU {
+		for _, s := range lgc.Schedule {
+			if s != nil && s.Type == SegmentType_Poisson {
+				return ErrPoissonSegmentVU
+			}
+		}
+	}
+	for _, c := range lgc.AbortConditions {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
 	if lgc.RateLimitUnitDuration == 0 {
 		lgc.RateLimitUnitDuration = DefaultRateLimitUnitDuration
 	}
@@ -223,7 +273,18 @@ type Stats struct {
 	Success         atomic.Int64 `json:"success"`
 	Failed          atomic.Int64 `json:"failed"`
 	CallTimeout     atomic.Int64 `json:"callTimeout"`
+	// ArrivalsSkipped counts scheduled RPS arrivals that were not sent because the generator couldn't keep up with the schedule
+	ArrivalsSkipped atomic.Int64 `json:"arrivals_skipped"`
 	Duration        int64        `json:"load_duration"`
+	// Latencies keeps latencies of all calls, including the ones skipped by the Sampler.
+	// With CorrectCoordinatedOmission it also has a sample of every skipped arrival, so its count is Calls() + ArrivalsSkipped
+	Latencies *LatencyHistogram `json:"-"`
+}
+
+// Calls returns the amount of finished calls, including failed, timed out and successful ones skipped by the Sampler.
+// Unlike the count of Latencies, it never includes arrivals skipped with CorrectCoordinatedOmission.
+func (s *Stats) Calls() int64 {
+	return s.Success.Load() + s.Failed.Load() + s.SamplesSkipped.Load()
 }
 
 // ResponseData includes any request/response data that a gun might store
@@ -253,9 +314,15 @@ type Generator struct {
 	dataWaitGroup      *sync.WaitGroup
 	ResponsesCtx       context.Context
 	responsesCancel    context.CancelFunc
+	deadline           *time.Timer
+	deadlineAt         time.Time
+	controlChan        chan *scheduleCommand
+	scheduleDone       chan struct{}
+	callsCtx           context.Context
+	callsCancel        context.CancelFunc
 	dataCtx            context.Context
 	dataCancel         context.CancelFunc
-	gun                Gun
+	gun                ContextGun
 	vu                 VirtualUser
 	vus                []VirtualUser
 	ResponsesChan      chan *Response
@@ -266,6 +333,11 @@ type Generator struct {
 	stats              *Stats
 	loki               *LokiClient
 	lokiResponsesChan  chan *Response
+	sinkResponsesChan  chan *Response
+	abortConditions    []*AbortCondition
+	abortErr           atomic.Pointer[AbortError]
+	onAbort            func(err *AbortError)
+	capacityResult     atomic.Pointer[CapacityResult]
 }
 
 // NewGenerator initializes a Generator with the provided configuration.
@@ -304,7 +376,9 @@ func NewGenerator(cfg *Config) (*Generator, error) {
 	}
 	cfg.nodeID = os.Getenv("WASP_NODE_ID")
 	// context for all requests/responses and vus
-	responsesCtx, responsesCancel := context.WithTimeout(context.Background(), cfg.duration)
+	responsesCtx, responsesCancel := context.WithCancel(context.Background())
+	// context for in-flight Gun calls, it's only cancelled on Stop or abort so the calls in-flight at the end of the schedule can finish
+	callsCtx, callsCancel := context.WithCancel(context.Background())
 	// context for all the collected data
 	dataCtx, dataCancel := context.WithCancel(context.Background())
 	rch := make(chan *Response)
@@ -316,9 +390,13 @@ func NewGenerator(cfg *Config) (*Generator, error) {
 		dataWaitGroup:      &sync.WaitGroup{},
 		ResponsesCtx:       responsesCtx,
 		responsesCancel:    responsesCancel,
+		controlChan:        make(chan *scheduleCommand),
+		scheduleDone:       make(chan struct{}),
+		callsCtx:           callsCtx,
+		callsCancel:        callsCancel,
 		dataCtx:            dataCtx,
 		dataCancel:         dataCancel,
-		gun:                cfg.Gun,
+		gun:                ContextGunAdapter(cfg.Gun),
 		vu:                 cfg.VU,
 		rpsLoopOnce:        &sync.Once{},
 		Responses:          NewResponses(rch),
@@ -335,9 +413,11 @@ func NewGenerator(cfg *Config) (*Generator, error) {
 		},
 		errsMu:            &sync.Mutex{},
 		errs:              NewSliceBuffer[string](cfg.CallResultBufLen),
-		stats:             &Stats{},
+		stats:             &Stats{Latencies: NewLatencyHistogram()},
 		Log:               l,
 		lokiResponsesChan: make(chan *Response, 50000),
+		sinkResponsesChan: make(chan *Response, 50000),
+		abortConditions:   append([]*AbortCondition{}, cfg.AbortConditions...),
 	}
 	var err error
 	if cfg.LokiConfig != nil {
@@ -346,6 +426,9 @@ func NewGenerator(cfg *Config) (*Generator, error) {
 			return nil, err
 		}
 	}
+	if err := g.registerSinks(); err != nil {
+		return nil, err
+	}
 	return g, nil
 }
 
@@ -419,6 +502,10 @@ func (g *Generator) runTeardownWithTimeout(vu VirtualUser) bool {
 
 // runVU starts and manages the execution cycle for a VirtualUser. It handles setup, executes user calls with timeout control, processes responses, and ensures proper teardown. Use it to simulate and manage individual virtual user behavior within the Generator.
 func (g *Generator) runVU(vu VirtualUser) {
+	if cvu, ok := vu.(ContextVirtualUser); ok {
+		g.runContextVU(cvu)
+		return
+	}
 	g.ResponsesWaitGroup.Add(1)
 	go func() {
 		defer g.ResponsesWaitGroup.Done()
@@ -431,7 +518,8 @@ func (g *Generator) runVU(vu VirtualUser) {
 			}
 			startedAt := time.Now()
 			ctx, cancel := context.WithTimeout(context.Background(), g.Cfg.CallTimeout)
-			vuChan := make(chan struct{})
+			// buffered, so the call goroutine can exit after the loop has stopped waiting for it
+			vuChan := make(chan struct{}, 1)
 			go func() {
 				vu.Call(g)
 				select {
@@ -476,26 +564,39 @@ func (g *Generator) processSegment() bool {
 	g.currentSegmentMu.Unlock()
 	g.stats.CurrentSegment.Add(1)
 	g.currentSegment.StartTime = time.Now()
+	g.applyLoad(g.currentSegment.From, g.currentSegment.Type)
+	return false
+}
+
+// applyLoad sets a new rate limiter for RPS load or spawns and stops virtual users for VU load
+func (g *Generator) applyLoad(from int64, segmentType SegmentType) {
 	switch g.Cfg.LoadType {
 	case RPS:
-		newRateLimit := ratelimit.New(int(g.currentSegment.From), ratelimit.Per(g.Cfg.RateLimitUnitDuration), ratelimit.WithoutSlack)
+		var newRateLimit ratelimit.Limiter
+		if segmentType == SegmentType_Poisson {
+			newRateLimit = newPoissonLimiter(from, g.Cfg.RateLimitUnitDuration)
+		} else if g.Cfg.CorrectCoordinatedOmission {
+			newRateLimit = newUniformLimiter(from, g.Cfg.RateLimitUnitDuration)
+		} else {
+			newRateLimit = ratelimit.New(int(from), ratelimit.Per(g.Cfg.RateLimitUnitDuration), ratelimit.WithoutSlack)
+		}
 		g.rl.Store(&newRateLimit)
-		g.stats.CurrentRPS.Store(g.currentSegment.From)
+		g.stats.CurrentRPS.Store(from)
 		// start Gun loop once, in next segments we control it using g.rl ratelimiter
 		g.rpsLoopOnce.Do(func() {
 			g.runGunLoop()
 		})
 	case VU:
 		oldVUs := g.stats.CurrentVUs.Load()
-		newVUs := g.currentSegment.From
+		newVUs := from
 		g.stats.CurrentVUs.Store(newVUs)
 
-		vusToSpawn := int(math.Abs(float64(max(oldVUs, g.currentSegment.From) - min(oldVUs, g.currentSegment.From))))
+		vusToSpawn := int(math.Abs(float64(max(oldVUs, from) - min(oldVUs, from))))
 		log.Debug().Int64("OldVUs", oldVUs).Int64("NewVUs", newVUs).Int("VUsDelta", vusToSpawn).Msg("Changing VUs")
 		if oldVUs == newVUs {
-			return false
+			return
 		}
-		if oldVUs > g.currentSegment.From {
+		if oldVUs > from {
 			for i := 0; i < vusToSpawn; i++ {
 				g.vus[i].Stop(g)
 			}
@@ -508,7 +609,6 @@ func (g *Generator) processSegment() bool {
 			}
 		}
 	}
-	return false
 }
 
 // runScheduleLoop initiates an asynchronous loop that processes scheduling segments and monitors for completion signals.
@@ -517,6 +617,7 @@ func (g *Generator) runScheduleLoop() {
 	g.currentSegment = g.scheduleSegments[0]
 	g.stats.LastSegment.Store(int64(len(g.scheduleSegments)))
 	go func() {
+		defer close(g.scheduleDone)
 		for {
 			select {
 			case <-g.ResponsesCtx.Done():
@@ -531,22 +632,52 @@ func (g *Generator) runScheduleLoop() {
 				if g.processSegment() {
 					return
 				}
-				time.Sleep(g.currentSegment.Duration)
+				g.waitSegment()
 				g.currentSegment.EndTime = time.Now()
 			}
 		}
 	}()
 }
 
+// waitSegment waits until the current segment ends or the run is finished, control commands are applied meanwhile, see SetRate and InjectSegments
+func (g *Generator) waitSegment() {
+	timer := time.NewTimer(g.currentSegment.Duration)
+	defer timer.Stop()
+	for {
+		select {
+		case <-g.ResponsesCtx.Done():
+			return
+		case <-timer.C:
+			return
+		case cmd := <-g.controlChan:
+			next, err := cmd.apply()
+			cmd.done <- err
+			if next {
+				return
+			}
+		}
+	}
+}
+
 // storeResponses processes a Response, updating metrics and recording success or failure.
 // It is used to handle generator call results for monitoring and error tracking.
 func (g *Generator) storeResponses(res *Response) {
-	if g.Cfg.CallTimeout > 0 && res.Duration > g.Cfg.CallTimeout && !res.Timeout {
+	serviceDuration := res.Duration
+	if res.ServiceDuration > 0 {
+		serviceDuration = res.ServiceDuration
+	}
+	if g.Cfg.CallTimeout > 0 && serviceDuration > g.Cfg.CallTimeout && !res.Timeout {
 		return
 	}
+	g.stats.Latencies.Record(res.Group, res.Duration)
 	if !g.sampler.ShouldRecord(res, g.stats) {
 		return
 	}
+	if len(g.Cfg.Sinks) > 0 {
+		// Loki handler modifies the response, so sinks get their own copy
+		sinkRes := *res
+		g.sinkResponsesChan <- &sinkRes
+	}
 	if g.Cfg.LokiConfig != nil {
 		g.lokiResponsesChan <- res
 	}
@@ -610,38 +741,80 @@ func (g *Generator) collectVUResults() {
 // handling timeouts and storing the response.
 // It ensures requests adhere to the generator's configuration and execution state.
 func (g *Generator) pacedCall() {
-	(*g.rl.Load()).Take()
+	var intendedStartTS time.Time
+	var skipped []time.Time
+	if sl, ok := (*g.rl.Load()).(*scheduledLimiter); ok {
+		intendedStartTS, skipped = sl.take()
+	} else {
+		intendedStartTS = (*g.rl.Load()).Take()
+	}
+	g.stats.ArrivalsSkipped.Add(int64(len(skipped)))
 	if g.stats.RunPaused.Load() {
 		return
 	}
 	if g.stats.RunStopped.Load() {
 		return
 	}
-	result := make(chan *Response)
-	requestCtx, cancel := context.WithTimeout(context.Background(), g.Cfg.CallTimeout)
+	callsCtx := g.callsCtx
+	if _, ok := g.gun.(*legacyGun); ok {
+		// calls of a Gun without context support can't be cancelled, so they are waited for and recorded on Stop
+		callsCtx = context.Background()
+	}
+	requestCtx, cancel := context.WithTimeout(callsCtx, g.Cfg.CallTimeout)
+	var tc *TraceContext
+	if g.Cfg.Tracing {
+		tc = NewTraceContext()
+		requestCtx = ContextWithTrace(requestCtx, tc)
+	}
 	callStartTS := time.Now()
-	go func() {
-		result <- g.gun.Call(g)
-	}()
 	g.ResponsesWaitGroup.Add(1)
 	go func() {
 		defer g.ResponsesWaitGroup.Done()
-		select {
-		case <-requestCtx.Done():
-			ts := time.Now()
-			cr := &Response{Duration: time.Since(callStartTS), FinishedAt: &ts, Timeout: true, Error: ErrCallTimeout.Error()}
-			g.storeResponses(cr)
-		case res := <-result:
-			defer close(result)
-			res.Duration = time.Since(callStartTS)
-			ts := time.Now()
-			res.FinishedAt = &ts
-			g.storeResponses(res)
+		defer cancel()
+		res := g.gun.CallContext(requestCtx, g)
+		switch {
+		case errors.Is(requestCtx.Err(), context.Canceled):
+			g.Log.Debug().Msg("Call was cancelled by generator stop")
+			return
+		case errors.Is(requestCtx.Err(), context.DeadlineExceeded):
+			cr := &Response{Timeout: true, Error: ErrCallTimeout.Error()}
+			if res != nil {
+				cr.StatusCode, cr.Path, cr.Group = res.StatusCode, res.Path, res.Group
+			}
+			res = cr
 		}
-		cancel()
+		res.SetTrace(tc)
+		g.setCallDurations(res, intendedStartTS, callStartTS)
+		ts := time.Now()
+		res.FinishedAt = &ts
+		g.storeResponses(res)
+		g.recordSkippedArrivals(res, skipped)
 	}()
 }
 
+// recordSkippedArrivals charges arrivals skipped by the rate limiter with the latency they would have had,
+// as if they were queued behind the late call, from their intended start time until the call finished.
+// It's only done with CorrectCoordinatedOmission, otherwise latencies are measured from the actual start time.
+func (g *Generator) recordSkippedArrivals(res *Response, skipped []time.Time) {
+	if !g.Cfg.CorrectCoordinatedOmission {
+		return
+	}
+	for _, intended := range skipped {
+		g.stats.Latencies.Record(res.Group, res.FinishedAt.Sub(intended))
+	}
+}
+
+// setCallDurations sets the intended start time and call durations on a Gun response.
+// With CorrectCoordinatedOmission the duration is measured from the intended start time and the service time is kept separately.
+func (g *Generator) setCallDurations(res *Response, intendedStartTS, callStartTS time.Time) {
+	res.IntendedStartedAt = &intendedStartTS
+	res.Duration = time.Since(callStartTS)
+	if g.Cfg.CorrectCoordinatedOmission {
+		res.ServiceDuration = res.Duration
+		res.Duration = time.Since(intendedStartTS)
+	}
+}
+
 // Run starts the Generator’s scheduling and execution workflows, managing logging and metrics.
 // If wait is true, it waits for all processes to complete and returns the results.
 // Use Run to execute generator tasks either synchronously or asynchronously.
@@ -652,8 +825,22 @@ func (g *Generator) Run(wait bool) (interface{}, bool) {
 		g.sendResponsesToLoki()
 		g.sendStatsToLoki()
 	}
-	g.runScheduleLoop()
+	if len(g.Cfg.Sinks) > 0 {
+		g.sendResponsesToSinks()
+		g.sendStatsToSinks()
+	}
+	if g.Cfg.CapacitySearch != nil {
+		// capacity search duration is not known in advance, it cancels the context when it's finished
+		g.runCapacitySearch()
+	} else {
+		// the deadline starts with the schedule, not in NewGenerator, so generators created before a delayed start keep their full duration,
+		// a timer instead of a context deadline, so the run can be extended with InjectSegments
+		g.deadlineAt = time.Now().Add(g.Cfg.duration)
+		g.deadline = time.AfterFunc(g.Cfg.duration, g.responsesCancel)
+		g.runScheduleLoop()
+	}
 	g.collectVUResults()
+	g.checkAbortConditions()
 	if wait {
 		return g.Wait()
 	}
@@ -684,6 +871,7 @@ func (g *Generator) Stop() (interface{}, bool) {
 	g.stats.RunFailed.Store(true)
 	g.Log.Warn().Msg("Graceful stop")
 	g.responsesCancel()
+	g.callsCancel()
 	return g.Wait()
 }
 
@@ -691,13 +879,22 @@ func (g *Generator) Stop() (interface{}, bool) {
 func (g *Generator) Wait() (interface{}, bool) {
 	g.Log.Info().Msg("Waiting for all responses to finish")
 	g.ResponsesWaitGroup.Wait()
+	g.callsCancel()
+	if g.deadline != nil {
+		g.deadline.Stop()
+	}
+	g.currentSegmentMu.Lock()
 	g.stats.Duration = g.Cfg.duration.Nanoseconds()
 	g.stats.CurrentTimeUnit = g.Cfg.RateLimitUnitDuration.Nanoseconds()
+	g.currentSegmentMu.Unlock()
 	g.dataCancel()
 	g.dataWaitGroup.Wait()
 	if g.Cfg.LokiConfig != nil {
 		g.stopLokiStream()
 	}
+	if len(g.Cfg.Sinks) > 0 {
+		g.stopSinks()
+	}
 	return g.GetData(), g.stats.RunFailed.Load()
 }
 
@@ -749,6 +946,7 @@ func (g *Generator) handleLokiResponsePayload(r *Response) {
 	ts := r.FinishedAt
 	r.StartedAt = nil
 	r.FinishedAt = nil
+	r.IntendedStartedAt = nil
 	err := g.loki.HandleStruct(labels, *ts, r)
 	if err != nil {
 		g.Log.Err(err).Send()
@@ -814,6 +1012,7 @@ func (g *Generator) sendStatsToLoki() {
 // StatsJSON returns the generator's current statistics as a JSON-compatible map.
 // It is used to capture and transmit real-time metrics for monitoring and analysis.
 func (g *Generator) StatsJSON() map[string]interface{} {
+	latency := g.stats.Latencies.Percentiles()
 	return map[string]interface{}{
 		"node_id":           g.Cfg.nodeID,
 		"current_rps":       g.stats.CurrentRPS.Load(),
@@ -825,8 +1024,16 @@ func (g *Generator) StatsJSON() map[string]interface{} {
 		"failed":            g.stats.Failed.Load(),
 		"success":           g.stats.Success.Load(),
 		"callTimeout":       g.stats.CallTimeout.Load(),
+		"arrivals_skipped":  g.stats.ArrivalsSkipped.Load(),
+		"calls":             g.stats.Calls(),
 		"load_duration":     g.stats.Duration,
 		"current_time_unit": g.stats.CurrentTimeUnit,
+		"latency_p50":       latency.P50.Nanoseconds(),
+		"latency_p90":       latency.P90.Nanoseconds(),
+		"latency_p99":       latency.P99.Nanoseconds(),
+		"latency_p999":      latency.P999.Nanoseconds(),
+		"latency_max":       latency.Max.Nanoseconds(),
+		"latency_by_group":  g.stats.Latencies.GroupPercentiles(),
 	}
 }
 
@@ -119,6 +119,97 @@ func TestSmokePositiveCustomRateLimitUnit(t *testing.T) {
 	require.Empty(t, gen.Errors())
 }
 
+func TestSmokePoissonSchedule(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:                 t,
+		LoadType:          RPS,
+		StatsPollInterval: 1 * time.Second,
+		Schedule: Combine(
+			Ramp(1, 10, 2, 1*time.Second),
+			Poisson(20, 2*time.Second),
+		),
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.Equal(t, false, failed)
+	stats := gen.Stats()
+	require.Equal(t, int64(20), stats.CurrentRPS.Load())
+	require.Greater(t, stats.Success.Load(), int64(20))
+	require.Empty(t, gen.Errors())
+}
+
+func TestSmokePoissonScheduleIsRPSOnly(t *testing.T) {
+	t.Parallel()
+	_, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: VU,
+		Schedule: Poisson(1, 1*time.Second),
+		VU:       NewMockVU(&MockVirtualUserConfig{}),
+	})
+	require.Equal(t, ErrPoissonSegmentVU, err)
+}
+
+func TestSmokeCoordinatedOmissionCorrection(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:                          t,
+		LoadType:                   RPS,
+		StatsPollInterval:          1 * time.Second,
+		Schedule:                   Plain(5, 1*time.Second),
+		CorrectCoordinatedOmission: true,
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 50 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	_, failed := gen.Run(true)
+	require.Equal(t, false, failed)
+
+	_, okResponses, _ := convertResponsesData(gen)
+	require.GreaterOrEqual(t, len(okResponses), 5)
+	for _, r := range okResponses {
+		require.NotNil(t, r.IntendedStartedAt)
+		require.GreaterOrEqual(t, r.ServiceDuration, 50*time.Millisecond)
+		require.GreaterOrEqual(t, r.Duration, r.ServiceDuration)
+	}
+}
+
+func TestSmokeCoordinatedOmissionSkippedArrivals(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:                          t,
+		LoadType:                   RPS,
+		Schedule:                   Plain(10, 1*time.Second),
+		CorrectCoordinatedOmission: true,
+		Gun:                        NewMockGun(&MockGunConfig{}),
+	})
+	require.NoError(t, err)
+	finished := time.Now()
+	res := &Response{Group: "a", FinishedAt: &finished}
+	gen.recordSkippedArrivals(res, []time.Time{finished.Add(-300 * time.Millisecond), finished.Add(-200 * time.Millisecond)})
+	latency := gen.Stats().Latencies.GroupPercentiles()["a"]
+	require.Equal(t, int64(2), latency.Count)
+	require.InDelta(t, 300*time.Millisecond, latency.Max, float64(time.Millisecond))
+	require.Equal(t, int64(2), gen.Stats().Latencies.Percentiles().Count)
+	require.Equal(t, int64(0), gen.Stats().Calls())
+}
+
+func TestSmokeCoordinatedOmissionCorrectionIsRPSOnly(t *testing.T) {
+	t.Parallel()
+	_, err := NewGenerator(&Config{
+		T:                          t,
+		LoadType:                   VU,
+		Schedule:                   Plain(1, 1*time.Second),
+		CorrectCoordinatedOmission: true,
+		VU:                         NewMockVU(&MockVirtualUserConfig{}),
+	})
+	require.Equal(t, ErrCoordinatedOmissionVU, err)
+}
+
 func TestSmokeGenCanBeStoppedMultipleTimes(t *testing.T) {
 	t.Parallel()
 	gen, err := NewGenerator(&Config{
@@ -437,6 +528,26 @@ func TestStopOnFirstFailure(t *testing.T) {
 	require.Equal(t, true, failed)
 }
 
+func TestSmokeDurationStartsWithRun(t *testing.T) {
+	t.Parallel()
+	gen, err := NewGenerator(&Config{
+		T:        t,
+		LoadType: RPS,
+		Schedule: Plain(10, 1*time.Second),
+		Gun: NewMockGun(&MockGunConfig{
+			CallSleep: 10 * time.Millisecond,
+		}),
+	})
+	require.NoError(t, err)
+	// a delayed start, e.g. an agent waiting for StartAt, must not shorten the schedule
+	time.Sleep(500 * time.Millisecond)
+	start := time.Now()
+	_, failed := gen.Run(true)
+	require.False(t, failed)
+	require.GreaterOrEqual(t, time.Since(start), 1*time.Second)
+	require.GreaterOrEqual(t, gen.Stats().Success.Load(), int64(9))
+}
+
 func TestSmokeStaticRPSSchedulePrecision(t *testing.T) {
 	gen, err := NewGenerator(&Config{
 		T:        t,
@@ -609,6 +720,18 @@ func TestSmokeValidation(t *testing.T) {
 		_, err := NewGenerator(nil)
 		require.Equal(t, ErrNoCfg, err)
 	})
+	t.Run("can't start with an empty schedule", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewGenerator(&Config{
+			T:        t,
+			LoadType: RPS,
+			Schedule: []*Segment{},
+			Gun: NewMockGun(&MockGunConfig{
+				CallSleep: 10 * time.Millisecond,
+			}),
+		})
+		require.Equal(t, ErrNoSchedule, err)
+	})
 	t.Run("can't start without gun/vu implementation", func(t *testing.T) {
 		t.Parallel()
 		_, err := NewGenerator(&Config{